@@ -14,21 +14,32 @@ type GetUpdatesChanOpts struct {
 	ErrorHandler    func(error)
 	RetryDelay      time.Duration
 	ShutdownTimeout time.Duration
+	// PollHandler is called after every successful getUpdates request, even if no updates were received.
+	PollHandler func(updates []Update)
+}
+
+// DefaultGetUpdatesOpts returns options of long polling used by GetUpdatesChanWithContext if opts don't specify them.
+func DefaultGetUpdatesOpts() *GetUpdatesOpts {
+	return &GetUpdatesOpts{
+		Timeout: 600,
+		Offset:  0,
+		RequestOpts: &RequestOpts{
+			Timeout: 605 * time.Second,
+		},
+	}
+}
+
+// DefaultGetUpdatesErrorHandler logs errors of getUpdates requests,
+// GetUpdatesChanWithContext uses it if opts are nil.
+func DefaultGetUpdatesErrorHandler(err error) {
+	log.Println("GetUpdatesChanWithContext error:", err)
 }
 
 func (bot *Bot) GetUpdatesChanWithContext(ctx context.Context, opts *GetUpdatesChanOpts) <-chan Update {
 	cfg := GetUpdatesChanOpts{
-		Buffer: 100,
-		GetUpdatesOpts: &GetUpdatesOpts{
-			Timeout: 600,
-			Offset:  0,
-			RequestOpts: &RequestOpts{
-				Timeout: 605 * time.Second,
-			},
-		},
-		ErrorHandler: func(err error) {
-			log.Println("GetUpdatesChanWithContext error:", err)
-		},
+		Buffer:         100,
+		GetUpdatesOpts: DefaultGetUpdatesOpts(),
+		ErrorHandler:   DefaultGetUpdatesErrorHandler,
 	}
 
 	if opts != nil {
@@ -36,6 +47,7 @@ func (bot *Bot) GetUpdatesChanWithContext(ctx context.Context, opts *GetUpdatesC
 			cfg.Buffer = opts.Buffer
 		}
 		cfg.ErrorHandler = opts.ErrorHandler
+		cfg.PollHandler = opts.PollHandler
 		if opts.GetUpdatesOpts != nil {
 			cfg.GetUpdatesOpts.Timeout = opts.GetUpdatesOpts.Timeout
 			cfg.GetUpdatesOpts.Offset = opts.GetUpdatesOpts.Offset
@@ -75,6 +87,10 @@ func (bot *Bot) GetUpdatesChanWithContext(ctx context.Context, opts *GetUpdatesC
 				continue
 			}
 
+			if cfg.PollHandler != nil {
+				cfg.PollHandler(updates)
+			}
+
 			for _, update := range updates {
 				if update.UpdateId >= getUpdatesOpts.Offset {
 					getUpdatesOpts.Offset = update.UpdateId + 1
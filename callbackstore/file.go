@@ -0,0 +1,142 @@
+package callbackstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var _ Store = (*File)(nil)
+
+// File is a Store implementation which keeps every payload in a separate file.
+// The file modification time is the time of saving, so payloads survive restarts
+// and several processes may share the same directory.
+type File struct {
+	dir string
+	ttl time.Duration
+	now func() time.Time
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+// NewFile creates a file-backed store in dir which keeps payloads for ttl, creating the directory if needed.
+func NewFile(dir string, ttl time.Duration) (*File, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create callback store directory: %w", err)
+	}
+
+	return &File{
+		dir: dir,
+		ttl: ttl,
+		now: time.Now,
+	}, nil
+}
+
+func (s *File) Save(_ context.Context, payload string) (string, error) {
+	key, err := NewKey()
+	if err != nil {
+		return "", err
+	}
+
+	s.sweep()
+
+	// the payload is written to a temporary file first, so Load never reads a partially written payload
+	tmp, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create callback payload: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.WriteString(payload); err != nil {
+		_ = tmp.Close()
+
+		return "", fmt.Errorf("failed to write callback payload: %w", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed to write callback payload: %w", err)
+	}
+
+	now := s.now()
+	if err = os.Chtimes(tmp.Name(), now, now); err != nil {
+		return "", fmt.Errorf("failed to write callback payload: %w", err)
+	}
+
+	if err = os.Rename(tmp.Name(), s.path(key)); err != nil {
+		return "", fmt.Errorf("failed to save callback payload: %w", err)
+	}
+
+	return key, nil
+}
+
+func (s *File) Load(_ context.Context, key string) (string, error) {
+	// keys come from the client, so they are checked before they are used as file names
+	if !IsKey(key) {
+		return "", ErrNotFound
+	}
+
+	info, err := os.Stat(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to load callback payload: %w", err)
+	}
+
+	if s.expired(info) {
+		_ = os.Remove(s.path(key))
+
+		return "", ErrNotFound
+	}
+
+	payload, err := os.ReadFile(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to load callback payload: %w", err)
+	}
+
+	return string(payload), nil
+}
+
+func (s *File) path(key string) string {
+	return filepath.Join(s.dir, strings.TrimPrefix(key, KeyPrefix))
+}
+
+func (s *File) expired(info os.FileInfo) bool {
+	return s.now().Sub(info.ModTime()) > s.ttl
+}
+
+// sweep removes expired payloads at most once per ttl, so Save stays cheap.
+func (s *File) sweep() {
+	s.mu.Lock()
+	now := s.now()
+	if now.Sub(s.lastSweep) < s.ttl {
+		s.mu.Unlock()
+
+		return
+	}
+	s.lastSweep = now
+	s.mu.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		if !IsKey(KeyPrefix + entry.Name()) {
+			continue
+		}
+
+		if info, err := entry.Info(); err == nil && s.expired(info) {
+			_ = os.Remove(filepath.Join(s.dir, entry.Name()))
+		}
+	}
+}
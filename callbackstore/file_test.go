@@ -0,0 +1,64 @@
+package callbackstore
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFile(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s, err := NewFile(dir, time.Minute)
+	assert.NoError(t, err)
+
+	key, err := s.Save(ctx, "payload")
+	assert.NoError(t, err)
+	assert.True(t, IsKey(key))
+
+	t.Run("payload survives restart", func(t *testing.T) {
+		restarted, err := NewFile(dir, time.Minute)
+		assert.NoError(t, err)
+
+		got, err := restarted.Load(ctx, key)
+		assert.NoError(t, err)
+		assert.Equal(t, "payload", got)
+	})
+
+	t.Run("unknown and invalid keys", func(t *testing.T) {
+		for _, key := range []string{"~AAAAAAAAAAAAAAAA", "~../../etc/passwd", "payload"} {
+			_, err := s.Load(ctx, key)
+			assert.ErrorIs(t, err, ErrNotFound, "Load(%q)", key)
+		}
+	})
+
+	t.Run("expired payloads", func(t *testing.T) {
+		now := time.Now().Add(2 * time.Minute)
+		s.now = func() time.Time {
+			return now
+		}
+
+		_, err := s.Load(ctx, key)
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		expiredKey := key
+		key, err = s.Save(ctx, "fresh")
+		assert.NoError(t, err)
+
+		_, err = os.Stat(filepath.Join(dir, expiredKey[1:]))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+
+		entries, err := os.ReadDir(dir)
+		assert.NoError(t, err)
+		assert.Len(t, entries, 1, "temporary files are left")
+
+		got, err := s.Load(ctx, key)
+		assert.NoError(t, err)
+		assert.Equal(t, "fresh", got)
+	})
+}
@@ -0,0 +1,90 @@
+package callbackstore
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+var _ Store = (*Memory)(nil)
+
+type memoryItem struct {
+	payload   string
+	expiresAt time.Time
+}
+
+// Memory is an in-process Store implementation.
+// Payloads are lost when the process exits, so buttons sent before a restart expire.
+type Memory struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu        sync.Mutex
+	items     map[string]memoryItem
+	lastSweep time.Time
+}
+
+// NewMemory creates an in-memory store which keeps payloads for ttl.
+func NewMemory(ttl time.Duration) *Memory {
+	return &Memory{
+		ttl:   ttl,
+		now:   time.Now,
+		items: make(map[string]memoryItem),
+	}
+}
+
+func (s *Memory) Save(_ context.Context, payload string) (string, error) {
+	key, err := NewKey()
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+	s.items[key] = memoryItem{payload: payload, expiresAt: now.Add(s.ttl)}
+
+	return key, nil
+}
+
+func (s *Memory) Load(_ context.Context, key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.items[key]
+	if !ok {
+		return "", ErrNotFound
+	}
+
+	if s.now().After(item.expiresAt) {
+		delete(s.items, key)
+
+		return "", ErrNotFound
+	}
+
+	return item.payload, nil
+}
+
+// Len returns the number of stored payloads including expired ones which are not removed yet.
+func (s *Memory) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.items)
+}
+
+// sweep removes expired payloads at most once per ttl, so Save stays cheap.
+func (s *Memory) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < s.ttl {
+		return
+	}
+	s.lastSweep = now
+
+	for key, item := range s.items {
+		if now.After(item.expiresAt) {
+			delete(s.items, key)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package callbackstore
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKey(t *testing.T) {
+	key, err := NewKey()
+	assert.NoError(t, err)
+	assert.Len(t, key, 17)
+	assert.True(t, IsKey(key))
+
+	for _, data := range []string{"", "~", "product/1", key[1:], key + "a", "~../../etc/passwd", "~" + strings.Repeat(".", 16)} {
+		assert.False(t, IsKey(data), "IsKey(%q)", data)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemory(time.Minute)
+	now := time.Now()
+	s.now = func() time.Time {
+		return now
+	}
+
+	payload := strings.Repeat("search?color=red&size=42;", 10)
+	key, err := s.Save(ctx, payload)
+	assert.NoError(t, err)
+	assert.True(t, IsKey(key))
+
+	got, err := s.Load(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, payload, got)
+
+	_, err = s.Load(ctx, "~unknown")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	now = now.Add(2 * time.Minute)
+	_, err = s.Load(ctx, key)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Equal(t, 0, s.Len())
+
+	_, err = s.Save(ctx, "a")
+	assert.NoError(t, err)
+	now = now.Add(2 * time.Minute)
+	_, err = s.Save(ctx, "b")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, s.Len(), "expired payloads are not swept")
+}
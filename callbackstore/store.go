@@ -0,0 +1,66 @@
+package callbackstore
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// KeyPrefix marks callback data which is a key of a stored payload.
+	KeyPrefix = "~"
+
+	keyBytes = 12
+)
+
+var ErrNotFound = errors.New("callback payload not found or expired")
+
+// keyLength is the length of a key without KeyPrefix.
+var keyLength = base64.RawURLEncoding.EncodedLen(keyBytes)
+
+// Store
+//
+// keeps callback payloads which don't fit in 64 bytes of callback data.
+// Only a short random key is sent to Telegram, the payload is resolved by the key when the button is pressed.
+// Payloads are kept for a limited time, so old buttons expire.
+type Store interface {
+	// Save stores the payload and returns its key, see NewKey.
+	Save(ctx context.Context, payload string) (string, error)
+	// Load returns the payload by the key or ErrNotFound if it doesn't exist or expired.
+	Load(ctx context.Context, key string) (string, error)
+}
+
+// NewKey
+//
+// returns a new random key for custom Store implementations.
+// The key starts with KeyPrefix and is 17 bytes long.
+func NewKey() (string, error) {
+	b := make([]byte, keyBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate callback key: %w", err)
+	}
+
+	return KeyPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// IsKey
+//
+// reports whether the callback data is a key generated by NewKey.
+// Callback data comes from the client, so stores must check keys before using them in file names or queries.
+func IsKey(data string) bool {
+	key, ok := strings.CutPrefix(data, KeyPrefix)
+	if !ok || len(key) != keyLength {
+		return false
+	}
+
+	for _, c := range key {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,338 @@
+package conversation
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kbgod/lumex"
+	"github.com/kbgod/lumex/fsm"
+	"github.com/kbgod/lumex/router"
+)
+
+const (
+	DefaultBackCommand   = "back"
+	DefaultCancelCommand = "cancel"
+	DefaultCancelText    = "Cancelled"
+	DefaultTimeoutText   = "The conversation has expired, please start again"
+
+	statePrefix = "conversation:"
+)
+
+var ErrNoSession = errors.New("conversation requires fsm.Middleware")
+
+// SubmitFunc receives answers of all steps when the last step is answered.
+type SubmitFunc func(ctx *router.Context, answers Answers) error
+
+// progress is the persisted part of the conversation, it is kept in the fsm session between updates.
+type progress struct {
+	Answers   Answers   `json:"answers"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Conversation
+//
+// is a multi-step form on top of states: every step is a state "conversation:<name>:<step>",
+// relative to the state of the router it is registered on like patterns of nested state routers, and answers are kept in fsm.Session, so the conversation survives restarts when fsm uses durable storage.
+// Every update in the conversation is handled by it, except updates matched by routes registered before Register.
+type Conversation struct {
+	name    string
+	steps   []*Step
+	index   map[string]int
+	submit  SubmitFunc
+	timeout time.Duration
+
+	backCommand   string
+	cancelCommand string
+	// back and cancel match the back and cancel commands, they are built by Register.
+	back      router.RouteFilter
+	cancel    router.RouteFilter
+	onCancel  router.Handler
+	onTimeout router.Handler
+	// base is the state of the router the conversation is registered on with ":", states of steps start with it.
+	base string
+
+	now func() time.Time
+}
+
+type Option func(*Conversation)
+
+// WithTimeout cancels the conversation if the user doesn't answer for the duration, the timeout handler is called instead.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Conversation) {
+		c.timeout = timeout
+	}
+}
+
+// WithBackCommand sets the command which returns to the previous step, DefaultBackCommand by default.
+func WithBackCommand(command string) Option {
+	return func(c *Conversation) {
+		c.backCommand = command
+	}
+}
+
+// WithCancelCommand sets the command which cancels the conversation, DefaultCancelCommand by default.
+func WithCancelCommand(command string) Option {
+	return func(c *Conversation) {
+		c.cancelCommand = command
+	}
+}
+
+// OnCancel sets the handler called when the conversation is cancelled, it replies DefaultCancelText by default.
+func OnCancel(handler router.Handler) Option {
+	return func(c *Conversation) {
+		c.onCancel = handler
+	}
+}
+
+// OnTimeout sets the handler called when the user answers after the timeout, it replies DefaultTimeoutText by default.
+func OnTimeout(handler router.Handler) Option {
+	return func(c *Conversation) {
+		c.onTimeout = handler
+	}
+}
+
+// New creates a conversation, the name must be unique among conversations of the router.
+func New(name string, submit SubmitFunc, opts ...Option) *Conversation {
+	c := &Conversation{
+		name:          name,
+		index:         make(map[string]int),
+		submit:        submit,
+		backCommand:   DefaultBackCommand,
+		cancelCommand: DefaultCancelCommand,
+		onCancel: func(ctx *router.Context) error {
+			return ctx.ReplyVoid(DefaultCancelText)
+		},
+		onTimeout: func(ctx *router.Context) error {
+			return ctx.ReplyVoid(DefaultTimeoutText)
+		},
+		now: time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Text adds a step which expects a text message.
+func (c *Conversation) Text(name, prompt string, opts ...StepOption) *Conversation {
+	return c.addStep(&Step{name: name, prompt: prompt, kind: InputText}, opts)
+}
+
+// Contact adds a step which expects a contact, the prompt has a button to share the contact of the user.
+func (c *Conversation) Contact(name, prompt string, opts ...StepOption) *Conversation {
+	return c.addStep(&Step{name: name, prompt: prompt, kind: InputContact}, opts)
+}
+
+// Photo adds a step which expects a photo, the answer has the file id of the largest size and the caption.
+func (c *Conversation) Photo(name, prompt string, opts ...StepOption) *Conversation {
+	return c.addStep(&Step{name: name, prompt: prompt, kind: InputPhoto}, opts)
+}
+
+// Choice adds a step which expects a press of one of the inline buttons.
+// It panics if callback data of a choice is longer than router.MaxCallbackDataLength.
+func (c *Conversation) Choice(name, prompt string, choices []Choice, opts ...StepOption) *Conversation {
+	for _, choice := range choices {
+		if data := c.choicePrefix() + choice.Value; len(data) > router.MaxCallbackDataLength {
+			panic(fmt.Sprintf("conversation %q: choice data %q is longer than %d bytes", c.name, data, router.MaxCallbackDataLength))
+		}
+	}
+
+	return c.addStep(&Step{name: name, prompt: prompt, kind: InputChoice, choices: choices}, opts)
+}
+
+func (c *Conversation) addStep(step *Step, opts []StepOption) *Conversation {
+	if _, ok := c.index[step.name]; ok {
+		panic(fmt.Sprintf("conversation %q: duplicate step %q", c.name, step.name))
+	}
+
+	step.retry = defaultRetry[step.kind]
+	for _, opt := range opts {
+		opt(step)
+	}
+
+	c.index[step.name] = len(c.steps)
+	c.steps = append(c.steps, step)
+
+	return c
+}
+
+// Steps returns steps of the conversation in order.
+func (c *Conversation) Steps() []*Step {
+	return c.steps
+}
+
+// Register adds the route handling updates of the conversation, fsm.Middleware must be used by the router.
+// Routes registered before match updates in the conversation first, so register it before fallbacks.
+// Commands, except the back and cancel ones, are not taken as answers and are routed to other routes,
+// so are updates which can't answer the step: only messages and callback queries of choice steps reach it.
+// The router may be a state router of an exact state, states of steps are nested in it then,
+// it panics for patterns like "menu:*", because the conversation can't set such a state.
+func (c *Conversation) Register(r *router.Router, handlers ...router.Handler) *router.Route {
+	c.base = ""
+	if state := r.GetState(); state != nil {
+		if strings.ContainsAny(*state, "*|") {
+			panic(fmt.Sprintf("conversation %q: state %q of the router is not exact", c.name, *state))
+		}
+		c.base = *state + ":"
+	}
+
+	c.back = router.Command(c.backCommand)
+	c.cancel = router.Command(c.cancelCommand)
+	filter := router.And(c.answers, router.Or(c.back, c.cancel, router.Not(router.AnyCommand())))
+
+	return r.UseState(statePrefix+c.name+":*").
+		On(filter, slices.Concat(handlers, []router.Handler{c.handle})...).
+		UpdateTypes(lumex.UpdateTypeMessage, lumex.UpdateTypeCallbackQuery).
+		Name("conversation:" + c.name)
+}
+
+// answers reports whether the update can answer the current step: a message or a callback query of a choice step.
+// Steps which are not known anymore get any of them, so the conversation is cancelled.
+func (c *Conversation) answers(ctx *router.Context) bool {
+	switch {
+	case ctx.Update.Message != nil:
+		return true
+	case ctx.Update.CallbackQuery != nil:
+		i, ok := c.stepIndex(ctx)
+
+		return !ok || c.steps[i].kind == InputChoice
+	default:
+		return false
+	}
+}
+
+// stepIndex returns the index of the step the state of the context belongs to.
+func (c *Conversation) stepIndex(ctx *router.Context) (int, bool) {
+	state := ctx.GetState()
+	if state == nil {
+		return 0, false
+	}
+
+	i, ok := c.index[strings.TrimPrefix(*state, c.state(""))]
+
+	return i, ok
+}
+
+// Start is a handler which starts the conversation from the first step, dropping answers of the previous run.
+func (c *Conversation) Start(ctx *router.Context) error {
+	session := fsm.FromContext(ctx)
+	if session == nil {
+		return ErrNoSession
+	}
+
+	if len(c.steps) == 0 {
+		return c.submit(ctx, Answers{})
+	}
+
+	return c.enter(ctx, session, &progress{Answers: Answers{}}, 0)
+}
+
+func (c *Conversation) handle(ctx *router.Context) error {
+	session := fsm.FromContext(ctx)
+	if session == nil {
+		return ErrNoSession
+	}
+
+	var p progress
+	if _, err := session.Get(c.dataKey(), &p); err != nil {
+		return err
+	}
+	if p.Answers == nil {
+		p.Answers = Answers{}
+	}
+
+	i, ok := c.stepIndex(ctx)
+	if !ok {
+		// the step was removed from the conversation since the state was saved
+		c.finish(ctx, session)
+
+		return c.onCancel(ctx)
+	}
+
+	if c.timeout > 0 && c.now().Sub(p.UpdatedAt) > c.timeout {
+		c.finish(ctx, session)
+
+		return c.onTimeout(ctx)
+	}
+
+	if c.cancel(ctx) {
+		c.finish(ctx, session)
+
+		return c.onCancel(ctx)
+	}
+
+	if c.back(ctx) {
+		if i > 0 {
+			i--
+		}
+		delete(p.Answers, c.steps[i].name)
+
+		return c.enter(ctx, session, &p, i)
+	}
+
+	step := c.steps[i]
+
+	answer, ok := step.read(ctx, c.choicePrefix())
+	if ctx.Update.CallbackQuery != nil {
+		if err := ctx.AnswerVoid(""); err != nil {
+			return err
+		}
+	}
+	if !ok {
+		return ctx.ReplyVoid(step.retry)
+	}
+
+	for _, validate := range step.validators {
+		if err := validate(ctx, answer); err != nil {
+			if err = ctx.ReplyVoid(err.Error()); err != nil {
+				return err
+			}
+
+			return step.sendPrompt(ctx, c.choicePrefix())
+		}
+	}
+
+	p.Answers[step.name] = answer
+
+	if i == len(c.steps)-1 {
+		c.finish(ctx, session)
+
+		return c.submit(ctx, p.Answers)
+	}
+
+	return c.enter(ctx, session, &p, i+1)
+}
+
+// enter saves the progress, moves the conversation to the step and prompts it.
+func (c *Conversation) enter(ctx *router.Context, session *fsm.Session, p *progress, i int) error {
+	p.UpdatedAt = c.now()
+	if err := session.Set(c.dataKey(), p); err != nil {
+		return err
+	}
+
+	ctx.SetState(c.state(c.steps[i].name))
+
+	return c.steps[i].sendPrompt(ctx, c.choicePrefix())
+}
+
+func (c *Conversation) finish(ctx *router.Context, session *fsm.Session) {
+	session.Delete(c.dataKey())
+	ctx.ClearState()
+}
+
+func (c *Conversation) state(step string) string {
+	return c.base + statePrefix + c.name + ":" + step
+}
+
+func (c *Conversation) dataKey() string {
+	return statePrefix + c.name
+}
+
+func (c *Conversation) choicePrefix() string {
+	return c.name + ":"
+}
@@ -0,0 +1,266 @@
+package conversation
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kbgod/lumex"
+	"github.com/kbgod/lumex/fsm"
+	"github.com/kbgod/lumex/router"
+	"github.com/kbgod/lumex/routertest"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	user = routertest.User(2, "Alice")
+	chat = routertest.PrivateChat(user)
+)
+
+type testBot struct {
+	t       *testing.T
+	bot     *routertest.Bot
+	router  *router.Router
+	answers Answers
+}
+
+func newTestBot(t *testing.T, storage fsm.Storage, opts ...Option) (*testBot, *Conversation) {
+	tb := &testBot{t: t, bot: routertest.NewBot(t)}
+
+	signup := New("signup", func(ctx *router.Context, answers Answers) error {
+		tb.answers = answers
+
+		return ctx.ReplyVoid("Welcome, " + answers.Text("name"))
+	}, opts...).
+		Text("name", "What is your name?", WithValidator(func(ctx *router.Context, answer Answer) error {
+			if len(answer.Text) < 2 {
+				return errors.New("Name is too short")
+			}
+
+			return nil
+		})).
+		Contact("phone", "Share your phone").
+		Photo("avatar", "Send your photo").
+		Choice("confirm", "Confirm?", []Choice{{Text: "Yes", Value: "yes"}, {Text: "No", Value: "no"}})
+
+	tb.router = router.New(tb.bot.Bot)
+	tb.router.Use(fsm.Middleware(storage))
+	tb.router.OnCommand("signup", signup.Start)
+	signup.Register(tb.router)
+	tb.router.OnUpdate(func(ctx *router.Context) error {
+		return ctx.ReplyVoid("fallback")
+	})
+
+	return tb, signup
+}
+
+// send handles the update and returns texts of messages sent since the previous update.
+func (tb *testBot) send(update *lumex.Update) []string {
+	tb.t.Helper()
+
+	assert.NoError(tb.t, tb.router.HandleUpdate(context.Background(), update))
+
+	var messages []string
+	for _, call := range tb.bot.Calls() {
+		if call.Method == "sendMessage" {
+			messages = append(messages, call.Text)
+		}
+	}
+	tb.bot.Reset()
+
+	return messages
+}
+
+func (tb *testBot) text(text string) []string {
+	tb.t.Helper()
+
+	return tb.send(routertest.TextMessage(user, chat, text))
+}
+
+func (tb *testBot) message(m *lumex.Message) []string {
+	tb.t.Helper()
+
+	m.Chat, m.From = chat, user
+
+	return tb.send(&lumex.Update{Message: m})
+}
+
+func (tb *testBot) callback(data string) []string {
+	tb.t.Helper()
+
+	return tb.send(routertest.Callback(user, chat, data))
+}
+
+func TestConversation(t *testing.T) {
+	storage := fsm.NewMemory()
+	tb, _ := newTestBot(t, storage)
+
+	assert.Equal(t, []string{"fallback"}, tb.text("hello"))
+	assert.Equal(t, []string{"What is your name?"}, tb.text("/signup"))
+
+	// validator error re-prompts the step
+	assert.Equal(t, []string{"Name is too short", "What is your name?"}, tb.text("A"))
+	assert.Equal(t, []string{"Share your phone"}, tb.text("Alice"))
+
+	// input of another kind
+	assert.Equal(t, []string{defaultRetry[InputContact]}, tb.text("+380000000000"))
+	assert.Equal(t, []string{"Send your photo"}, tb.message(&lumex.Message{
+		Contact: &lumex.Contact{PhoneNumber: "+380000000000", FirstName: "Alice"},
+	}))
+
+	// back returns to the previous step
+	assert.Equal(t, []string{"Share your phone"}, tb.text("/back"))
+	assert.Equal(t, []string{"Send your photo"}, tb.message(&lumex.Message{
+		Contact: &lumex.Contact{PhoneNumber: "+381111111111", FirstName: "Alice"},
+	}))
+
+	assert.Equal(t, []string{"Confirm?"}, tb.message(&lumex.Message{
+		Caption: "me",
+		Photo:   []lumex.PhotoSize{{FileId: "small"}, {FileId: "large"}},
+	}))
+
+	assert.Equal(t, []string{defaultRetry[InputChoice]}, tb.text("yes"))
+	assert.Equal(t, []string{defaultRetry[InputChoice]}, tb.callback("signup:maybe"))
+	assert.Equal(t, []string{"Welcome, Alice"}, tb.callback("signup:yes"))
+
+	assert.Equal(t, Answers{
+		"name":    {Kind: InputText, Text: "Alice"},
+		"phone":   {Kind: InputContact, Text: "+381111111111", Contact: &lumex.Contact{PhoneNumber: "+381111111111", FirstName: "Alice"}},
+		"avatar":  {Kind: InputPhoto, Text: "me", FileID: "large"},
+		"confirm": {Kind: InputChoice, Text: "yes"},
+	}, tb.answers)
+
+	// the conversation is finished
+	assert.Equal(t, []string{"fallback"}, tb.text("hello"))
+	assert.Equal(t, 0, storage.Len())
+}
+
+func TestConversation_Cancel(t *testing.T) {
+	tb, _ := newTestBot(t, fsm.NewMemory())
+
+	tb.text("/signup")
+	assert.Equal(t, []string{DefaultCancelText}, tb.text("/cancel"))
+	assert.Equal(t, []string{"fallback"}, tb.text("Alice"))
+}
+
+func TestConversation_Commands(t *testing.T) {
+	tb, _ := newTestBot(t, fsm.NewMemory())
+
+	tb.text("/signup")
+	assert.Equal(t, []string{"fallback"}, tb.text("/help"), "command is taken as the answer")
+	assert.Equal(t, []string{"fallback"}, tb.message(&lumex.Message{
+		Caption:         "/help",
+		CaptionEntities: []lumex.MessageEntity{{Type: "bot_command", Length: 5}},
+		Photo:           []lumex.PhotoSize{{FileId: "photo"}},
+	}))
+	assert.Equal(t, []string{"Share your phone"}, tb.text("Alice"))
+	assert.Equal(t, []string{"What is your name?"}, tb.text("/back"))
+}
+
+func TestConversation_OtherUpdates(t *testing.T) {
+	tb, _ := newTestBot(t, fsm.NewMemory())
+
+	tb.text("/signup")
+	assert.Equal(t, []string{"fallback"}, tb.send(&lumex.Update{EditedMessage: &lumex.Message{Text: "Bob", Chat: chat, From: user}}))
+	assert.Equal(t, []string{"fallback"}, tb.callback("signup:yes"), "callback query answers only choice steps")
+	assert.Equal(t, []string{"Share your phone"}, tb.text("Alice"))
+}
+
+func TestConversation_StateRouter(t *testing.T) {
+	bot := routertest.NewBot(t)
+	var answers Answers
+	signup := New("signup", func(ctx *router.Context, a Answers) error {
+		answers = a
+
+		return ctx.ReplyVoid("Welcome, " + a.Text("name"))
+	}).Text("name", "What is your name?")
+
+	r := router.New(bot.Bot)
+	r.Use(fsm.Middleware(fsm.NewMemory()))
+	r.OnCommand("menu", func(ctx *router.Context) error {
+		ctx.SetState("menu")
+
+		return nil
+	})
+	menu := r.UseState("menu")
+	menu.OnCommand("signup", signup.Start)
+	signup.Register(menu)
+
+	c := bot.Conversation(r, user, chat)
+	c.Send("/menu")
+	c.Send("/signup").ExpectReply().TextEquals("What is your name?")
+	c.Send("Alice").ExpectReply().TextEquals("Welcome, Alice")
+	assert.Equal(t, "Alice", answers.Text("name"))
+
+	assert.Panics(t, func() {
+		signup.Register(r.UseState("menu:*"))
+	})
+}
+
+func TestConversation_Timeout(t *testing.T) {
+	tb, signup := newTestBot(t, fsm.NewMemory(), WithTimeout(time.Minute))
+
+	now := time.Now()
+	signup.now = func() time.Time {
+		return now
+	}
+
+	tb.text("/signup")
+	assert.Equal(t, []string{"Share your phone"}, tb.text("Alice"))
+
+	now = now.Add(2 * time.Minute)
+	assert.Equal(t, []string{DefaultTimeoutText}, tb.text("Bob"))
+	assert.Equal(t, []string{"fallback"}, tb.text("Bob"))
+}
+
+func TestConversation_SurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "states.json")
+
+	storage, err := fsm.NewFile(path)
+	assert.NoError(t, err)
+	tb, _ := newTestBot(t, storage)
+	tb.text("/signup")
+	tb.text("Alice")
+
+	storage, err = fsm.NewFile(path)
+	assert.NoError(t, err)
+	tb, _ = newTestBot(t, storage)
+	tb.message(&lumex.Message{Contact: &lumex.Contact{PhoneNumber: "+380000000000"}})
+	tb.message(&lumex.Message{Photo: []lumex.PhotoSize{{FileId: "photo"}}})
+
+	assert.Equal(t, []string{"Welcome, Alice"}, tb.callback("signup:no"))
+	assert.Equal(t, "no", tb.answers.Text("confirm"))
+}
+
+func TestConversation_Definition(t *testing.T) {
+	c := New("c", nil).Text("a", "A").Choice("b", "B", []Choice{{Text: "x", Value: "x"}})
+	assert.Len(t, c.Steps(), 2)
+	assert.Equal(t, "b", c.Steps()[1].Name())
+	assert.Equal(t, InputChoice, c.Steps()[1].Kind())
+	assert.Equal(t, "choice", InputChoice.String())
+
+	assert.Panics(t, func() {
+		c.Text("a", "duplicate")
+	})
+	assert.Panics(t, func() {
+		c.Choice("long", "Long", []Choice{{Text: "x", Value: strings.Repeat("x", 64)}})
+	})
+
+	r := router.New(nil)
+	c.Register(r)
+	err := r.HandleUpdate(context.Background(), &lumex.Update{Message: &lumex.Message{}})
+	assert.ErrorIs(t, err, router.ErrRouteNotFound)
+
+	r = router.New(nil)
+	r.OnUpdate(c.Start)
+	assert.ErrorIs(t, r.HandleUpdate(context.Background(), &lumex.Update{Message: &lumex.Message{}}), ErrNoSession)
+
+	// spare capacity of the caller's handlers is not written by Register
+	handlers := make([]router.Handler, 1, 2)
+	handlers[0] = func(ctx *router.Context) error { return ctx.Next() }
+	c.Register(router.New(nil), handlers...)
+	assert.Nil(t, handlers[:2][1])
+}
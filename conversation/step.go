@@ -0,0 +1,177 @@
+package conversation
+
+import (
+	"fmt"
+
+	"github.com/kbgod/lumex"
+	"github.com/kbgod/lumex/router"
+)
+
+// InputKind is the kind of input a step expects.
+type InputKind uint8
+
+const (
+	InputText InputKind = iota + 1
+	InputContact
+	InputPhoto
+	InputChoice
+)
+
+func (k InputKind) String() string {
+	switch k {
+	case InputText:
+		return "text"
+	case InputContact:
+		return "contact"
+	case InputPhoto:
+		return "photo"
+	case InputChoice:
+		return "choice"
+	default:
+		return fmt.Sprintf("InputKind(%d)", uint8(k))
+	}
+}
+
+// defaultRetry is the reply to input of another kind.
+var defaultRetry = map[InputKind]string{
+	InputText:    "Please send a text message",
+	InputContact: "Please share your contact using the button below",
+	InputPhoto:   "Please send a photo",
+	InputChoice:  "Please choose one of the options above",
+}
+
+// Choice is an option of a choice step, Value is sent as callback data, so it must be short.
+type Choice struct {
+	Text  string
+	Value string
+}
+
+// Answer is the input received on a step.
+type Answer struct {
+	Kind InputKind `json:"kind"`
+	// Text is the message text, the choice value or the phone number of the contact.
+	Text string `json:"text,omitempty"`
+	// FileID is the file id of the largest size of the photo.
+	FileID  string         `json:"file_id,omitempty"`
+	Contact *lumex.Contact `json:"contact,omitempty"`
+}
+
+// Answers are answers of the conversation by step names.
+type Answers map[string]Answer
+
+// Text returns the text of the answer on the step, empty string if the step has no answer.
+func (a Answers) Text(step string) string {
+	return a[step].Text
+}
+
+// Validator checks the answer, its error is sent to the user and the step is prompted again.
+type Validator func(ctx *router.Context, answer Answer) error
+
+// Step is a single question of the conversation.
+type Step struct {
+	name       string
+	prompt     string
+	kind       InputKind
+	choices    []Choice
+	validators []Validator
+	retry      string
+	promptFunc func(ctx *router.Context) error
+}
+
+type StepOption func(*Step)
+
+// WithValidator adds a validator of the answer, validators are called in order of adding.
+func WithValidator(validator Validator) StepOption {
+	return func(s *Step) {
+		s.validators = append(s.validators, validator)
+	}
+}
+
+// WithRetry sets the reply to input of another kind, like a sticker on a text step.
+func WithRetry(text string) StepOption {
+	return func(s *Step) {
+		s.retry = text
+	}
+}
+
+// WithPrompt replaces the default prompt of the step, which sends the prompt text with a keyboard for the input kind.
+func WithPrompt(prompt func(ctx *router.Context) error) StepOption {
+	return func(s *Step) {
+		s.promptFunc = prompt
+	}
+}
+
+// Name returns the name of the step.
+func (s *Step) Name() string {
+	return s.name
+}
+
+// Kind returns the input kind of the step.
+func (s *Step) Kind() InputKind {
+	return s.kind
+}
+
+// read returns the answer from the update and reports false if the update has input of another kind.
+func (s *Step) read(ctx *router.Context, choicePrefix string) (Answer, bool) {
+	answer := Answer{Kind: s.kind}
+
+	if s.kind == InputChoice {
+		query := ctx.Update.CallbackQuery
+		if query == nil || len(query.Data) <= len(choicePrefix) || query.Data[:len(choicePrefix)] != choicePrefix {
+			return answer, false
+		}
+
+		value := query.Data[len(choicePrefix):]
+		for _, choice := range s.choices {
+			if choice.Value == value {
+				answer.Text = value
+
+				return answer, true
+			}
+		}
+
+		return answer, false
+	}
+
+	m := ctx.Update.Message
+	if m == nil {
+		return answer, false
+	}
+
+	switch s.kind {
+	case InputText:
+		answer.Text = m.Text
+	case InputContact:
+		if m.Contact != nil {
+			answer.Text, answer.Contact = m.Contact.PhoneNumber, m.Contact
+		}
+	case InputPhoto:
+		if len(m.Photo) > 0 {
+			answer.FileID = m.Photo[len(m.Photo)-1].FileId
+			answer.Text = m.Caption
+		}
+	}
+
+	return answer, answer.Text != "" || answer.FileID != ""
+}
+
+// sendPrompt asks the user for the input of the step.
+func (s *Step) sendPrompt(ctx *router.Context, choicePrefix string) error {
+	if s.promptFunc != nil {
+		return s.promptFunc(ctx)
+	}
+
+	switch s.kind {
+	case InputContact:
+		return ctx.ReplyWithMenuVoid(s.prompt, lumex.NewMenu().SetOneTime(true).ContactBtn(s.prompt))
+	case InputChoice:
+		menu := lumex.NewInlineMenu()
+		for _, choice := range s.choices {
+			menu.Row(lumex.CallbackBtn(choice.Text, choicePrefix+choice.Value))
+		}
+
+		return ctx.ReplyWithMenuVoid(s.prompt, menu)
+	default:
+		return ctx.ReplyVoid(s.prompt)
+	}
+}
@@ -3,79 +3,170 @@ package dispatcher
 import (
 	"context"
 	"errors"
+	"fmt"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/kbgod/lumex"
+	"github.com/kbgod/lumex/queue"
 	"github.com/kbgod/lumex/router"
 )
 
 var (
 	ErrDispatcherAlreadyStarted = errors.New("dispatcher already started")
 	ErrDispatcherNotStarted     = errors.New("dispatcher not started")
+	ErrQueueNotConfigured       = errors.New("queue not configured")
+	// ErrHandlerPanic is router.ErrHandlerPanic, so panics recovered by the dispatcher and late panics
+	// reported by the router are matched by the same error.
+	ErrHandlerPanic = router.ErrHandlerPanic
 )
 
+// retryDelay is the delay before the next attempt after a queue error.
+const retryDelay = time.Second
+
 type Dispatcher struct {
 	bot     *lumex.Bot
 	router  *router.Router
 	wg      *sync.WaitGroup
 	started atomic.Bool
 	cancel  context.CancelFunc
+
+	hooks         Hooks
+	updateTimeout time.Duration
+	queue         queue.Queue
+
+	mu        sync.RWMutex
+	updates   <-chan lumex.Update
+	startedAt time.Time
+	polling   bool
+
+	inFlight   atomic.Int64
+	processed  atomic.Uint64
+	failed     atomic.Uint64
+	notFound   atomic.Uint64
+	lastPollAt atomic.Int64
 }
 
-func New(bot *lumex.Bot, router *router.Router) *Dispatcher {
-	return &Dispatcher{
+func New(bot *lumex.Bot, router *router.Router, opts ...Option) *Dispatcher {
+	d := &Dispatcher{
 		bot:    bot,
 		router: router,
 		wg:     &sync.WaitGroup{},
 	}
+
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	return d
 }
 
+// StartPolling
+//
+// starts getting updates using bot.GetUpdatesChanWithContext method and handling them with poolSize workers.
+// If the queue is configured, received updates are published to it and workers consume them from the queue.
+// Polling errors are logged with lumex.DefaultGetUpdatesErrorHandler if opts don't set ErrorHandler.
 func (d *Dispatcher) StartPolling(poolSize int, opts *lumex.GetUpdatesChanOpts) error {
-	if !d.started.CompareAndSwap(false, true) {
-		return ErrDispatcherAlreadyStarted
+	ctx, err := d.start(true)
+	if err != nil {
+		return err
 	}
+	defer d.wg.Done()
 
-	var ctx context.Context
+	updates := d.bot.GetUpdatesChanWithContext(ctx, d.pollingOpts(opts))
 
-	ctx, d.cancel = context.WithCancel(context.Background())
+	if d.queue != nil {
+		d.publish(ctx, updates)
+		d.consume(ctx, poolSize)
+	} else {
+		d.mu.Lock()
+		d.updates = updates
+		d.mu.Unlock()
 
-	updates := d.bot.GetUpdatesChanWithContext(ctx, opts)
+		d.handle(ctx, updates, poolSize)
+	}
 
-	d.wg.Add(poolSize)
+	if d.hooks.OnStart != nil {
+		d.hooks.OnStart()
+	}
 
-	for range poolSize {
-		go func() {
-			defer d.wg.Done()
+	return nil
+}
 
-			for {
-				select {
-				case <-ctx.Done():
-					return
-				case update, ok := <-updates:
-					if !ok {
-						return
-					}
+// StartPublishing
+//
+// starts getting updates and publishing them to the queue without handling them.
+// Use it in the poller process, when updates are handled by StartConsuming in other processes.
+func (d *Dispatcher) StartPublishing(opts *lumex.GetUpdatesChanOpts) error {
+	if d.queue == nil {
+		return ErrQueueNotConfigured
+	}
 
-					_ = d.router.HandleUpdate(ctx, &update)
-				}
-			}
-		}()
+	ctx, err := d.start(true)
+	if err != nil {
+		return err
+	}
+	defer d.wg.Done()
+
+	d.publish(ctx, d.bot.GetUpdatesChanWithContext(ctx, d.pollingOpts(opts)))
+
+	if d.hooks.OnStart != nil {
+		d.hooks.OnStart()
+	}
+
+	return nil
+}
+
+// StartConsuming
+//
+// starts handling updates from the queue with poolSize workers without getting updates.
+// Updates are acknowledged when the router returns no error and returned to the queue otherwise,
+// so every update is handled at least once.
+func (d *Dispatcher) StartConsuming(poolSize int) error {
+	if d.queue == nil {
+		return ErrQueueNotConfigured
+	}
+
+	ctx, err := d.start(false)
+	if err != nil {
+		return err
+	}
+	defer d.wg.Done()
+
+	d.consume(ctx, poolSize)
+
+	if d.hooks.OnStart != nil {
+		d.hooks.OnStart()
 	}
 
 	return nil
 }
 
+// Stop
+//
+// cancels workers and waits until they finish or ctx is done.
+// The OnStop hook is called when workers finish, even if Stop has already returned the ctx error.
 func (d *Dispatcher) Stop(ctx context.Context) error {
-	if !d.started.CompareAndSwap(true, false) {
+	d.mu.Lock()
+	if !d.started.Load() {
+		d.mu.Unlock()
+
 		return ErrDispatcherNotStarted
 	}
+	d.started.Store(false)
+	cancel := d.cancel
+	d.mu.Unlock()
 
-	d.cancel()
+	cancel()
 
 	done := make(chan struct{})
 	go func() {
 		d.wg.Wait()
+
+		if d.hooks.OnStop != nil {
+			d.hooks.OnStop()
+		}
 		close(done)
 	}()
 
@@ -86,3 +177,232 @@ func (d *Dispatcher) Stop(ctx context.Context) error {
 		return ctx.Err()
 	}
 }
+
+// start marks the dispatcher started, cancel is set under d.mu before, so a concurrent Stop always sees it.
+// The caller must call d.wg.Done once workers are started, so Stop waits for them even while they are starting.
+func (d *Dispatcher) start(polling bool) (context.Context, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.started.Load() {
+		return nil, ErrDispatcherAlreadyStarted
+	}
+
+	var ctx context.Context
+
+	ctx, d.cancel = context.WithCancel(context.Background())
+	d.updates = nil
+	d.startedAt = time.Now()
+	d.polling = polling
+	d.started.Store(true)
+	d.wg.Add(1)
+
+	return ctx, nil
+}
+
+// handle starts a worker reading updates from the channel and handling them in a pool of poolSize handlers.
+// Handlers waiting in Context.Ask don't occupy the pool, so replies to them are handled even when all of them wait.
+func (d *Dispatcher) handle(ctx context.Context, updates <-chan lumex.Update, poolSize int) {
+	pool := router.NewPool(poolSize)
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		defer pool.Wait()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case update, ok := <-updates:
+				if !ok {
+					return
+				}
+
+				if !pool.Go(ctx, func(ctx context.Context) {
+					_ = d.handleUpdate(ctx, &update)
+				}) {
+					return
+				}
+			}
+		}
+	}()
+}
+
+// publish starts a worker publishing updates from the channel to the queue.
+// Publishing is retried until it succeeds or the dispatcher is stopped.
+func (d *Dispatcher) publish(ctx context.Context, updates <-chan lumex.Update) {
+	d.wg.Add(1)
+
+	go func() {
+		defer d.wg.Done()
+
+		for update := range updates {
+			for {
+				err := d.queue.Publish(ctx, update)
+				if err == nil {
+					break
+				}
+
+				if ctx.Err() != nil {
+					return
+				}
+
+				if d.hooks.OnError != nil {
+					d.hooks.OnError(&update, err)
+				}
+
+				if !sleep(ctx, retryDelay) {
+					return
+				}
+			}
+		}
+	}()
+}
+
+// consume starts a worker consuming updates from the queue and handling them in a pool of poolSize handlers.
+// Replies to Context.Ask are delivered to handlers waiting in the same process, otherwise they are routed as usual.
+func (d *Dispatcher) consume(ctx context.Context, poolSize int) {
+	pool := router.NewPool(poolSize)
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		defer pool.Wait()
+
+		for {
+			delivery, err := d.queue.Consume(ctx)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+
+				if d.hooks.OnError != nil {
+					d.hooks.OnError(nil, err)
+				}
+
+				if !sleep(ctx, retryDelay) {
+					return
+				}
+
+				continue
+			}
+
+			if !pool.Go(ctx, func(ctx context.Context) {
+				d.settle(delivery, d.handleUpdate(ctx, &delivery.Update))
+			}) {
+				d.settle(delivery, ctx.Err())
+
+				return
+			}
+		}
+	}()
+}
+
+// settle acknowledges the delivery if it was handled without an error and returns it to the queue otherwise.
+// Updates without a route are acknowledged, they would not find a route on the next attempt too.
+func (d *Dispatcher) settle(delivery *queue.Delivery, err error) {
+	if err != nil && !errors.Is(err, router.ErrRouteNotFound) {
+		err = delivery.Nack()
+	} else {
+		err = delivery.Ack()
+	}
+
+	if err != nil && d.hooks.OnError != nil {
+		d.hooks.OnError(&delivery.Update, err)
+	}
+}
+
+// sleep waits for the given duration and reports false if ctx is done earlier.
+func sleep(ctx context.Context, duration time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(duration):
+		return true
+	}
+}
+
+// pollingOpts returns a copy of opts with the polling handlers wrapped,
+// so the dispatcher can track successful polls and report polling errors.
+// Allowed updates are derived from routes if opts don't specify them, see router.Router.UpdatesOpts.
+func (d *Dispatcher) pollingOpts(opts *lumex.GetUpdatesChanOpts) *lumex.GetUpdatesChanOpts {
+	var cfg lumex.GetUpdatesChanOpts
+	if d.router != nil {
+		cfg = *d.router.UpdatesOpts(opts)
+	} else if opts != nil {
+		cfg = *opts
+	}
+
+	errorHandler := cfg.ErrorHandler
+	if errorHandler == nil {
+		// unlike GetUpdatesChanWithContext, which drops errors of opts without the handler,
+		// the dispatcher logs them on purpose, so polling failures are never silent
+		errorHandler = lumex.DefaultGetUpdatesErrorHandler
+	}
+	cfg.ErrorHandler = func(err error) {
+		errorHandler(err)
+
+		if d.hooks.OnError != nil {
+			d.hooks.OnError(nil, err)
+		}
+	}
+
+	pollHandler := cfg.PollHandler
+	cfg.PollHandler = func(updates []lumex.Update) {
+		d.lastPollAt.Store(time.Now().UnixNano())
+
+		if pollHandler != nil {
+			pollHandler(updates)
+		}
+	}
+
+	return &cfg
+}
+
+// handleUpdate handles the update with the router and updates stats and hooks.
+// A panic of the handler is recovered and counted as a failure with an error wrapping ErrHandlerPanic,
+// so a consumed update is returned to the queue instead of crashing the worker.
+// Updates without a route are counted separately and aren't passed to OnError, like settle acknowledges them.
+func (d *Dispatcher) handleUpdate(ctx context.Context, update *lumex.Update) error {
+	d.inFlight.Add(1)
+	start := time.Now()
+
+	if d.updateTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.updateTimeout)
+		defer cancel()
+	}
+
+	err := d.routeUpdate(ctx, update)
+
+	d.inFlight.Add(-1)
+	d.processed.Add(1)
+
+	if errors.Is(err, router.ErrRouteNotFound) {
+		d.notFound.Add(1)
+	} else if err != nil {
+		d.failed.Add(1)
+
+		if d.hooks.OnError != nil {
+			d.hooks.OnError(update, err)
+		}
+	}
+
+	if d.hooks.OnUpdateHandled != nil {
+		d.hooks.OnUpdateHandled(update, time.Since(start), err)
+	}
+
+	return err
+}
+
+// routeUpdate passes the update to the router and returns a panic of the handler as an error.
+func (d *Dispatcher) routeUpdate(ctx context.Context, update *lumex.Update) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", ErrHandlerPanic, r)
+		}
+	}()
+
+	return d.router.HandleUpdate(ctx, update)
+}
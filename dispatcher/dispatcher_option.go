@@ -0,0 +1,57 @@
+package dispatcher
+
+import (
+	"time"
+
+	"github.com/kbgod/lumex"
+	"github.com/kbgod/lumex/queue"
+)
+
+type Option func(*Dispatcher)
+
+// Hooks
+//
+// are lifecycle callbacks of the dispatcher. All of them are optional.
+type Hooks struct {
+	// OnStart is called after all workers are started.
+	OnStart func()
+	// OnStop is called after all workers are finished.
+	OnStop func()
+	// OnError is called when the router returns an error for an update
+	// or when polling fails. In the latter case update is nil.
+	// router.ErrRouteNotFound isn't reported, it is counted in Stats.NotFound and passed to OnUpdateHandled.
+	OnError func(update *lumex.Update, err error)
+	// OnUpdateHandled is called after every update with the handling duration and the router error, if any.
+	OnUpdateHandled func(update *lumex.Update, duration time.Duration, err error)
+}
+
+// WithHooks
+//
+// is an option for the dispatcher that sets lifecycle hooks.
+func WithHooks(hooks Hooks) Option {
+	return func(d *Dispatcher) {
+		d.hooks = hooks
+	}
+}
+
+// WithUpdateTimeout
+//
+// is an option for the dispatcher that sets the maximum duration of handling a single update.
+// The deadline is applied to the event context, so handlers and their requests are cancelled when it is reached
+// and the router reports an error wrapping router.ErrHandlerTimeout.
+// See router.Router.HandleUpdate for handlers which ignore the context.
+func WithUpdateTimeout(timeout time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.updateTimeout = timeout
+	}
+}
+
+// WithQueue
+//
+// is an option for the dispatcher that makes it pass updates through the queue
+// instead of the in-process channel. See StartPublishing and StartConsuming.
+func WithQueue(q queue.Queue) Option {
+	return func(d *Dispatcher) {
+		d.queue = q
+	}
+}
@@ -0,0 +1,497 @@
+package dispatcher
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kbgod/lumex"
+	"github.com/kbgod/lumex/mocks"
+	"github.com/kbgod/lumex/queue"
+	"github.com/kbgod/lumex/router"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// newPollingBot returns the bot which gets pollErr, if it's not nil, and then every batch once on getUpdates,
+// after that getUpdates blocks until the request is cancelled. Other requests succeed.
+func newPollingBot(t *testing.T, pollErr error, batches ...[]lumex.Update) *lumex.Bot {
+	cl := mocks.NewBotClient(t)
+	getUpdates := func() *mock.Call {
+		return cl.On("RequestWithContext", mock.Anything, mock.Anything, "getUpdates", mock.Anything, mock.Anything)
+	}
+
+	if pollErr != nil {
+		getUpdates().Return(nil, pollErr).Once()
+	}
+	for _, batch := range batches {
+		data, err := json.Marshal(batch)
+		assert.NoError(t, err)
+		getUpdates().Return(json.RawMessage(data), nil).Once()
+	}
+	getUpdates().Return(func(
+		ctx context.Context, _ string, _ string, _ map[string]any, _ *lumex.RequestOpts,
+	) (json.RawMessage, error) {
+		<-ctx.Done()
+
+		return nil, ctx.Err()
+	}, nil).Maybe()
+	cl.On(
+		"RequestWithContext",
+		mock.Anything,
+		mock.Anything,
+		mock.MatchedBy(func(method string) bool {
+			return method != "getUpdates"
+		}),
+		mock.Anything,
+		mock.Anything,
+	).Return(json.RawMessage(`true`), nil).Maybe()
+
+	bot, err := lumex.NewBot("123:test", &lumex.BotOpts{
+		BotClient:         cl,
+		DisableTokenCheck: true,
+	})
+	assert.NoError(t, err, "lumex.NewBot() = %v; want <nil>", err)
+
+	return bot
+}
+
+func TestDispatcher_StartStop(t *testing.T) {
+	bot := newPollingBot(t, nil)
+	d := New(bot, router.New(bot))
+
+	assert.ErrorIs(t, d.Stop(context.Background()), ErrDispatcherNotStarted)
+	assert.NoError(t, d.StartPolling(1, nil))
+	assert.ErrorIs(t, d.StartPolling(1, nil), ErrDispatcherAlreadyStarted)
+	assert.True(t, d.Stats().Running)
+	assert.NoError(t, d.Stop(context.Background()))
+	assert.False(t, d.Stats().Running)
+}
+
+func TestDispatcher_concurrentStartStop(t *testing.T) {
+	bot := newPollingBot(t, nil)
+	d := New(bot, router.New(bot))
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_ = d.StartPolling(1, nil)
+	}()
+	go func() {
+		defer wg.Done()
+		_ = d.Stop(context.Background())
+	}()
+	wg.Wait()
+
+	if d.Stats().Running {
+		assert.NoError(t, d.Stop(context.Background()))
+	}
+}
+
+func TestDispatcher_OnStopAfterStopTimeout(t *testing.T) {
+	bot := newPollingBot(t, nil, []lumex.Update{{UpdateId: 1, Message: &lumex.Message{Text: "stuck"}}})
+
+	started, release := make(chan struct{}), make(chan struct{})
+	r := router.New(bot)
+	r.OnMessage(func(ctx *router.Context) error {
+		close(started)
+		<-release
+
+		return nil
+	})
+
+	stopped := make(chan struct{})
+	d := New(bot, r, WithHooks(Hooks{
+		OnStop: func() {
+			close(stopped)
+		},
+	}))
+	assert.NoError(t, d.StartPolling(1, nil))
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, d.Stop(ctx), context.DeadlineExceeded)
+
+	select {
+	case <-stopped:
+		t.Fatal("OnStop called before workers finished")
+	default:
+	}
+
+	close(release)
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("OnStop not called after workers finished")
+	}
+}
+
+func TestDispatcher_Hooks(t *testing.T) {
+	handlerErr := errors.New("handler error")
+	pollErr := errors.New("poll error")
+	bot := newPollingBot(t, pollErr, []lumex.Update{
+		{UpdateId: 1, Message: &lumex.Message{Text: "ok"}},
+		{UpdateId: 2, Message: &lumex.Message{Text: "fail"}},
+	})
+
+	r := router.New(bot)
+	r.OnTextEquals("ok", func(ctx *router.Context) error {
+		return nil
+	})
+	r.OnTextEquals("fail", func(ctx *router.Context) error {
+		return handlerErr
+	})
+
+	var (
+		mu        sync.Mutex
+		started   bool
+		stopped   bool
+		errs      []error
+		handled   = make(chan struct{}, 2)
+		userPolls int
+	)
+
+	d := New(bot, r, WithHooks(Hooks{
+		OnStart: func() {
+			started = true
+		},
+		OnStop: func() {
+			stopped = true
+		},
+		OnError: func(update *lumex.Update, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			errs = append(errs, err)
+		},
+		OnUpdateHandled: func(update *lumex.Update, duration time.Duration, err error) {
+			handled <- struct{}{}
+		},
+	}))
+
+	err := d.StartPolling(1, &lumex.GetUpdatesChanOpts{
+		PollHandler: func(updates []lumex.Update) {
+			mu.Lock()
+			defer mu.Unlock()
+			userPolls++
+		},
+	})
+	assert.NoError(t, err)
+	assert.True(t, started, "OnStart hook not called")
+
+	for range 2 {
+		select {
+		case <-handled:
+		case <-time.After(time.Second):
+			t.Fatal("updates were not handled")
+		}
+	}
+
+	stats := d.Stats()
+	assert.Equal(t, uint64(2), stats.Processed)
+	assert.Equal(t, uint64(1), stats.Failed)
+	assert.Equal(t, int64(0), stats.InFlight)
+	assert.False(t, stats.LastPollAt.IsZero(), "LastPollAt is zero")
+
+	assert.NoError(t, d.Stop(context.Background()))
+	assert.True(t, stopped, "OnStop hook not called")
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []error{pollErr, handlerErr}, errs)
+	assert.Equal(t, 1, userPolls, "user poll handler not called")
+}
+
+func TestDispatcher_pollingErrorsAreLogged(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	bot := newPollingBot(t, nil)
+	for _, d := range []*Dispatcher{New(bot, router.New(bot)), New(bot, nil)} {
+		buf.Reset()
+
+		opts := d.pollingOpts(&lumex.GetUpdatesChanOpts{})
+		opts.ErrorHandler(errors.New("bad gateway"))
+		assert.Contains(t, buf.String(), "GetUpdatesChanWithContext error: bad gateway")
+	}
+}
+
+func TestDispatcher_handlerPanic(t *testing.T) {
+	r := router.New(nil)
+	r.OnMessage(func(ctx *router.Context) error {
+		panic("boom")
+	})
+
+	var handled error
+	d := New(nil, r, WithHooks(Hooks{
+		OnUpdateHandled: func(update *lumex.Update, duration time.Duration, err error) {
+			handled = err
+		},
+	}))
+
+	err := d.handleUpdate(context.Background(), &lumex.Update{Message: &lumex.Message{Text: "hi"}})
+	assert.ErrorIs(t, err, ErrHandlerPanic)
+	assert.ErrorContains(t, err, "boom")
+	assert.ErrorIs(t, handled, ErrHandlerPanic)
+
+	stats := d.Stats()
+	assert.Equal(t, int64(0), stats.InFlight)
+	assert.Equal(t, uint64(1), stats.Processed)
+	assert.Equal(t, uint64(1), stats.Failed)
+}
+
+func TestDispatcher_routeNotFound(t *testing.T) {
+	r := router.New(nil)
+	r.OnCommand("start", func(ctx *router.Context) error {
+		return nil
+	})
+
+	var errs, handled []error
+	d := New(nil, r, WithHooks(Hooks{
+		OnError: func(update *lumex.Update, err error) {
+			errs = append(errs, err)
+		},
+		OnUpdateHandled: func(update *lumex.Update, duration time.Duration, err error) {
+			handled = append(handled, err)
+		},
+	}))
+
+	err := d.handleUpdate(context.Background(), &lumex.Update{Message: &lumex.Message{Text: "hi"}})
+	assert.ErrorIs(t, err, router.ErrRouteNotFound)
+	assert.Empty(t, errs, "OnError called for update without route")
+	assert.Len(t, handled, 1)
+	assert.ErrorIs(t, handled[0], router.ErrRouteNotFound)
+
+	stats := d.Stats()
+	assert.Equal(t, uint64(1), stats.Processed)
+	assert.Equal(t, uint64(0), stats.Failed)
+	assert.Equal(t, uint64(1), stats.NotFound)
+}
+
+func TestDispatcher_HealthHandlers(t *testing.T) {
+	bot := newPollingBot(t, nil)
+	d := New(bot, router.New(bot))
+
+	probe := func(h http.Handler) (int, Stats) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		var stats Stats
+		assert.NoError(t, json.NewDecoder(rec.Body).Decode(&stats))
+
+		return rec.Code, stats
+	}
+
+	code, stats := probe(d.LivenessHandler())
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.False(t, stats.Running)
+
+	code, _ = probe(d.ReadinessHandler(time.Minute))
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+
+	assert.NoError(t, d.StartPolling(1, nil))
+
+	code, stats = probe(d.LivenessHandler())
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, stats.Running)
+
+	code, _ = probe(d.ReadinessHandler(time.Minute))
+	assert.Equal(t, http.StatusOK, code)
+
+	time.Sleep(time.Millisecond)
+
+	code, _ = probe(d.ReadinessHandler(time.Nanosecond))
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+
+	assert.NoError(t, d.Stop(context.Background()))
+}
+
+func TestDispatcher_UpdateTimeout(t *testing.T) {
+	bot := newPollingBot(t, nil, []lumex.Update{
+		{UpdateId: 1, Message: &lumex.Message{Text: "stuck"}},
+		{UpdateId: 2, Message: &lumex.Message{Text: "ok"}},
+	})
+
+	release := make(chan struct{})
+	defer close(release)
+
+	r := router.New(bot)
+	r.OnTextEquals("stuck", func(ctx *router.Context) error {
+		// the handler ignores its context
+		<-release
+
+		return nil
+	})
+	r.OnTextEquals("ok", func(ctx *router.Context) error {
+		return nil
+	})
+
+	errs := make(chan error, 2)
+	d := New(bot, r, WithUpdateTimeout(10*time.Millisecond), WithHooks(Hooks{
+		OnUpdateHandled: func(update *lumex.Update, duration time.Duration, err error) {
+			errs <- err
+		},
+	}))
+
+	// a single worker moves on when the stuck handler reaches the timeout
+	assert.NoError(t, d.StartPolling(1, nil))
+
+	for _, want := range []error{router.ErrHandlerTimeout, nil} {
+		select {
+		case err := <-errs:
+			if want == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("update was not handled")
+		}
+	}
+
+	assert.Equal(t, uint64(1), d.Stats().Failed)
+	assert.NoError(t, d.Stop(context.Background()))
+}
+
+func TestDispatcher_Queue(t *testing.T) {
+	t.Run("queue not configured", func(t *testing.T) {
+		bot := newPollingBot(t, nil)
+		d := New(bot, router.New(bot))
+
+		assert.ErrorIs(t, d.StartPublishing(nil), ErrQueueNotConfigured)
+		assert.ErrorIs(t, d.StartConsuming(1), ErrQueueNotConfigured)
+	})
+
+	t.Run("poller publishes and consumers handle at least once", func(t *testing.T) {
+		bot := newPollingBot(t, nil, []lumex.Update{
+			{UpdateId: 1, Message: &lumex.Message{Text: "ok"}},
+			{UpdateId: 2, Message: &lumex.Message{Text: "retry"}},
+			{UpdateId: 3, Message: &lumex.Message{Text: "ok"}},
+		})
+		q := queue.NewMemory(10, queue.WithMemoryRetryBackoff(0))
+
+		var (
+			mu       sync.Mutex
+			attempts = make(map[int64]int)
+			handled  = make(chan int64, 10)
+		)
+		r := router.New(bot)
+		r.OnMessage(func(ctx *router.Context) error {
+			mu.Lock()
+			attempts[ctx.Update.UpdateId]++
+			attempt := attempts[ctx.Update.UpdateId]
+			mu.Unlock()
+
+			if ctx.Update.Message.Text == "retry" && attempt == 1 {
+				return errors.New("temporary error")
+			}
+			handled <- ctx.Update.UpdateId
+
+			return nil
+		})
+
+		poller := New(bot, r, WithQueue(q))
+		assert.NoError(t, poller.StartPublishing(nil))
+		assert.True(t, poller.Stats().Polling)
+
+		consumers := []*Dispatcher{New(bot, r, WithQueue(q)), New(bot, r, WithQueue(q))}
+		for _, consumer := range consumers {
+			assert.NoError(t, consumer.StartConsuming(2))
+			assert.False(t, consumer.Stats().Polling)
+		}
+
+		got := make(map[int64]bool)
+		for len(got) < 3 {
+			select {
+			case id := <-handled:
+				got[id] = true
+			case <-time.After(time.Second):
+				t.Fatal("updates were not handled")
+			}
+		}
+
+		mu.Lock()
+		assert.Equal(t, map[int64]int{1: 1, 2: 2, 3: 1}, attempts)
+		mu.Unlock()
+		assert.Equal(t, 0, poller.Stats().QueueDepth)
+
+		assert.NoError(t, poller.Stop(context.Background()))
+		for _, consumer := range consumers {
+			assert.NoError(t, consumer.Stop(context.Background()))
+		}
+	})
+}
+
+func TestDispatcher_settle(t *testing.T) {
+	d := New(nil, nil)
+	settled := func(err error) string {
+		var result string
+		d.settle(queue.NewDelivery(lumex.Update{}, 1, func() error {
+			result = "ack"
+
+			return nil
+		}, func() error {
+			result = "nack"
+
+			return nil
+		}), err)
+
+		return result
+	}
+
+	assert.Equal(t, "ack", settled(nil))
+	assert.Equal(t, "nack", settled(errors.New("temporary error")))
+	assert.Equal(t, "ack", settled(fmt.Errorf("dispatch: %w", router.ErrRouteNotFound)))
+}
+
+func TestDispatcher_Ask(t *testing.T) {
+	bot := newPollingBot(t, nil, []lumex.Update{
+		{
+			UpdateId: 1,
+			Message: &lumex.Message{
+				Text:     "/start",
+				Entities: []lumex.MessageEntity{{Type: "bot_command", Length: 6}},
+				Chat:     lumex.Chat{Id: 1},
+				From:     &lumex.User{Id: 1},
+			},
+		},
+		{UpdateId: 2, Message: &lumex.Message{Text: "me@example.com", Chat: lumex.Chat{Id: 1}, From: &lumex.User{Id: 1}}},
+	})
+
+	answers := make(chan string, 1)
+	r := router.New(bot)
+	r.OnCommand("start", func(ctx *router.Context) error {
+		answer, err := ctx.Ask("", router.ExpectText(), time.Second)
+		if err != nil {
+			return err
+		}
+		answers <- answer.Message.Text
+
+		return nil
+	})
+
+	// the only worker waits in Ask, the reply must still reach it
+	d := New(bot, r)
+	assert.NoError(t, d.StartPolling(1, nil))
+
+	select {
+	case answer := <-answers:
+		assert.Equal(t, "me@example.com", answer)
+	case <-time.After(2 * time.Second):
+		t.Fatal("reply was not delivered to the waiting handler")
+	}
+
+	assert.NoError(t, d.Stop(context.Background()))
+}
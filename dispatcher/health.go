@@ -0,0 +1,54 @@
+package dispatcher
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// LivenessHandler
+//
+// returns http.Handler for liveness probes.
+// It responds with 200 while the dispatcher is running and 503 otherwise.
+// The response body is the JSON encoded Stats.
+func (d *Dispatcher) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		stats := d.Stats()
+
+		writeStats(rw, stats, stats.Running)
+	})
+}
+
+// ReadinessHandler
+//
+// returns http.Handler for readiness probes.
+// It responds with 200 while the dispatcher is running and the last successful poll
+// (or the start, if there was no poll yet) is not older than maxPollAge, and 503 otherwise.
+// The poll age is not checked for dispatchers which only consume updates from the queue.
+// maxPollAge should be greater than the long polling timeout, because an idle long poll
+// returns only when the timeout expires.
+// The response body is the JSON encoded Stats.
+func (d *Dispatcher) ReadinessHandler(maxPollAge time.Duration) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		stats := d.Stats()
+
+		lastActivity := stats.LastPollAt
+		if lastActivity.Before(stats.StartedAt) {
+			lastActivity = stats.StartedAt
+		}
+
+		writeStats(rw, stats, stats.Running && (!stats.Polling || time.Since(lastActivity) <= maxPollAge))
+	})
+}
+
+func writeStats(rw http.ResponseWriter, stats Stats, healthy bool) {
+	rw.Header().Set("Content-Type", "application/json")
+
+	if healthy {
+		rw.WriteHeader(http.StatusOK)
+	} else {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	_ = json.NewEncoder(rw).Encode(stats)
+}
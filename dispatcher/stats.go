@@ -0,0 +1,53 @@
+package dispatcher
+
+import "time"
+
+// Stats is a point-in-time snapshot of the dispatcher state.
+type Stats struct {
+	// Running reports whether the dispatcher is started and not stopped.
+	Running bool `json:"running"`
+	// Polling reports whether the dispatcher gets updates from Telegram.
+	Polling bool `json:"polling"`
+	// QueueDepth is the number of received updates waiting for a free worker.
+	// For queues it is reported only if the queue has a Len() int method.
+	QueueDepth int `json:"queue_depth"`
+	// InFlight is the number of updates being handled right now.
+	InFlight int64 `json:"in_flight"`
+	// Processed is the total number of handled updates, including failed ones.
+	Processed uint64 `json:"processed"`
+	// Failed is the total number of updates for which the router returned an error other than router.ErrRouteNotFound.
+	Failed uint64 `json:"failed"`
+	// NotFound is the total number of updates for which the router found no route.
+	NotFound uint64 `json:"not_found"`
+	// StartedAt is the time the dispatcher was started, zero if it never was.
+	StartedAt time.Time `json:"started_at"`
+	// LastPollAt is the time of the last successful getUpdates request, zero if there was none yet.
+	LastPollAt time.Time `json:"last_poll_at"`
+}
+
+// Stats returns a snapshot of the dispatcher state.
+func (d *Dispatcher) Stats() Stats {
+	d.mu.RLock()
+	stats := Stats{
+		Running:    d.started.Load(),
+		Polling:    d.polling,
+		QueueDepth: len(d.updates),
+		StartedAt:  d.startedAt,
+	}
+	d.mu.RUnlock()
+
+	if q, ok := d.queue.(interface{ Len() int }); ok {
+		stats.QueueDepth = q.Len()
+	}
+
+	stats.InFlight = d.inFlight.Load()
+	stats.Processed = d.processed.Load()
+	stats.Failed = d.failed.Load()
+	stats.NotFound = d.notFound.Load()
+
+	if lastPollAt := d.lastPollAt.Load(); lastPollAt != 0 {
+		stats.LastPollAt = time.Unix(0, lastPollAt)
+	}
+
+	return stats
+}
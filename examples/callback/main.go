@@ -20,6 +20,11 @@ var logger = zerolog.New(
 	}),
 ).With().Timestamp().Logger()
 
+var (
+	productPath  = router.MustCallbackPath("product/:id")
+	categoryPath = router.MustCallbackPath("category/:id/page/:page")
+)
+
 func main() {
 	bot, err := lumex.NewBot(os.Getenv("BOT_TOKEN"), nil)
 	if err != nil {
@@ -37,11 +42,11 @@ func main() {
 		var buttons []lumex.InlineKeyboardButton
 		for i := 0; i < 5; i++ {
 			sid := fmt.Sprintf("%d", i)
-			buttons = append(buttons, lumex.CallbackBtn("Product "+sid, "product:"+sid))
+			buttons = append(buttons, lumex.CallbackBtn("Product "+sid, productPath.MustBuild(i)))
 		}
 		for i := 0; i < 5; i++ {
 			sid := fmt.Sprintf("%d", i)
-			buttons = append(buttons, lumex.CallbackBtn("Category "+sid, "category:"+sid))
+			buttons = append(buttons, lumex.CallbackBtn("Category "+sid, categoryPath.MustBuild(i, 1)))
 		}
 
 		menu.Fill(2, buttons...)
@@ -49,11 +54,11 @@ func main() {
 		return ctx.ReplyWithMenuVoid("Menu", menu)
 	})
 
-	r.OnCallbackPrefix("product", func(ctx *router.Context) error {
-		return ctx.AnswerAlertVoid("You selected product " + ctx.ShiftCallbackData(":"))
+	r.OnCallbackPath(productPath.Pattern(), func(ctx *router.Context) error {
+		return ctx.AnswerAlertVoid("You selected product " + ctx.Param("id"))
 	})
-	r.OnCallbackPrefix("category", func(ctx *router.Context) error {
-		return ctx.AnswerAlertVoid("You selected category " + ctx.ShiftCallbackData(":"))
+	r.OnCallbackPath(categoryPath.Pattern(), func(ctx *router.Context) error {
+		return ctx.AnswerAlertVoid("You selected category " + ctx.Param("id") + ", page " + ctx.Param("page"))
 	})
 
 	interrupt := make(chan os.Signal, 1)
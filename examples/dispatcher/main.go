@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
@@ -46,7 +47,28 @@ func main() {
 		}
 	})
 
-	d := dispatcher.New(bot, r)
+	d := dispatcher.New(bot, r, dispatcher.WithHooks(dispatcher.Hooks{
+		OnStart: func() {
+			log.Info("dispatcher started")
+		},
+		OnStop: func() {
+			log.Info("dispatcher stopped")
+		},
+		OnError: func(update *lumex.Update, err error) {
+			if update == nil {
+				log.Error("polling error", "error", err)
+			}
+		},
+	}))
+
+	http.Handle("/livez", d.LivenessHandler())
+	http.Handle("/readyz", d.ReadinessHandler(15*time.Minute))
+
+	go func() {
+		if err := http.ListenAndServe(":8080", nil); err != nil {
+			log.Error("health server stopped", "error", err)
+		}
+	}()
 
 	go func() {
 		if err := d.StartPolling(100, nil); err != nil {
@@ -54,8 +76,6 @@ func main() {
 
 			os.Exit(1)
 		}
-
-		log.Info("dispatcher started")
 	}()
 
 	<-interrupt
@@ -99,6 +99,7 @@ func main() {
 			RequestOpts: &lumex.RequestOpts{
 				Timeout: 600 * time.Second,
 			},
+			// updates handled only by middlewares are not derived from routes, so the list is explicit
 			AllowedUpdates: []string{
 				"message",
 				"callback_query",
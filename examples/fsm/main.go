@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/kbgod/lumex"
+	"github.com/kbgod/lumex/fsm"
 	"github.com/kbgod/lumex/router"
 	"github.com/rs/zerolog"
 )
@@ -20,17 +21,6 @@ var logger = zerolog.New(
 	}),
 ).With().Timestamp().Logger()
 
-var stateStore = make(map[int64]string)
-
-func stateMiddleware(ctx *router.Context) error {
-	state, ok := stateStore[ctx.Sender().Id]
-	if ok {
-		ctx.SetState(state)
-	}
-
-	return ctx.Next()
-}
-
 func main() {
 	bot, err := lumex.NewBot(os.Getenv("BOT_TOKEN"), nil)
 	if err != nil {
@@ -43,12 +33,13 @@ func main() {
 			logger.Error().Err(err).Interface("upd", ctx.Update).Msg("handle update error")
 		}
 	}))
-	r.Use(stateMiddleware)
+	// states are loaded before routing and saved after handlers, use fsm.NewFile to keep them between restarts
+	r.Use(fsm.Middleware(fsm.NewMemory(), fsm.WithKeyStrategy(fsm.UserKey), fsm.WithTTL(24*time.Hour)))
 
 	r.OnStart(mainMenu)
 	r.Use(mainMiddleware) // called also for /start command
 	r.OnCommand("admin", func(ctx *router.Context) error {
-		stateStore[ctx.Sender().Id] = "admin"
+		ctx.SetState("admin")
 
 		return adminMenu(ctx)
 	})
@@ -64,22 +55,17 @@ func main() {
 		return mainMenu(ctx)
 	})
 
-	adminRouter := r.UseState("admin")
-	adminRouter.Use(adminMiddleware)
-	adminRouter.OnStart(func(ctx *router.Context) error {
-		return ctx.ReplyVoid("NEVER CALLED, because exists OnStart handler defined before")
-	}) // this command will be available only in admin state
-	adminRouter.OnCommand("ban", func(ctx *router.Context) error {
-		return ctx.ReplyVoid("user banned")
-	}) // this command will be available only in admin state
-	adminRouter.OnCommand("exit", func(ctx *router.Context) error {
-		delete(stateStore, ctx.Sender().Id)
-		return mainMenu(ctx)
-	}) // this command will be available only in admin state
-	adminRouter.OnMessage(adminMenu)
+	// routes of the module are checked before routes of the root router, because of the priority,
+	// so /start in admin state is handled by the module instead of OnStart defined before
+	r.Mount(adminModule{}, &router.MountOpts{
+		Name:        "admin",
+		Middlewares: []router.Handler{adminMiddleware},
+		State:       "admin",
+		Priority:    1,
+	})
 
-	// this handler will be available only if ctx.UseState("admin") not called,
-	// because exists OnMessage defined before
+	// this handler will be available only if the state is not "admin",
+	// because OnMessage of the admin module is checked before
 	r.OnMessage(mainMenu)
 
 	interrupt := make(chan os.Signal, 1)
@@ -92,6 +78,21 @@ func main() {
 	logger.Info().Str("username", bot.User.Username).Msg("bot stopped")
 }
 
+// adminModule has commands available only in admin state.
+type adminModule struct{}
+
+func (adminModule) Register(r *router.Router) {
+	r.OnStart(adminMenu)
+	r.OnCommand("ban", func(ctx *router.Context) error {
+		return ctx.ReplyVoid("user banned")
+	})
+	r.OnCommand("exit", func(ctx *router.Context) error {
+		ctx.ClearState()
+		return mainMenu(ctx)
+	})
+	r.OnMessage(adminMenu)
+}
+
 func mainMenu(ctx *router.Context) error {
 	return ctx.ReplyVoid(
 		"/admin - enter to admin menu\n" +
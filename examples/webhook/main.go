@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"os"
@@ -34,12 +35,15 @@ func main() {
 		panic(err)
 	}
 
-	if ok, err := bot.SetWebhook(os.Getenv("WEBHOOK_URL"), nil); err != nil || !ok {
+	r := makeRouter(bot)
+
+	// allowed updates are derived from the routes
+	if err := r.SetWebhook(context.Background(), os.Getenv("WEBHOOK_URL"), nil); err != nil {
 		panic(err)
 	}
 
 	h := &handler{
-		botRouter: makeRouter(bot),
+		botRouter: r,
 	}
 
 	http.HandleFunc("/webhook", h.webhookHandler)
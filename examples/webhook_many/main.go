@@ -41,12 +41,18 @@ func main() {
 		panic(err)
 	}
 
-	if ok, err := bot.SetWebhook(os.Getenv("WEBHOOK_URL"), nil); err != nil || !ok {
+	r := makeRouter()
+
+	// the router has no bot, so allowed updates are passed to the webhook of every bot
+	ok, err := bot.SetWebhook(os.Getenv("WEBHOOK_URL"), &lumex.SetWebhookOpts{
+		AllowedUpdates: r.AllowedUpdates(),
+	})
+	if err != nil || !ok {
 		panic(err)
 	}
 
 	h := &handler{
-		botRouter: makeRouter(),
+		botRouter: r,
 		bots:      map[string]*lumex.Bot{"bot": bot},
 	}
 
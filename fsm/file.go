@@ -0,0 +1,174 @@
+package fsm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var _ Storage = (*File)(nil)
+
+type fileRecord struct {
+	Record
+	ExpiresAt time.Time `json:"expires_at"`
+	// flushed is ExpiresAt last written to the file, see File.Set.
+	flushed time.Time
+}
+
+// File is a Storage implementation which keeps all records in a single JSON file.
+// The file is read once by NewFile and rewritten atomically on every change,
+// so it suits bots with moderate load which must keep states between restarts.
+// Set of an unchanged record only to refresh its TTL writes the file only when at least half of the TTL
+// has passed since the expiration time was last written, so after a restart such records may expire
+// up to half of the TTL earlier.
+// The file must not be shared between processes.
+type File struct {
+	path string
+	now  func() time.Time
+
+	mu      sync.RWMutex
+	records map[string]fileRecord
+}
+
+// NewFile creates a storage in the JSON file at path, loading records saved before.
+func NewFile(path string) (*File, error) {
+	s := &File{
+		path:    path,
+		now:     time.Now,
+		records: make(map[string]fileRecord),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fsm storage: %w", err)
+	}
+
+	if len(data) > 0 {
+		if err = json.Unmarshal(data, &s.records); err != nil {
+			return nil, fmt.Errorf("failed to decode fsm storage: %w", err)
+		}
+	}
+
+	for key, item := range s.records {
+		item.flushed = item.ExpiresAt
+		s.records[key] = item
+	}
+
+	return s, nil
+}
+
+func (s *File) Get(_ context.Context, key string) (*Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	item, ok := s.records[key]
+	if !ok || expired(s.now(), item.ExpiresAt) {
+		return nil, nil
+	}
+
+	record := item.Record.clone()
+
+	return &record, nil
+}
+
+func (s *File) Set(_ context.Context, key string, record Record, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	prev, existed := s.records[key]
+	item := fileRecord{Record: record.clone(), ExpiresAt: expiresAt(now, ttl)}
+
+	// only the expiration time is refreshed, it is written later unless half of the TTL has passed
+	if existed && ttl > 0 && !expired(now, prev.ExpiresAt) && prev.Record.equal(record) &&
+		!prev.flushed.IsZero() && prev.flushed.Sub(now) > ttl/2 {
+		item.flushed = prev.flushed
+		s.records[key] = item
+
+		return nil
+	}
+
+	s.records[key] = item
+
+	if err := s.flush(); err != nil {
+		// the caller is told the record is not saved, so the next flush must not write it
+		if existed {
+			s.records[key] = prev
+		} else {
+			delete(s.records, key)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (s *File) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev, ok := s.records[key]
+	if !ok {
+		return nil
+	}
+	delete(s.records, key)
+
+	if err := s.flush(); err != nil {
+		s.records[key] = prev
+
+		return err
+	}
+
+	return nil
+}
+
+// flush drops expired records and writes the rest to the file, the caller must hold the lock.
+func (s *File) flush() error {
+	now := s.now()
+	for key, item := range s.records {
+		if expired(now, item.ExpiresAt) {
+			delete(s.records, key)
+		}
+	}
+
+	data, err := json.Marshal(s.records)
+	if err != nil {
+		return fmt.Errorf("failed to encode fsm storage: %w", err)
+	}
+
+	// the file is replaced by rename, so it is never left partially written
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to write fsm storage: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+
+		return fmt.Errorf("failed to write fsm storage: %w", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write fsm storage: %w", err)
+	}
+
+	if err = os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to write fsm storage: %w", err)
+	}
+
+	for key, item := range s.records {
+		item.flushed = item.ExpiresAt
+		s.records[key] = item
+	}
+
+	return nil
+}
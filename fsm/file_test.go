@@ -0,0 +1,173 @@
+package fsm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFile(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "states.json")
+
+	s, err := NewFile(path)
+	assert.NoError(t, err)
+
+	saved := Record{State: "checkout:address", Data: map[string]json.RawMessage{"item": json.RawMessage(`"book"`)}}
+	assert.NoError(t, s.Set(ctx, "chat:1:user:2", saved, time.Hour))
+	assert.NoError(t, s.Set(ctx, "chat:1:user:3", Record{State: "menu"}, 0))
+	assert.NoError(t, s.Delete(ctx, "chat:1:user:3"))
+
+	t.Run("records survive restart", func(t *testing.T) {
+		restarted, err := NewFile(path)
+		assert.NoError(t, err)
+
+		record, err := restarted.Get(ctx, "chat:1:user:2")
+		assert.NoError(t, err)
+		assert.Equal(t, saved, *record)
+
+		record, err = restarted.Get(ctx, "chat:1:user:3")
+		assert.NoError(t, err)
+		assert.Nil(t, record)
+	})
+
+	t.Run("expired records", func(t *testing.T) {
+		now := time.Now().Add(2 * time.Hour)
+		s.now = func() time.Time {
+			return now
+		}
+
+		record, err := s.Get(ctx, "chat:1:user:2")
+		assert.NoError(t, err)
+		assert.Nil(t, record)
+
+		assert.NoError(t, s.Set(ctx, "chat:1:user:4", Record{State: "menu"}, 0))
+
+		data, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		assert.NotContains(t, string(data), "chat:1:user:2", "expired record is kept in the file")
+
+		entries, err := os.ReadDir(filepath.Dir(path))
+		assert.NoError(t, err)
+		assert.Len(t, entries, 1, "temporary files are left")
+	})
+
+	t.Run("invalid file", func(t *testing.T) {
+		invalid := filepath.Join(t.TempDir(), "invalid.json")
+		assert.NoError(t, os.WriteFile(invalid, []byte("{"), 0o600))
+
+		_, err := NewFile(invalid)
+		assert.Error(t, err)
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := range 5 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				key := fmt.Sprintf("user:%d", i)
+				for range 20 {
+					assert.NoError(t, s.Set(ctx, key, Record{State: "a"}, 0))
+					_, err := s.Get(ctx, key)
+					assert.NoError(t, err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		restarted, err := NewFile(path)
+		assert.NoError(t, err)
+		for i := range 5 {
+			record, err := restarted.Get(ctx, fmt.Sprintf("user:%d", i))
+			assert.NoError(t, err)
+			assert.Equal(t, "a", record.State)
+		}
+	})
+}
+
+func TestFile_failedWrite(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "states")
+	assert.NoError(t, os.Mkdir(dir, 0o755))
+	path := filepath.Join(dir, "states.json")
+
+	s, err := NewFile(path)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Set(ctx, "kept", Record{State: "a"}, 0))
+
+	assert.NoError(t, os.RemoveAll(dir))
+	assert.Error(t, s.Set(ctx, "kept", Record{State: "b"}, 0))
+	assert.Error(t, s.Set(ctx, "failed", Record{State: "c"}, 0))
+	assert.Error(t, s.Delete(ctx, "kept"))
+
+	record, err := s.Get(ctx, "kept")
+	assert.NoError(t, err)
+	assert.Equal(t, &Record{State: "a"}, record)
+
+	record, err = s.Get(ctx, "failed")
+	assert.NoError(t, err)
+	assert.Nil(t, record)
+
+	assert.NoError(t, os.Mkdir(dir, 0o755))
+	assert.NoError(t, s.Set(ctx, "other", Record{State: "d"}, 0))
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "failed", "record of the failed Set is written")
+	assert.NotContains(t, string(data), `"b"`, "record of the failed Set is written")
+}
+
+func TestFile_refreshTTL(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "states.json")
+
+	s, err := NewFile(path)
+	assert.NoError(t, err)
+
+	start := time.Now()
+	now := start
+	s.now = func() time.Time {
+		return now
+	}
+
+	record := Record{State: "menu"}
+	assert.NoError(t, s.Set(ctx, "key", record, time.Hour))
+	written, err := os.ReadFile(path)
+	assert.NoError(t, err)
+
+	// refreshing an unchanged record doesn't write the file before half of the TTL has passed
+	now = start.Add(20 * time.Minute)
+	assert.NoError(t, s.Set(ctx, "key", record, time.Hour))
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, written, data)
+
+	// the refreshed expiration time is kept in memory
+	now = start.Add(70 * time.Minute)
+	got, err := s.Get(ctx, "key")
+	assert.NoError(t, err)
+	assert.Equal(t, &record, got)
+
+	now = start.Add(50 * time.Minute)
+	assert.NoError(t, s.Set(ctx, "key", record, time.Hour))
+	data, err = os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.NotEqual(t, written, data)
+
+	// changed records are written at once
+	written = data
+	now = start.Add(51 * time.Minute)
+	assert.NoError(t, s.Set(ctx, "key", Record{State: "cart"}, time.Hour))
+	data, err = os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.NotEqual(t, written, data)
+}
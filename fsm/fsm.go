@@ -0,0 +1,162 @@
+package fsm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kbgod/lumex/router"
+)
+
+// sessionKey is the key of the session in router.Context values.
+const sessionKey = "fsm.session"
+
+type Option func(*config)
+
+type config struct {
+	key KeyStrategy
+	ttl time.Duration
+}
+
+// WithKeyStrategy sets how updates are mapped to storage keys, UserInChatKey by default.
+func WithKeyStrategy(key KeyStrategy) Option {
+	return func(cfg *config) {
+		cfg.key = key
+	}
+}
+
+// WithTTL sets how long the state lives after the last handled update of its key, states never expire by default.
+// Middleware saves the state after every update of the key to refresh its TTL, even when it is not changed,
+// File writes such refreshes to disk only once half of the TTL has passed, see File.
+func WithTTL(ttl time.Duration) Option {
+	return func(cfg *config) {
+		cfg.ttl = ttl
+	}
+}
+
+// Middleware
+//
+// loads the state of the update from the storage before routing, so Router.UseState routes match it,
+// and saves the state and data after the handler if they were changed, or to refresh them if WithTTL is used.
+// Handlers change the state with router.Context SetState and ClearState and the data with Session.
+// Concurrent updates of the same key are not serialized, the last saved change wins.
+func Middleware(storage Storage, opts ...Option) router.Handler {
+	cfg := config{key: UserInChatKey}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return func(ctx *router.Context) error {
+		key, ok := cfg.key(ctx)
+		if !ok {
+			return ctx.Next()
+		}
+
+		record, err := storage.Get(ctx.Context(), key)
+		if err != nil {
+			return fmt.Errorf("failed to load state: %w", err)
+		}
+
+		session := &Session{key: key}
+		if record != nil {
+			session.record = *record
+			if record.State != "" {
+				ctx.SetState(record.State)
+			}
+		}
+		ctx.Set(sessionKey, session)
+
+		err = ctx.Next()
+
+		var state string
+		if s := ctx.GetState(); s != nil {
+			state = *s
+		}
+
+		// without changes the stored record is saved again only to refresh its TTL
+		refresh := cfg.ttl > 0 && record != nil
+		if state == session.record.State && !session.dirty && !refresh {
+			return err
+		}
+		session.record.State = state
+
+		var saveErr error
+		if session.record.empty() {
+			saveErr = storage.Delete(ctx.Context(), key)
+		} else {
+			saveErr = storage.Set(ctx.Context(), key, session.record, cfg.ttl)
+		}
+		if saveErr != nil {
+			saveErr = fmt.Errorf("failed to save state: %w", saveErr)
+		}
+
+		return errors.Join(err, saveErr)
+	}
+}
+
+// Session is the state data of the update loaded by Middleware.
+// It belongs to a single update, so it must not be used after the handler returns.
+type Session struct {
+	key    string
+	record Record
+	dirty  bool
+}
+
+// FromContext returns the session loaded by Middleware, nil if the middleware is not used or the update has no key.
+func FromContext(ctx *router.Context) *Session {
+	session, _ := router.Value[*Session](ctx, sessionKey)
+
+	return session
+}
+
+// Key returns the storage key of the session.
+func (s *Session) Key() string {
+	return s.key
+}
+
+// Set stores the value in the state data as JSON.
+func (s *Session) Set(key string, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode state data %q: %w", key, err)
+	}
+
+	if s.record.Data == nil {
+		s.record.Data = make(map[string]json.RawMessage)
+	}
+	s.record.Data[key] = data
+	s.dirty = true
+
+	return nil
+}
+
+// Get decodes the value of the state data into dst and reports whether the key exists.
+func (s *Session) Get(key string, dst any) (bool, error) {
+	data, ok := s.record.Data[key]
+	if !ok {
+		return false, nil
+	}
+
+	if err := json.Unmarshal(data, dst); err != nil {
+		return true, fmt.Errorf("failed to decode state data %q: %w", key, err)
+	}
+
+	return true, nil
+}
+
+// Delete removes the value from the state data.
+func (s *Session) Delete(key string) {
+	if _, ok := s.record.Data[key]; ok {
+		delete(s.record.Data, key)
+		s.dirty = true
+	}
+}
+
+// Reset removes all state data, the state itself is cleared with router.Context ClearState.
+func (s *Session) Reset() {
+	if len(s.record.Data) > 0 {
+		s.record.Data = nil
+		s.dirty = true
+	}
+}
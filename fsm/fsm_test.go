@@ -0,0 +1,210 @@
+package fsm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kbgod/lumex"
+	"github.com/kbgod/lumex/router"
+	"github.com/stretchr/testify/assert"
+)
+
+func message(chatID, userID int64, text string) *lumex.Update {
+	return &lumex.Update{Message: &lumex.Message{
+		Text: text,
+		Chat: lumex.Chat{Id: chatID},
+		From: &lumex.User{Id: userID},
+	}}
+}
+
+func TestKeyStrategies(t *testing.T) {
+	topic := message(-100, 2, "")
+	topic.Message.IsTopicMessage = true
+	topic.Message.MessageThreadId = 7
+
+	cases := []struct {
+		name   string
+		key    KeyStrategy
+		update *lumex.Update
+		want   string
+		ok     bool
+	}{
+		{"UserKey", UserKey, message(-100, 2, ""), "user:2", true},
+		{"ChatKey", ChatKey, message(-100, 2, ""), "chat:-100", true},
+		{"UserInChatKey", UserInChatKey, message(-100, 2, ""), "chat:-100:user:2", true},
+		{"UserInTopicKey", UserInTopicKey, topic, "chat:-100:user:2:topic:7", true},
+		{"UserInTopicKey outside topic", UserInTopicKey, message(-100, 2, ""), "chat:-100:user:2:topic:0", true},
+		{"UserKey callback", UserKey, &lumex.Update{CallbackQuery: &lumex.CallbackQuery{From: lumex.User{Id: 3}}}, "user:3", true},
+		{"UserKey without sender", UserKey, &lumex.Update{ChannelPost: &lumex.Message{Chat: lumex.Chat{Id: 1}}}, "", false},
+		{"ChatKey without chat", ChatKey, &lumex.Update{InlineQuery: &lumex.InlineQuery{From: lumex.User{Id: 3}}}, "", false},
+		{"UserInChatKey without sender", UserInChatKey, &lumex.Update{ChannelPost: &lumex.Message{Chat: lumex.Chat{Id: 1}}}, "", false},
+		{"UserInTopicKey without sender", UserInTopicKey, &lumex.Update{ChannelPost: &lumex.Message{Chat: lumex.Chat{Id: 1}}}, "", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var (
+				key string
+				ok  bool
+			)
+			r := router.New(nil)
+			r.OnUpdate(func(ctx *router.Context) error {
+				key, ok = tc.key(ctx)
+
+				return nil
+			})
+
+			assert.NoError(t, r.HandleUpdate(context.Background(), tc.update))
+			assert.Equal(t, tc.want, key)
+			assert.Equal(t, tc.ok, ok)
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemory()
+
+	r := router.New(nil)
+	r.Use(Middleware(storage, WithKeyStrategy(UserKey), WithTTL(time.Hour)))
+
+	r.OnCommand("order", func(ctx *router.Context) error {
+		ctx.SetState("order:item")
+
+		return nil
+	})
+
+	orderItem := r.UseState("order:item")
+	orderItem.OnMessage(func(ctx *router.Context) error {
+		if err := FromContext(ctx).Set("item", ctx.Message().Text); err != nil {
+			return err
+		}
+		ctx.SetState("order:count")
+
+		return nil
+	})
+
+	var (
+		item  string
+		count string
+	)
+	orderCount := r.UseState("order:count")
+	orderCount.OnMessage(func(ctx *router.Context) error {
+		session := FromContext(ctx)
+		if _, err := session.Get("item", &item); err != nil {
+			return err
+		}
+		count = ctx.Message().Text
+		session.Reset()
+		ctx.ClearState()
+
+		return nil
+	})
+
+	r.OnMessage(func(ctx *router.Context) error {
+		return nil
+	})
+
+	command := message(1, 2, "/order")
+	command.Message.Entities = []lumex.MessageEntity{{Type: "bot_command", Length: 6}}
+
+	assert.NoError(t, r.HandleUpdate(ctx, command))
+	record, _ := storage.Get(ctx, "user:2")
+	assert.Equal(t, "order:item", record.State)
+
+	assert.NoError(t, r.HandleUpdate(ctx, message(1, 2, "book")))
+	record, _ = storage.Get(ctx, "user:2")
+	assert.Equal(t, "order:count", record.State)
+
+	// other users have own states
+	assert.NoError(t, r.HandleUpdate(ctx, message(1, 3, "hello")))
+	record, _ = storage.Get(ctx, "user:3")
+	assert.Nil(t, record, "unchanged state is saved")
+
+	assert.NoError(t, r.HandleUpdate(ctx, message(1, 2, "3")))
+	assert.Equal(t, "book", item)
+	assert.Equal(t, "3", count)
+	record, _ = storage.Get(ctx, "user:2")
+	assert.Nil(t, record, "cleared state is not deleted")
+	assert.Equal(t, 0, storage.Len())
+}
+
+func TestMiddleware_RefreshesTTL(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	storage := NewMemory()
+	storage.now = func() time.Time { return now }
+
+	r := router.New(nil)
+	r.Use(Middleware(storage, WithTTL(time.Hour)))
+	r.OnMessage(func(ctx *router.Context) error {
+		if ctx.Message().Text == "start" {
+			ctx.SetState("waiting")
+		}
+
+		return nil
+	})
+
+	assert.NoError(t, r.HandleUpdate(ctx, message(1, 2, "start")))
+
+	// an update which doesn't change the state keeps it alive
+	now = now.Add(50 * time.Minute)
+	assert.NoError(t, r.HandleUpdate(ctx, message(1, 2, "hello")))
+	now = now.Add(50 * time.Minute)
+	record, _ := storage.Get(ctx, "chat:1:user:2")
+	if assert.NotNil(t, record) {
+		assert.Equal(t, "waiting", record.State)
+	}
+
+	now = now.Add(2 * time.Hour)
+	record, _ = storage.Get(ctx, "chat:1:user:2")
+	assert.Nil(t, record)
+}
+
+type failingStorage struct {
+	Storage
+	getErr, setErr error
+}
+
+func (s failingStorage) Get(ctx context.Context, key string) (*Record, error) {
+	if s.getErr != nil {
+		return nil, s.getErr
+	}
+
+	return s.Storage.Get(ctx, key)
+}
+
+func (s failingStorage) Set(_ context.Context, _ string, _ Record, _ time.Duration) error {
+	return s.setErr
+}
+
+func TestMiddleware_Errors(t *testing.T) {
+	storageErr := errors.New("storage error")
+	handlerErr := errors.New("handler error")
+
+	newRouter := func(storage Storage) *router.Router {
+		r := router.New(nil)
+		r.Use(Middleware(storage))
+		r.OnMessage(func(ctx *router.Context) error {
+			ctx.SetState("next")
+
+			return handlerErr
+		})
+
+		return r
+	}
+
+	err := newRouter(failingStorage{Storage: NewMemory(), getErr: storageErr}).HandleUpdate(context.Background(), message(1, 2, "a"))
+	assert.ErrorIs(t, err, storageErr)
+	assert.NotErrorIs(t, err, handlerErr)
+
+	err = newRouter(failingStorage{Storage: NewMemory(), setErr: storageErr}).HandleUpdate(context.Background(), message(1, 2, "a"))
+	assert.ErrorIs(t, err, storageErr)
+	assert.ErrorIs(t, err, handlerErr)
+
+	// updates without key are passed through
+	r := newRouter(failingStorage{getErr: storageErr})
+	assert.ErrorIs(t, r.HandleUpdate(context.Background(), &lumex.Update{ChannelPost: &lumex.Message{}}), router.ErrRouteNotFound)
+}
@@ -0,0 +1,56 @@
+package fsm
+
+import (
+	"strconv"
+
+	"github.com/kbgod/lumex/router"
+)
+
+// KeyStrategy returns the storage key of the update and reports false if the update has no state,
+// like channel posts without a sender.
+type KeyStrategy func(ctx *router.Context) (string, bool)
+
+// UserKey shares the state of the user between all chats.
+func UserKey(ctx *router.Context) (string, bool) {
+	sender := ctx.Sender()
+	if sender == nil {
+		return "", false
+	}
+
+	return "user:" + strconv.FormatInt(sender.Id, 10), true
+}
+
+// ChatKey shares the state of the chat between all its members.
+func ChatKey(ctx *router.Context) (string, bool) {
+	chat := ctx.Chat()
+	if chat == nil {
+		return "", false
+	}
+
+	return "chat:" + strconv.FormatInt(chat.Id, 10), true
+}
+
+// UserInChatKey keeps a separate state of the user in every chat.
+func UserInChatKey(ctx *router.Context) (string, bool) {
+	chat, sender := ctx.Chat(), ctx.Sender()
+	if chat == nil || sender == nil {
+		return "", false
+	}
+
+	return "chat:" + strconv.FormatInt(chat.Id, 10) + ":user:" + strconv.FormatInt(sender.Id, 10), true
+}
+
+// UserInTopicKey keeps a separate state of the user in every forum topic, messages outside topics share the chat state.
+func UserInTopicKey(ctx *router.Context) (string, bool) {
+	key, ok := UserInChatKey(ctx)
+	if !ok {
+		return "", false
+	}
+
+	var topic int64
+	if m := ctx.Message(); m != nil && m.IsTopicMessage {
+		topic = m.MessageThreadId
+	}
+
+	return key + ":topic:" + strconv.FormatInt(topic, 10), true
+}
@@ -0,0 +1,101 @@
+package fsm
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+var _ Storage = (*Memory)(nil)
+
+// memorySweepInterval is how often Set removes expired records which are never read.
+const memorySweepInterval = time.Minute
+
+type memoryRecord struct {
+	record    Record
+	expiresAt time.Time
+}
+
+// Memory is an in-process Storage implementation, states are lost when the process exits.
+type Memory struct {
+	mu        sync.RWMutex
+	records   map[string]memoryRecord
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemory creates an in-memory storage.
+func NewMemory() *Memory {
+	return &Memory{
+		records: make(map[string]memoryRecord),
+		now:     time.Now,
+	}
+}
+
+func (s *Memory) Get(_ context.Context, key string) (*Record, error) {
+	s.mu.RLock()
+	item, ok := s.records[key]
+	s.mu.RUnlock()
+
+	if !ok {
+		return nil, nil
+	}
+
+	if expired(s.now(), item.expiresAt) {
+		s.mu.Lock()
+		// the record could be saved again while the lock was released
+		if current, ok := s.records[key]; ok && expired(s.now(), current.expiresAt) {
+			delete(s.records, key)
+		}
+		s.mu.Unlock()
+
+		return nil, nil
+	}
+
+	record := item.record.clone()
+
+	return &record, nil
+}
+
+func (s *Memory) Set(_ context.Context, key string, record Record, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+	s.records[key] = memoryRecord{record: record.clone(), expiresAt: expiresAt(now, ttl)}
+
+	return nil
+}
+
+func (s *Memory) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, key)
+
+	return nil
+}
+
+// Len returns the number of records including expired ones which are not removed yet.
+func (s *Memory) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.records)
+}
+
+// sweep removes expired records at most once per memorySweepInterval, so Set stays cheap.
+// The caller must hold the lock.
+func (s *Memory) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < memorySweepInterval {
+		return
+	}
+	s.lastSweep = now
+
+	for key, item := range s.records {
+		if expired(now, item.expiresAt) {
+			delete(s.records, key)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package fsm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemory()
+	now := time.Now()
+	s.now = func() time.Time {
+		return now
+	}
+
+	record, err := s.Get(ctx, "user:1")
+	assert.NoError(t, err)
+	assert.Nil(t, record)
+
+	saved := Record{State: "checkout", Data: map[string]json.RawMessage{"item": json.RawMessage(`"book"`)}}
+	assert.NoError(t, s.Set(ctx, "user:1", saved, time.Minute))
+	assert.NoError(t, s.Set(ctx, "user:2", Record{State: "menu"}, 0))
+
+	record, err = s.Get(ctx, "user:1")
+	assert.NoError(t, err)
+	assert.Equal(t, saved, *record)
+
+	// the returned record doesn't share data with the storage
+	record.Data["item"] = json.RawMessage(`"pen"`)
+	record, _ = s.Get(ctx, "user:1")
+	assert.Equal(t, json.RawMessage(`"book"`), record.Data["item"])
+
+	now = now.Add(2 * time.Minute)
+	record, err = s.Get(ctx, "user:1")
+	assert.NoError(t, err)
+	assert.Nil(t, record, "expired record returned")
+	assert.Equal(t, 1, s.Len())
+
+	record, _ = s.Get(ctx, "user:2")
+	assert.Equal(t, "menu", record.State, "record without ttl expired")
+
+	assert.NoError(t, s.Delete(ctx, "user:2"))
+	assert.NoError(t, s.Delete(ctx, "user:2"))
+	assert.Equal(t, 0, s.Len())
+}
+
+func TestMemory_sweep(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemory()
+	now := time.Now()
+	s.now = func() time.Time {
+		return now
+	}
+
+	assert.NoError(t, s.Set(ctx, "user:1", Record{State: "menu"}, time.Minute))
+	assert.NoError(t, s.Set(ctx, "user:2", Record{State: "menu"}, 0))
+
+	now = now.Add(30 * time.Second)
+	assert.NoError(t, s.Set(ctx, "user:3", Record{State: "menu"}, time.Second))
+	assert.Equal(t, 3, s.Len(), "records are swept at most once per interval")
+
+	// the expired records are never read, but removed by the next sweep
+	now = now.Add(2 * time.Minute)
+	assert.NoError(t, s.Set(ctx, "user:4", Record{State: "menu"}, time.Minute))
+	assert.Equal(t, 2, s.Len())
+
+	record, _ := s.Get(ctx, "user:2")
+	assert.NotNil(t, record, "record without ttl swept")
+}
+
+func TestMemory_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemory()
+
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			key := fmt.Sprintf("user:%d", i%3)
+			for range 100 {
+				assert.NoError(t, s.Set(ctx, key, Record{State: "a", Data: map[string]json.RawMessage{"i": json.RawMessage("1")}}, time.Minute))
+				_, err := s.Get(ctx, key)
+				assert.NoError(t, err)
+				assert.NoError(t, s.Delete(ctx, key))
+			}
+		}()
+	}
+	wg.Wait()
+}
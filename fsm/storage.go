@@ -0,0 +1,60 @@
+package fsm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"maps"
+	"time"
+)
+
+// Record is the state of a key with its data.
+type Record struct {
+	State string `json:"state,omitempty"`
+	// Data holds values of the state, like answers of the previous steps. Values are JSON, so every Storage keeps them the same way.
+	Data map[string]json.RawMessage `json:"data,omitempty"`
+}
+
+// clone returns a copy of the record which doesn't share Data with the original.
+func (r Record) clone() Record {
+	r.Data = maps.Clone(r.Data)
+
+	return r
+}
+
+// equal reports whether both records have the same state and data.
+func (r Record) equal(other Record) bool {
+	return r.State == other.State && maps.EqualFunc(r.Data, other.Data, func(a, b json.RawMessage) bool {
+		return bytes.Equal(a, b)
+	})
+}
+
+func (r Record) empty() bool {
+	return r.State == "" && len(r.Data) == 0
+}
+
+// Storage
+//
+// persists records of state machines by keys, see KeyStrategy.
+// Implementations must be safe for concurrent use.
+type Storage interface {
+	// Get returns the record by the key, nil if it doesn't exist or expired.
+	Get(ctx context.Context, key string) (*Record, error)
+	// Set saves the record, it expires after ttl or never if ttl is zero.
+	Set(ctx context.Context, key string, record Record, ttl time.Duration) error
+	// Delete removes the record, it is not an error if the record doesn't exist.
+	Delete(ctx context.Context, key string) error
+}
+
+// expiresAt returns the expiration time for ttl, zero time means the record never expires.
+func expiresAt(now time.Time, ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+
+	return now.Add(ttl)
+}
+
+func expired(now, expiresAt time.Time) bool {
+	return !expiresAt.IsZero() && now.After(expiresAt)
+}
@@ -1,9 +1,19 @@
 package lumex
 
+import "context"
+
 type IMenu interface {
 	Unwrap() ReplyMarkup
 }
 
+// CallbackStore
+//
+// saves callback payloads which don't fit in 64 bytes of callback data, see package callbackstore.
+type CallbackStore interface {
+	// Save stores the payload and returns a short key which is sent as callback data.
+	Save(ctx context.Context, payload string) (string, error)
+}
+
 type Menu struct {
 	ReplyKeyboardMarkup
 	rowIndex int
@@ -204,6 +214,8 @@ func (m *Menu) RequestUserBtn(text string, req *KeyboardButtonRequestUsers, styl
 type InlineMenu struct {
 	InlineKeyboardMarkup
 	rowIndex int
+	// err is the first error of StoredCallbackBtn, see Err.
+	err error
 }
 
 func NewInlineMenu() *InlineMenu {
@@ -259,6 +271,36 @@ func (m *InlineMenu) CallbackBtn(text, data string, style ...string) *InlineMenu
 	return m
 }
 
+// StoredCallbackBtn
+//
+// adds a callback button which payload is saved in the store and only its key is sent as callback data.
+// The payload is loaded back by middleware.CallbackPayloadMiddleware.
+// If the store fails, the button is not added and the error is returned by Err, so the chain isn't broken.
+// Example:
+// menu := lumex.NewInlineMenu().StoredCallbackBtn(ctx, store, "Search", "search/"+query).CallbackBtn("Back", "back")
+// err := menu.Err()
+func (m *InlineMenu) StoredCallbackBtn(
+	ctx context.Context, store CallbackStore, text, payload string, style ...string,
+) *InlineMenu {
+	if m.err != nil {
+		return m
+	}
+
+	key, err := store.Save(ctx, payload)
+	if err != nil {
+		m.err = err
+
+		return m
+	}
+
+	return m.CallbackBtn(text, key, style...)
+}
+
+// Err returns the first error of StoredCallbackBtn, the menu must not be sent if it is not nil.
+func (m *InlineMenu) Err() error {
+	return m.err
+}
+
 func (m *InlineMenu) URLBtn(text, url string, style ...string) *InlineMenu {
 	m.InlineKeyboard[m.rowIndex] = append(m.InlineKeyboard[m.rowIndex], InlineKeyboardButton{
 		Text:  text,
@@ -364,6 +406,22 @@ func CallbackBtn(text, data string) InlineKeyboardButton {
 	}
 }
 
+// StoredCallbackBtn
+//
+// returns a callback button which payload is saved in the store and only its key is sent as callback data,
+// add it with InlineMenu.Btn or InlineMenu.Row, or use InlineMenu.StoredCallbackBtn. The payload is loaded back by middleware.CallbackPayloadMiddleware.
+// Example:
+// btn, err := lumex.StoredCallbackBtn(ctx, store, "Search", "search/"+query)
+// menu.Btn(btn)
+func StoredCallbackBtn(ctx context.Context, store CallbackStore, text, payload string) (InlineKeyboardButton, error) {
+	key, err := store.Save(ctx, payload)
+	if err != nil {
+		return InlineKeyboardButton{}, err
+	}
+
+	return CallbackBtn(text, key), nil
+}
+
 func NewForceReply() *ForceReply {
 	return &ForceReply{
 		ForceReply: true,
@@ -1,6 +1,8 @@
 package lumex
 
 import (
+	"context"
+	"errors"
 	"testing"
 )
 
@@ -338,6 +340,12 @@ func TestInlineMenu_CallbackBtn(t *testing.T) {
 	}
 }
 
+type callbackStoreFunc func(ctx context.Context, payload string) (string, error)
+
+func (f callbackStoreFunc) Save(ctx context.Context, payload string) (string, error) {
+	return f(ctx, payload)
+}
+
 func TestInlineMenu_URLBtn(t *testing.T) {
 	menu := NewInlineMenu()
 	menu.URLBtn("test", "test")
@@ -466,3 +474,63 @@ func TestCallbackBtn(t *testing.T) {
 		t.Error("CallbackBtn failed")
 	}
 }
+
+func TestStoredCallbackBtn(t *testing.T) {
+	var saved string
+	store := callbackStoreFunc(func(ctx context.Context, payload string) (string, error) {
+		saved = payload
+
+		return "~key", nil
+	})
+
+	btn, err := StoredCallbackBtn(context.Background(), store, "test", "long payload")
+	if err != nil {
+		t.Errorf("StoredCallbackBtn() = %v; want <nil>", err)
+	}
+	if saved != "long payload" {
+		t.Error("StoredCallbackBtn failed")
+	}
+	if btn.Text != "test" || btn.CallbackData != "~key" {
+		t.Error("StoredCallbackBtn failed")
+	}
+
+	storeErr := errors.New("store error")
+	_, err = StoredCallbackBtn(context.Background(), callbackStoreFunc(
+		func(ctx context.Context, payload string) (string, error) {
+			return "", storeErr
+		},
+	), "test", "payload")
+	if !errors.Is(err, storeErr) {
+		t.Errorf("StoredCallbackBtn() = %v; want %v", err, storeErr)
+	}
+}
+
+func TestInlineMenu_StoredCallbackBtn(t *testing.T) {
+	store := callbackStoreFunc(func(ctx context.Context, payload string) (string, error) {
+		return "~" + payload, nil
+	})
+
+	menu := NewInlineMenu().StoredCallbackBtn(context.Background(), store, "test", "key", "primary").CallbackBtn("back", "back")
+	if menu.Err() != nil {
+		t.Errorf("Err() = %v; want <nil>", menu.Err())
+	}
+	row := menu.InlineKeyboard[0]
+	if len(row) != 2 || row[0].Text != "test" || row[0].CallbackData != "~key" || row[0].Style != "primary" {
+		t.Error("StoredCallbackBtn failed")
+	}
+
+	storeErr := errors.New("store error")
+	failing := callbackStoreFunc(func(ctx context.Context, payload string) (string, error) {
+		return "", storeErr
+	})
+	menu = NewInlineMenu().
+		StoredCallbackBtn(context.Background(), failing, "first", "payload").
+		StoredCallbackBtn(context.Background(), store, "second", "key").
+		CallbackBtn("back", "back")
+	if !errors.Is(menu.Err(), storeErr) {
+		t.Errorf("Err() = %v; want %v", menu.Err(), storeErr)
+	}
+	if len(menu.InlineKeyboard[0]) != 1 || menu.InlineKeyboard[0][0].Text != "back" {
+		t.Error("StoredCallbackBtn added a button after the store error")
+	}
+}
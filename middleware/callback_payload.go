@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/kbgod/lumex/callbackstore"
+	"github.com/kbgod/lumex/router"
+)
+
+const (
+	// DefaultCallbackExpiredText is the answer to callback queries with expired payloads.
+	DefaultCallbackExpiredText = "This button has expired"
+
+	// CallbackPayloadKey is the key of the payload stored in the context by CallbackPayloadMiddleware.
+	CallbackPayloadKey = "lumex.callback_payload"
+)
+
+// CallbackPayloadMiddleware loads payloads of buttons created with lumex.StoredCallbackBtn:
+// the payload of the key in callback data is stored in the context, see CallbackPayload and CallbackPayloadPrefix,
+// and the callback query is left as Telegram sent it.
+// Unknown and expired keys are passed to the expired handler instead of routes,
+// if it is nil, the callback query is answered with DefaultCallbackExpiredText.
+func CallbackPayloadMiddleware(store callbackstore.Store, expired router.Handler) router.Handler {
+	if expired == nil {
+		expired = func(ctx *router.Context) error {
+			return ctx.AnswerVoid(DefaultCallbackExpiredText)
+		}
+	}
+
+	return func(ctx *router.Context) error {
+		query := ctx.Update.CallbackQuery
+		if query == nil || !callbackstore.IsKey(query.Data) {
+			return ctx.Next()
+		}
+
+		payload, err := store.Load(ctx.Context(), query.Data)
+		if errors.Is(err, callbackstore.ErrNotFound) {
+			return expired(ctx)
+		}
+		if err != nil {
+			return err
+		}
+
+		ctx.Set(CallbackPayloadKey, payload)
+
+		return ctx.Next()
+	}
+}
+
+// CallbackPayload returns the payload loaded by CallbackPayloadMiddleware and reports whether it exists.
+func CallbackPayload(ctx *router.Context) (string, bool) {
+	return router.Value[string](ctx, CallbackPayloadKey)
+}
+
+// CallbackPayloadPrefix returns a filter that checks if the payload loaded by CallbackPayloadMiddleware
+// starts with the given text. Declare the type of the route with Route.UpdateTypes, so it is checked
+// only for callback queries.
+func CallbackPayloadPrefix(text string) router.RouteFilter {
+	return func(ctx *router.Context) bool {
+		payload, ok := CallbackPayload(ctx)
+
+		return ok && strings.HasPrefix(payload, text)
+	}
+}
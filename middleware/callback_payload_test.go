@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kbgod/lumex"
+	"github.com/kbgod/lumex/callbackstore"
+	"github.com/kbgod/lumex/router"
+	"github.com/stretchr/testify/assert"
+)
+
+type failingStore struct {
+	callbackstore.Store
+	err error
+}
+
+func (s failingStore) Load(_ context.Context, _ string) (string, error) {
+	return "", s.err
+}
+
+func TestCallbackPayloadMiddleware(t *testing.T) {
+	ctx := context.Background()
+	store := callbackstore.NewMemory(time.Minute)
+
+	var (
+		got     string
+		data    string
+		expired bool
+	)
+	newRouter := func(store callbackstore.Store, expiredHandler router.Handler) *router.Router {
+		r := router.New(nil)
+		r.Use(CallbackPayloadMiddleware(store, expiredHandler))
+		r.On(CallbackPayloadPrefix("search/"), func(ctx *router.Context) error {
+			payload, _ := CallbackPayload(ctx)
+			got, data = strings.TrimPrefix(payload, "search/"), ctx.CallbackData()
+
+			return nil
+		})
+		r.OnCallbackPrefix("search/", func(ctx *router.Context) error {
+			got, data = "plain", ctx.CallbackData()
+
+			return nil
+		})
+
+		return r
+	}
+	onExpired := func(ctx *router.Context) error {
+		expired = true
+
+		return nil
+	}
+	callback := func(data string) *lumex.Update {
+		return &lumex.Update{CallbackQuery: &lumex.CallbackQuery{Data: data}}
+	}
+
+	r := newRouter(store, onExpired)
+
+	key, err := store.Save(ctx, "search/red shoes with a very long description which doesn't fit in callback data")
+	assert.NoError(t, err)
+
+	assert.NoError(t, r.HandleUpdate(ctx, callback(key)))
+	assert.Equal(t, "red shoes with a very long description which doesn't fit in callback data", got)
+	// callback data is left as Telegram sent it
+	assert.Equal(t, key, data)
+
+	assert.NoError(t, r.HandleUpdate(ctx, callback("search/plain")))
+	assert.Equal(t, "plain", got)
+	assert.Equal(t, "search/plain", data)
+
+	missing, err := callbackstore.NewKey()
+	assert.NoError(t, err)
+	assert.NoError(t, r.HandleUpdate(ctx, callback(missing)))
+	assert.True(t, expired, "expired handler not called")
+
+	storeErr := errors.New("store error")
+	r = newRouter(failingStore{err: storeErr}, onExpired)
+	assert.ErrorIs(t, r.HandleUpdate(ctx, callback(missing)), storeErr)
+}
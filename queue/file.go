@@ -0,0 +1,396 @@
+package queue
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kbgod/lumex"
+)
+
+const (
+	fileQueuePending    = "pending"
+	fileQueueProcessing = "processing"
+	fileQueueTmp        = "tmp"
+	fileQueueDead       = "dead"
+
+	// DefaultFilePollInterval is the default interval of checking the directory for new updates.
+	DefaultFilePollInterval = 100 * time.Millisecond
+)
+
+var _ DeadLetterQueue = (*File)(nil)
+
+type fileMessage struct {
+	Update  lumex.Update `json:"update"`
+	Attempt int          `json:"attempt"`
+}
+
+// File is a Queue implementation which stores every update in a separate file.
+// Several processes may share the same directory: a message is claimed by an atomic rename,
+// so it is delivered to a single consumer at a time.
+// Messages which ran out of attempts and messages which can't be decoded are moved to the "dead" subdirectory,
+// the former are dead letters, see DeadLetterQueue.
+type File struct {
+	dir          string
+	pollInterval time.Duration
+	maxAttempts  int
+	backoff      time.Duration
+	deadLetter   DeadLetterHandler
+}
+
+type FileOption func(*File)
+
+// WithFilePollInterval
+//
+// is an option for the file queue that sets how often Consume checks the directory for new updates.
+func WithFilePollInterval(interval time.Duration) FileOption {
+	return func(q *File) {
+		q.pollInterval = interval
+	}
+}
+
+// WithFileMaxAttempts
+//
+// is an option for the file queue that limits the number of delivery attempts of an update.
+// An update nacked on the last attempt is kept as a dead letter in the "dead" subdirectory instead of being redelivered.
+// DefaultMaxAttempts is used by default, zero means no limit.
+func WithFileMaxAttempts(attempts int) FileOption {
+	return func(q *File) {
+		q.maxAttempts = attempts
+	}
+}
+
+// WithFileRetryBackoff
+//
+// is an option for the file queue that sets the delay before the second attempt of a nacked update,
+// it doubles with every next attempt up to MaxRetryBackoff. DefaultRetryBackoff is used by default,
+// zero redelivers updates immediately.
+func WithFileRetryBackoff(backoff time.Duration) FileOption {
+	return func(q *File) {
+		q.backoff = backoff
+	}
+}
+
+// WithFileDeadLetter
+//
+// is an option for the file queue that sets the handler called when an update runs out of attempts,
+// see WithFileMaxAttempts. The update is kept as a dead letter either way.
+func WithFileDeadLetter(handler DeadLetterHandler) FileOption {
+	return func(q *File) {
+		q.deadLetter = handler
+	}
+}
+
+// NewFile creates a file-backed queue in dir, creating the directory if needed.
+func NewFile(dir string, opts ...FileOption) (*File, error) {
+	q := &File{
+		dir:          dir,
+		pollInterval: DefaultFilePollInterval,
+		maxAttempts:  DefaultMaxAttempts,
+		backoff:      DefaultRetryBackoff,
+	}
+
+	for _, opt := range opts {
+		opt(q)
+	}
+
+	for _, sub := range []string{fileQueuePending, fileQueueProcessing, fileQueueTmp, fileQueueDead} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create queue directory: %w", err)
+		}
+	}
+
+	return q, nil
+}
+
+func (q *File) Publish(_ context.Context, update lumex.Update) error {
+	name, err := messageName(time.Now(), update.UpdateId)
+	if err != nil {
+		return err
+	}
+
+	return q.write(fileMessage{Update: update, Attempt: 1}, name, fileQueuePending)
+}
+
+// messageName returns the name of the message which is delivered after readyAt.
+// Names are ordered by the time, so the oldest update is consumed first and retries wait for their backoff.
+func messageName(readyAt time.Time, updateID int64) (string, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", fmt.Errorf("failed to generate message name: %w", err)
+	}
+
+	return fmt.Sprintf("%020d-%d-%s.json", readyAt.UnixNano(), updateID, hex.EncodeToString(suffix)), nil
+}
+
+// readyAt returns the time after which the message is delivered, zero for names of unknown format.
+func readyAt(name string) time.Time {
+	prefix, _, _ := strings.Cut(name, "-")
+	nanos, err := strconv.ParseInt(prefix, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return time.Unix(0, nanos)
+}
+
+func (q *File) Consume(ctx context.Context) (*Delivery, error) {
+	for {
+		delivery, err := q.claim()
+		if err != nil || delivery != nil {
+			return delivery, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(q.pollInterval):
+		}
+	}
+}
+
+// Len returns the number of updates waiting in the queue.
+func (q *File) Len() int {
+	names, _ := q.list(fileQueuePending)
+
+	return len(names)
+}
+
+// Recover returns updates which were claimed but not acknowledged back to the queue.
+// It should be called when no consumers are running, e.g. after a crash.
+func (q *File) Recover() error {
+	names, err := q.list(fileQueueProcessing)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if err := os.Rename(q.path(fileQueueProcessing, name), q.path(fileQueuePending, name)); err != nil {
+			return fmt.Errorf("failed to recover message %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// DeadLetters returns updates which ran out of attempts.
+// Messages which can't be decoded are skipped, they stay in the "dead" subdirectory.
+func (q *File) DeadLetters() ([]DeadLetter, error) {
+	names, err := q.list(fileQueueDead)
+	if err != nil {
+		return nil, err
+	}
+
+	letters := make([]DeadLetter, 0, len(names))
+	for _, name := range names {
+		msg, ok, err := q.readDead(name)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			letters = append(letters, DeadLetter{Update: msg.Update, Attempt: msg.Attempt})
+		}
+	}
+
+	return letters, nil
+}
+
+// RequeueDeadLetters returns dead letters to the queue with attempts starting over.
+// Messages which can't be decoded are skipped, they stay in the "dead" subdirectory.
+func (q *File) RequeueDeadLetters() (int, error) {
+	names, err := q.list(fileQueueDead)
+	if err != nil {
+		return 0, err
+	}
+
+	requeued := 0
+	for _, name := range names {
+		msg, ok, err := q.readDead(name)
+		if err != nil {
+			return requeued, err
+		}
+		if !ok {
+			continue
+		}
+
+		pending, err := messageName(time.Now(), msg.Update.UpdateId)
+		if err != nil {
+			return requeued, err
+		}
+
+		msg.Attempt = 1
+		if err := q.write(msg, pending, fileQueuePending); err != nil {
+			return requeued, err
+		}
+		if err := os.Remove(q.path(fileQueueDead, name)); err != nil {
+			return requeued, fmt.Errorf("failed to remove dead letter %s: %w", name, err)
+		}
+		requeued++
+	}
+
+	return requeued, nil
+}
+
+// PurgeDeadLetters removes all messages of the "dead" subdirectory, including ones which can't be decoded.
+func (q *File) PurgeDeadLetters() error {
+	names, err := q.list(fileQueueDead)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if err := os.Remove(q.path(fileQueueDead, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove dead letter %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// readDead reads the dead letter, it reports false for messages which can't be decoded or were already removed.
+func (q *File) readDead(name string) (fileMessage, bool, error) {
+	data, err := os.ReadFile(q.path(fileQueueDead, name))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fileMessage{}, false, nil
+		}
+
+		return fileMessage{}, false, fmt.Errorf("failed to read dead letter %s: %w", name, err)
+	}
+
+	var msg fileMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return fileMessage{}, false, nil
+	}
+
+	return msg, true, nil
+}
+
+func (q *File) claim() (*Delivery, error) {
+	names, err := q.list(fileQueuePending)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for _, name := range names {
+		if readyAt(name).After(now) {
+			// names are sorted, so the rest are nacked updates waiting for their backoff too
+			break
+		}
+
+		processing := q.path(fileQueueProcessing, name)
+		if err := os.Rename(q.path(fileQueuePending, name), processing); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				// claimed by another consumer
+				continue
+			}
+
+			return nil, fmt.Errorf("failed to claim message %s: %w", name, err)
+		}
+
+		data, err := os.ReadFile(processing)
+		if err != nil {
+			if renameErr := os.Rename(processing, q.path(fileQueuePending, name)); renameErr != nil {
+				err = errors.Join(err, renameErr)
+			}
+
+			return nil, fmt.Errorf("failed to read message %s: %w", name, err)
+		}
+
+		var msg fileMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			if renameErr := os.Rename(processing, q.path(fileQueueDead, name)); renameErr != nil {
+				err = errors.Join(err, renameErr)
+			}
+
+			return nil, fmt.Errorf("failed to decode message %s, it is moved to dead letters: %w", name, err)
+		}
+
+		return NewDelivery(msg.Update, msg.Attempt, func() error {
+			return os.Remove(processing)
+		}, func() error {
+			return q.requeue(msg, name)
+		}), nil
+	}
+
+	return nil, nil
+}
+
+// requeue returns the nacked message of the claimed file to pending messages after the backoff,
+// or moves it to dead letters if it ran out of attempts.
+func (q *File) requeue(msg fileMessage, name string) error {
+	processing := q.path(fileQueueProcessing, name)
+	if q.maxAttempts > 0 && msg.Attempt >= q.maxAttempts {
+		if err := os.Rename(processing, q.path(fileQueueDead, name)); err != nil {
+			return err
+		}
+
+		if q.deadLetter != nil {
+			q.deadLetter(msg.Update, msg.Attempt)
+		}
+
+		return nil
+	}
+
+	retry, err := messageName(time.Now().Add(retryDelay(q.backoff, msg.Attempt)), msg.Update.UpdateId)
+	if err != nil {
+		return err
+	}
+
+	msg.Attempt++
+	if err := q.write(msg, retry, fileQueuePending); err != nil {
+		return err
+	}
+
+	return os.Remove(processing)
+}
+
+// write stores the message through a temporary file, so readers never see partially written messages.
+func (q *File) write(msg fileMessage, name, sub string) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %w", err)
+	}
+
+	tmp := q.path(fileQueueTmp, name)
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+
+	if err := os.Rename(tmp, q.path(sub, name)); err != nil {
+		return fmt.Errorf("failed to store message: %w", err)
+	}
+
+	return nil
+}
+
+func (q *File) list(sub string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(q.dir, sub))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read queue directory: %w", err)
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+func (q *File) path(sub, name string) string {
+	return filepath.Join(q.dir, sub, name)
+}
@@ -0,0 +1,170 @@
+package queue
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kbgod/lumex"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFile(t *testing.T) {
+	t.Run("publish and consume in order", func(t *testing.T) {
+		q, err := NewFile(t.TempDir(), WithFilePollInterval(time.Millisecond))
+		assert.NoError(t, err)
+		ctx := context.Background()
+
+		for i := int64(1); i <= 3; i++ {
+			assert.NoError(t, q.Publish(ctx, lumex.Update{UpdateId: i, Message: &lumex.Message{Text: "test"}}))
+		}
+		assert.Equal(t, 3, q.Len())
+
+		for i := int64(1); i <= 3; i++ {
+			d, err := q.Consume(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, i, d.Update.UpdateId)
+			assert.Equal(t, "test", d.Update.Message.Text)
+			assert.NoError(t, d.Ack())
+		}
+		assert.Equal(t, 0, q.Len())
+	})
+
+	t.Run("nack redelivers update", func(t *testing.T) {
+		q, err := NewFile(t.TempDir(), WithFilePollInterval(time.Millisecond), WithFileRetryBackoff(0))
+		assert.NoError(t, err)
+		ctx := context.Background()
+
+		assert.NoError(t, q.Publish(ctx, lumex.Update{UpdateId: 1}))
+
+		d, err := q.Consume(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, q.Len())
+		assert.NoError(t, d.Nack())
+
+		d, err = q.Consume(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), d.Update.UpdateId)
+		assert.Equal(t, 2, d.Attempt)
+	})
+
+	t.Run("nacked update waits for backoff", func(t *testing.T) {
+		q, err := NewFile(t.TempDir(), WithFilePollInterval(time.Millisecond), WithFileRetryBackoff(50*time.Millisecond))
+		assert.NoError(t, err)
+		ctx := context.Background()
+
+		assert.NoError(t, q.Publish(ctx, lumex.Update{UpdateId: 1}))
+		d, err := q.Consume(ctx)
+		assert.NoError(t, err)
+		nackedAt := time.Now()
+		assert.NoError(t, d.Nack())
+		assert.Equal(t, 1, q.Len())
+
+		assert.NoError(t, q.Publish(ctx, lumex.Update{UpdateId: 2}))
+		d, err = q.Consume(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), d.Update.UpdateId)
+
+		d, err = q.Consume(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), d.Update.UpdateId)
+		assert.GreaterOrEqual(t, time.Since(nackedAt), 50*time.Millisecond)
+	})
+
+	t.Run("dead letters", func(t *testing.T) {
+		dir := t.TempDir()
+		q, err := NewFile(dir, WithFilePollInterval(time.Millisecond), WithFileMaxAttempts(2), WithFileRetryBackoff(0))
+		assert.NoError(t, err)
+		ctx := context.Background()
+
+		assert.NoError(t, q.Publish(ctx, lumex.Update{UpdateId: 1}))
+		for range 2 {
+			d, err := q.Consume(ctx)
+			assert.NoError(t, err)
+			assert.NoError(t, d.Nack())
+		}
+		assert.Equal(t, 0, q.Len())
+
+		// corrupt messages are moved to dead letters instead of staying claimed
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "pending", "00000000000000000001-2-corrupt.json"), []byte("{"), 0o644))
+		_, err = q.Consume(ctx)
+		assert.Error(t, err)
+
+		processing, err := os.ReadDir(filepath.Join(dir, "processing"))
+		assert.NoError(t, err)
+		assert.Empty(t, processing)
+		dead, err := os.ReadDir(filepath.Join(dir, "dead"))
+		assert.NoError(t, err)
+		assert.Len(t, dead, 2)
+	})
+
+	t.Run("recover unacknowledged updates", func(t *testing.T) {
+		dir := t.TempDir()
+		q, err := NewFile(dir, WithFilePollInterval(time.Millisecond))
+		assert.NoError(t, err)
+		ctx := context.Background()
+
+		assert.NoError(t, q.Publish(ctx, lumex.Update{UpdateId: 1}))
+		_, err = q.Consume(ctx)
+		assert.NoError(t, err)
+
+		// simulate a restarted process
+		q, err = NewFile(dir, WithFilePollInterval(time.Millisecond))
+		assert.NoError(t, err)
+		assert.Equal(t, 0, q.Len())
+		assert.NoError(t, q.Recover())
+		assert.Equal(t, 1, q.Len())
+	})
+
+	t.Run("every update is delivered to a single consumer", func(t *testing.T) {
+		dir := t.TempDir()
+		q, err := NewFile(dir, WithFilePollInterval(time.Millisecond))
+		assert.NoError(t, err)
+
+		const count = 50
+		for i := int64(1); i <= count; i++ {
+			assert.NoError(t, q.Publish(context.Background(), lumex.Update{UpdateId: i}))
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var (
+			mu   sync.Mutex
+			seen = make(map[int64]int)
+			wg   sync.WaitGroup
+		)
+		for range 4 {
+			consumer, err := NewFile(dir, WithFilePollInterval(time.Millisecond))
+			assert.NoError(t, err)
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					d, err := consumer.Consume(ctx)
+					if err != nil {
+						return
+					}
+					mu.Lock()
+					seen[d.Update.UpdateId]++
+					done := len(seen) == count
+					mu.Unlock()
+					assert.NoError(t, d.Ack())
+					if done {
+						cancel()
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Len(t, seen, count)
+		for id, n := range seen {
+			assert.Equal(t, 1, n, "update %d delivered %d times", id, n)
+		}
+	})
+}
@@ -0,0 +1,253 @@
+package queue
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/kbgod/lumex"
+)
+
+var _ DeadLetterQueue = (*Memory)(nil)
+
+type memoryItem struct {
+	update  lumex.Update
+	attempt int
+	// readyAt is the time after which the nacked update is redelivered.
+	readyAt time.Time
+}
+
+// Memory is an in-process Queue implementation.
+// It is useful when polling and processing live in the same process,
+// but the updates are lost when the process exits.
+// Updates which ran out of attempts are kept as dead letters, see DeadLetterQueue.
+type Memory struct {
+	items chan memoryItem
+
+	mu sync.Mutex
+	// retries are nacked updates in order of Nack, they are consumed before new updates once their backoff passes.
+	// Only consumed updates are nacked, so there are no more retries than unsettled deliveries.
+	retries []memoryItem
+	retried chan struct{}
+	dead    []DeadLetter
+
+	maxAttempts int
+	backoff     time.Duration
+	deadLetter  DeadLetterHandler
+}
+
+type MemoryOption func(*Memory)
+
+// WithMemoryMaxAttempts
+//
+// is an option for the in-memory queue that limits the number of delivery attempts of an update.
+// An update nacked on the last attempt is kept as a dead letter instead of being redelivered. DefaultMaxAttempts is used by default, zero means no limit.
+func WithMemoryMaxAttempts(attempts int) MemoryOption {
+	return func(q *Memory) {
+		q.maxAttempts = attempts
+	}
+}
+
+// WithMemoryRetryBackoff
+//
+// is an option for the in-memory queue that sets the delay before the second attempt of a nacked update,
+// it doubles with every next attempt up to MaxRetryBackoff. DefaultRetryBackoff is used by default,
+// zero redelivers updates immediately.
+func WithMemoryRetryBackoff(backoff time.Duration) MemoryOption {
+	return func(q *Memory) {
+		q.backoff = backoff
+	}
+}
+
+// WithMemoryDeadLetter
+//
+// is an option for the in-memory queue that sets the handler called when an update runs out of attempts,
+// see WithMemoryMaxAttempts. The update is kept as a dead letter either way.
+func WithMemoryDeadLetter(handler DeadLetterHandler) MemoryOption {
+	return func(q *Memory) {
+		q.deadLetter = handler
+	}
+}
+
+// NewMemory creates an in-memory queue which holds up to size updates.
+// Publish blocks while the queue is full.
+func NewMemory(size int, opts ...MemoryOption) *Memory {
+	q := &Memory{
+		items:       make(chan memoryItem, size),
+		retried:     make(chan struct{}, 1),
+		maxAttempts: DefaultMaxAttempts,
+		backoff:     DefaultRetryBackoff,
+	}
+
+	for _, opt := range opts {
+		opt(q)
+	}
+
+	return q
+}
+
+func (q *Memory) Publish(ctx context.Context, update lumex.Update) error {
+	select {
+	case q.items <- memoryItem{update: update, attempt: 1}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (q *Memory) Consume(ctx context.Context) (*Delivery, error) {
+	for {
+		item, wait, ok := q.popRetry(time.Now())
+		if ok {
+			return q.delivery(item), nil
+		}
+
+		var (
+			timer *time.Timer
+			ready <-chan time.Time
+		)
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			ready = timer.C
+		}
+
+		select {
+		case item := <-q.items:
+			if timer != nil {
+				timer.Stop()
+				// another consumer takes the retry when its backoff passes
+				q.wakeConsumer()
+			}
+
+			return q.delivery(item), nil
+		case <-q.retried:
+		case <-ready:
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+				q.wakeConsumer()
+			}
+
+			return nil, ctx.Err()
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// DeadLetters returns updates which ran out of attempts.
+func (q *Memory) DeadLetters() ([]DeadLetter, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return slices.Clone(q.dead), nil
+}
+
+// RequeueDeadLetters returns dead letters to the queue with attempts starting over.
+func (q *Memory) RequeueDeadLetters() (int, error) {
+	q.mu.Lock()
+	dead := q.dead
+	q.dead = nil
+	now := time.Now()
+	for _, letter := range dead {
+		q.retries = append(q.retries, memoryItem{update: letter.Update, attempt: 1, readyAt: now})
+	}
+	q.mu.Unlock()
+
+	if len(dead) > 0 {
+		q.wakeConsumer()
+	}
+
+	return len(dead), nil
+}
+
+// PurgeDeadLetters removes all dead letters.
+func (q *Memory) PurgeDeadLetters() error {
+	q.mu.Lock()
+	q.dead = nil
+	q.mu.Unlock()
+
+	return nil
+}
+
+// Len returns the number of updates waiting in the queue, including nacked ones.
+func (q *Memory) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.items) + len(q.retries)
+}
+
+func (q *Memory) delivery(item memoryItem) *Delivery {
+	return NewDelivery(item.update, item.attempt, func() error {
+		return nil
+	}, func() error {
+		q.requeue(item)
+
+		return nil
+	})
+}
+
+// requeue adds the nacked update to retries without blocking the consumer,
+// or keeps it as a dead letter if it ran out of attempts.
+func (q *Memory) requeue(item memoryItem) {
+	if q.maxAttempts > 0 && item.attempt >= q.maxAttempts {
+		q.mu.Lock()
+		q.dead = append(q.dead, DeadLetter{Update: item.update, Attempt: item.attempt})
+		q.mu.Unlock()
+
+		if q.deadLetter != nil {
+			q.deadLetter(item.update, item.attempt)
+		}
+
+		return
+	}
+
+	q.mu.Lock()
+	q.retries = append(q.retries, memoryItem{
+		update:  item.update,
+		attempt: item.attempt + 1,
+		readyAt: time.Now().Add(retryDelay(q.backoff, item.attempt)),
+	})
+	q.mu.Unlock()
+
+	q.wakeConsumer()
+}
+
+// wakeConsumer wakes up a consumer waiting for new updates to take a retry.
+func (q *Memory) wakeConsumer() {
+	select {
+	case q.retried <- struct{}{}:
+	default:
+	}
+}
+
+// popRetry returns the first retry which is ready at now,
+// otherwise it returns how long to wait for the next retry, zero if there are no retries.
+func (q *Memory) popRetry(now time.Time) (memoryItem, time.Duration, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var wait time.Duration
+	for i, item := range q.retries {
+		if delay := item.readyAt.Sub(now); delay > 0 {
+			if wait == 0 || delay < wait {
+				wait = delay
+			}
+
+			continue
+		}
+
+		q.retries = slices.Delete(q.retries, i, i+1)
+		if len(q.retries) > 0 {
+			q.wakeConsumer()
+		}
+
+		return item, 0, true
+	}
+
+	return memoryItem{}, wait, false
+}
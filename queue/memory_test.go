@@ -0,0 +1,190 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kbgod/lumex"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemory(t *testing.T) {
+	t.Run("publish and consume", func(t *testing.T) {
+		q := NewMemory(2)
+		ctx := context.Background()
+
+		assert.NoError(t, q.Publish(ctx, lumex.Update{UpdateId: 1}))
+		assert.NoError(t, q.Publish(ctx, lumex.Update{UpdateId: 2}))
+		assert.Equal(t, 2, q.Len())
+
+		d, err := q.Consume(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), d.Update.UpdateId)
+		assert.Equal(t, 1, d.Attempt)
+		assert.NoError(t, d.Ack())
+		assert.Equal(t, 1, q.Len())
+	})
+
+	t.Run("nack redelivers update", func(t *testing.T) {
+		q := NewMemory(1, WithMemoryRetryBackoff(0))
+		ctx := context.Background()
+
+		assert.NoError(t, q.Publish(ctx, lumex.Update{UpdateId: 1}))
+
+		d, err := q.Consume(ctx)
+		assert.NoError(t, err)
+		assert.NoError(t, d.Nack())
+
+		d, err = q.Consume(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), d.Update.UpdateId)
+		assert.Equal(t, 2, d.Attempt)
+	})
+
+	t.Run("nack of full queue keeps order", func(t *testing.T) {
+		q := NewMemory(1, WithMemoryRetryBackoff(0))
+		ctx := context.Background()
+
+		assert.NoError(t, q.Publish(ctx, lumex.Update{UpdateId: 1}))
+		first, err := q.Consume(ctx)
+		assert.NoError(t, err)
+		assert.NoError(t, q.Publish(ctx, lumex.Update{UpdateId: 2}))
+		second, err := q.Consume(ctx)
+		assert.NoError(t, err)
+		assert.NoError(t, q.Publish(ctx, lumex.Update{UpdateId: 3}))
+
+		assert.NoError(t, first.Nack())
+		assert.NoError(t, second.Nack())
+		assert.Equal(t, 3, q.Len())
+
+		for _, id := range []int64{1, 2, 3} {
+			d, err := q.Consume(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, id, d.Update.UpdateId)
+		}
+	})
+
+	t.Run("nack wakes up waiting consumer", func(t *testing.T) {
+		q := NewMemory(1, WithMemoryRetryBackoff(0))
+		ctx := context.Background()
+
+		assert.NoError(t, q.Publish(ctx, lumex.Update{UpdateId: 1}))
+		d, err := q.Consume(ctx)
+		assert.NoError(t, err)
+
+		consumed := make(chan *Delivery)
+		go func() {
+			d, _ := q.Consume(ctx)
+			consumed <- d
+		}()
+
+		assert.NoError(t, d.Nack())
+		select {
+		case d := <-consumed:
+			assert.Equal(t, 2, d.Attempt)
+		case <-time.After(time.Second):
+			t.Fatal("nacked update is not consumed")
+		}
+	})
+
+	t.Run("settling twice is a no-op", func(t *testing.T) {
+		q := NewMemory(1)
+		ctx := context.Background()
+
+		assert.NoError(t, q.Publish(ctx, lumex.Update{UpdateId: 1}))
+		d, err := q.Consume(ctx)
+		assert.NoError(t, err)
+		assert.NoError(t, d.Ack())
+		assert.NoError(t, d.Ack())
+		assert.NoError(t, d.Nack())
+		assert.Equal(t, 0, q.Len())
+
+		assert.NoError(t, q.Publish(ctx, lumex.Update{UpdateId: 2}))
+		d, err = q.Consume(ctx)
+		assert.NoError(t, err)
+		assert.NoError(t, d.Nack())
+		assert.NoError(t, d.Nack())
+		assert.Equal(t, 1, q.Len())
+	})
+
+	t.Run("dead letter after max attempts", func(t *testing.T) {
+		var dead []int
+		q := NewMemory(1, WithMemoryMaxAttempts(2), WithMemoryRetryBackoff(0), WithMemoryDeadLetter(func(update lumex.Update, attempt int) {
+			assert.Equal(t, int64(1), update.UpdateId)
+			dead = append(dead, attempt)
+		}))
+		ctx := context.Background()
+
+		assert.NoError(t, q.Publish(ctx, lumex.Update{UpdateId: 1}))
+		for range 2 {
+			d, err := q.Consume(ctx)
+			assert.NoError(t, err)
+			assert.NoError(t, d.Nack())
+		}
+
+		assert.Equal(t, []int{2}, dead)
+		assert.Equal(t, 0, q.Len())
+	})
+
+	t.Run("default max attempts", func(t *testing.T) {
+		var dead []int
+		q := NewMemory(1, WithMemoryRetryBackoff(0), WithMemoryDeadLetter(func(update lumex.Update, attempt int) {
+			dead = append(dead, attempt)
+		}))
+		ctx := context.Background()
+
+		assert.NoError(t, q.Publish(ctx, lumex.Update{UpdateId: 1}))
+		for range DefaultMaxAttempts {
+			d, err := q.Consume(ctx)
+			assert.NoError(t, err)
+			assert.NoError(t, d.Nack())
+		}
+
+		assert.Equal(t, []int{DefaultMaxAttempts}, dead)
+		assert.Equal(t, 0, q.Len())
+	})
+
+	t.Run("nacked update waits for backoff", func(t *testing.T) {
+		q := NewMemory(2, WithMemoryRetryBackoff(50*time.Millisecond))
+		ctx := context.Background()
+
+		assert.NoError(t, q.Publish(ctx, lumex.Update{UpdateId: 1}))
+		d, err := q.Consume(ctx)
+		assert.NoError(t, err)
+		nackedAt := time.Now()
+		assert.NoError(t, d.Nack())
+
+		// new updates are not blocked by the waiting retry
+		assert.NoError(t, q.Publish(ctx, lumex.Update{UpdateId: 2}))
+		d, err = q.Consume(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), d.Update.UpdateId)
+
+		d, err = q.Consume(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), d.Update.UpdateId)
+		assert.GreaterOrEqual(t, time.Since(nackedAt), 50*time.Millisecond)
+	})
+
+	t.Run("publish respects context when full", func(t *testing.T) {
+		q := NewMemory(1)
+		assert.NoError(t, q.Publish(context.Background(), lumex.Update{UpdateId: 1}))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		assert.ErrorIs(t, q.Publish(ctx, lumex.Update{UpdateId: 2}), context.DeadlineExceeded)
+	})
+
+	t.Run("consume respects context when empty", func(t *testing.T) {
+		q := NewMemory(1)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		d, err := q.Consume(ctx)
+		assert.Nil(t, d)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
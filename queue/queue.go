@@ -0,0 +1,110 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/kbgod/lumex"
+)
+
+const (
+	// DefaultMaxAttempts is the default number of delivery attempts of an update before it is dead-lettered.
+	DefaultMaxAttempts = 5
+	// DefaultRetryBackoff is the default delay before the second attempt, it doubles with every next attempt.
+	DefaultRetryBackoff = time.Second
+	// MaxRetryBackoff is the maximum delay before the next attempt.
+	MaxRetryBackoff = time.Minute
+)
+
+// Queue
+//
+// is a work queue of updates with at-least-once delivery semantics.
+// It allows to split polling and update processing between several processes:
+// the poller publishes updates and any number of consumers handle them.
+type Queue interface {
+	// Publish adds the update to the queue.
+	Publish(ctx context.Context, update lumex.Update) error
+	// Consume blocks until an update is available or ctx is done.
+	// Every returned delivery must be either acknowledged with Ack or returned to the queue with Nack.
+	Consume(ctx context.Context) (*Delivery, error)
+}
+
+// DeadLetterHandler is called with an update which ran out of delivery attempts and the number of its last attempt.
+type DeadLetterHandler func(update lumex.Update, attempt int)
+
+// DeadLetter is an update which ran out of delivery attempts.
+type DeadLetter struct {
+	Update lumex.Update
+	// Attempt is the number of the last delivery attempt.
+	Attempt int
+}
+
+// DeadLetterQueue
+//
+// is a Queue which keeps updates that ran out of attempts until they are requeued or purged.
+// Memory and File implement it.
+type DeadLetterQueue interface {
+	Queue
+	// DeadLetters returns kept dead letters, oldest first.
+	DeadLetters() ([]DeadLetter, error)
+	// RequeueDeadLetters returns dead letters to the queue with attempts starting over and reports how many were requeued.
+	RequeueDeadLetters() (int, error)
+	// PurgeDeadLetters removes all dead letters.
+	PurgeDeadLetters() error
+}
+
+// Delivery is an update received from the queue.
+type Delivery struct {
+	Update lumex.Update
+	// Attempt is the number of the delivery attempt, starting from 1.
+	Attempt int
+
+	ack  func() error
+	nack func() error
+	once sync.Once
+}
+
+// NewDelivery
+//
+// creates a delivery for custom Queue implementations.
+// ack removes the update from the queue, nack makes it available for redelivery.
+// Only the first call of Ack or Nack calls them, so settling a delivery twice is a no-op.
+func NewDelivery(update lumex.Update, attempt int, ack, nack func() error) *Delivery {
+	return &Delivery{
+		Update:  update,
+		Attempt: attempt,
+		ack:     ack,
+		nack:    nack,
+	}
+}
+
+// Ack removes the update from the queue. It does nothing if the delivery is already settled.
+func (d *Delivery) Ack() error {
+	return d.settle(d.ack)
+}
+
+// Nack returns the update to the queue for redelivery. It does nothing if the delivery is already settled.
+func (d *Delivery) Nack() error {
+	return d.settle(d.nack)
+}
+
+func (d *Delivery) settle(fn func() error) error {
+	var err error
+	d.once.Do(func() {
+		err = fn()
+	})
+
+	return err
+}
+
+// retryDelay returns the delay before the attempt which follows the given one: backoff doubled
+// with every attempt and capped by MaxRetryBackoff.
+func retryDelay(backoff time.Duration, attempt int) time.Duration {
+	delay := backoff
+	for i := 1; i < attempt && delay < MaxRetryBackoff; i++ {
+		delay *= 2
+	}
+
+	return min(delay, MaxRetryBackoff)
+}
@@ -0,0 +1,79 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kbgod/lumex"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeadLetterQueue(t *testing.T) {
+	queues := map[string]func(t *testing.T, handler DeadLetterHandler) DeadLetterQueue{
+		"memory": func(t *testing.T, handler DeadLetterHandler) DeadLetterQueue {
+			return NewMemory(1, WithMemoryMaxAttempts(2), WithMemoryRetryBackoff(0), WithMemoryDeadLetter(handler))
+		},
+		"file": func(t *testing.T, handler DeadLetterHandler) DeadLetterQueue {
+			q, err := NewFile(
+				t.TempDir(),
+				WithFilePollInterval(time.Millisecond),
+				WithFileMaxAttempts(2),
+				WithFileRetryBackoff(0),
+				WithFileDeadLetter(handler),
+			)
+			assert.NoError(t, err)
+
+			return q
+		},
+	}
+
+	for name, newQueue := range queues {
+		t.Run(name, func(t *testing.T) {
+			var handled []int
+			q := newQueue(t, func(update lumex.Update, attempt int) {
+				assert.Equal(t, int64(1), update.UpdateId)
+				handled = append(handled, attempt)
+			})
+			ctx := context.Background()
+
+			assert.NoError(t, q.Publish(ctx, lumex.Update{UpdateId: 1}))
+			for range 2 {
+				d, err := q.Consume(ctx)
+				assert.NoError(t, err)
+				assert.NoError(t, d.Nack())
+			}
+			assert.Equal(t, []int{2}, handled)
+
+			dead, err := q.DeadLetters()
+			assert.NoError(t, err)
+			assert.Equal(t, []DeadLetter{{Update: lumex.Update{UpdateId: 1}, Attempt: 2}}, dead)
+
+			requeued, err := q.RequeueDeadLetters()
+			assert.NoError(t, err)
+			assert.Equal(t, 1, requeued)
+
+			dead, err = q.DeadLetters()
+			assert.NoError(t, err)
+			assert.Empty(t, dead)
+
+			d, err := q.Consume(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(1), d.Update.UpdateId)
+			assert.Equal(t, 1, d.Attempt)
+			assert.NoError(t, d.Nack())
+
+			d, err = q.Consume(ctx)
+			assert.NoError(t, err)
+			assert.NoError(t, d.Nack())
+
+			dead, err = q.DeadLetters()
+			assert.NoError(t, err)
+			assert.Len(t, dead, 1)
+			assert.NoError(t, q.PurgeDeadLetters())
+			dead, err = q.DeadLetters()
+			assert.NoError(t, err)
+			assert.Empty(t, dead)
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package router
+
+import (
+	"context"
+	"slices"
+
+	"github.com/kbgod/lumex"
+)
+
+// updateTypes are all types of updates in order of the Bot API docs.
+var updateTypes = []string{
+	lumex.UpdateTypeMessage,
+	lumex.UpdateTypeEditedMessage,
+	lumex.UpdateTypeChannelPost,
+	lumex.UpdateTypeEditedChannelPost,
+	lumex.UpdateTypeBusinessConnection,
+	lumex.UpdateTypeBusinessMessage,
+	lumex.UpdateTypeEditedBusinessMessage,
+	lumex.UpdateTypeDeletedBusinessMessages,
+	lumex.UpdateTypeMessageReaction,
+	lumex.UpdateTypeMessageReactionCount,
+	lumex.UpdateTypeInlineQuery,
+	lumex.UpdateTypeChosenInlineResult,
+	lumex.UpdateTypeCallbackQuery,
+	lumex.UpdateTypeShippingQuery,
+	lumex.UpdateTypePreCheckoutQuery,
+	lumex.UpdateTypePurchasedPaidMedia,
+	lumex.UpdateTypePoll,
+	lumex.UpdateTypePollAnswer,
+	lumex.UpdateTypeMyChatMember,
+	lumex.UpdateTypeChatMember,
+	lumex.UpdateTypeChatJoinRequest,
+	lumex.UpdateTypeChatBoost,
+	lumex.UpdateTypeRemovedChatBoost,
+}
+
+// defaultUpdateTypes are types of updates Telegram sends if allowed updates are empty.
+var defaultUpdateTypes = slices.DeleteFunc(slices.Clone(updateTypes), func(updateType string) bool {
+	return updateType == lumex.UpdateTypeChatMember ||
+		updateType == lumex.UpdateTypeMessageReaction ||
+		updateType == lumex.UpdateTypeMessageReactionCount
+})
+
+// AllowedUpdates
+//
+// returns types of updates the routes can match, see Route.UpdateTypes, to use them as allowed updates,
+// so Telegram sends the updates routes need, like chat_member, and doesn't send updates which are not handled.
+// Routes which don't declare their types, like OnUpdate and routes of On, and fallbacks registered with NotFound
+// need the types Telegram sends by default: all types except chat_member, message_reaction and message_reaction_count.
+//
+// Types of updates handled only by middlewares or by replies to Context.Ask are not known from routes,
+// allow them explicitly.
+func (r *Router) AllowedUpdates() []string {
+	declared, undeclared := r.root().neededUpdateTypes()
+
+	allowed := make([]string, 0, len(declared))
+	for _, updateType := range updateTypes {
+		if _, ok := declared[updateType]; ok || (undeclared && slices.Contains(defaultUpdateTypes, updateType)) {
+			allowed = append(allowed, updateType)
+		}
+	}
+
+	// types declared with Route.UpdateTypes may be newer than the list
+	var unknown []string
+	for updateType := range declared {
+		if !slices.Contains(updateTypes, updateType) {
+			unknown = append(unknown, updateType)
+		}
+	}
+	slices.Sort(unknown)
+
+	return append(allowed, unknown...)
+}
+
+// neededUpdateTypes returns types of updates declared by routes with the first route which needs each of them
+// and reports whether any route doesn't declare its types. Fallbacks of NotFound never declare them.
+func (r *Router) neededUpdateTypes() (declared map[string]*Route, undeclared bool) {
+	declared = make(map[string]*Route)
+	for _, route := range slices.Concat(r.routes, r.notFound) {
+		types := route.spec.updateTypes
+		if types == nil {
+			undeclared = true
+
+			continue
+		}
+
+		for _, updateType := range types {
+			if _, ok := declared[updateType]; !ok {
+				declared[updateType] = route
+			}
+		}
+	}
+
+	return declared, undeclared
+}
+
+// allowedUpdates returns allowed if they are specified and AllowedUpdates otherwise.
+// A warning is logged for every type of updates declared by routes which is not in allowed.
+func (r *Router) allowedUpdates(allowed []string) []string {
+	root := r.root()
+	if allowed == nil {
+		return root.AllowedUpdates()
+	}
+
+	// Telegram sends the default types if the list is empty
+	effective := allowed
+	if len(effective) == 0 {
+		effective = defaultUpdateTypes
+	}
+
+	declared, _ := root.neededUpdateTypes()
+	for _, updateType := range updateTypes {
+		route, ok := declared[updateType]
+		if ok && !slices.Contains(effective, updateType) {
+			root.log.Warn("route needs updates which are not allowed", map[string]any{
+				"update_type": updateType,
+				"route":       route.GetName(),
+				"filter":      route.GetFilterDescription(),
+			})
+		}
+	}
+
+	return allowed
+}
+
+// UpdatesOpts
+//
+// returns a copy of opts for GetUpdatesChanWithContext with allowed updates set to AllowedUpdates
+// if opts don't specify them. Specified allowed updates are kept, but a warning is logged
+// for every type of updates which routes need and which is not allowed.
+// Updates handled only by middlewares or Context.Ask are not derived from routes, see AllowedUpdates.
+// Other options are kept as they are, if opts are nil, errors of getUpdates requests are logged
+// with lumex.DefaultGetUpdatesErrorHandler like GetUpdatesChanWithContext does.
+// Listen and the dispatcher use it, call it if updates are received with the bot directly.
+func (r *Router) UpdatesOpts(opts *lumex.GetUpdatesChanOpts) *lumex.GetUpdatesChanOpts {
+	cfg := lumex.GetUpdatesChanOpts{ErrorHandler: lumex.DefaultGetUpdatesErrorHandler}
+	if opts != nil {
+		cfg = *opts
+	}
+
+	getUpdatesOpts := lumex.DefaultGetUpdatesOpts()
+	if cfg.GetUpdatesOpts != nil {
+		copied := *cfg.GetUpdatesOpts
+		getUpdatesOpts = &copied
+	}
+	getUpdatesOpts.AllowedUpdates = r.allowedUpdates(getUpdatesOpts.AllowedUpdates)
+	cfg.GetUpdatesOpts = getUpdatesOpts
+
+	return &cfg
+}
+
+// SetWebhook
+//
+// sets the webhook of the bot with allowed updates set to AllowedUpdates if opts don't specify them, see UpdatesOpts.
+// Updates handled only by middlewares or Context.Ask are not derived from routes, see AllowedUpdates.
+// Call it after all routes are registered.
+// It returns ErrNoBot for a router created without a bot.
+func (r *Router) SetWebhook(ctx context.Context, url string, opts *lumex.SetWebhookOpts) error {
+	bot := r.root().bot
+	if bot == nil {
+		return ErrNoBot
+	}
+
+	var cfg lumex.SetWebhookOpts
+	if opts != nil {
+		cfg = *opts
+	}
+	cfg.AllowedUpdates = r.allowedUpdates(cfg.AllowedUpdates)
+
+	_, err := bot.SetWebhookWithContext(ctx, url, &cfg)
+
+	return err
+}
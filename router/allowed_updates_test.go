@@ -0,0 +1,181 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/kbgod/lumex"
+	"github.com/kbgod/lumex/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRouter_AllowedUpdates(t *testing.T) {
+	handler := func(ctx *Context) error {
+		return nil
+	}
+
+	t.Run("declared", func(t *testing.T) {
+		r := New(nil)
+		r.OnChatMember(handler)
+		r.OnCommand("start", handler)
+		r.Group().OnCallbackPrefix("menu:", handler)
+
+		assert.Equal(t, []string{
+			lumex.UpdateTypeMessage,
+			lumex.UpdateTypeCallbackQuery,
+			lumex.UpdateTypeChatMember,
+		}, r.AllowedUpdates())
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		r := New(nil)
+		r.OnCommand("start", handler)
+		r.NotFound(handler)
+
+		// the fallback handles any update Telegram sends
+		assert.Equal(t, defaultUpdateTypes, r.AllowedUpdates())
+	})
+
+	t.Run("undeclared", func(t *testing.T) {
+		r := New(nil)
+		r.OnChatMember(handler)
+		r.OnUpdate(handler)
+
+		want := slices.DeleteFunc(slices.Clone(updateTypes), func(updateType string) bool {
+			return updateType == lumex.UpdateTypeMessageReaction || updateType == lumex.UpdateTypeMessageReactionCount
+		})
+		assert.Equal(t, want, r.AllowedUpdates())
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		r := New(nil)
+		r.On(func(ctx *Context) bool {
+			return false
+		}, handler).UpdateTypes("future_update")
+		r.OnMessage(handler)
+
+		assert.Equal(t, []string{lumex.UpdateTypeMessage, "future_update"}, r.AllowedUpdates())
+	})
+
+	t.Run("no routes", func(t *testing.T) {
+		assert.Empty(t, New(nil).AllowedUpdates())
+	})
+}
+
+func TestRouter_UpdatesOpts(t *testing.T) {
+	handler := func(ctx *Context) error {
+		return nil
+	}
+
+	t.Run("derived", func(t *testing.T) {
+		r := New(nil)
+		r.OnMessage(handler)
+
+		opts := r.UpdatesOpts(nil)
+		assert.Equal(t, lumex.DefaultGetUpdatesOpts().Timeout, opts.GetUpdatesOpts.Timeout)
+		assert.Equal(t, []string{lumex.UpdateTypeMessage}, opts.GetUpdatesOpts.AllowedUpdates)
+	})
+
+	t.Run("polling errors are logged", func(t *testing.T) {
+		var buf bytes.Buffer
+		log.SetOutput(&buf)
+		defer log.SetOutput(os.Stderr)
+
+		r := New(nil)
+		r.OnMessage(handler)
+
+		opts := r.UpdatesOpts(nil)
+		if assert.NotNil(t, opts.ErrorHandler) {
+			opts.ErrorHandler(errors.New("bad gateway"))
+		}
+		assert.Contains(t, buf.String(), "GetUpdatesChanWithContext error: bad gateway")
+
+		// the handler is kept as it is if opts are specified
+		errorHandler := func(err error) {}
+		opts = r.UpdatesOpts(&lumex.GetUpdatesChanOpts{ErrorHandler: errorHandler})
+		assert.Equal(t, reflect.ValueOf(errorHandler).Pointer(), reflect.ValueOf(opts.ErrorHandler).Pointer())
+		assert.Nil(t, r.UpdatesOpts(&lumex.GetUpdatesChanOpts{}).ErrorHandler)
+	})
+
+	t.Run("specified", func(t *testing.T) {
+		logger := mocks.NewLogger(t)
+		logger.On("Warn", "route needs updates which are not allowed", map[string]any{
+			"update_type": lumex.UpdateTypeChatMember,
+			"route":       "members",
+			"filter":      "chat member",
+		}).Once()
+
+		r := New(nil, WithLogger(logger))
+		r.OnMessage(handler)
+		r.OnChatMember(handler).Name("members")
+
+		getUpdatesOpts := &lumex.GetUpdatesOpts{Timeout: 10, AllowedUpdates: []string{lumex.UpdateTypeMessage}}
+		opts := r.UpdatesOpts(&lumex.GetUpdatesChanOpts{GetUpdatesOpts: getUpdatesOpts})
+
+		assert.Equal(t, int64(10), opts.GetUpdatesOpts.Timeout)
+		assert.Equal(t, []string{lumex.UpdateTypeMessage}, opts.GetUpdatesOpts.AllowedUpdates)
+		assert.NotSame(t, getUpdatesOpts, opts.GetUpdatesOpts)
+	})
+
+	t.Run("empty means default", func(t *testing.T) {
+		logger := mocks.NewLogger(t)
+		logger.On("Warn", "route needs updates which are not allowed", mock.Anything).Once()
+
+		r := New(nil, WithLogger(logger))
+		r.OnMessage(handler)
+		r.OnMessageReaction(handler)
+
+		opts := r.UpdatesOpts(&lumex.GetUpdatesChanOpts{
+			GetUpdatesOpts: &lumex.GetUpdatesOpts{AllowedUpdates: []string{}},
+		})
+		assert.Equal(t, []string{}, opts.GetUpdatesOpts.AllowedUpdates)
+	})
+}
+
+func TestRouter_SetWebhook(t *testing.T) {
+	const fakeToken = "123:test"
+	cl := mocks.NewBotClient(t)
+	cl.On(
+		"RequestWithContext",
+		mock.IsType(context.Background()),
+		fakeToken,
+		"setWebhook",
+		mock.MatchedBy(func(params map[string]any) bool {
+			allowed, ok := params["allowed_updates"].([]string)
+
+			return params["url"] == "https://example.com" &&
+				ok && assert.ObjectsAreEqual([]string{lumex.UpdateTypeCallbackQuery}, allowed)
+		}),
+		mock.Anything,
+	).Return(json.RawMessage(`true`), nil).Once()
+
+	bot, err := lumex.NewBot(fakeToken, &lumex.BotOpts{
+		BotClient:         cl,
+		DisableTokenCheck: true,
+	})
+	assert.NoErrorf(t, err, "lumex.NewBot() = %v; want <nil>", err)
+
+	r := New(bot)
+	r.OnCallbackQuery(func(ctx *Context) error {
+		return nil
+	})
+
+	assert.NoError(t, r.SetWebhook(context.Background(), "https://example.com", nil))
+}
+
+func TestRouter_SetWebhook_noBot(t *testing.T) {
+	r := New(nil)
+	r.OnCallbackQuery(func(ctx *Context) error {
+		return nil
+	})
+
+	assert.ErrorIs(t, r.SetWebhook(context.Background(), "https://example.com", nil), ErrNoBot)
+}
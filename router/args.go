@@ -0,0 +1,176 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/kbgod/lumex"
+)
+
+var (
+	ErrUnterminatedQuote = errors.New("unterminated quote")
+	ErrMissingArgument   = errors.New("missing argument")
+	ErrTooManyArguments  = errors.New("too many arguments")
+	ErrInvalidArgument   = errors.New("invalid argument")
+	ErrNotCommand        = errors.New("message is not a command")
+)
+
+// argToken is a single command argument with its position in the message text.
+type argToken struct {
+	value string
+	// start and end are byte offsets of the raw argument in the message text.
+	start, end int
+	// entity is the message entity which covers the argument exactly, if any.
+	entity *lumex.ParsedMessageEntity
+}
+
+// SplitArgs
+//
+// splits the text into arguments like a shell does:
+// arguments are separated by any whitespace, single and double quotes group words
+// and backslash escapes the next character outside single quotes.
+// Example: `a "b c" 'd e' f\ g` -> ["a", "b c", "d e", "f g"]
+func SplitArgs(text string) ([]string, error) {
+	tokens, err := splitArgs(text, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		args = append(args, token.value)
+	}
+
+	return args, nil
+}
+
+// splitArgs splits text[from:] into arguments.
+// text_mention entities are kept as single arguments, since user names can contain spaces.
+// If a quote is not terminated, ErrUnterminatedQuote is returned with the arguments before it
+// and the rest of the text as the last argument.
+func splitArgs(text string, from int, entities []lumex.ParsedMessageEntity) ([]argToken, error) {
+	var tokens []argToken
+
+	i := from
+	for i < len(text) {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if unicode.IsSpace(r) {
+			i += size
+
+			continue
+		}
+
+		if entity := entityAt(entities, i); entity != nil && entity.Type == "text_mention" {
+			end := i + int(entity.Length)
+			tokens = append(tokens, argToken{value: entity.Text, start: i, end: end, entity: entity})
+			i = end
+
+			continue
+		}
+
+		token, err := scanArg(text, i)
+		if err != nil {
+			return append(tokens, argToken{value: text[i:], start: i, end: len(text)}), err
+		}
+
+		if entity := entityAt(entities, token.start); entity != nil && token.start+int(entity.Length) == token.end {
+			token.entity = entity
+		}
+
+		tokens = append(tokens, token)
+		i = token.end
+	}
+
+	return tokens, nil
+}
+
+// scanArg reads a single argument starting at text[start].
+func scanArg(text string, start int) (argToken, error) {
+	var (
+		value strings.Builder
+		quote rune
+		i     = start
+	)
+
+	for i < len(text) {
+		r, size := utf8.DecodeRuneInString(text[i:])
+
+		switch {
+		case quote == 0 && unicode.IsSpace(r):
+			return argToken{value: value.String(), start: start, end: i}, nil
+		case quote == 0 && (r == '"' || r == '\''):
+			quote = r
+		case quote != 0 && r == quote:
+			quote = 0
+		case r == '\\' && quote != '\'' && i+size < len(text):
+			i += size
+			r, size = utf8.DecodeRuneInString(text[i:])
+			value.WriteRune(r)
+		default:
+			value.WriteRune(r)
+		}
+
+		i += size
+	}
+
+	if quote != 0 {
+		return argToken{}, ErrUnterminatedQuote
+	}
+
+	return argToken{value: value.String(), start: start, end: i}, nil
+}
+
+func entityAt(entities []lumex.ParsedMessageEntity, offset int) *lumex.ParsedMessageEntity {
+	for i := range entities {
+		if int(entities[i].Offset) == offset {
+			return &entities[i]
+		}
+	}
+
+	return nil
+}
+
+// commandArgTokens returns the arguments of the command in the message, see splitArgs.
+func commandArgTokens(m *lumex.Message) ([]argToken, string, error) {
+	cmd, ok := parseCommand(m)
+	if !ok {
+		return nil, "", ErrNotCommand
+	}
+
+	text, entities := m.Text, m.Entities
+	if text == "" {
+		text, entities = m.Caption, m.CaptionEntities
+	}
+
+	from := len(text) - len(cmd.args)
+	tokens, err := splitArgs(text, from, lumex.ParseEntities(text, entities))
+
+	return tokens, text, err
+}
+
+// UsageError
+//
+// is returned when command arguments don't match the expected usage.
+// Its message contains the usage line, so it can be sent to the user as is.
+type UsageError struct {
+	Usage *Usage
+	// Arg is the name of the argument which caused the error, empty if the error is not related to a single argument.
+	Arg string
+	Err error
+}
+
+func (e *UsageError) Error() string {
+	msg := e.Err.Error()
+	if e.Arg != "" {
+		msg = fmt.Sprintf("argument %q: %s", e.Arg, msg)
+	}
+
+	return msg + "\nusage: " + e.Usage.String()
+}
+
+func (e *UsageError) Unwrap() error {
+	return e.Err
+}
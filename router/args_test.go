@@ -0,0 +1,58 @@
+package router
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kbgod/lumex"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitArgs(t *testing.T) {
+	cases := []struct {
+		name string
+		text string
+		want []string
+		err  error
+	}{
+		{"empty", "", []string{}, nil},
+		{"single spaces", "a b c", []string{"a", "b", "c"}, nil},
+		{"multiple spaces and newlines", "  a \n\n b\t c  ", []string{"a", "b", "c"}, nil},
+		{"double quotes", `a "b c" d`, []string{"a", "b c", "d"}, nil},
+		{"single quotes", `a 'b "c"' d`, []string{"a", `b "c"`, "d"}, nil},
+		{"quotes inside argument", `key="some value"`, []string{"key=some value"}, nil},
+		{"escaped space", `a\ b c`, []string{"a b", "c"}, nil},
+		{"escaped quote", `"a \" b"`, []string{`a " b`}, nil},
+		{"no escape in single quotes", `'a\b'`, []string{`a\b`}, nil},
+		{"empty quotes", `a "" b`, []string{"a", "", "b"}, nil},
+		{"unicode", "привіт 'світ 🌍'", []string{"привіт", "світ 🌍"}, nil},
+		{"unterminated quote", `a "b c`, nil, ErrUnterminatedQuote},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := SplitArgs(tc.text)
+			assert.ErrorIs(t, err, tc.err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestContext_CommandArgs_Quoting(t *testing.T) {
+	r := New(&lumex.Bot{})
+	ctx := r.acquireContext(context.Background(), &lumex.Update{
+		Message: &lumex.Message{
+			Text:     "/test  first \"second arg\"\nthird",
+			Entities: []lumex.MessageEntity{{Type: "bot_command", Length: 5}},
+		},
+	})
+	assert.Equal(t, []string{"first", "second arg", "third"}, ctx.CommandArgs())
+
+	ctx = r.acquireContext(context.Background(), &lumex.Update{
+		Message: &lumex.Message{
+			Text:     "/test don't stop",
+			Entities: []lumex.MessageEntity{{Type: "bot_command", Length: 5}},
+		},
+	})
+	assert.Equal(t, []string{"don't", "stop"}, ctx.CommandArgs(), "unterminated quote falls back to whitespace split")
+}
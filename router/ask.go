@@ -0,0 +1,232 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kbgod/lumex"
+)
+
+var (
+	ErrAskTimeout    = errors.New("ask timeout")
+	ErrAskInProgress = errors.New("another ask is in progress for the user in the chat")
+	ErrAskNoSender   = errors.New("ask requires an update with a sender")
+)
+
+// askKey identifies the user in the chat waiting for a reply.
+type askKey struct {
+	chatID int64
+	userID int64
+}
+
+type askWaiter struct {
+	expect RouteFilter
+	reply  chan askReply
+}
+
+// askReply is the update delivered to the waiting handler with captures of the expect filter.
+type askReply struct {
+	update     *lumex.Update
+	match      []string
+	matchNames []string
+}
+
+// askRegistry holds handlers waiting in Context.Ask, it is used only on the root router.
+type askRegistry struct {
+	mu      sync.Mutex
+	waiters map[askKey]*askWaiter
+	// waiting is the number of waiters, so Deliver doesn't lock while nobody waits.
+	waiting atomic.Int32
+}
+
+func askKeyOf(ctx *Context) (askKey, bool) {
+	sender := ctx.Sender()
+	if sender == nil {
+		return askKey{}, false
+	}
+
+	return askKey{chatID: ctx.ChatID(), userID: sender.Id}, true
+}
+
+// ExpectText returns a filter for Context.Ask that accepts a message with text.
+func ExpectText() RouteFilter {
+	return describe("text message", func(ctx *Context) bool {
+		return ctx.Update.Message != nil && ctx.Update.Message.Text != ""
+	}).filter
+}
+
+// ExpectMessage returns a filter for Context.Ask that accepts any message.
+func ExpectMessage() RouteFilter {
+	return describe("message", func(ctx *Context) bool {
+		return ctx.Update.Message != nil
+	}).filter
+}
+
+// ExpectCallback returns a filter for Context.Ask that accepts a callback query.
+func ExpectCallback() RouteFilter {
+	return describe("callback query", func(ctx *Context) bool {
+		return ctx.Update.CallbackQuery != nil
+	}).filter
+}
+
+// Ask
+//
+// sends the text (if it is not empty) and blocks the handler until the same user replies in the same chat
+// with an update matching expect, any RouteFilter can be used, like ExpectText or TextRegex.
+// The reply is delivered to the handler instead of routing, updates which don't match expect are routed as usual.
+// Replies pass through middlewares of the router before they are delivered, so middlewares like fsm or auth
+// see them too, and captures of expect, like those of TextRegex, are kept: Match and Matches return them
+// once Ask returns the reply.
+// It returns ErrAskTimeout after the timeout and the context error if the event context is done earlier,
+// so the handler timeout of the router limits the wait too.
+// Replies are not routes, so types of updates they need are not included in AllowedUpdates, allow them explicitly.
+//
+// Waiting handlers don't occupy workers of Listen and dispatcher pools, see Pool, so replies are handled
+// even when all workers are waiting. Only one Ask may wait for the user in the chat at a time.
+// Example:
+// answer, err := ctx.Ask("What's your email?", router.ExpectText(), 2*time.Minute)
+func (ctx *Context) Ask(text string, expect RouteFilter, timeout time.Duration) (update *lumex.Update, err error) {
+	key, ok := askKeyOf(ctx)
+	if !ok {
+		return nil, ErrAskNoSender
+	}
+
+	asks := &ctx.router.asks
+	waiter := &askWaiter{expect: expect, reply: make(chan askReply, 1)}
+
+	asks.mu.Lock()
+	if _, exists := asks.waiters[key]; exists {
+		asks.mu.Unlock()
+
+		return nil, ErrAskInProgress
+	}
+	if asks.waiters == nil {
+		asks.waiters = make(map[askKey]*askWaiter)
+	}
+	// the waiter is registered before the question is sent, so a fast reply is not routed as usual
+	asks.waiters[key] = waiter
+	asks.waiting.Add(1)
+	asks.mu.Unlock()
+
+	if text != "" {
+		if err := ctx.ReplyVoid(text); err != nil {
+			asks.cancel(key, waiter)
+
+			return nil, err
+		}
+	}
+
+	if slot, ok := ctx.Context().Value(poolContextKey{}).(*poolSlot); ok {
+		slot.release()
+		defer func() {
+			// the handler goes on only with the slot, unless the event context is done while it waits for it
+			if acquireErr := slot.acquire(ctx.Context()); acquireErr != nil && err == nil {
+				update, err = nil, acquireErr
+			}
+		}()
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case reply := <-waiter.reply:
+		return ctx.replied(reply), nil
+	case <-timer.C:
+		err = ErrAskTimeout
+	case <-ctx.Context().Done():
+		err = ctx.Context().Err()
+	}
+
+	if !asks.cancel(key, waiter) {
+		// the reply was delivered at the same moment
+		return ctx.replied(<-waiter.reply), nil
+	}
+
+	return nil, err
+}
+
+// replied keeps captures of the expect filter in the context and returns the reply update.
+func (ctx *Context) replied(reply askReply) *lumex.Update {
+	ctx.match, ctx.matchNames = reply.match, reply.matchNames
+
+	return reply.update
+}
+
+// cancel removes the waiter and reports false if it was already removed, by Deliver or by another cancel.
+func (a *askRegistry) cancel(key askKey, waiter *askWaiter) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.waiters[key] != waiter {
+		return false
+	}
+
+	delete(a.waiters, key)
+	a.waiting.Add(-1)
+
+	return true
+}
+
+// Deliver
+//
+// passes the update to the handler waiting for it in Context.Ask and reports whether it was delivered.
+// HandleUpdate delivers replies after middlewares of the router, so it is needed only to handle updates
+// without the router, middlewares are not run then.
+func (r *Router) Deliver(update *lumex.Update) bool {
+	if r.asks.waiting.Load() == 0 {
+		return false
+	}
+
+	ctx := r.acquireContext(context.Background(), update)
+	defer r.releaseContext(ctx)
+
+	return r.deliver(ctx)
+}
+
+// deliver passes the update of the context to the handler waiting for it with captures of its expect filter.
+func (r *Router) deliver(ctx *Context) bool {
+	key, waiter := r.asks.waiterFor(ctx)
+	if waiter == nil {
+		return false
+	}
+
+	// the waiter may be cancelled or replaced while expect runs, then the update is routed as usual
+	if !r.asks.cancel(key, waiter) {
+		return false
+	}
+	waiter.reply <- askReply{update: ctx.Update, match: ctx.match, matchNames: ctx.matchNames}
+
+	return true
+}
+
+// waiterFor returns the waiter expecting the update of the context, captures of its expect filter are kept in ctx.
+// The expect filter is user code, so the waiter is copied out under the lock and expect runs without it.
+func (a *askRegistry) waiterFor(ctx *Context) (askKey, *askWaiter) {
+	if a.waiting.Load() == 0 {
+		return askKey{}, nil
+	}
+
+	key, ok := askKeyOf(ctx)
+	if !ok {
+		return key, nil
+	}
+
+	a.mu.Lock()
+	waiter := a.waiters[key]
+	a.mu.Unlock()
+
+	if waiter == nil {
+		return key, nil
+	}
+
+	ctx.match, ctx.matchNames = nil, nil
+	if waiter.expect != nil && !waiter.expect(ctx) {
+		return key, nil
+	}
+
+	return key, waiter
+}
@@ -0,0 +1,372 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kbgod/lumex"
+	"github.com/kbgod/lumex/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func askUpdate(chatID, userID int64, text string) *lumex.Update {
+	update := &lumex.Update{
+		Message: &lumex.Message{
+			Chat: lumex.Chat{Id: chatID},
+			From: &lumex.User{Id: userID},
+			Text: text,
+		},
+	}
+	if strings.HasPrefix(text, "/") {
+		update.Message.Entities = []lumex.MessageEntity{{Type: "bot_command", Length: int64(len(text))}}
+	}
+
+	return update
+}
+
+// waitAsking waits until the router has the given number of handlers waiting in Ask.
+func waitAsking(t *testing.T, r *Router, n int32) {
+	t.Helper()
+
+	assert.Eventually(t, func() bool {
+		return r.asks.waiting.Load() == n
+	}, time.Second, time.Millisecond)
+}
+
+func TestContext_Ask(t *testing.T) {
+	t.Run("reply is delivered while the pool is busy", func(t *testing.T) {
+		r := New(nil)
+		pool := NewPool(1)
+		answers := make(chan string, 1)
+		other := make(chan struct{})
+
+		r.OnCommand("start", func(ctx *Context) error {
+			answer, err := ctx.Ask("", ExpectText(), time.Second)
+			if err != nil {
+				return err
+			}
+			answers <- answer.Message.Text
+
+			return nil
+		})
+		r.OnMessage(func(ctx *Context) error {
+			close(other)
+
+			return nil
+		})
+
+		handle := func(update *lumex.Update) {
+			assert.True(t, pool.Go(context.Background(), func(ctx context.Context) {
+				assert.NoError(t, r.HandleUpdate(ctx, update))
+			}))
+		}
+
+		handle(askUpdate(1, 1, "/start"))
+		waitAsking(t, r, 1)
+
+		// the only slot of the pool is given back while the handler waits
+		handle(askUpdate(1, 2, "hello"))
+		select {
+		case <-other:
+		case <-time.After(time.Second):
+			t.Fatal("update of another user was not handled while the handler was waiting")
+		}
+
+		handle(askUpdate(1, 1, "me@example.com"))
+		pool.Wait()
+
+		assert.Equal(t, "me@example.com", <-answers)
+		assert.Equal(t, int32(0), r.asks.waiting.Load())
+		assert.Empty(t, r.asks.waiters)
+		assert.Empty(t, pool.slots)
+	})
+
+	t.Run("slot is not taken back when the context is done", func(t *testing.T) {
+		r := New(nil)
+		pool := NewPool(1)
+		errs := make(chan error, 1)
+		busy := make(chan struct{})
+		release := make(chan struct{})
+
+		r.OnCommand("start", func(ctx *Context) error {
+			_, err := ctx.Ask("", ExpectText(), time.Second)
+			errs <- err
+
+			return nil
+		})
+		r.OnCommand("busy", func(ctx *Context) error {
+			close(busy)
+			<-release
+
+			return nil
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		assert.True(t, pool.Go(ctx, func(ctx context.Context) {
+			assert.NoError(t, r.HandleUpdate(ctx, askUpdate(1, 1, "/start")))
+		}))
+		waitAsking(t, r, 1)
+
+		// the slot given back by the waiting handler is taken by another one, so the reply can't take it again
+		assert.True(t, pool.Go(context.Background(), func(ctx context.Context) {
+			assert.NoError(t, r.HandleUpdate(ctx, askUpdate(1, 2, "/busy")))
+		}))
+		<-busy
+		assert.True(t, r.Deliver(askUpdate(1, 1, "me@example.com")))
+
+		cancel()
+		select {
+		case err := <-errs:
+			assert.ErrorIs(t, err, context.Canceled)
+		case <-time.After(time.Second):
+			t.Fatal("handler waiting for the slot was not cancelled")
+		}
+
+		close(release)
+		pool.Wait()
+		assert.Empty(t, pool.slots)
+	})
+
+	t.Run("HandleUpdate delivers the reply", func(t *testing.T) {
+		r := New(nil)
+		answers := make(chan string, 1)
+		r.OnCommand("start", func(ctx *Context) error {
+			answer, err := ctx.Ask("", ExpectText(), time.Second)
+			if err != nil {
+				return err
+			}
+			answers <- answer.Message.Text
+
+			return nil
+		})
+
+		done := make(chan error, 1)
+		go func() {
+			done <- r.HandleUpdate(context.Background(), askUpdate(1, 1, "/start"))
+		}()
+		waitAsking(t, r, 1)
+
+		assert.NoError(t, r.HandleUpdate(context.Background(), askUpdate(1, 1, "answer")))
+		assert.NoError(t, <-done)
+		assert.Equal(t, "answer", <-answers)
+	})
+
+	t.Run("reply passes through middlewares and keeps captures", func(t *testing.T) {
+		r := New(nil)
+		seen := make(chan string, 2)
+		emails := make(chan string, 1)
+		r.Use(func(ctx *Context) error {
+			seen <- ctx.Update.Message.Text
+
+			return ctx.Next()
+		})
+		r.OnCommand("start", func(ctx *Context) error {
+			if _, err := ctx.Ask("", TextRegex(`^(?P<user>\w+)@example\.com$`), time.Second); err != nil {
+				return err
+			}
+			emails <- ctx.Match("user")
+
+			return nil
+		})
+
+		done := make(chan error, 1)
+		go func() {
+			done <- r.HandleUpdate(context.Background(), askUpdate(1, 1, "/start"))
+		}()
+		waitAsking(t, r, 1)
+
+		assert.NoError(t, r.HandleUpdate(context.Background(), askUpdate(1, 1, "me@example.com")))
+		assert.NoError(t, <-done)
+		assert.Equal(t, "me", <-emails)
+		assert.Equal(t, "/start", <-seen)
+		assert.Equal(t, "me@example.com", <-seen)
+	})
+
+	t.Run("not matching updates are routed", func(t *testing.T) {
+		r := New(nil)
+		routed := make(chan *lumex.Update, 3)
+		answers := make(chan string, 1)
+		r.OnCommand("start", func(ctx *Context) error {
+			answer, err := ctx.Ask("", ExpectText(), time.Second)
+			if err != nil {
+				return err
+			}
+			answers <- answer.Message.Text
+
+			return nil
+		})
+		r.OnUpdate(func(ctx *Context) error {
+			routed <- ctx.Update
+
+			return nil
+		})
+
+		go func() {
+			_ = r.HandleUpdate(context.Background(), askUpdate(1, 1, "/start"))
+		}()
+		waitAsking(t, r, 1)
+
+		// a message without text, the same user in another chat and another user in the chat
+		for _, update := range []*lumex.Update{askUpdate(1, 1, ""), askUpdate(2, 1, "text"), askUpdate(1, 2, "text")} {
+			assert.False(t, r.Deliver(update))
+			assert.NoError(t, r.HandleUpdate(context.Background(), update))
+		}
+		assert.Len(t, routed, 3)
+
+		assert.True(t, r.Deliver(askUpdate(1, 1, "text")))
+		assert.Equal(t, "text", <-answers)
+	})
+
+	t.Run("expect runs without the registry lock", func(t *testing.T) {
+		r := New(nil)
+		replied := make(chan struct{})
+		r.OnCommand("start", func(ctx *Context) error {
+			_, err := ctx.Ask("", func(ctx *Context) bool {
+				// a filter touching the registry must not deadlock
+				assert.False(t, r.Deliver(askUpdate(1, 2, "other")))
+
+				return true
+			}, time.Second)
+			close(replied)
+
+			return err
+		})
+
+		go func() {
+			assert.NoError(t, r.HandleUpdate(context.Background(), askUpdate(1, 1, "/start")))
+		}()
+		waitAsking(t, r, 1)
+
+		assert.NoError(t, r.HandleUpdate(context.Background(), askUpdate(1, 1, "answer")))
+		select {
+		case <-replied:
+		case <-time.After(time.Second):
+			t.Fatal("reply was not delivered")
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		r := New(nil)
+		ctx := r.acquireContext(context.Background(), askUpdate(1, 1, "/start"))
+		defer r.releaseContext(ctx)
+
+		answer, err := ctx.Ask("", ExpectText(), 10*time.Millisecond)
+		assert.ErrorIs(t, err, ErrAskTimeout)
+		assert.Nil(t, answer)
+		assert.Equal(t, int32(0), r.asks.waiting.Load())
+		assert.Empty(t, r.asks.waiters)
+		assert.False(t, r.Deliver(askUpdate(1, 1, "late")))
+	})
+
+	t.Run("context is cancelled", func(t *testing.T) {
+		r := New(nil)
+		cancelCtx, cancel := context.WithCancel(context.Background())
+		ctx := r.acquireContext(cancelCtx, askUpdate(1, 1, "/start"))
+		defer r.releaseContext(ctx)
+
+		time.AfterFunc(10*time.Millisecond, cancel)
+		answer, err := ctx.Ask("", ExpectText(), time.Minute)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Nil(t, answer)
+		assert.Empty(t, r.asks.waiters)
+	})
+
+	t.Run("handler timeout", func(t *testing.T) {
+		r := New(nil, WithHandlerTimeout(10*time.Millisecond))
+		askErr := make(chan error, 1)
+		r.OnCommand("start", func(ctx *Context) error {
+			_, err := ctx.Ask("", ExpectText(), time.Minute)
+			askErr <- err
+
+			return err
+		})
+
+		err := r.HandleUpdate(context.Background(), askUpdate(1, 1, "/start"))
+		assert.ErrorIs(t, err, ErrHandlerTimeout)
+		assert.ErrorIs(t, <-askErr, context.DeadlineExceeded)
+		assert.Empty(t, r.asks.waiters)
+	})
+
+	t.Run("ask in progress", func(t *testing.T) {
+		r := New(nil)
+		first := r.acquireContext(context.Background(), askUpdate(1, 1, "/start"))
+		defer r.releaseContext(first)
+		second := r.acquireContext(context.Background(), askUpdate(1, 1, "/start"))
+		defer r.releaseContext(second)
+
+		done := make(chan error, 1)
+		go func() {
+			_, err := first.Ask("", ExpectText(), time.Second)
+			done <- err
+		}()
+		waitAsking(t, r, 1)
+
+		_, err := second.Ask("", ExpectText(), time.Second)
+		assert.ErrorIs(t, err, ErrAskInProgress)
+
+		assert.True(t, r.Deliver(askUpdate(1, 1, "answer")))
+		assert.NoError(t, <-done)
+	})
+
+	t.Run("no sender", func(t *testing.T) {
+		r := New(nil)
+		ctx := r.acquireContext(context.Background(), &lumex.Update{})
+		defer r.releaseContext(ctx)
+
+		_, err := ctx.Ask("", ExpectText(), time.Second)
+		assert.ErrorIs(t, err, ErrAskNoSender)
+	})
+
+	t.Run("prompt", func(t *testing.T) {
+		cl := mocks.NewBotClient(t)
+		cl.On(
+			"RequestWithContext",
+			mock.Anything,
+			"123:test",
+			"sendMessage",
+			mock.MatchedBy(func(params map[string]any) bool {
+				return params["chat_id"].(int64) == 1 && params["text"].(string) == "What's your email?"
+			}),
+			mock.IsType(&lumex.RequestOpts{}),
+		).Return(json.RawMessage(`{"message_id":1,"chat":{"id":1},"text":"What's your email?"}`), nil).Once()
+		bot, err := lumex.NewBot("123:test", &lumex.BotOpts{BotClient: cl, DisableTokenCheck: true})
+		assert.NoError(t, err)
+
+		r := New(bot)
+		ctx := r.acquireContext(context.Background(), askUpdate(1, 1, "/start"))
+		defer r.releaseContext(ctx)
+
+		go func() {
+			waitAsking(t, r, 1)
+			r.Deliver(askUpdate(1, 1, "me@example.com"))
+		}()
+
+		answer, err := ctx.Ask("What's your email?", ExpectText(), time.Second)
+		assert.NoError(t, err)
+		assert.Equal(t, "me@example.com", answer.Message.Text)
+	})
+
+	t.Run("prompt error", func(t *testing.T) {
+		cl := mocks.NewBotClient(t)
+		sendErr := errors.New("send error")
+		cl.On(
+			"RequestWithContext",
+			mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything,
+		).Return(nil, sendErr).Once()
+		bot, err := lumex.NewBot("123:test", &lumex.BotOpts{BotClient: cl, DisableTokenCheck: true})
+		assert.NoError(t, err)
+
+		r := New(bot)
+		ctx := r.acquireContext(context.Background(), askUpdate(1, 1, "/start"))
+		defer r.releaseContext(ctx)
+
+		_, err = ctx.Ask("What's your email?", ExpectText(), time.Second)
+		assert.ErrorIs(t, err, sendErr)
+		assert.Empty(t, r.asks.waiters)
+	})
+}
@@ -0,0 +1,385 @@
+package router
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/kbgod/lumex"
+)
+
+// callbackSeparator separates the prefix and the payload of encoded callback data.
+// It is not a part of the base64 url alphabet, so it never appears in the payload.
+const callbackSeparator = ":"
+
+var (
+	ErrCallbackPrefix    = errors.New("callback data has another prefix")
+	ErrCallbackMalformed = errors.New("malformed callback data")
+	ErrCallbackSignature = errors.New("invalid callback data signature")
+	ErrCallbackExpired   = errors.New("callback data expired")
+)
+
+// CallbackCodecOption configures CallbackCodec.
+type CallbackCodecOption func(*callbackCodecConfig)
+
+type callbackCodecConfig struct {
+	key     []byte
+	macSize int
+	ttl     time.Duration
+}
+
+// WithCallbackSignature
+//
+// signs callback data with HMAC-SHA256 truncated to size bytes, so tampered data is rejected by Decode.
+// size must be between 4 and 32, 8 bytes is a good trade-off between security and the 64 bytes limit.
+func WithCallbackSignature(key []byte, size int) CallbackCodecOption {
+	return func(cfg *callbackCodecConfig) {
+		cfg.key = key
+		cfg.macSize = size
+	}
+}
+
+// WithCallbackTTL
+//
+// adds the expiration time to callback data, so stale buttons are rejected by Decode with ErrCallbackExpired.
+// Use it with WithCallbackSignature, otherwise the expiration time can be changed by the client.
+func WithCallbackTTL(ttl time.Duration) CallbackCodecOption {
+	return func(cfg *callbackCodecConfig) {
+		cfg.ttl = ttl
+	}
+}
+
+// CallbackCodec
+//
+// packs values of the struct T into compact callback data: "<prefix>:<base64 payload>".
+// Exported fields of kinds bool, int*, uint*, float* and string (including named types like enums) are encoded
+// in order of declaration, integers as varints, floats as 8 bytes and strings with their length. Fields tagged `callback:"-"` are skipped.
+// Changing the order or the types of fields invalidates already sent buttons.
+type CallbackCodec[T any] struct {
+	prefix string
+	fields []int
+	cfg    callbackCodecConfig
+	now    func() time.Time
+}
+
+// NewCallbackCodec
+//
+// returns a codec for callback data with the given prefix, the prefix must not be empty or contain ":".
+// It returns an error if T is not a struct or has fields of unsupported kinds.
+func NewCallbackCodec[T any](prefix string, opts ...CallbackCodecOption) (*CallbackCodec[T], error) {
+	if prefix == "" || strings.Contains(prefix, callbackSeparator) {
+		return nil, fmt.Errorf("invalid callback prefix %q", prefix)
+	}
+
+	codec := &CallbackCodec[T]{prefix: prefix, now: time.Now}
+	for _, opt := range opts {
+		opt(&codec.cfg)
+	}
+
+	if codec.cfg.key != nil && (codec.cfg.macSize < 4 || codec.cfg.macSize > sha256.Size) {
+		return nil, fmt.Errorf("invalid callback signature size %d", codec.cfg.macSize)
+	}
+
+	typ := reflect.TypeFor[T]()
+	if typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("callback data type %s is not a struct", typ)
+	}
+
+	for i := range typ.NumField() {
+		field := typ.Field(i)
+		if !field.IsExported() || field.Tag.Get("callback") == "-" {
+			continue
+		}
+
+		switch field.Type.Kind() {
+		case reflect.Bool, reflect.String, reflect.Float32, reflect.Float64,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			codec.fields = append(codec.fields, i)
+		default:
+			return nil, fmt.Errorf("unsupported callback data field %s.%s of type %s", typ, field.Name, field.Type)
+		}
+	}
+
+	return codec, nil
+}
+
+// MustCallbackCodec
+//
+// is like NewCallbackCodec but panics on error.
+func MustCallbackCodec[T any](prefix string, opts ...CallbackCodecOption) *CallbackCodec[T] {
+	codec, err := NewCallbackCodec[T](prefix, opts...)
+	if err != nil {
+		panic(err)
+	}
+
+	return codec
+}
+
+// Prefix
+//
+// returns the prefix of callback data
+func (c *CallbackCodec[T]) Prefix() string {
+	return c.prefix
+}
+
+// Match
+//
+// reports whether the data has the prefix of the codec, it doesn't check the payload
+func (c *CallbackCodec[T]) Match(data string) bool {
+	payload, ok := strings.CutPrefix(data, c.prefix)
+
+	return ok && strings.HasPrefix(payload, callbackSeparator)
+}
+
+// Encode
+//
+// returns callback data for the value, it returns ErrCallbackDataTooLong if the data is longer than MaxCallbackDataLength
+func (c *CallbackCodec[T]) Encode(value T) (string, error) {
+	var payload []byte
+
+	if c.cfg.ttl > 0 {
+		payload = binary.AppendUvarint(payload, uint64(c.now().Add(c.cfg.ttl).Unix()))
+	}
+
+	v := reflect.ValueOf(value)
+	for _, i := range c.fields {
+		field := v.Field(i)
+
+		switch field.Kind() {
+		case reflect.Bool:
+			if field.Bool() {
+				payload = append(payload, 1)
+			} else {
+				payload = append(payload, 0)
+			}
+		case reflect.String:
+			payload = binary.AppendUvarint(payload, uint64(field.Len()))
+			payload = append(payload, field.String()...)
+		case reflect.Float32, reflect.Float64:
+			payload = binary.BigEndian.AppendUint64(payload, math.Float64bits(field.Float()))
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			payload = binary.AppendUvarint(payload, field.Uint())
+		default:
+			payload = binary.AppendVarint(payload, field.Int())
+		}
+	}
+
+	payload = append(payload, c.sign(payload)...)
+
+	data := c.prefix + callbackSeparator + base64.RawURLEncoding.EncodeToString(payload)
+	if len(data) > MaxCallbackDataLength {
+		return "", fmt.Errorf("%w: %q is %d bytes", ErrCallbackDataTooLong, data, len(data))
+	}
+
+	return data, nil
+}
+
+// MustEncode
+//
+// is like Encode but panics on error
+func (c *CallbackCodec[T]) MustEncode(value T) string {
+	data, err := c.Encode(value)
+	if err != nil {
+		panic(err)
+	}
+
+	return data
+}
+
+// Decode
+//
+// returns the value packed into callback data. Callback data comes from the client,
+// so the signature and the expiration time are checked before the payload is decoded.
+func (c *CallbackCodec[T]) Decode(data string) (T, error) {
+	var value T
+
+	if !c.Match(data) {
+		return value, ErrCallbackPrefix
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(data[len(c.prefix)+len(callbackSeparator):])
+	if err != nil {
+		return value, ErrCallbackMalformed
+	}
+
+	if c.cfg.key != nil {
+		if len(payload) < c.cfg.macSize {
+			return value, ErrCallbackMalformed
+		}
+
+		mac := payload[len(payload)-c.cfg.macSize:]
+		payload = payload[:len(payload)-c.cfg.macSize]
+		if !hmac.Equal(mac, c.sign(payload)) {
+			return value, ErrCallbackSignature
+		}
+	}
+
+	r := payloadReader{data: payload}
+
+	if c.cfg.ttl > 0 {
+		expiresAt := r.uvarint()
+		if r.err == nil && c.now().Unix() > int64(expiresAt) {
+			return value, ErrCallbackExpired
+		}
+	}
+
+	v := reflect.ValueOf(&value).Elem()
+	for _, i := range c.fields {
+		field := v.Field(i)
+
+		switch field.Kind() {
+		case reflect.Bool:
+			field.SetBool(r.byte() != 0)
+		case reflect.String:
+			field.SetString(r.string())
+		case reflect.Float32, reflect.Float64:
+			field.SetFloat(math.Float64frombits(r.uint64()))
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			n := r.uvarint()
+			if field.OverflowUint(n) {
+				r.fail()
+			}
+			field.SetUint(n)
+		default:
+			n := r.varint()
+			if field.OverflowInt(n) {
+				r.fail()
+			}
+			field.SetInt(n)
+		}
+	}
+
+	if r.err != nil || len(r.data) != 0 {
+		var zero T
+
+		return zero, ErrCallbackMalformed
+	}
+
+	return value, nil
+}
+
+// sign returns the truncated signature of the payload, nil if the codec has no key.
+func (c *CallbackCodec[T]) sign(payload []byte) []byte {
+	if c.cfg.key == nil {
+		return nil
+	}
+
+	mac := hmac.New(sha256.New, c.cfg.key)
+	mac.Write([]byte(c.prefix + callbackSeparator))
+	mac.Write(payload)
+
+	return mac.Sum(nil)[:c.cfg.macSize]
+}
+
+// payloadReader reads values of the payload, it remembers the first error and returns zero values after it.
+type payloadReader struct {
+	data []byte
+	err  error
+}
+
+func (r *payloadReader) fail() {
+	r.data, r.err = nil, ErrCallbackMalformed
+}
+
+func (r *payloadReader) byte() byte {
+	if len(r.data) == 0 {
+		r.fail()
+
+		return 0
+	}
+
+	b := r.data[0]
+	r.data = r.data[1:]
+
+	return b
+}
+
+func (r *payloadReader) uvarint() uint64 {
+	n, size := binary.Uvarint(r.data)
+	if size <= 0 {
+		r.fail()
+
+		return 0
+	}
+	r.data = r.data[size:]
+
+	return n
+}
+
+func (r *payloadReader) uint64() uint64 {
+	if len(r.data) < 8 {
+		r.fail()
+
+		return 0
+	}
+
+	n := binary.BigEndian.Uint64(r.data)
+	r.data = r.data[8:]
+
+	return n
+}
+
+func (r *payloadReader) varint() int64 {
+	n, size := binary.Varint(r.data)
+	if size <= 0 {
+		r.fail()
+
+		return 0
+	}
+	r.data = r.data[size:]
+
+	return n
+}
+
+func (r *payloadReader) string() string {
+	n := r.uvarint()
+	if n > uint64(len(r.data)) {
+		r.fail()
+
+		return ""
+	}
+
+	s := string(r.data[:n])
+	r.data = r.data[n:]
+
+	return s
+}
+
+// OnCallback
+//
+// registers a route for callback queries encoded by the codec and decodes callback data into T before the handler runs.
+// Decode errors like ErrCallbackSignature or ErrCallbackExpired are returned from the route, so they reach the error handler.
+// It is a function, because Go methods can't have type parameters, so middlewares of the route are added
+// with Use of the returned route, they run before callback data is decoded.
+// Example:
+// router.OnCallback(r, productCodec, func(ctx *router.Context, data Product) error {
+// return showProduct(ctx, data.ID, data.Page)
+// }).Use(adminOnly)
+func OnCallback[T any](r *Router, codec *CallbackCodec[T], handler func(ctx *Context, data T) error) *Route {
+	spec := filterSpec{
+		updateTypes:      []string{lumex.UpdateTypeCallbackQuery},
+		callbackPrefixes: []string{codec.prefix + callbackSeparator},
+	}
+	filter := describe(fmt.Sprintf("callback codec %q", codec.prefix), func(ctx *Context) bool {
+		return ctx.Update.CallbackQuery != nil && codec.Match(ctx.Update.CallbackQuery.Data)
+	})
+
+	decode := func(ctx *Context) error {
+		data, err := codec.Decode(ctx.Update.CallbackQuery.Data)
+		if err != nil {
+			return fmt.Errorf("decode callback data: %w", err)
+		}
+
+		return handler(ctx, data)
+	}
+
+	return r.on(declare(spec, filter), []Handler{decode})
+}
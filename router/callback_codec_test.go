@@ -0,0 +1,209 @@
+package router
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kbgod/lumex"
+	"github.com/stretchr/testify/assert"
+)
+
+type productStatus uint8
+
+const (
+	productActive productStatus = iota + 1
+	productArchived
+)
+
+type productData struct {
+	ID       int64
+	Page     int
+	Status   productStatus
+	Query    string
+	Discount bool
+	Price    float64
+	Note     string `callback:"-"`
+	internal int
+}
+
+func TestNewCallbackCodec(t *testing.T) {
+	_, err := NewCallbackCodec[productData]("")
+	assert.Error(t, err)
+	_, err = NewCallbackCodec[productData]("a:b")
+	assert.Error(t, err)
+	_, err = NewCallbackCodec[productData]("p", WithCallbackSignature([]byte("key"), 2))
+	assert.Error(t, err)
+	_, err = NewCallbackCodec[int]("p")
+	assert.Error(t, err)
+	_, err = NewCallbackCodec[struct{ IDs []int }]("p")
+	assert.Error(t, err)
+
+	assert.Panics(t, func() {
+		MustCallbackCodec[int]("p")
+	})
+}
+
+func TestCallbackCodec(t *testing.T) {
+	value := productData{
+		ID: -42, Page: 3, Status: productArchived, Query: "red shoes", Discount: true, Price: 9.5,
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		codec := MustCallbackCodec[productData]("p")
+
+		data, err := codec.Encode(productData{ID: value.ID, Page: 3, Status: productArchived, Query: "red shoes",
+			Discount: true, Price: 9.5, Note: "skipped", internal: 1})
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(data, "p:"), "data = %q; want prefix p:", data)
+		assert.LessOrEqual(t, len(data), MaxCallbackDataLength)
+
+		got, err := codec.Decode(data)
+		assert.NoError(t, err)
+		assert.Equal(t, value, got)
+	})
+
+	t.Run("floats", func(t *testing.T) {
+		codec := MustCallbackCodec[struct{ Price float64 }]("p")
+
+		// floats take 8 bytes, uvarints of their bits would take up to 10
+		for _, price := range []float64{0, 0.1, -9.5, math.MaxFloat64, math.SmallestNonzeroFloat64} {
+			data := codec.MustEncode(struct{ Price float64 }{Price: price})
+			assert.Len(t, data, len("p:")+base64.RawURLEncoding.EncodedLen(8))
+
+			got, err := codec.Decode(data)
+			assert.NoError(t, err)
+			assert.Equal(t, price, got.Price)
+		}
+	})
+
+	t.Run("prefix", func(t *testing.T) {
+		codec := MustCallbackCodec[productData]("p")
+		other := MustCallbackCodec[productData]("pp")
+
+		data := other.MustEncode(value)
+		assert.False(t, codec.Match(data))
+		_, err := codec.Decode(data)
+		assert.ErrorIs(t, err, ErrCallbackPrefix)
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		codec := MustCallbackCodec[productData]("p")
+
+		for _, data := range []string{"p:!!!", "p:", "p:AQ", codec.MustEncode(value) + "AA"} {
+			_, err := codec.Decode(data)
+			assert.ErrorIs(t, err, ErrCallbackMalformed, "Decode(%q)", data)
+		}
+
+		small := MustCallbackCodec[struct{ N int8 }]("p")
+		_, err := small.Decode(MustCallbackCodec[struct{ N int }]("p").MustEncode(struct{ N int }{N: 1000}))
+		assert.ErrorIs(t, err, ErrCallbackMalformed)
+	})
+
+	t.Run("too long", func(t *testing.T) {
+		codec := MustCallbackCodec[productData]("p")
+
+		_, err := codec.Encode(productData{Query: strings.Repeat("a", 64)})
+		assert.ErrorIs(t, err, ErrCallbackDataTooLong)
+		assert.Panics(t, func() {
+			codec.MustEncode(productData{Query: strings.Repeat("a", 64)})
+		})
+	})
+
+	t.Run("signature", func(t *testing.T) {
+		codec := MustCallbackCodec[productData]("p", WithCallbackSignature([]byte("secret"), 8))
+
+		data := codec.MustEncode(value)
+		got, err := codec.Decode(data)
+		assert.NoError(t, err)
+		assert.Equal(t, value, got)
+
+		tampered := []byte(data)
+		tampered[2] ^= 1
+		_, err = codec.Decode(string(tampered))
+		assert.ErrorIs(t, err, ErrCallbackSignature)
+
+		otherKey := MustCallbackCodec[productData]("p", WithCallbackSignature([]byte("other"), 8))
+		_, err = codec.Decode(otherKey.MustEncode(value))
+		assert.ErrorIs(t, err, ErrCallbackSignature)
+	})
+
+	t.Run("ttl", func(t *testing.T) {
+		codec := MustCallbackCodec[productData]("p", WithCallbackSignature([]byte("secret"), 8), WithCallbackTTL(time.Hour))
+		now := time.Now()
+		codec.now = func() time.Time {
+			return now
+		}
+
+		data := codec.MustEncode(value)
+		_, err := codec.Decode(data)
+		assert.NoError(t, err)
+
+		now = now.Add(2 * time.Hour)
+		_, err = codec.Decode(data)
+		assert.ErrorIs(t, err, ErrCallbackExpired)
+	})
+}
+
+func TestOnCallback(t *testing.T) {
+	codec := MustCallbackCodec[productData]("p", WithCallbackSignature([]byte("secret"), 8))
+
+	var errs []error
+	r := New(nil, WithErrorHandler(func(ctx *Context, err error) {
+		errs = append(errs, err)
+	}))
+
+	var got productData
+	OnCallback(r, codec, func(ctx *Context, data productData) error {
+		got = data
+
+		return nil
+	})
+
+	handle := func(data string) error {
+		return r.HandleUpdate(context.Background(), &lumex.Update{CallbackQuery: &lumex.CallbackQuery{Data: data}})
+	}
+
+	assert.NoError(t, handle(codec.MustEncode(productData{ID: 7, Status: productActive})))
+	assert.Equal(t, productData{ID: 7, Status: productActive}, got)
+
+	otherKey := MustCallbackCodec[productData]("p", WithCallbackSignature([]byte("other"), 8))
+	assert.NoError(t, handle(otherKey.MustEncode(productData{ID: 8})))
+	assert.NoError(t, handle("other:data"))
+	assert.Len(t, errs, 2)
+	assert.ErrorIs(t, errs[0], ErrCallbackSignature)
+	assert.True(t, errors.Is(errs[1], ErrRouteNotFound))
+
+	t.Run("middlewares of the route", func(t *testing.T) {
+		r := New(nil)
+		var calls []string
+		OnCallback(r, codec, func(ctx *Context, data productData) error {
+			calls = append(calls, "handler")
+
+			return nil
+		}).Use(func(ctx *Context) error {
+			calls = append(calls, "middleware")
+			if ctx.Update.CallbackQuery.From.Id != 1 {
+				return nil
+			}
+
+			return ctx.Next()
+		})
+
+		handle := func(userID int64, data string) error {
+			return r.HandleUpdate(context.Background(), &lumex.Update{CallbackQuery: &lumex.CallbackQuery{
+				From: lumex.User{Id: userID},
+				Data: data,
+			}})
+		}
+
+		assert.NoError(t, handle(1, codec.MustEncode(productData{ID: 7})))
+		// the middleware stops the update before callback data is decoded
+		assert.NoError(t, handle(2, "p:broken"))
+		assert.Equal(t, []string{"middleware", "handler", "middleware"}, calls)
+	})
+}
@@ -0,0 +1,320 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/kbgod/lumex"
+)
+
+// MaxCallbackDataLength is the maximum length of callback data in bytes allowed by Telegram.
+const MaxCallbackDataLength = 64
+
+var (
+	ErrInvalidCallbackPath  = errors.New("invalid callback path")
+	ErrInvalidCallbackParam = errors.New("invalid callback param")
+	ErrCallbackDataTooLong  = errors.New("callback data too long")
+)
+
+type segmentKind uint8
+
+const (
+	segmentStatic segmentKind = iota
+	segmentParam
+	segmentWildcard
+)
+
+type pathSegment struct {
+	kind  segmentKind
+	value string
+}
+
+// CallbackPath
+//
+// is a path-style pattern of callback data, segments are separated by "/".
+// ":name" matches a single non-empty segment, "*name" matches the rest of the data and must be the last segment.
+// Example: "product/:id/page/:n", "cat/*rest"
+// The same path is used to route callback queries with Router.OnCallbackPath and to build callback data with Build.
+type CallbackPath struct {
+	pattern  string
+	segments []pathSegment
+	params   []string
+}
+
+// NewCallbackPath
+//
+// parses the pattern, it returns an error if the pattern is malformed
+// or its static part alone doesn't fit in MaxCallbackDataLength.
+func NewCallbackPath(pattern string) (*CallbackPath, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("%w: empty pattern", ErrInvalidCallbackPath)
+	}
+
+	path := &CallbackPath{pattern: pattern}
+	minLength := len(pattern)
+
+	parts := strings.Split(pattern, "/")
+	for i, part := range parts {
+		segment := pathSegment{kind: segmentStatic, value: part}
+
+		switch {
+		case part == "":
+			return nil, fmt.Errorf("%w: empty segment in %q", ErrInvalidCallbackPath, pattern)
+		case part[0] == ':':
+			segment.kind = segmentParam
+			minLength -= len(part) - 1
+		case part[0] == '*':
+			if i != len(parts)-1 {
+				return nil, fmt.Errorf("%w: wildcard %q must be the last segment in %q", ErrInvalidCallbackPath, part, pattern)
+			}
+			segment.kind = segmentWildcard
+			minLength -= len(part)
+		}
+
+		if segment.kind != segmentStatic {
+			segment.value = part[1:]
+			if segment.value == "" {
+				return nil, fmt.Errorf("%w: unnamed parameter in %q", ErrInvalidCallbackPath, pattern)
+			}
+			path.params = append(path.params, segment.value)
+		}
+
+		path.segments = append(path.segments, segment)
+	}
+
+	if minLength > MaxCallbackDataLength {
+		return nil, fmt.Errorf("%w: pattern %q needs at least %d bytes", ErrCallbackDataTooLong, pattern, minLength)
+	}
+
+	return path, nil
+}
+
+// MustCallbackPath
+//
+// is like NewCallbackPath but panics if the pattern is invalid.
+func MustCallbackPath(pattern string) *CallbackPath {
+	path, err := NewCallbackPath(pattern)
+	if err != nil {
+		panic(err)
+	}
+
+	return path
+}
+
+// Pattern
+//
+// returns the pattern of the path
+func (p *CallbackPath) Pattern() string {
+	return p.pattern
+}
+
+// Params
+//
+// returns names of the path parameters in order of appearance
+func (p *CallbackPath) Params() []string {
+	return p.params
+}
+
+// Build
+//
+// returns callback data for the path with the given parameter values in order of appearance.
+// Values are formatted with fmt.Sprint. Parameter values must be non-empty and must not contain "/",
+// the wildcard value may contain "/" and may be empty.
+// It returns ErrCallbackDataTooLong if the data is longer than MaxCallbackDataLength.
+// Example: MustCallbackPath("product/:id/page/:n").Build(42, 2) -> "product/42/page/2"
+func (p *CallbackPath) Build(values ...any) (string, error) {
+	if len(values) != len(p.params) {
+		return "", fmt.Errorf(
+			"%w: path %q expects %d values, got %d", ErrInvalidCallbackParam, p.pattern, len(p.params), len(values),
+		)
+	}
+
+	var (
+		data  strings.Builder
+		index int
+	)
+
+	for i, segment := range p.segments {
+		if i > 0 {
+			data.WriteByte('/')
+		}
+
+		if segment.kind == segmentStatic {
+			data.WriteString(segment.value)
+
+			continue
+		}
+
+		value := fmt.Sprint(values[index])
+		index++
+
+		if segment.kind == segmentParam && (value == "" || strings.Contains(value, "/")) {
+			return "", fmt.Errorf("%w: %q = %q", ErrInvalidCallbackParam, segment.value, value)
+		}
+
+		data.WriteString(value)
+	}
+
+	if data.Len() > MaxCallbackDataLength {
+		return "", fmt.Errorf("%w: %q is %d bytes", ErrCallbackDataTooLong, data.String(), data.Len())
+	}
+
+	return data.String(), nil
+}
+
+// MustBuild
+//
+// is like Build but panics on error
+func (p *CallbackPath) MustBuild(values ...any) string {
+	data, err := p.Build(values...)
+	if err != nil {
+		panic(err)
+	}
+
+	return data
+}
+
+// callbackNode is a node of the tree of callback paths keyed by path segments.
+// Lookup costs a single walk over the callback data regardless of the number of registered paths.
+type callbackNode struct {
+	static   map[string]*callbackNode
+	param    *callbackNode
+	wildcard *CallbackPath
+	path     *CallbackPath
+}
+
+// insert adds the path to the tree and returns the path which is stored in the tree for its shape,
+// so routes registered with the same pattern share the same path.
+// It panics if a path of the same shape with different parameter names is already registered.
+func (n *callbackNode) insert(path *CallbackPath) *CallbackPath {
+	node := n
+
+	for _, segment := range path.segments {
+		switch segment.kind {
+		case segmentStatic:
+			if node.static == nil {
+				node.static = make(map[string]*callbackNode)
+			}
+			if node.static[segment.value] == nil {
+				node.static[segment.value] = &callbackNode{}
+			}
+			node = node.static[segment.value]
+		case segmentParam:
+			if node.param == nil {
+				node.param = &callbackNode{}
+			}
+			node = node.param
+		case segmentWildcard:
+			if node.wildcard == nil {
+				node.wildcard = path
+			}
+
+			return checkPathConflict(node.wildcard, path)
+		}
+	}
+
+	if node.path == nil {
+		node.path = path
+	}
+
+	return checkPathConflict(node.path, path)
+}
+
+func checkPathConflict(registered, path *CallbackPath) *CallbackPath {
+	if registered.pattern != path.pattern {
+		panic(fmt.Sprintf("callback path %q conflicts with %q", path.pattern, registered.pattern))
+	}
+
+	return registered
+}
+
+// match returns the path which matches the data and appends its parameter values to params.
+// Static segments take precedence over parameters and parameters take precedence over wildcards.
+func (n *callbackNode) match(data string, params []string) (*CallbackPath, []string) {
+	segment, rest, more := strings.Cut(data, "/")
+
+	if child := n.static[segment]; child != nil {
+		if path, values := child.matchRest(rest, more, params); path != nil {
+			return path, values
+		}
+	}
+
+	if n.param != nil && segment != "" {
+		if path, values := n.param.matchRest(rest, more, append(params, segment)); path != nil {
+			return path, values
+		}
+	}
+
+	if n.wildcard != nil {
+		return n.wildcard, append(params, data)
+	}
+
+	return nil, params
+}
+
+func (n *callbackNode) matchRest(rest string, more bool, params []string) (*CallbackPath, []string) {
+	if !more {
+		return n.path, params
+	}
+
+	return n.match(rest, params)
+}
+
+// OnCallbackPath
+//
+// registers a route for callback queries which data matches the path pattern, see CallbackPath.
+// Parameters are available in handlers with Context.Param. It panics if the pattern is invalid.
+// Example:
+// r.OnCallbackPath("product/:id/page/:n", func(ctx *Context) error {
+// return showProduct(ctx, ctx.Param("id"), ctx.Param("n"))
+// })
+func (r *Router) OnCallbackPath(pattern string, handlers ...Handler) *Route {
+	root := r.root()
+
+	if root.callbackPaths == nil {
+		root.callbackPaths = &callbackNode{}
+	}
+	path := root.callbackPaths.insert(MustCallbackPath(pattern))
+
+	filter := describe(fmt.Sprintf("callback path %q", pattern), func(ctx *Context) bool {
+		return ctx.matchCallbackPath() == path
+	})
+
+	return r.on(forUpdate(lumex.UpdateTypeCallbackQuery, filter), handlers)
+}
+
+// matchCallbackPath looks up the callback data in the tree of callback paths once per update.
+func (ctx *Context) matchCallbackPath() *CallbackPath {
+	if ctx.callbackMatched {
+		return ctx.callbackPath
+	}
+	ctx.callbackMatched = true
+
+	if ctx.Update.CallbackQuery == nil || ctx.router.callbackPaths == nil {
+		return nil
+	}
+
+	ctx.callbackPath, ctx.params = ctx.router.callbackPaths.match(ctx.Update.CallbackQuery.Data, ctx.params[:0])
+
+	return ctx.callbackPath
+}
+
+// Param
+//
+// returns the parameter of the callback path which matches callback data, empty string if not exists
+// Example: for OnCallbackPath("product/:id") and data "product/42", Param("id") -> "42"
+func (ctx *Context) Param(name string) string {
+	path := ctx.matchCallbackPath()
+	if path == nil {
+		return ""
+	}
+
+	for i, param := range path.params {
+		if param == name {
+			return ctx.params[i]
+		}
+	}
+
+	return ""
+}
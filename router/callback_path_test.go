@@ -0,0 +1,159 @@
+package router
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/kbgod/lumex"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCallbackPath(t *testing.T) {
+	cases := []struct {
+		pattern string
+		params  []string
+		err     error
+	}{
+		{"product/:id/page/:n", []string{"id", "n"}, nil},
+		{"cat/*rest", []string{"rest"}, nil},
+		{"menu", nil, nil},
+		{"", nil, ErrInvalidCallbackPath},
+		{"a//b", nil, ErrInvalidCallbackPath},
+		{"a/:", nil, ErrInvalidCallbackPath},
+		{"a/*rest/b", nil, ErrInvalidCallbackPath},
+		{strings.Repeat("a", 65), nil, ErrCallbackDataTooLong},
+		{strings.Repeat("a", 63) + "/:id", nil, ErrCallbackDataTooLong},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.pattern, func(t *testing.T) {
+			path, err := NewCallbackPath(tc.pattern)
+			if tc.err != nil {
+				assert.ErrorIs(t, err, tc.err)
+
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.pattern, path.Pattern())
+			assert.Equal(t, tc.params, path.Params())
+		})
+	}
+
+	assert.Panics(t, func() {
+		MustCallbackPath("")
+	})
+}
+
+func TestCallbackPath_Build(t *testing.T) {
+	product := MustCallbackPath("product/:id/page/:n")
+
+	data, err := product.Build(42, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, "product/42/page/2", data)
+
+	_, err = product.Build(42)
+	assert.ErrorIs(t, err, ErrInvalidCallbackParam)
+	_, err = product.Build("", 2)
+	assert.ErrorIs(t, err, ErrInvalidCallbackParam)
+	_, err = product.Build("a/b", 2)
+	assert.ErrorIs(t, err, ErrInvalidCallbackParam)
+	_, err = product.Build(strings.Repeat("1", 60), 2)
+	assert.ErrorIs(t, err, ErrCallbackDataTooLong)
+
+	assert.Equal(t, "cat/a/b", MustCallbackPath("cat/*rest").MustBuild("a/b"))
+	assert.Equal(t, "cat/", MustCallbackPath("cat/*rest").MustBuild(""))
+	assert.Panics(t, func() {
+		product.MustBuild()
+	})
+}
+
+func TestRouter_OnCallbackPath(t *testing.T) {
+	r := New(nil)
+
+	var got []string
+	handler := func(name string, params ...string) Handler {
+		return func(ctx *Context) error {
+			got = append(got, name)
+			for _, param := range params {
+				got = append(got, param+"="+ctx.Param(param))
+			}
+
+			return nil
+		}
+	}
+
+	r.OnCallbackPath("product/new", handler("new"))
+	r.OnCallbackPath("product/:id", handler("product", "id"))
+	r.OnCallbackPath("product/:id/page/:n", handler("page", "id", "n"))
+	r.OnCallbackPath("cat/*rest", handler("cat", "rest"))
+	r.OnCallbackPath("cat/top", handler("top"))
+
+	cases := []struct {
+		data string
+		want []string
+	}{
+		{"product/new", []string{"new"}},
+		{"product/42", []string{"product", "id=42"}},
+		{"product/42/page/3", []string{"page", "id=42", "n=3"}},
+		{"product/new/page/3", []string{"page", "id=new", "n=3"}},
+		{"cat/top", []string{"top"}},
+		{"cat/a/b", []string{"cat", "rest=a/b"}},
+		{"cat/", []string{"cat", "rest="}},
+		{"products/42", nil},
+		{"product", nil},
+		{"product/", nil},
+		{"product/42/page", nil},
+		{"cat", nil},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.data, func(t *testing.T) {
+			got = nil
+			err := r.HandleUpdate(context.Background(), &lumex.Update{
+				CallbackQuery: &lumex.CallbackQuery{Data: tc.data},
+			})
+			if tc.want == nil {
+				assert.ErrorIs(t, err, ErrRouteNotFound)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+
+	t.Run("state routers share patterns", func(t *testing.T) {
+		r := New(nil)
+		r.Use(func(ctx *Context) error {
+			ctx.SetState(ctx.Update.CallbackQuery.From.FirstName)
+
+			return ctx.Next()
+		})
+
+		var state string
+		for _, s := range []string{"a", "b"} {
+			r.UseState(s).OnCallbackPath("item/:id", func(ctx *Context) error {
+				state = *ctx.GetState() + ctx.Param("id")
+
+				return nil
+			})
+		}
+
+		assert.NoError(t, r.HandleUpdate(context.Background(), &lumex.Update{
+			CallbackQuery: &lumex.CallbackQuery{Data: "item/1", From: lumex.User{FirstName: "b"}},
+		}))
+		assert.Equal(t, "b1", state)
+	})
+
+	t.Run("conflicting parameter names", func(t *testing.T) {
+		assert.Panics(t, func() {
+			r.OnCallbackPath("product/:pid")
+		})
+	})
+
+	t.Run("Param without callback path", func(t *testing.T) {
+		ctx := r.acquireContext(context.Background(), &lumex.Update{Message: &lumex.Message{}})
+		assert.Empty(t, ctx.Param("id"))
+	})
+}
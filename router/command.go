@@ -0,0 +1,67 @@
+package router
+
+import (
+	"strings"
+
+	"github.com/kbgod/lumex"
+)
+
+// command is a bot command parsed from the bot_command entity at the beginning of a message.
+type command struct {
+	// name is the lowercase command name without the leading slash.
+	name string
+	// username is the bot username from "/command@username", empty if not specified.
+	username string
+	// args is the rest of the text after the command.
+	args string
+}
+
+// parseCommand parses the command from the message text or caption.
+// Only the bot_command entity at offset 0 is considered a command.
+func parseCommand(m *lumex.Message) (command, bool) {
+	text, entities := m.Text, m.Entities
+	if text == "" {
+		text, entities = m.Caption, m.CaptionEntities
+	}
+
+	for _, entity := range entities {
+		if entity.Offset != 0 || entity.Type != "bot_command" {
+			continue
+		}
+
+		// bot commands consist of ASCII characters only,
+		// so the entity length in UTF-16 code units equals its length in bytes.
+		if entity.Length < 2 || int(entity.Length) > len(text) || text[0] != '/' {
+			return command{}, false
+		}
+
+		name, username, _ := strings.Cut(text[1:entity.Length], "@")
+
+		return command{
+			name:     strings.ToLower(name),
+			username: username,
+			args:     text[entity.Length:],
+		}, true
+	}
+
+	return command{}, false
+}
+
+// commandMessage returns the message which can contain a command: new or edited message or channel post.
+func (ctx *Context) commandMessage() *lumex.Message {
+	return firstNotNil(
+		ctx.Update.Message,
+		ctx.Update.EditedMessage,
+		ctx.Update.ChannelPost,
+		ctx.Update.EditedChannelPost,
+	)
+}
+
+// addressedToBot reports whether the command without username or with the username of the bot in context.
+func (ctx *Context) addressedToBot(cmd command) bool {
+	if cmd.username == "" {
+		return true
+	}
+
+	return ctx.Bot != nil && strings.EqualFold(cmd.username, ctx.Bot.Username)
+}
@@ -0,0 +1,230 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/kbgod/lumex"
+)
+
+var ErrInvalidBotCommand = errors.New("invalid bot command")
+
+// botCommandRe is the format of command names accepted by SetMyCommands.
+var botCommandRe = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+// broadCommandScopes are the scopes checked by SyncCommands even when no route uses them,
+// so commands removed from the router are removed from the menu too.
+var broadCommandScopes = []lumex.BotCommandScope{
+	lumex.BotCommandScopeDefault{},
+	lumex.BotCommandScopeAllPrivateChats{},
+	lumex.BotCommandScopeAllGroupChats{},
+	lumex.BotCommandScopeAllChatAdministrators{},
+}
+
+func (route *Route) asCommand(command string) *Route {
+	route.command = strings.ToLower(command)
+	return route
+}
+
+// commandList is the list of bot commands for the scope and the language.
+type commandList struct {
+	scope    lumex.BotCommandScope
+	language string
+	commands []lumex.BotCommand
+}
+
+type commandListKey struct {
+	scope    lumex.MergedBotCommandScope
+	language string
+}
+
+// commandLists builds lists of bot commands from described command routes in order of registration.
+// A language list contains all commands of its scope, so commands without the translation
+// are shown with the default description instead of disappearing for users with that language.
+func (r *Router) commandLists() ([]commandList, error) {
+	type scopeRoutes struct {
+		scope     lumex.BotCommandScope
+		routes    []*Route
+		languages map[string]struct{}
+	}
+
+	var scopes []*scopeRoutes
+	byScope := make(map[lumex.MergedBotCommandScope]*scopeRoutes)
+
+	for _, route := range r.routes {
+		if route.command == "" || (route.description == "" && len(route.descriptions) == 0) {
+			continue
+		}
+
+		if err := validateCommand(route); err != nil {
+			return nil, err
+		}
+
+		routeScopes := route.scopes
+		if len(routeScopes) == 0 {
+			routeScopes = []lumex.BotCommandScope{lumex.BotCommandScopeDefault{}}
+		}
+
+		for _, scope := range routeScopes {
+			key := scope.MergeBotCommandScope()
+			sr := byScope[key]
+			if sr == nil {
+				sr = &scopeRoutes{scope: scope, languages: make(map[string]struct{})}
+				byScope[key] = sr
+				scopes = append(scopes, sr)
+			}
+
+			// the same command can be registered for several states, the first description wins
+			if slices.ContainsFunc(sr.routes, func(other *Route) bool { return other.command == route.command }) {
+				continue
+			}
+
+			sr.routes = append(sr.routes, route)
+			for language := range route.descriptions {
+				sr.languages[language] = struct{}{}
+			}
+		}
+	}
+
+	var lists []commandList
+	for _, sr := range scopes {
+		languages := make([]string, 0, len(sr.languages)+1)
+		for language := range sr.languages {
+			languages = append(languages, language)
+		}
+		sort.Strings(languages)
+
+		for _, language := range append([]string{""}, languages...) {
+			list := commandList{scope: sr.scope, language: language}
+			for _, route := range sr.routes {
+				description := route.description
+				if translated, ok := route.descriptions[language]; ok && language != "" {
+					description = translated
+				}
+
+				if description != "" {
+					list.commands = append(list.commands, lumex.BotCommand{
+						Command:     route.command,
+						Description: description,
+					})
+				}
+			}
+
+			if len(list.commands) > 0 {
+				lists = append(lists, list)
+			}
+		}
+	}
+
+	return lists, nil
+}
+
+func validateCommand(route *Route) error {
+	if !botCommandRe.MatchString(route.command) {
+		return fmt.Errorf("%w: command %q must contain 1-32 lowercase letters, digits and underscores",
+			ErrInvalidBotCommand, route.command)
+	}
+
+	descriptions := []string{route.description}
+	for _, description := range route.descriptions {
+		descriptions = append(descriptions, description)
+	}
+
+	for _, description := range descriptions {
+		if utf8.RuneCountInString(description) > 256 {
+			return fmt.Errorf("%w: description of command %q is longer than 256 characters",
+				ErrInvalidBotCommand, route.command)
+		}
+	}
+
+	return nil
+}
+
+// SyncCommands
+//
+// sets bot commands shown in the Telegram menu from routes described with Route.Describe, Route.DescribeIn and Route.Scope.
+// Current commands are requested for every scope and language used by routes
+// and for the default, all private chats, all group chats and all chat administrators scopes,
+// then only the lists which differ are set with SetMyCommands, lists without commands are removed with DeleteMyCommands.
+// Commands set for other chat specific scopes are not removed, because the Bot API can't list them.
+// Call it after all routes are registered, usually once on startup.
+// It returns ErrNoBot for a router created without a bot.
+func (r *Router) SyncCommands(ctx context.Context) error {
+	root := r.root()
+	if root.bot == nil {
+		return ErrNoBot
+	}
+
+	lists, err := root.commandLists()
+	if err != nil {
+		return err
+	}
+
+	languages := map[string]struct{}{"": {}}
+	wanted := make(map[commandListKey]commandList, len(lists))
+	for _, list := range lists {
+		wanted[commandListKey{scope: list.scope.MergeBotCommandScope(), language: list.language}] = list
+		languages[list.language] = struct{}{}
+	}
+
+	sortedLanguages := make([]string, 0, len(languages))
+	for language := range languages {
+		sortedLanguages = append(sortedLanguages, language)
+	}
+	sort.Strings(sortedLanguages)
+
+	// lists of broad scopes which are not wanted anymore are checked too, so they can be deleted
+	for _, scope := range broadCommandScopes {
+		for _, language := range sortedLanguages {
+			key := commandListKey{scope: scope.MergeBotCommandScope(), language: language}
+			if _, ok := wanted[key]; !ok {
+				lists = append(lists, commandList{scope: scope, language: language})
+			}
+		}
+	}
+
+	for _, list := range lists {
+		if err := root.syncCommandList(ctx, list); err != nil {
+			return fmt.Errorf("sync commands for scope %s and language %q: %w",
+				list.scope.GetType(), list.language, err)
+		}
+	}
+
+	return nil
+}
+
+func (r *Router) syncCommandList(ctx context.Context, list commandList) error {
+	current, err := r.bot.GetMyCommandsWithContext(ctx, &lumex.GetMyCommandsOpts{
+		Scope:        list.scope,
+		LanguageCode: list.language,
+	})
+	if err != nil {
+		return err
+	}
+
+	if slices.Equal(current, list.commands) {
+		return nil
+	}
+
+	if len(list.commands) == 0 {
+		_, err = r.bot.DeleteMyCommandsWithContext(ctx, &lumex.DeleteMyCommandsOpts{
+			Scope:        list.scope,
+			LanguageCode: list.language,
+		})
+
+		return err
+	}
+
+	_, err = r.bot.SetMyCommandsWithContext(ctx, list.commands, &lumex.SetMyCommandsOpts{
+		Scope:        list.scope,
+		LanguageCode: list.language,
+	})
+
+	return err
+}
@@ -0,0 +1,139 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/kbgod/lumex"
+	"github.com/kbgod/lumex/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// newCommandsRouter returns the router of the bot which has commands by scope and language,
+// keys are like `{"type":"default"} uk`. Other lists are empty, changes must be expected with expectCommands.
+func newCommandsRouter(t *testing.T, commands map[string][]lumex.BotCommand) (*Router, *mocks.BotClient) {
+	cl := mocks.NewBotClient(t)
+	for key, list := range commands {
+		scope, language, _ := strings.Cut(key, " ")
+		data, err := json.Marshal(list)
+		assert.NoError(t, err)
+		expectCommands(cl, "getMyCommands", scope, language, nil).Return(json.RawMessage(data), nil).Maybe()
+	}
+	cl.On("RequestWithContext", mock.Anything, mock.Anything, "getMyCommands", mock.Anything, mock.Anything).
+		Return(json.RawMessage(`[]`), nil).Maybe()
+
+	bot, err := lumex.NewBot("123:test", &lumex.BotOpts{BotClient: cl, DisableTokenCheck: true})
+	assert.NoError(t, err)
+
+	return New(bot), cl
+}
+
+// expectCommands expects the request of the method with the scope and language, and the commands for setMyCommands.
+func expectCommands(cl *mocks.BotClient, method, scope, language string, commands []lumex.BotCommand) *mock.Call {
+	return cl.On("RequestWithContext", mock.Anything, mock.Anything, method, mock.MatchedBy(func(params map[string]any) bool {
+		gotScope, _ := json.Marshal(params["scope"])
+		gotLanguage, _ := params["language_code"].(string)
+		if method == "setMyCommands" && !assert.ObjectsAreEqual(commands, params["commands"]) {
+			return false
+		}
+
+		return string(gotScope) == scope && gotLanguage == language
+	}), mock.Anything)
+}
+
+func TestRouter_SyncCommands(t *testing.T) {
+	const (
+		defaultScope = `{"type":"default"}`
+		adminScope   = `{"type":"all_chat_administrators"}`
+		privateScope = `{"type":"all_private_chats"}`
+	)
+	handler := func(ctx *Context) error { return nil }
+
+	t.Run("sets commands of scopes and languages", func(t *testing.T) {
+		want := map[string][]lumex.BotCommand{
+			defaultScope + " ":   {{Command: "start", Description: "Start the bot"}, {Command: "help", Description: "Show help"}},
+			defaultScope + " uk": {{Command: "start", Description: "Почати"}, {Command: "help", Description: "Show help"}},
+			adminScope + " ":     {{Command: "ban", Description: "Ban a user"}},
+		}
+		register := func(r *Router) {
+			r.OnStart(handler).Describe("Start the bot").DescribeIn("uk", "Почати")
+			r.OnCommand("Help", handler).Describe("Show help")
+			r.OnCommand("ban", handler).Describe("Ban a user").Scope(lumex.BotCommandScopeAllChatAdministrators{})
+			r.OnCommand("hidden", handler)
+			r.UseState("menu").OnCommand("help", handler).Describe("Another help")
+		}
+
+		r, cl := newCommandsRouter(t, nil)
+		register(r)
+		for key, commands := range want {
+			scope, language, _ := strings.Cut(key, " ")
+			expectCommands(cl, "setMyCommands", scope, language, commands).Return(json.RawMessage(`true`), nil).Once()
+		}
+		assert.NoError(t, r.SyncCommands(context.Background()))
+
+		// nothing changed, so nothing is set again
+		r, _ = newCommandsRouter(t, want)
+		register(r)
+		assert.NoError(t, r.SyncCommands(context.Background()))
+	})
+
+	t.Run("changes and deletes only outdated lists", func(t *testing.T) {
+		r, cl := newCommandsRouter(t, map[string][]lumex.BotCommand{
+			defaultScope + " ":   {{Command: "start", Description: "Start the bot"}},
+			defaultScope + " uk": {{Command: "start", Description: "Почати"}},
+			privateScope + " ":   {{Command: "old", Description: "Old command"}},
+			privateScope + " uk": {{Command: "start", Description: "Почати"}},
+		})
+		r.OnStart(handler).Describe("Start the bot").DescribeIn("uk", "Почати").Scope(lumex.BotCommandScopeAllPrivateChats{})
+		r.Group().OnCommand("settings", handler).Describe("Settings").Scope(lumex.BotCommandScopeChat{ChatId: 42})
+
+		expectCommands(cl, "setMyCommands", privateScope, "", []lumex.BotCommand{{Command: "start", Description: "Start the bot"}}).
+			Return(json.RawMessage(`true`), nil).Once()
+		expectCommands(cl, "setMyCommands", `{"type":"chat","chat_id":42}`, "", []lumex.BotCommand{{Command: "settings", Description: "Settings"}}).
+			Return(json.RawMessage(`true`), nil).Once()
+		expectCommands(cl, "deleteMyCommands", defaultScope, "", nil).Return(json.RawMessage(`true`), nil).Once()
+		expectCommands(cl, "deleteMyCommands", defaultScope, "uk", nil).Return(json.RawMessage(`true`), nil).Once()
+
+		assert.NoError(t, r.Group().SyncCommands(context.Background()))
+	})
+
+	t.Run("invalid command", func(t *testing.T) {
+		// no requests are expected
+		r, _ := newCommandsRouter(t, nil)
+		r.OnCommand("do-it", handler).Describe("Invalid name")
+
+		assert.ErrorIs(t, r.SyncCommands(context.Background()), ErrInvalidBotCommand)
+
+		r, _ = newCommandsRouter(t, nil)
+		r.OnCommand("long", handler).Describe(strings.Repeat("a", 257))
+
+		assert.ErrorIs(t, r.SyncCommands(context.Background()), ErrInvalidBotCommand)
+	})
+
+	t.Run("no bot", func(t *testing.T) {
+		r := New(nil)
+		r.OnStart(handler).Describe("Start the bot")
+
+		assert.ErrorIs(t, r.SyncCommands(context.Background()), ErrNoBot)
+	})
+
+	t.Run("request error", func(t *testing.T) {
+		requestErr := errors.New("request error")
+		cl := mocks.NewBotClient(t)
+		cl.On("RequestWithContext", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+			Return(nil, requestErr)
+		bot, err := lumex.NewBot("123:test", &lumex.BotOpts{BotClient: cl, DisableTokenCheck: true})
+		assert.NoError(t, err)
+
+		r := New(bot)
+		r.OnStart(handler).Describe("Start the bot")
+
+		err = r.SyncCommands(context.Background())
+		assert.ErrorIs(t, err, requestErr)
+		assert.ErrorContains(t, err, "scope default")
+	})
+}
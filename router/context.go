@@ -2,7 +2,9 @@ package router
 
 import (
 	"context"
+	"errors"
 	"strings"
+	"sync/atomic"
 
 	"github.com/kbgod/lumex"
 )
@@ -10,9 +12,12 @@ import (
 type BotContextKey = struct{}
 
 type Context struct {
-	state        *string
-	router       *Router
-	route        *Route
+	state  *string
+	router *Router
+	route  *Route
+	// matched is the route set by Router.next, HandleUpdate reads it while a handler which missed the deadline runs.
+	// It is a pointer, so the context can be copied.
+	matched      *atomic.Pointer[Route]
 	indexRoute   int
 	indexHandler int
 
@@ -20,6 +25,38 @@ type Context struct {
 	ctx       context.Context
 	Update    *lumex.Update
 	Bot       *lumex.Bot
+
+	// filterMessage is the message checked by message filters, see messageVariant.
+	filterMessage *lumex.Message
+	// match holds capture groups of the regex filter of the matched route, matchNames are names of the groups.
+	match      []string
+	matchNames []string
+	// callbackPath is the callback path matched by callback data, params are values of its parameters.
+	callbackPath    *CallbackPath
+	callbackMatched bool
+	params          []string
+	// values are set by Set, the slice is reused between updates, so storing values doesn't allocate in steady state.
+	values []contextValue
+	// filterTrace is set only while filters are explained, see Router.Explain.
+	filterTrace *filterTrace
+	// routes are routes checked for the update, indexRoute is the position in them.
+	// routeBuf is reused between updates to merge routes found by the index.
+	routes   []indexedRoute
+	routeBuf []indexedRoute
+	// typed is the typed context of TypedRouter, it is reused with the event context.
+	typed interface{ reset() }
+}
+
+type contextValue struct {
+	key   string
+	value any
+}
+
+// setMatched publishes the matched route for HandleUpdate, contexts made without the router don't track it.
+func (ctx *Context) setMatched(route *Route) {
+	if ctx.matched != nil {
+		ctx.matched.Store(route)
+	}
 }
 
 // Context
@@ -36,6 +73,58 @@ func (ctx *Context) SetContext(newCtx context.Context) {
 	ctx.ctx = newCtx
 }
 
+// Set
+//
+// stores the value in the event context by the key, so middlewares can pass data to handlers.
+// Values live until the update is handled.
+// Example: ctx.Set("user", user) in a middleware and router.Value[*User](ctx, "user") in a handler
+func (ctx *Context) Set(key string, value any) {
+	for i := range ctx.values {
+		if ctx.values[i].key == key {
+			ctx.values[i].value = value
+
+			return
+		}
+	}
+
+	ctx.values = append(ctx.values, contextValue{key: key, value: value})
+}
+
+// Get
+//
+// returns the value stored by Set and reports whether the key exists
+func (ctx *Context) Get(key string) (any, bool) {
+	for i := range ctx.values {
+		if ctx.values[i].key == key {
+			return ctx.values[i].value, true
+		}
+	}
+
+	return nil, false
+}
+
+// Value
+//
+// returns the value stored by Set with the type T, it reports false if the key doesn't exist or has another type
+func Value[T any](ctx *Context, key string) (T, bool) {
+	value, ok := ctx.Get(key)
+	if !ok {
+		var zero T
+
+		return zero, false
+	}
+
+	typed, ok := value.(T)
+
+	return typed, ok
+}
+
+// clearValues removes values stored by Set, keeping the slice for the next update.
+func (ctx *Context) clearValues() {
+	clear(ctx.values)
+	ctx.values = ctx.values[:0]
+}
+
 // SetParseMode
 //
 // sets default parse mode for context helpers like Reply, ReplyWithMenu, etc.
@@ -58,6 +147,13 @@ func (ctx *Context) SetState(state string) {
 	ctx.state = &state
 }
 
+// ClearState
+//
+// removes state of the event context, so only routes without state match
+func (ctx *Context) ClearState() {
+	ctx.state = nil
+}
+
 // Next
 //
 // calls handler in the chain
@@ -79,13 +175,16 @@ func (ctx *Context) Next() error {
 
 // Message
 //
-// returns message from any type of update
+// returns message from any type of update: new or edited message, channel post, business message
+// or the message of the callback query
 func (ctx *Context) Message() *lumex.Message {
 	if m := firstNotNil(
 		ctx.Update.Message,
 		ctx.Update.EditedMessage,
 		ctx.Update.ChannelPost,
 		ctx.Update.EditedChannelPost,
+		ctx.Update.BusinessMessage,
+		ctx.Update.EditedBusinessMessage,
 	); m != nil {
 		return m
 	}
@@ -115,7 +214,8 @@ func (ctx *Context) Message() *lumex.Message {
 
 // Sender
 //
-// returns sender from any type of update
+// returns sender from any type of update, nil for updates without a user like Poll and MessageReactionCount
+// or if the user is hidden like in anonymous reactions
 func (ctx *Context) Sender() *lumex.User {
 	switch {
 	case ctx.Update.CallbackQuery != nil:
@@ -124,10 +224,14 @@ func (ctx *Context) Sender() *lumex.User {
 		return ctx.Message().From
 	case ctx.Update.InlineQuery != nil:
 		return &ctx.Update.InlineQuery.From
+	case ctx.Update.ChosenInlineResult != nil:
+		return &ctx.Update.ChosenInlineResult.From
 	case ctx.Update.ShippingQuery != nil:
 		return &ctx.Update.ShippingQuery.From
 	case ctx.Update.PreCheckoutQuery != nil:
 		return &ctx.Update.PreCheckoutQuery.From
+	case ctx.Update.PurchasedPaidMedia != nil:
+		return &ctx.Update.PurchasedPaidMedia.From
 	case ctx.Update.PollAnswer != nil:
 		return ctx.Update.PollAnswer.User
 	case ctx.Update.MyChatMember != nil:
@@ -136,57 +240,130 @@ func (ctx *Context) Sender() *lumex.User {
 		return &ctx.Update.ChatMember.From
 	case ctx.Update.ChatJoinRequest != nil:
 		return &ctx.Update.ChatJoinRequest.From
+	case ctx.Update.MessageReaction != nil:
+		return ctx.Update.MessageReaction.User
+	case ctx.Update.ChatBoost != nil:
+		return boostSourceUser(ctx.Update.ChatBoost.Boost.Source)
+	case ctx.Update.RemovedChatBoost != nil:
+		return boostSourceUser(ctx.Update.RemovedChatBoost.Source)
+	case ctx.Update.BusinessConnection != nil:
+		return &ctx.Update.BusinessConnection.User
 	default:
 		return nil
 	}
 }
 
+// boostSourceUser returns the user who boosted the chat, nil for giveaways without the user.
+func boostSourceUser(source lumex.ChatBoostSource) *lumex.User {
+	if source == nil {
+		return nil
+	}
+
+	return source.MergeChatBoostSource().User
+}
+
 // Chat
 //
-// returns chat from any type of update
+// returns chat from any type of update, nil for updates outside of chats like InlineQuery and Poll
 func (ctx *Context) Chat() *lumex.Chat {
 	if m := ctx.Message(); m != nil {
 		return &m.Chat
-	} else if ctx.Update.MyChatMember != nil {
+	}
+
+	switch {
+	case ctx.Update.MyChatMember != nil:
 		return &ctx.Update.MyChatMember.Chat
-	} else if ctx.Update.ChatMember != nil {
+	case ctx.Update.ChatMember != nil:
 		return &ctx.Update.ChatMember.Chat
-	} else if ctx.Update.ChatJoinRequest != nil {
+	case ctx.Update.ChatJoinRequest != nil:
 		return &ctx.Update.ChatJoinRequest.Chat
+	case ctx.Update.MessageReaction != nil:
+		return &ctx.Update.MessageReaction.Chat
+	case ctx.Update.MessageReactionCount != nil:
+		return &ctx.Update.MessageReactionCount.Chat
+	case ctx.Update.ChatBoost != nil:
+		return &ctx.Update.ChatBoost.Chat
+	case ctx.Update.RemovedChatBoost != nil:
+		return &ctx.Update.RemovedChatBoost.Chat
+	case ctx.Update.DeletedBusinessMessages != nil:
+		return &ctx.Update.DeletedBusinessMessages.Chat
+	case ctx.Update.PollAnswer != nil:
+		// nil if the poll isn't anonymous
+		return ctx.Update.PollAnswer.VoterChat
+	default:
+		return nil
 	}
-
-	return nil
 }
 
 // ChatID
 //
-// returns chat id from any type of update
+// returns chat id from any type of update, the id of the private chat with the sender if the update has no chat.
+// It returns 0 for updates without a chat and a user like Poll.
 func (ctx *Context) ChatID() int64 {
 	if c := ctx.Chat(); c != nil {
 		return c.Id
 	}
 
+	if ctx.Update.BusinessConnection != nil {
+		return ctx.Update.BusinessConnection.UserChatId
+	}
+
 	if s := ctx.Sender(); s != nil {
 		return s.Id
 	}
 
-	// impossible
 	return 0
 }
 
 // CommandArgs
 //
-// returns command arguments from message
-// Example: "/command arg1 arg2 arg3" -> ["arg1", "arg2", "arg3"]
+// returns command arguments from message text or caption, including edited messages and channel posts.
+// Arguments are split like in a shell, so quoted strings are kept as a single argument.
+// Example: "/command arg1 'arg 2' arg3" -> ["arg1", "arg 2", "arg3"]
 func (ctx *Context) CommandArgs() []string {
-	if ctx.Update.Message == nil {
+	m := ctx.commandMessage()
+	if m == nil {
 		return nil
 	}
-	args := strings.Split(ctx.Update.Message.Text, " ")
-	if len(args) > 1 {
-		return args[1:]
+
+	tokens, _, err := commandArgTokens(m)
+	if errors.Is(err, ErrUnterminatedQuote) {
+		cmd, _ := parseCommand(m)
+
+		return strings.Fields(cmd.args)
 	}
-	return nil
+	if err != nil || len(tokens) == 0 {
+		return nil
+	}
+
+	args := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		args = append(args, token.value)
+	}
+
+	return args
+}
+
+// Match
+//
+// returns the named capture group of the regex filter which matched the route, empty string if not exists
+// Example: for TextRegex(`order #(?P<id>\d+)`) and text "order #123", Match("id") -> "123"
+func (ctx *Context) Match(name string) string {
+	for i, groupName := range ctx.matchNames {
+		if groupName == name && name != "" && i < len(ctx.match) {
+			return ctx.match[i]
+		}
+	}
+
+	return ""
+}
+
+// Matches
+//
+// returns the whole match and all capture groups of the regex filter which matched the route
+// Example: for TextRegex(`pay (\d+) (\w+)`) and text "pay 50 usd", Matches() -> ["pay 50 usd", "50", "usd"]
+func (ctx *Context) Matches() []string {
+	return ctx.match
 }
 
 // CallbackData
@@ -34,6 +34,119 @@ func TestContext_Context(t *testing.T) {
 
 }
 
+func TestContext_Values(t *testing.T) {
+	type user struct {
+		ID int64
+	}
+
+	r := New(nil)
+	ctx := r.acquireContext(context.Background(), &lumex.Update{})
+
+	_, ok := ctx.Get("user")
+	assert.False(t, ok, "ctx.Get() of unknown key = true; want false")
+
+	ctx.Set("user", &user{ID: 1})
+	ctx.Set("locale", "uk")
+	ctx.Set("locale", "en")
+	ctx.Set("nil", nil)
+
+	value, ok := ctx.Get("locale")
+	assert.True(t, ok)
+	assert.Equal(t, "en", value)
+
+	value, ok = ctx.Get("nil")
+	assert.True(t, ok)
+	assert.Nil(t, value)
+
+	u, ok := Value[*user](ctx, "user")
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), u.ID)
+
+	_, ok = Value[string](ctx, "user")
+	assert.False(t, ok, "Value[string]() of *user = true; want false")
+	_, ok = Value[string](ctx, "unknown")
+	assert.False(t, ok, "Value[string]() of unknown key = true; want false")
+
+	values := ctx.values[:cap(ctx.values)]
+	r.releaseContext(ctx)
+	for _, v := range values {
+		assert.Nil(t, v.value, "released context keeps value of %q", v.key)
+	}
+
+	ctx = r.acquireContext(context.Background(), &lumex.Update{})
+	_, ok = ctx.Get("locale")
+	assert.False(t, ok, "ctx.Get() after acquireContext = true; want false")
+}
+
+func TestContext_ValuesFromMiddleware(t *testing.T) {
+	r := New(nil)
+	r.Use(func(ctx *Context) error {
+		ctx.Set("locale", "en")
+
+		return ctx.Next()
+	})
+
+	var locale string
+	r.OnUpdate(func(ctx *Context) error {
+		locale, _ = Value[string](ctx, "locale")
+
+		return nil
+	})
+
+	assert.NoError(t, r.HandleUpdate(context.Background(), &lumex.Update{}))
+	assert.Equal(t, "en", locale)
+}
+
+func BenchmarkHandleUpdate(b *testing.B) {
+	update := &lumex.Update{Message: &lumex.Message{Text: "hello"}}
+
+	b.Run("without values", func(b *testing.B) {
+		r := New(nil)
+		r.OnMessage(func(ctx *Context) error {
+			return nil
+		})
+
+		b.ReportAllocs()
+		for range b.N {
+			_ = r.HandleUpdate(context.Background(), update)
+		}
+	})
+
+	b.Run("with values", func(b *testing.B) {
+		r := New(nil)
+		r.Use(func(ctx *Context) error {
+			ctx.Set("locale", "en")
+			ctx.Set("admin", true)
+
+			return ctx.Next()
+		})
+		r.OnMessage(func(ctx *Context) error {
+			_, _ = Value[string](ctx, "locale")
+			_, _ = Value[bool](ctx, "admin")
+
+			return nil
+		})
+
+		b.ReportAllocs()
+		for range b.N {
+			_ = r.HandleUpdate(context.Background(), update)
+		}
+	})
+}
+
+func BenchmarkContext_Get(b *testing.B) {
+	r := New(nil)
+	ctx := r.acquireContext(context.Background(), &lumex.Update{})
+	for _, key := range []string{"user", "locale", "permissions", "tenant"} {
+		ctx.Set(key, key)
+	}
+
+	b.ReportAllocs()
+	for range b.N {
+		_, _ = Value[string](ctx, "tenant")
+	}
+}
+
 func TestContext_SetParseMode(t *testing.T) {
 	t.Run("empty send message opts", func(t *testing.T) {
 		cl := mocks.NewBotClient(t)
@@ -163,6 +276,16 @@ func TestContext_SetState(t *testing.T) {
 	}
 }
 
+func TestContext_ClearState(t *testing.T) {
+	ctx := new(Context)
+	ctx.SetState("test")
+	ctx.ClearState()
+
+	if ctx.state != nil {
+		t.Errorf("ctx.state = %v; want <nil>", ctx.state)
+	}
+}
+
 func TestContext_Next(t *testing.T) {
 	tests := []struct {
 		name                    string
@@ -177,7 +300,8 @@ func TestContext_Next(t *testing.T) {
 			name: "Valid command",
 			update: &lumex.Update{
 				Message: &lumex.Message{
-					Text: "/test",
+					Text:     "/test",
+					Entities: []lumex.MessageEntity{{Type: "bot_command", Length: 5}},
 				},
 			},
 			wantErr:                 nil,
@@ -617,11 +741,162 @@ func TestContext_ChatID(t *testing.T) {
 	assert.Equal(t, int64(0), ctx.ChatID(), "ctx.ChatId() = %v; want 0", ctx.ChatID())
 }
 
+func TestContext_UpdateTypes(t *testing.T) {
+	user := lumex.User{Id: 1}
+	chat := lumex.Chat{Id: 2}
+	message := &lumex.Message{From: &user, Chat: chat}
+
+	tests := []struct {
+		update *lumex.Update
+		// route is the On* helper which handles the update
+		route   string
+		message bool
+		// sender and chat are ids, 0 if the accessor returns nil
+		sender int64
+		chat   int64
+		chatID int64
+	}{
+		{update: &lumex.Update{Message: message}, route: "message", message: true, sender: 1, chat: 2, chatID: 2},
+		{update: &lumex.Update{EditedMessage: message}, route: "edited message", message: true, sender: 1, chat: 2, chatID: 2},
+		{update: &lumex.Update{ChannelPost: message}, route: "channel post", message: true, sender: 1, chat: 2, chatID: 2},
+		{
+			update: &lumex.Update{EditedChannelPost: message},
+			route:  "edited channel post", message: true, sender: 1, chat: 2, chatID: 2,
+		},
+		{
+			update: &lumex.Update{BusinessConnection: &lumex.BusinessConnection{User: user, UserChatId: 3}},
+			route:  "business connection", sender: 1, chatID: 3,
+		},
+		{update: &lumex.Update{BusinessMessage: message}, route: "business message", message: true, sender: 1, chat: 2, chatID: 2},
+		{
+			update: &lumex.Update{EditedBusinessMessage: message},
+			route:  "edited business message", message: true, sender: 1, chat: 2, chatID: 2,
+		},
+		{
+			update: &lumex.Update{DeletedBusinessMessages: &lumex.BusinessMessagesDeleted{Chat: chat}},
+			route:  "deleted business messages", chat: 2, chatID: 2,
+		},
+		{
+			update: &lumex.Update{MessageReaction: &lumex.MessageReactionUpdated{Chat: chat, User: &user}},
+			route:  "message reaction", sender: 1, chat: 2, chatID: 2,
+		},
+		{
+			update: &lumex.Update{MessageReactionCount: &lumex.MessageReactionCountUpdated{Chat: chat}},
+			route:  "message reaction count", chat: 2, chatID: 2,
+		},
+		{update: &lumex.Update{InlineQuery: &lumex.InlineQuery{From: user}}, route: "inline query", sender: 1, chatID: 1},
+		{
+			update: &lumex.Update{ChosenInlineResult: &lumex.ChosenInlineResult{From: user}},
+			route:  "chosen inline result", sender: 1, chatID: 1,
+		},
+		{
+			update: &lumex.Update{CallbackQuery: &lumex.CallbackQuery{From: user, Message: message}},
+			route:  "callback query", message: true, sender: 1, chat: 2, chatID: 2,
+		},
+		{update: &lumex.Update{ShippingQuery: &lumex.ShippingQuery{From: user}}, route: "shipping query", sender: 1, chatID: 1},
+		{
+			update: &lumex.Update{PreCheckoutQuery: &lumex.PreCheckoutQuery{From: user}},
+			route:  "pre-checkout query", sender: 1, chatID: 1,
+		},
+		{
+			update: &lumex.Update{PurchasedPaidMedia: &lumex.PaidMediaPurchased{From: user}},
+			route:  "purchased paid media", sender: 1, chatID: 1,
+		},
+		{update: &lumex.Update{Poll: &lumex.Poll{}}, route: "poll"},
+		{update: &lumex.Update{PollAnswer: &lumex.PollAnswer{User: &user}}, route: "poll answer", sender: 1, chatID: 1},
+		{
+			update: &lumex.Update{MyChatMember: &lumex.ChatMemberUpdated{From: user, Chat: chat}},
+			route:  "my chat member", sender: 1, chat: 2, chatID: 2,
+		},
+		{
+			update: &lumex.Update{ChatMember: &lumex.ChatMemberUpdated{From: user, Chat: chat}},
+			route:  "chat member", sender: 1, chat: 2, chatID: 2,
+		},
+		{
+			update: &lumex.Update{ChatJoinRequest: &lumex.ChatJoinRequest{From: user, Chat: chat}},
+			route:  "chat join request", sender: 1, chat: 2, chatID: 2,
+		},
+		{
+			update: &lumex.Update{ChatBoost: &lumex.ChatBoostUpdated{
+				Chat:  chat,
+				Boost: lumex.ChatBoost{Source: lumex.ChatBoostSourcePremium{User: user}},
+			}},
+			route: "chat boost", sender: 1, chat: 2, chatID: 2,
+		},
+		{
+			update: &lumex.Update{RemovedChatBoost: &lumex.ChatBoostRemoved{
+				Chat:   chat,
+				Source: lumex.ChatBoostSourceGiveaway{},
+			}},
+			route: "removed chat boost", chat: 2, chatID: 2,
+		},
+	}
+
+	var handled string
+	r := New(&lumex.Bot{})
+	for name, on := range map[string]func(handlers ...Handler) *Route{
+		"message":                   r.OnMessage,
+		"edited message":            r.OnEditedMessage,
+		"channel post":              r.OnChannelPost,
+		"edited channel post":       r.OnEditedChannelPost,
+		"business connection":       r.OnBusinessConnection,
+		"business message":          r.OnBusinessMessage,
+		"edited business message":   r.OnEditedBusinessMessage,
+		"deleted business messages": r.OnDeletedBusinessMessages,
+		"message reaction":          r.OnMessageReaction,
+		"message reaction count":    r.OnMessageReactionCount,
+		"inline query":              r.OnInlineQuery,
+		"chosen inline result":      r.OnChosenInlineResult,
+		"callback query":            r.OnCallbackQuery,
+		"shipping query":            r.OnShippingQuery,
+		"pre-checkout query":        r.OnPreCheckoutQuery,
+		"purchased paid media":      r.OnPurchasedPaidMedia,
+		"poll":                      r.OnPoll,
+		"poll answer":               r.OnPollAnswer,
+		"my chat member":            r.OnMyChatMember,
+		"chat member":               r.OnChatMember,
+		"chat join request":         r.OnChatJoinRequest,
+		"chat boost":                r.OnChatBoost,
+		"removed chat boost":        r.OnRemovedChatBoost,
+	} {
+		on(func(ctx *Context) error {
+			handled = name
+
+			return nil
+		})
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.update.GetType(), func(t *testing.T) {
+			ctx := r.acquireContext(context.Background(), tc.update)
+			defer r.releaseContext(ctx)
+
+			assert.Equal(t, tc.message, ctx.Message() != nil, "ctx.Message()")
+
+			var sender, chatID int64
+			if s := ctx.Sender(); s != nil {
+				sender = s.Id
+			}
+			if c := ctx.Chat(); c != nil {
+				chatID = c.Id
+			}
+			assert.Equal(t, tc.sender, sender, "ctx.Sender()")
+			assert.Equal(t, tc.chat, chatID, "ctx.Chat()")
+			assert.Equal(t, tc.chatID, ctx.ChatID(), "ctx.ChatID()")
+
+			handled = ""
+			assert.NoError(t, r.HandleUpdate(context.Background(), tc.update))
+			assert.Equal(t, tc.route, handled)
+		})
+	}
+}
+
 func TestContext_CommandArgs(t *testing.T) {
 	r := New(&lumex.Bot{})
 	ctx := r.acquireContext(context.Background(), &lumex.Update{
 		Message: &lumex.Message{
-			Text: "/test arg1 arg2",
+			Text:     "/test arg1 arg2",
+			Entities: []lumex.MessageEntity{{Type: "bot_command", Length: 5}},
 		},
 	})
 	if len(ctx.CommandArgs()) != 2 {
@@ -636,7 +911,8 @@ func TestContext_CommandArgs(t *testing.T) {
 
 	ctx = r.acquireContext(context.Background(), &lumex.Update{
 		Message: &lumex.Message{
-			Text: "/test",
+			Text:     "/test",
+			Entities: []lumex.MessageEntity{{Type: "bot_command", Length: 5}},
 		},
 	})
 	if len(ctx.CommandArgs()) != 0 {
@@ -647,6 +923,29 @@ func TestContext_CommandArgs(t *testing.T) {
 	if ctx.CommandArgs() != nil {
 		t.Errorf("ctx.CommandArgs() = %v; want <nil>", ctx.CommandArgs())
 	}
+
+	ctx = r.acquireContext(context.Background(), &lumex.Update{
+		Message: &lumex.Message{
+			Caption:         "/test arg1",
+			CaptionEntities: []lumex.MessageEntity{{Type: "bot_command", Length: 5}},
+		},
+	})
+	assert.Equal(t, []string{"arg1"}, ctx.CommandArgs(), "ctx.CommandArgs() for caption")
+
+	ctx = r.acquireContext(context.Background(), &lumex.Update{
+		EditedMessage: &lumex.Message{
+			Text:     "/test@bot arg1",
+			Entities: []lumex.MessageEntity{{Type: "bot_command", Length: 9}},
+		},
+	})
+	assert.Equal(t, []string{"arg1"}, ctx.CommandArgs(), "ctx.CommandArgs() for edited message")
+
+	ctx = r.acquireContext(context.Background(), &lumex.Update{
+		Message: &lumex.Message{
+			Text: "not a command arg1",
+		},
+	})
+	assert.Nil(t, ctx.CommandArgs(), "ctx.CommandArgs() for plain text")
 }
 
 func TestContext_Reply(t *testing.T) {
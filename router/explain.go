@@ -0,0 +1,339 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/kbgod/lumex"
+)
+
+// customFilterDescription describes routes of On without Route.DescribeFilter and custom filters checked by Explain.
+const customFilterDescription = "custom filter"
+
+// filterTrace is set on the context by Router.Explain, so filters of the package report the innermost filter
+// which didn't match. Filters are described while they are checked, filters like And are described by the filters
+// they checked, so custom filters are never called to describe them.
+type filterTrace struct {
+	failed string
+	// described is the description of the last checked filter.
+	described string
+}
+
+// describe returns the filter of the package with the description, the filter reports it to Router.Explain.
+func describe(description string, match RouteFilter) describedFilter {
+	return describedFilter{description: description, filter: func(ctx *Context) bool {
+		ok := match(ctx)
+		if trace := ctx.filterTrace; trace != nil {
+			trace.report(description, ok)
+		}
+
+		return ok
+	}}
+}
+
+// report records the description of the checked filter, which is the innermost failed filter if it didn't match.
+func (t *filterTrace) report(description string, ok bool) {
+	t.described = description
+	if !ok {
+		t.failed = description
+	}
+}
+
+// check calls the filter and returns its result with its description, filters which don't report it are custom.
+func (t *filterTrace) check(ctx *Context, filter RouteFilter) (bool, string) {
+	t.described = ""
+	ok := filter(ctx)
+	if t.described == "" {
+		t.report(customFilterDescription, ok)
+	}
+
+	return ok, t.described
+}
+
+// all checks filters like And, the filter which didn't match is reported as failed.
+func (t *filterTrace) all(ctx *Context, name string, filters []RouteFilter) bool {
+	descriptions := make([]string, 0, len(filters))
+	for i, filter := range filters {
+		ok, description := t.check(ctx, filter)
+		descriptions = append(descriptions, description)
+		if !ok {
+			t.described = joinDescriptions(name, descriptions, i < len(filters)-1)
+
+			return false
+		}
+	}
+
+	t.described = joinDescriptions(name, descriptions, false)
+
+	return true
+}
+
+// any checks filters like Or, every filter failed if none matches, so Or is reported instead of the last of them.
+func (t *filterTrace) any(ctx *Context, filters []RouteFilter) bool {
+	descriptions := make([]string, 0, len(filters))
+	for i, filter := range filters {
+		ok, description := t.check(ctx, filter)
+		descriptions = append(descriptions, description)
+		if ok {
+			t.described = joinDescriptions("or", descriptions, i < len(filters)-1)
+
+			return true
+		}
+	}
+
+	t.report(joinDescriptions("or", descriptions, false), false)
+
+	return false
+}
+
+// not checks the filter like Not, Not is reported as failed if the filter matches.
+func (t *filterTrace) not(ctx *Context, filter RouteFilter) bool {
+	ok, description := t.check(ctx, filter)
+	t.report("not("+description+")", !ok)
+
+	return !ok
+}
+
+// joinDescriptions returns the description like "name(a, b)" or just "name" if there are no filters.
+// Filters which were not checked are shown as "...".
+func joinDescriptions(name string, descriptions []string, unchecked bool) string {
+	if unchecked {
+		descriptions = append(descriptions, "...")
+	}
+
+	if len(descriptions) == 0 {
+		return name
+	}
+
+	return name + "(" + strings.Join(descriptions, ", ") + ")"
+}
+
+// describeCommands returns the command with aliases like "/start|/begin".
+func describeCommands(command string, aliases []string) string {
+	names := make([]string, 0, len(aliases)+1)
+	for _, name := range append([]string{command}, aliases...) {
+		names = append(names, "/"+strings.ToLower(name))
+	}
+
+	return strings.Join(names, "|")
+}
+
+func forumTopicDescription(threadIDs []int64) string {
+	if len(threadIDs) == 0 {
+		return "forum topic"
+	}
+
+	return fmt.Sprintf("forum topic %v", threadIDs)
+}
+
+// RouteExplanation is the result of checking the route by Router.Explain.
+type RouteExplanation struct {
+	Route *Route
+	// Filter is the description of the route filter, see Route.GetFilterDescription.
+	Filter        string
+	FilterMatched bool
+	// FailedFilter is the description of the innermost filter which didn't match.
+	FailedFilter string
+	StateMatched bool
+}
+
+// Matched reports whether the route matches the update.
+func (e RouteExplanation) Matched() bool {
+	return e.FilterMatched && e.StateMatched
+}
+
+// Explanation is the result of Router.Explain.
+type Explanation struct {
+	Routes []RouteExplanation
+	// Handled is the first matched route or the fallback route registered with NotFound, which handles the update.
+	// It is nil if no route matches and there is no fallback for the state.
+	Handled *Route
+	// NotFound reports whether no route matches the update, Handled is the fallback route in this case.
+	NotFound bool
+	// Delivered reports whether the update is a reply to a handler waiting in Context.Ask, so it is not routed.
+	Delivered bool
+}
+
+// String formats the explanation as a report with a line per route.
+func (e *Explanation) String() string {
+	var b strings.Builder
+
+	if e.Delivered {
+		b.WriteString("delivered to a handler waiting in Ask\n")
+	}
+
+	for i, route := range e.Routes {
+		fmt.Fprintf(&b, "#%d %s state=%s: %s\n", i, route.Filter, route.Route.GetFormattedState(), e.result(route))
+	}
+
+	switch {
+	case e.Handled == nil:
+		b.WriteString(ErrRouteNotFound.Error() + "\n")
+	case e.NotFound:
+		fmt.Fprintf(&b, "not found: handled by fallback state=%s\n", e.Handled.GetFormattedState())
+	}
+
+	return b.String()
+}
+
+func (e *Explanation) result(route RouteExplanation) string {
+	switch {
+	case route.Route == e.Handled:
+		return "handled"
+	case route.Matched():
+		return "matched"
+	case !route.FilterMatched:
+		return "filter failed: " + route.FailedFilter
+	default:
+		return "state mismatch"
+	}
+}
+
+// Explain
+//
+// checks every route against the update without calling handlers and middlewares
+// and reports which filter or state check failed and which route handles the update.
+// The state is unknown without middlewares, so routes with a state don't match, use ExplainState for them.
+func (r *Router) Explain(update *lumex.Update) *Explanation {
+	return r.explain(update, nil)
+}
+
+// ExplainState
+//
+// is like Explain, but routes are checked as if the middlewares set the state with Context.SetState.
+func (r *Router) ExplainState(update *lumex.Update, state string) *Explanation {
+	return r.explain(update, &state)
+}
+
+func (r *Router) explain(update *lumex.Update, state *string) *Explanation {
+	root := r.root()
+
+	explanation := &Explanation{Delivered: root.asks.waiting.Load() > 0 && root.wouldDeliver(update)}
+
+	ctx := root.acquireContext(context.Background(), update)
+	defer func() {
+		ctx.filterTrace = nil
+		root.releaseContext(ctx)
+	}()
+	ctx.state = state
+	ctx.filterTrace = &filterTrace{}
+
+	for _, route := range root.routes {
+		ctx.filterTrace.failed, ctx.filterTrace.described = "", ""
+		ctx.match, ctx.matchNames = nil, nil
+
+		e := RouteExplanation{
+			Route:        route,
+			Filter:       route.GetFilterDescription(),
+			StateMatched: route.matchState(ctx.state),
+		}
+		e.FilterMatched = route.filter(ctx)
+		if !e.FilterMatched {
+			e.FailedFilter = ctx.filterTrace.failed
+			if ctx.filterTrace.described == "" {
+				// the custom filter of the route is reported as the route filter
+				e.FailedFilter = e.Filter
+			}
+		}
+
+		if e.Matched() && explanation.Handled == nil {
+			explanation.Handled = route
+		}
+
+		explanation.Routes = append(explanation.Routes, e)
+	}
+
+	if explanation.Handled == nil {
+		explanation.Handled = root.notFoundRoute(state)
+		explanation.NotFound = true
+	}
+
+	return explanation
+}
+
+// wouldDeliver reports whether Deliver would pass the update to a waiting handler.
+func (r *Router) wouldDeliver(update *lumex.Update) bool {
+	ctx := r.acquireContext(context.Background(), update)
+	defer r.releaseContext(ctx)
+
+	_, waiter := r.asks.waiterFor(ctx)
+
+	return waiter != nil
+}
+
+// Dump
+//
+// writes the route table: filters, states, middlewares and handlers of routes in order of checking.
+// Middlewares of the router are called for every update, group middlewares are called before route handlers.
+func (r *Router) Dump(w io.Writer) error {
+	root := r.root()
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	if len(root.handlers) > 0 {
+		fmt.Fprintf(tw, "middlewares: %s\n\n", handlerNames(root.handlers))
+	}
+
+	fmt.Fprintln(tw, "#\tNAME\tFILTER\tSTATE\tMIDDLEWARES\tHANDLERS")
+	for i, route := range root.routes {
+		dumpRoute(tw, strconv.Itoa(i), route.GetFilterDescription(), route)
+	}
+
+	// fallbacks are called only if no route matches
+	for _, route := range root.notFound {
+		dumpRoute(tw, "-", "not found", route)
+	}
+
+	return tw.Flush()
+}
+
+func dumpRoute(w io.Writer, index, filter string, route *Route) {
+	name := route.name
+	if name == "" {
+		name = "-"
+	}
+
+	middlewares := handlerNames(route.handlers[:route.middlewares])
+	if middlewares == "" {
+		middlewares = "-"
+	}
+
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", index, name, filter,
+		route.GetFormattedState(), middlewares, handlerNames(route.handlers[route.middlewares:]))
+}
+
+// handlerNames returns names of the functions like "main.auth -> main.start".
+func handlerNames(handlers []Handler) string {
+	names := make([]string, len(handlers))
+	for i, handler := range handlers {
+		names[i] = handlerName(handler)
+	}
+
+	return strings.Join(names, " -> ")
+}
+
+// closureSuffix matches suffixes of names the compiler gives to function literals, like ".func1" or ".func2.3".
+var closureSuffix = regexp.MustCompile(`(\.func\d+)+(\.\d+)*$`)
+
+// handlerName returns the name of the function, function literals are shown as closures of the enclosing function,
+// like "main.main (closure)", because names the compiler gives them change with inlining.
+func handlerName(handler Handler) string {
+	fn := runtime.FuncForPC(reflect.ValueOf(handler).Pointer())
+	if fn == nil {
+		return "unknown"
+	}
+
+	name := fn.Name()
+	if loc := closureSuffix.FindStringIndex(name); loc != nil {
+		return name[:loc[0]] + " (closure)"
+	}
+
+	return name
+}
@@ -0,0 +1,146 @@
+package router
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/kbgod/lumex"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoute_GetFilterDescription(t *testing.T) {
+	handler := func(ctx *Context) error { return nil }
+	custom := func(ctx *Context) bool { return true }
+
+	r := New(nil)
+	tests := []struct {
+		route *Route
+		want  string
+	}{
+		{route: r.OnUpdate(handler), want: "any update"},
+		{route: r.OnCommand("Start", handler), want: "command /start"},
+		{route: r.OnMessage(handler), want: "message"},
+		{route: r.OnEditedMessage(handler), want: "edited message"},
+		{route: r.OnCallbackRegex(`^item:(\d+)$`, handler), want: `callback data matches "^item:(\\d+)$"`},
+		{route: r.On(Message(TextEquals("hi")), handler), want: "custom filter"},
+		{route: r.On(custom, handler).DescribeFilter("premium user"), want: "premium user"},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(t, tc.want, tc.route.GetFilterDescription())
+	}
+}
+
+func TestRouter_Explain_failedFilter(t *testing.T) {
+	custom := func(ctx *Context) bool { return false }
+	sticker := &lumex.Update{Message: &lumex.Message{
+		Sticker: &lumex.Sticker{},
+		Chat:    lumex.Chat{Type: lumex.ChatTypePrivate},
+	}}
+
+	tests := []struct {
+		name   string
+		filter RouteFilter
+		want   string
+	}{
+		{name: "leaf", filter: Message(PrivateChat(), Text()), want: "text"},
+		{name: "or", filter: And(PrivateChat(), Or(Text(), Not(Sticker()))), want: "or(text, not(sticker))"},
+		{name: "or of unchecked and", filter: Or(And(Text(), Caption()), Photo()), want: "or(and(text, ...), photo)"},
+		{name: "message variant", filter: EditedMessage(Sticker()), want: "edited message"},
+		{name: "custom", filter: Message(PrivateChat(), custom), want: "custom filter"},
+		{name: "route filter", filter: custom, want: "premium user"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := New(nil)
+			r.On(tc.filter, func(ctx *Context) error { return nil }).DescribeFilter("premium user")
+
+			e := r.Explain(sticker)
+			if assert.Len(t, e.Routes, 1) {
+				assert.False(t, e.Routes[0].FilterMatched)
+				assert.Equal(t, tc.want, e.Routes[0].FailedFilter)
+			}
+		})
+	}
+}
+
+func TestRouter_Explain(t *testing.T) {
+	handler := func(ctx *Context) error { return nil }
+
+	r := New(nil)
+	r.OnCommand("start", handler)
+	r.On(Message(PrivateChat(), Or(Photo(), Video())), handler)
+	r.UseState("menu").OnMessage(handler)
+	r.OnTextPrefix("buy", handler)
+	r.OnUpdate(handler)
+
+	update := &lumex.Update{Message: &lumex.Message{Text: "buy milk", Chat: lumex.Chat{Type: lumex.ChatTypePrivate}}}
+
+	t.Run("without state", func(t *testing.T) {
+		e := r.Explain(update)
+		if assert.Len(t, e.Routes, 5) {
+			assert.Equal(t, "filter failed: command /start", e.result(e.Routes[0]))
+			assert.Equal(t, "filter failed: or(photo, video)", e.result(e.Routes[1]))
+			assert.Equal(t, "state mismatch", e.result(e.Routes[2]))
+			assert.Equal(t, "handled", e.result(e.Routes[3]))
+			assert.Equal(t, "matched", e.result(e.Routes[4]))
+		}
+		assert.Same(t, r.GetRoutes()[3], e.Handled)
+		assert.False(t, e.Delivered)
+		assert.Contains(t, e.String(), `#3 text has prefix "buy" state=<nil>: handled`)
+	})
+
+	t.Run("with state", func(t *testing.T) {
+		e := r.ExplainState(update, "menu")
+		assert.Same(t, r.GetRoutes()[2], e.Handled)
+		assert.Equal(t, "message", e.Routes[2].Filter)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		r := New(nil)
+		r.On(Message(PrivateChat(), TextEquals("hi")), handler)
+
+		e := r.Explain(update)
+		assert.Nil(t, e.Handled)
+		assert.Equal(t, `text equals "hi"`, e.Routes[0].FailedFilter)
+		assert.Contains(t, e.String(), ErrRouteNotFound.Error())
+	})
+}
+
+func dumpMiddleware(ctx *Context) error { return ctx.Next() }
+
+func dumpHandler(ctx *Context) error { return nil }
+
+func TestHandlerName(t *testing.T) {
+	assert.Equal(t, "github.com/kbgod/lumex/router.dumpHandler", handlerName(dumpHandler))
+	assert.Equal(t, "github.com/kbgod/lumex/router.TestHandlerName (closure)", handlerName(func(ctx *Context) error {
+		return nil
+	}))
+	assert.Equal(t, "github.com/kbgod/lumex/router.(*Context).Next", handlerName((*Context).Next))
+}
+
+func TestRouter_Dump(t *testing.T) {
+	r := New(nil)
+	r.Use(dumpMiddleware)
+	r.OnStart(dumpHandler).Name("start")
+	r.UseState("menu", dumpMiddleware).Group(dumpMiddleware).OnMessage(dumpHandler)
+
+	var buf bytes.Buffer
+	assert.NoError(t, r.Dump(&buf))
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if assert.Len(t, lines, 5) {
+		assert.Equal(t, "middlewares: github.com/kbgod/lumex/router.dumpMiddleware", lines[0])
+		assert.Equal(t, []string{"#", "NAME", "FILTER", "STATE", "MIDDLEWARES", "HANDLERS"}, strings.Fields(lines[2]))
+		assert.Equal(t, []string{
+			"0", "start", "command", "/start", "<nil>", "-", "github.com/kbgod/lumex/router.dumpHandler",
+		}, strings.Fields(lines[3]))
+		assert.Equal(t, []string{
+			"1", "-", "message", "menu",
+			"github.com/kbgod/lumex/router.dumpMiddleware", "->", "github.com/kbgod/lumex/router.dumpMiddleware",
+			"github.com/kbgod/lumex/router.dumpHandler",
+		}, strings.Fields(lines[4]))
+	}
+}
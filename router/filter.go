@@ -1,231 +1,977 @@
 package router
 
-import "strings"
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/kbgod/lumex"
+)
 
 type RouteFilter func(*Context) bool
 
-// Command returns a filter that checks if the message is a command with the given command name.
-// The command name should not contain the leading slash.
-func Command(command string) RouteFilter {
+// describedFilter is a filter of the package with the spec and the description
+// which routes registered by On* helpers carry, see Router.on.
+type describedFilter struct {
+	filter      RouteFilter
+	spec        filterSpec
+	description string
+}
+
+// And returns a filter that checks if all the given filters match. It matches if there are no filters.
+func And(filters ...RouteFilter) RouteFilter {
+	if len(filters) == 1 {
+		return filters[0]
+	}
+
 	return func(ctx *Context) bool {
-		if ctx.Update.Message == nil {
-			return false
+		if trace := ctx.filterTrace; trace != nil {
+			return trace.all(ctx, "and", filters)
+		}
+
+		for _, filter := range filters {
+			if !filter(ctx) {
+				return false
+			}
 		}
-		return strings.HasPrefix(ctx.Update.Message.Text, "/"+command)
+
+		return true
 	}
 }
 
-// AnyUpdate returns a filter that always returns true.
-func AnyUpdate() RouteFilter {
+// Or returns a filter that checks if any of the given filters matches. It doesn't match if there are no filters.
+func Or(filters ...RouteFilter) RouteFilter {
 	return func(ctx *Context) bool {
-		return true
+		if trace := ctx.filterTrace; trace != nil {
+			return trace.any(ctx, filters)
+		}
+
+		for _, filter := range filters {
+			if filter(ctx) {
+				return true
+			}
+		}
+
+		return false
 	}
 }
 
-// Message returns a filter that checks if the update is a message.
-func Message() RouteFilter {
+// Not returns a filter that checks if the given filter doesn't match.
+func Not(filter RouteFilter) RouteFilter {
 	return func(ctx *Context) bool {
-		return ctx.Update.Message != nil
+		if trace := ctx.filterTrace; trace != nil {
+			return trace.not(ctx, filter)
+		}
+
+		return !filter(ctx)
+	}
+}
+
+// messageVariant returns a filter that checks if the update contains the message returned by get
+// and the message matches all the given filters, name is used in the description of the filter.
+// updateTypes are types of updates with the message.
+// Message filters called inside check that message instead of Update.Message.
+func messageVariant(name string, get func(u *lumex.Update) *lumex.Message, filters []RouteFilter, updateTypes ...string) describedFilter {
+	filter := And(filters...)
+
+	variant := func(ctx *Context) bool {
+		m := get(ctx.Update)
+		if m == nil {
+			if trace := ctx.filterTrace; trace != nil {
+				trace.report(name, false)
+			}
+
+			return false
+		}
+
+		prev := ctx.filterMessage
+		ctx.filterMessage = m
+		defer func() {
+			ctx.filterMessage = prev
+		}()
+
+		if trace := ctx.filterTrace; trace != nil {
+			return trace.all(ctx, name, filters)
+		}
+
+		return filter(ctx)
+	}
+
+	return describedFilter{filter: variant, spec: filterSpec{updateTypes: updateTypes}, description: name}
+}
+
+// filteredMessage returns the message checked by message filters.
+// It is Update.Message unless the filter is wrapped with a message variant filter like EditedMessage.
+func (ctx *Context) filteredMessage() *lumex.Message {
+	if ctx.filterMessage != nil {
+		return ctx.filterMessage
 	}
+
+	return ctx.Update.Message
+}
+
+// Command returns a filter that checks if the message is a command with the given command name or one of aliases.
+// The command name should not contain the leading slash.
+// The command is taken from the bot_command entity at the beginning of the message text or caption
+// and compared with the names exactly and case-insensitively, so "/start" doesn't match "/starting".
+// "/command@username" matches only if username is the username of the bot.
+func Command(command string, aliases ...string) RouteFilter {
+	return commandFilter(command, aliases...).filter
+}
+
+func commandFilter(command string, aliases ...string) describedFilter {
+	names := commandNames(command, aliases)
+
+	return declare(commandSpec(names), describe("command "+describeCommands(command, aliases), func(ctx *Context) bool {
+		m := ctx.filteredMessage()
+		if m == nil {
+			return false
+		}
+
+		cmd, ok := parseCommand(m)
+		if !ok {
+			return false
+		}
+
+		_, ok = names[cmd.name]
+
+		return ok && ctx.addressedToBot(cmd)
+	}))
+}
+
+// AnyCommand returns a filter that checks if the message starts with a bot command, whatever its name is.
+// The command is taken from the message like Command takes it, commands for other bots match too.
+func AnyCommand() RouteFilter {
+	return describe("any command", func(ctx *Context) bool {
+		m := ctx.filteredMessage()
+		if m == nil {
+			return false
+		}
+
+		_, ok := parseCommand(m)
+
+		return ok
+	}).filter
+}
+
+func commandNames(command string, aliases []string) map[string]struct{} {
+	names := make(map[string]struct{}, len(aliases)+1)
+	for _, name := range append([]string{command}, aliases...) {
+		names[strings.ToLower(name)] = struct{}{}
+	}
+
+	return names
+}
+
+// AnyUpdate returns a filter that always returns true.
+func AnyUpdate() RouteFilter {
+	return anyUpdateFilter().filter
+}
+
+func anyUpdateFilter() describedFilter {
+	return describe("any update", func(ctx *Context) bool {
+		return true
+	})
+}
+
+// Message returns a filter that checks if the update is a message and it matches all the given filters.
+func Message(filters ...RouteFilter) RouteFilter {
+	return messageFilter(filters...).filter
+}
+
+func messageFilter(filters ...RouteFilter) describedFilter {
+	return messageVariant("message", func(u *lumex.Update) *lumex.Message {
+		return u.Message
+	}, filters, lumex.UpdateTypeMessage)
 }
 
 // CommandWithAt returns a filter that checks if the message is a command with the given command name and username.
 // Possible use case is to handle commands that are sent to a specific bot instance in a group chat.
-func CommandWithAt(command string) RouteFilter {
-	return func(ctx *Context) bool {
+// Unlike Command, it doesn't match commands without the username.
+func CommandWithAt(command string, aliases ...string) RouteFilter {
+	return commandWithAtFilter(command, aliases...).filter
+}
+
+func commandWithAtFilter(command string, aliases ...string) describedFilter {
+	names := commandNames(command, aliases)
+
+	description := "command with username " + describeCommands(command, aliases)
+
+	return declare(commandSpec(names), describe(description, func(ctx *Context) bool {
 		if ctx.Bot == nil {
 			return false
 		}
-		if ctx.Update.Message == nil {
+		m := ctx.filteredMessage()
+		if m == nil {
 			return false
 		}
 
-		return strings.HasPrefix(ctx.Update.Message.Text, "/"+command+"@"+ctx.Bot.Username)
+		cmd, ok := parseCommand(m)
+		if !ok || cmd.username == "" {
+			return false
+		}
+
+		_, ok = names[cmd.name]
+
+		return ok && ctx.addressedToBot(cmd)
+	}))
+}
+
+// commandSpec declares that the filter matches only messages with one of the commands.
+func commandSpec(names map[string]struct{}) filterSpec {
+	commands := make([]string, 0, len(names))
+	for name := range names {
+		commands = append(commands, name)
 	}
+	slices.Sort(commands)
+
+	return filterSpec{updateTypes: []string{lumex.UpdateTypeMessage}, commands: commands}
 }
 
 // TextContains returns a filter that checks if the message text contains the given text.
 // Possible use case is to handle messages that contain a specific keyword.
 func TextContains(text string) RouteFilter {
-	return func(ctx *Context) bool {
-		if ctx.Update.Message == nil {
-			return false
-		}
-		return strings.Contains(ctx.Update.Message.Text, text)
-	}
+	return textContainsFilter(text).filter
+}
+
+func textContainsFilter(text string) describedFilter {
+	return forMessage(describe(fmt.Sprintf("text contains %q", text), func(ctx *Context) bool {
+		m := ctx.filteredMessage()
+
+		return m != nil && strings.Contains(m.Text, text)
+	}))
 }
 
 func TextEquals(text string) RouteFilter {
-	return func(ctx *Context) bool {
-		if ctx.Update.Message == nil {
-			return false
-		}
+	return textEqualsFilter(text).filter
+}
 
-		return ctx.Update.Message.Text == text
-	}
+func textEqualsFilter(text string) describedFilter {
+	return forMessage(describe(fmt.Sprintf("text equals %q", text), func(ctx *Context) bool {
+		m := ctx.filteredMessage()
+
+		return m != nil && m.Text == text
+	}))
 }
 
 // TextPrefix returns a filter that checks if the message text starts with the given text.
 func TextPrefix(text string) RouteFilter {
-	return func(ctx *Context) bool {
-		if ctx.Update.Message == nil {
-			return false
-		}
+	return textPrefixFilter(text).filter
+}
 
-		return strings.HasPrefix(ctx.Update.Message.Text, text)
-	}
+func textPrefixFilter(text string) describedFilter {
+	return forMessage(describe(fmt.Sprintf("text has prefix %q", text), func(ctx *Context) bool {
+		m := ctx.filteredMessage()
+
+		return m != nil && strings.HasPrefix(m.Text, text)
+	}))
+}
+
+// TextRegex returns a filter that checks if the message text matches the regular expression.
+// The expression is compiled once, so the function panics if it is invalid.
+// Capture groups are available in handlers with Context.Match and Context.Matches.
+func TextRegex(pattern string) RouteFilter {
+	return textRegexFilter(pattern).filter
+}
+
+func textRegexFilter(pattern string) describedFilter {
+	re := regexp.MustCompile(pattern)
+
+	return forMessage(describe(fmt.Sprintf("text matches %q", pattern), func(ctx *Context) bool {
+		m := ctx.filteredMessage()
+
+		return m != nil && ctx.matchRegex(re, m.Text)
+	}))
 }
 
 // CallbackQuery returns a filter that checks if the update is a callback query.
 func CallbackQuery() RouteFilter {
-	return func(ctx *Context) bool {
+	return callbackQueryFilter().filter
+}
+
+func callbackQueryFilter() describedFilter {
+	return forUpdate(lumex.UpdateTypeCallbackQuery, describe("callback query", func(ctx *Context) bool {
 		return ctx.Update.CallbackQuery != nil
-	}
+	}))
 }
 
 // CallbackPrefix returns a filter that checks if the callback data starts with the given text.
 func CallbackPrefix(text string) RouteFilter {
-	return func(ctx *Context) bool {
+	return callbackPrefixFilter(text).filter
+}
+
+func callbackPrefixFilter(text string) describedFilter {
+	spec := filterSpec{updateTypes: []string{lumex.UpdateTypeCallbackQuery}, callbackPrefixes: []string{text}}
+
+	return declare(spec, describe(fmt.Sprintf("callback data has prefix %q", text), func(ctx *Context) bool {
 		if ctx.Update.CallbackQuery == nil {
 			return false
 		}
 
 		return strings.HasPrefix(ctx.Update.CallbackQuery.Data, text)
-	}
+	}))
+}
+
+// CallbackRegex returns a filter that checks if the callback data matches the regular expression.
+// The expression is compiled once, so the function panics if it is invalid.
+// Capture groups are available in handlers with Context.Match and Context.Matches.
+func CallbackRegex(pattern string) RouteFilter {
+	return callbackRegexFilter(pattern).filter
+}
+
+func callbackRegexFilter(pattern string) describedFilter {
+	re := regexp.MustCompile(pattern)
+	description := fmt.Sprintf("callback data matches %q", pattern)
+
+	return forUpdate(lumex.UpdateTypeCallbackQuery, describe(description, func(ctx *Context) bool {
+		return ctx.Update.CallbackQuery != nil && ctx.matchRegex(re, ctx.Update.CallbackQuery.Data)
+	}))
 }
 
 // InlineQuery returns a filter that checks if the update is an inline query.
 func InlineQuery() RouteFilter {
-	return func(ctx *Context) bool {
+	return inlineQueryFilter().filter
+}
+
+func inlineQueryFilter() describedFilter {
+	return forUpdate(lumex.UpdateTypeInlineQuery, describe("inline query", func(ctx *Context) bool {
 		return ctx.Update.InlineQuery != nil
-	}
+	}))
 }
 
 // InlineQueryPrefix returns a filter that checks if the inline query text starts with the given text.
 func InlineQueryPrefix(text string) RouteFilter {
-	return func(ctx *Context) bool {
+	return inlineQueryPrefixFilter(text).filter
+}
+
+func inlineQueryPrefixFilter(text string) describedFilter {
+	description := fmt.Sprintf("inline query has prefix %q", text)
+
+	return forUpdate(lumex.UpdateTypeInlineQuery, describe(description, func(ctx *Context) bool {
 		if ctx.Update.InlineQuery == nil {
 			return false
 		}
 
 		return strings.HasPrefix(ctx.Update.InlineQuery.Query, text)
+	}))
+}
+
+// InlineQueryRegex returns a filter that checks if the inline query text matches the regular expression.
+// The expression is compiled once, so the function panics if it is invalid.
+// Capture groups are available in handlers with Context.Match and Context.Matches.
+func InlineQueryRegex(pattern string) RouteFilter {
+	return inlineQueryRegexFilter(pattern).filter
+}
+
+func inlineQueryRegexFilter(pattern string) describedFilter {
+	re := regexp.MustCompile(pattern)
+	description := fmt.Sprintf("inline query matches %q", pattern)
+
+	return forUpdate(lumex.UpdateTypeInlineQuery, describe(description, func(ctx *Context) bool {
+		return ctx.Update.InlineQuery != nil && ctx.matchRegex(re, ctx.Update.InlineQuery.Query)
+	}))
+}
+
+// matchRegex matches the text and stores capture groups in the context on success.
+func (ctx *Context) matchRegex(re *regexp.Regexp, text string) bool {
+	match := re.FindStringSubmatch(text)
+	if match == nil {
+		return false
 	}
+
+	ctx.match, ctx.matchNames = match, re.SubexpNames()
+
+	return true
 }
 
 // MyChatMember returns a filter that checks if the update is a chat member update for the bot.
 func MyChatMember() RouteFilter {
-	return func(ctx *Context) bool {
+	return myChatMemberFilter().filter
+}
+
+func myChatMemberFilter() describedFilter {
+	return forUpdate(lumex.UpdateTypeMyChatMember, describe("my chat member", func(ctx *Context) bool {
 		return ctx.Update.MyChatMember != nil
-	}
+	}))
 }
 
 // ChatMember returns a filter that checks if the update is a chat member update.
 func ChatMember() RouteFilter {
-	return func(ctx *Context) bool {
+	return chatMemberFilter().filter
+}
+
+func chatMemberFilter() describedFilter {
+	return forUpdate(lumex.UpdateTypeChatMember, describe("chat member", func(ctx *Context) bool {
 		return ctx.Update.ChatMember != nil
-	}
+	}))
 }
 
 // PreCheckoutQuery returns a filter that checks if the update is a pre-checkout query.
 func PreCheckoutQuery() RouteFilter {
-	return func(ctx *Context) bool {
+	return preCheckoutQueryFilter().filter
+}
+
+func preCheckoutQueryFilter() describedFilter {
+	return forUpdate(lumex.UpdateTypePreCheckoutQuery, describe("pre-checkout query", func(ctx *Context) bool {
 		return ctx.Update.PreCheckoutQuery != nil
-	}
+	}))
 }
 
 // SuccessfulPayment returns a filter that checks if the update is a successful payment.
 func SuccessfulPayment() RouteFilter {
-	return func(ctx *Context) bool {
-		return ctx.Update.Message != nil && ctx.Update.Message.SuccessfulPayment != nil
-	}
+	return successfulPaymentFilter().filter
+}
+
+func successfulPaymentFilter() describedFilter {
+	return forMessage(describe("successful payment", func(ctx *Context) bool {
+		m := ctx.filteredMessage()
+
+		return m != nil && m.SuccessfulPayment != nil
+	}))
 }
 
 // ForwardedChannelMessage returns a filter that checks if the message is a forwarded message from a channel.
 // Possible use case is to make channel validation
 func ForwardedChannelMessage() RouteFilter {
-	return func(ctx *Context) bool {
-		if ctx.Update.Message == nil {
-			return false
-		}
-		origin := ctx.Update.Message.ForwardOrigin
+	return forwardedChannelMessageFilter().filter
+}
 
-		return origin != nil && origin.GetType() == "channel"
-	}
+func forwardedChannelMessageFilter() describedFilter {
+	return forMessage(describe("forwarded channel message", func(ctx *Context) bool {
+		m := ctx.filteredMessage()
+
+		return m != nil && m.ForwardOrigin != nil && m.ForwardOrigin.GetType() == "channel"
+	}))
 }
 
 // Photo returns a filter that checks if the message contains a photo.
 func Photo() RouteFilter {
-	return func(ctx *Context) bool {
-		return ctx.Update.Message != nil && ctx.Update.Message.Photo != nil
-	}
+	return photoFilter().filter
+}
+
+func photoFilter() describedFilter {
+	return forMessage(describe("photo", func(ctx *Context) bool {
+		m := ctx.filteredMessage()
+
+		return m != nil && m.Photo != nil
+	}))
 }
 
 // Video returns a filter that checks if the message contains a video.
 func Video() RouteFilter {
-	return func(ctx *Context) bool {
-		return ctx.Update.Message != nil && ctx.Update.Message.Video != nil
-	}
+	return videoFilter().filter
+}
+
+func videoFilter() describedFilter {
+	return forMessage(describe("video", func(ctx *Context) bool {
+		m := ctx.filteredMessage()
+
+		return m != nil && m.Video != nil
+	}))
 }
 
 // VideoNote returns a filter that checks if the message contains a video note.
 func VideoNote() RouteFilter {
-	return func(ctx *Context) bool {
-		return ctx.Update.Message != nil && ctx.Update.Message.VideoNote != nil
-	}
+	return videoNoteFilter().filter
+}
+
+func videoNoteFilter() describedFilter {
+	return forMessage(describe("video note", func(ctx *Context) bool {
+		m := ctx.filteredMessage()
+
+		return m != nil && m.VideoNote != nil
+	}))
 }
 
 // Animation returns a filter that checks if the message contains an animation.
 func Animation() RouteFilter {
-	return func(ctx *Context) bool {
-		return ctx.Update.Message != nil && ctx.Update.Message.Animation != nil
-	}
+	return animationFilter().filter
+}
+
+func animationFilter() describedFilter {
+	return forMessage(describe("animation", func(ctx *Context) bool {
+		m := ctx.filteredMessage()
+
+		return m != nil && m.Animation != nil
+	}))
 }
 
 // Voice returns a filter that checks if the message contains a voice message.
 func Voice() RouteFilter {
-	return func(ctx *Context) bool {
-		return ctx.Update.Message != nil && ctx.Update.Message.Voice != nil
-	}
+	return voiceFilter().filter
+}
+
+func voiceFilter() describedFilter {
+	return forMessage(describe("voice", func(ctx *Context) bool {
+		m := ctx.filteredMessage()
+
+		return m != nil && m.Voice != nil
+	}))
 }
 
 // Audio returns a filter that checks if the message contains an audio message.
 func Audio() RouteFilter {
-	return func(ctx *Context) bool {
-		return ctx.Update.Message != nil && ctx.Update.Message.Audio != nil
-	}
+	return audioFilter().filter
+}
+
+func audioFilter() describedFilter {
+	return forMessage(describe("audio", func(ctx *Context) bool {
+		m := ctx.filteredMessage()
+
+		return m != nil && m.Audio != nil
+	}))
 }
 
 // Document returns a filter that checks if the message contains a document.
 func Document() RouteFilter {
-	return func(ctx *Context) bool {
-		return ctx.Update.Message != nil && ctx.Update.Message.Document != nil
-	}
+	return documentFilter().filter
+}
+
+func documentFilter() describedFilter {
+	return forMessage(describe("document", func(ctx *Context) bool {
+		m := ctx.filteredMessage()
+
+		return m != nil && m.Document != nil
+	}))
 }
 
 // Sticker returns a filter that checks if the message contains a sticker.
 func Sticker() RouteFilter {
-	return func(ctx *Context) bool {
-		return ctx.Update.Message != nil && ctx.Update.Message.Sticker != nil
-	}
+	return stickerFilter().filter
+}
+
+func stickerFilter() describedFilter {
+	return forMessage(describe("sticker", func(ctx *Context) bool {
+		m := ctx.filteredMessage()
+
+		return m != nil && m.Sticker != nil
+	}))
 }
 
 // PurchasedPaidMedia returns a filter that checks if the message contains a purchased paid media.
 func PurchasedPaidMedia() RouteFilter {
-	return func(ctx *Context) bool {
+	return purchasedPaidMediaFilter().filter
+}
+
+func purchasedPaidMediaFilter() describedFilter {
+	return forUpdate(lumex.UpdateTypePurchasedPaidMedia, describe("purchased paid media", func(ctx *Context) bool {
 		return ctx.Update.PurchasedPaidMedia != nil
-	}
+	}))
 }
 
 // ChatShared returns a filter that checks if the message is a shared chat.
 func ChatShared() RouteFilter {
-	return func(ctx *Context) bool {
-		return ctx.Update.Message != nil && ctx.Update.Message.ChatShared != nil
-	}
+	return chatSharedFilter().filter
+}
+
+func chatSharedFilter() describedFilter {
+	return forMessage(describe("chat shared", func(ctx *Context) bool {
+		m := ctx.filteredMessage()
+
+		return m != nil && m.ChatShared != nil
+	}))
 }
 
 // UsersShared returns a filter that checks if the message is a shared user.
 func UsersShared() RouteFilter {
-	return func(ctx *Context) bool {
-		return ctx.Update.Message != nil && ctx.Update.Message.UsersShared != nil
+	return usersSharedFilter().filter
+}
+
+func usersSharedFilter() describedFilter {
+	return forMessage(describe("users shared", func(ctx *Context) bool {
+		m := ctx.filteredMessage()
+
+		return m != nil && m.UsersShared != nil
+	}))
+}
+
+// EditedMessage returns a filter that checks if the update is an edited message and it matches all the given filters.
+// Example: EditedMessage(TextContains("hello")) matches edited messages containing "hello".
+func EditedMessage(filters ...RouteFilter) RouteFilter {
+	return editedMessageFilter(filters...).filter
+}
+
+func editedMessageFilter(filters ...RouteFilter) describedFilter {
+	return messageVariant("edited message", func(u *lumex.Update) *lumex.Message {
+		return u.EditedMessage
+	}, filters, lumex.UpdateTypeEditedMessage)
+}
+
+// ChannelPost returns a filter that checks if the update is a channel post and it matches all the given filters.
+func ChannelPost(filters ...RouteFilter) RouteFilter {
+	return channelPostFilter(filters...).filter
+}
+
+func channelPostFilter(filters ...RouteFilter) describedFilter {
+	return messageVariant("channel post", func(u *lumex.Update) *lumex.Message {
+		return u.ChannelPost
+	}, filters, lumex.UpdateTypeChannelPost)
+}
+
+// EditedChannelPost returns a filter that checks if the update is an edited channel post
+// and it matches all the given filters.
+func EditedChannelPost(filters ...RouteFilter) RouteFilter {
+	return editedChannelPostFilter(filters...).filter
+}
+
+func editedChannelPostFilter(filters ...RouteFilter) describedFilter {
+	return messageVariant("edited channel post", func(u *lumex.Update) *lumex.Message {
+		return u.EditedChannelPost
+	}, filters, lumex.UpdateTypeEditedChannelPost)
+}
+
+// BusinessMessage returns a filter that checks if the update is a business message and it matches all the given filters.
+func BusinessMessage(filters ...RouteFilter) RouteFilter {
+	return businessMessageFilter(filters...).filter
+}
+
+func businessMessageFilter(filters ...RouteFilter) describedFilter {
+	return messageVariant("business message", func(u *lumex.Update) *lumex.Message {
+		return u.BusinessMessage
+	}, filters, lumex.UpdateTypeBusinessMessage)
+}
+
+// EditedBusinessMessage returns a filter that checks if the update is an edited business message
+// and it matches all the given filters.
+func EditedBusinessMessage(filters ...RouteFilter) RouteFilter {
+	return editedBusinessMessageFilter(filters...).filter
+}
+
+func editedBusinessMessageFilter(filters ...RouteFilter) describedFilter {
+	return messageVariant("edited business message", func(u *lumex.Update) *lumex.Message {
+		return u.EditedBusinessMessage
+	}, filters, lumex.UpdateTypeEditedBusinessMessage)
+}
+
+// AnyMessage returns a filter that checks if the update contains a new or edited message, channel post
+// or business message and it matches all the given filters.
+func AnyMessage(filters ...RouteFilter) RouteFilter {
+	return messageVariant("any message", func(u *lumex.Update) *lumex.Message {
+		return firstNotNil(
+			u.Message,
+			u.EditedMessage,
+			u.ChannelPost,
+			u.EditedChannelPost,
+			u.BusinessMessage,
+			u.EditedBusinessMessage,
+		)
+	}, filters, messageUpdateTypes...).filter
+}
+
+// BusinessConnection returns a filter that checks if the update is a business connection update.
+func BusinessConnection() RouteFilter {
+	return businessConnectionFilter().filter
+}
+
+func businessConnectionFilter() describedFilter {
+	return forUpdate(lumex.UpdateTypeBusinessConnection, describe("business connection", func(ctx *Context) bool {
+		return ctx.Update.BusinessConnection != nil
+	}))
+}
+
+// DeletedBusinessMessages returns a filter that checks if the update is about deleted business messages.
+func DeletedBusinessMessages() RouteFilter {
+	return deletedBusinessMessagesFilter().filter
+}
+
+func deletedBusinessMessagesFilter() describedFilter {
+	return forUpdate(lumex.UpdateTypeDeletedBusinessMessages, describe("deleted business messages", func(ctx *Context) bool {
+		return ctx.Update.DeletedBusinessMessages != nil
+	}))
+}
+
+// MessageReaction returns a filter that checks if the update is a change of a reaction on a message.
+func MessageReaction() RouteFilter {
+	return messageReactionFilter().filter
+}
+
+func messageReactionFilter() describedFilter {
+	return forUpdate(lumex.UpdateTypeMessageReaction, describe("message reaction", func(ctx *Context) bool {
+		return ctx.Update.MessageReaction != nil
+	}))
+}
+
+// MessageReactionCount returns a filter that checks if the update is a change of anonymous reactions on a message.
+func MessageReactionCount() RouteFilter {
+	return messageReactionCountFilter().filter
+}
+
+func messageReactionCountFilter() describedFilter {
+	return forUpdate(lumex.UpdateTypeMessageReactionCount, describe("message reaction count", func(ctx *Context) bool {
+		return ctx.Update.MessageReactionCount != nil
+	}))
+}
+
+// ChosenInlineResult returns a filter that checks if the update is a chosen inline result.
+func ChosenInlineResult() RouteFilter {
+	return chosenInlineResultFilter().filter
+}
+
+func chosenInlineResultFilter() describedFilter {
+	return forUpdate(lumex.UpdateTypeChosenInlineResult, describe("chosen inline result", func(ctx *Context) bool {
+		return ctx.Update.ChosenInlineResult != nil
+	}))
+}
+
+// ShippingQuery returns a filter that checks if the update is a shipping query.
+func ShippingQuery() RouteFilter {
+	return shippingQueryFilter().filter
+}
+
+func shippingQueryFilter() describedFilter {
+	return forUpdate(lumex.UpdateTypeShippingQuery, describe("shipping query", func(ctx *Context) bool {
+		return ctx.Update.ShippingQuery != nil
+	}))
+}
+
+// Poll returns a filter that checks if the update is a poll state update.
+func Poll() RouteFilter {
+	return pollFilter().filter
+}
+
+func pollFilter() describedFilter {
+	return forUpdate(lumex.UpdateTypePoll, describe("poll", func(ctx *Context) bool {
+		return ctx.Update.Poll != nil
+	}))
+}
+
+// PollAnswer returns a filter that checks if the update is a poll answer.
+func PollAnswer() RouteFilter {
+	return pollAnswerFilter().filter
+}
+
+func pollAnswerFilter() describedFilter {
+	return forUpdate(lumex.UpdateTypePollAnswer, describe("poll answer", func(ctx *Context) bool {
+		return ctx.Update.PollAnswer != nil
+	}))
+}
+
+// ChatJoinRequest returns a filter that checks if the update is a chat join request.
+func ChatJoinRequest() RouteFilter {
+	return chatJoinRequestFilter().filter
+}
+
+func chatJoinRequestFilter() describedFilter {
+	return forUpdate(lumex.UpdateTypeChatJoinRequest, describe("chat join request", func(ctx *Context) bool {
+		return ctx.Update.ChatJoinRequest != nil
+	}))
+}
+
+// ChatBoost returns a filter that checks if the update is a chat boost.
+func ChatBoost() RouteFilter {
+	return chatBoostFilter().filter
+}
+
+func chatBoostFilter() describedFilter {
+	return forUpdate(lumex.UpdateTypeChatBoost, describe("chat boost", func(ctx *Context) bool {
+		return ctx.Update.ChatBoost != nil
+	}))
+}
+
+// RemovedChatBoost returns a filter that checks if the update is a removed chat boost.
+func RemovedChatBoost() RouteFilter {
+	return removedChatBoostFilter().filter
+}
+
+func removedChatBoostFilter() describedFilter {
+	return forUpdate(lumex.UpdateTypeRemovedChatBoost, describe("removed chat boost", func(ctx *Context) bool {
+		return ctx.Update.RemovedChatBoost != nil
+	}))
+}
+
+// ChatType returns a filter that checks if the update chat is of one of the given types.
+// See lumex.ChatType* constants.
+func ChatType(types ...string) RouteFilter {
+	return describe("chat type "+strings.Join(types, "|"), func(ctx *Context) bool {
+		chat := ctx.filteredChat()
+
+		return chat != nil && slices.Contains(types, chat.Type)
+	}).filter
+}
+
+// PrivateChat returns a filter that checks if the update is from a private chat.
+func PrivateChat() RouteFilter {
+	return ChatType(lumex.ChatTypePrivate)
+}
+
+// GroupChat returns a filter that checks if the update is from a group or a supergroup.
+func GroupChat() RouteFilter {
+	return ChatType(lumex.ChatTypeGroup, lumex.ChatTypeSupergroup)
+}
+
+// ChatID returns a filter that checks if the update chat id is one of the given ids.
+func ChatID(ids ...int64) RouteFilter {
+	return describe(fmt.Sprintf("chat id %v", ids), func(ctx *Context) bool {
+		chat := ctx.filteredChat()
+
+		return chat != nil && slices.Contains(ids, chat.Id)
+	}).filter
+}
+
+// SenderID returns a filter that checks if the update sender id is one of the given ids.
+// Possible use case is to restrict routes to admins of the bot.
+func SenderID(ids ...int64) RouteFilter {
+	return describe(fmt.Sprintf("sender id %v", ids), func(ctx *Context) bool {
+		var sender *lumex.User
+		if m := ctx.filteredMessage(); m != nil {
+			sender = m.From
+		} else {
+			sender = ctx.Sender()
+		}
+
+		return sender != nil && slices.Contains(ids, sender.Id)
+	}).filter
+}
+
+// ForumTopic returns a filter that checks if the message is sent to a forum topic.
+// If thread ids are given, the topic must be one of them.
+func ForumTopic(threadIDs ...int64) RouteFilter {
+	return describe(forumTopicDescription(threadIDs), func(ctx *Context) bool {
+		m := ctx.filteredMessage()
+		if m == nil || !m.IsTopicMessage {
+			return false
+		}
+
+		return len(threadIDs) == 0 || slices.Contains(threadIDs, m.MessageThreadId)
+	}).filter
+}
+
+// Reply returns a filter that checks if the message is a reply to another message.
+func Reply() RouteFilter {
+	return describe("reply", func(ctx *Context) bool {
+		m := ctx.filteredMessage()
+
+		return m != nil && m.ReplyToMessage != nil
+	}).filter
+}
+
+// ReplyToBot returns a filter that checks if the message is a reply to a message of the bot.
+func ReplyToBot() RouteFilter {
+	return describe("reply to bot", func(ctx *Context) bool {
+		m := ctx.filteredMessage()
+		if m == nil || m.ReplyToMessage == nil || m.ReplyToMessage.From == nil || ctx.Bot == nil {
+			return false
+		}
+
+		return m.ReplyToMessage.From.Id == ctx.Bot.Id
+	}).filter
+}
+
+// Entity returns a filter that checks if the message text or caption contains an entity of one of the given types.
+// Example: Entity("url", "text_link") matches messages with links.
+func Entity(types ...string) RouteFilter {
+	return describe("entity "+strings.Join(types, "|"), func(ctx *Context) bool {
+		m := ctx.filteredMessage()
+		if m == nil {
+			return false
+		}
+
+		for _, entity := range m.GetEntities() {
+			if slices.Contains(types, entity.Type) {
+				return true
+			}
+		}
+
+		return false
+	}).filter
+}
+
+// Text returns a filter that checks if the message has a text.
+func Text() RouteFilter {
+	return describe("text", func(ctx *Context) bool {
+		m := ctx.filteredMessage()
+
+		return m != nil && m.Text != ""
+	}).filter
+}
+
+// Caption returns a filter that checks if the message has a caption.
+func Caption() RouteFilter {
+	return describe("caption", func(ctx *Context) bool {
+		m := ctx.filteredMessage()
+
+		return m != nil && m.Caption != ""
+	}).filter
+}
+
+// MediaGroup returns a filter that checks if the message is a part of a media group.
+func MediaGroup() RouteFilter {
+	return describe("media group", func(ctx *Context) bool {
+		m := ctx.filteredMessage()
+
+		return m != nil && m.MediaGroupId != ""
+	}).filter
+}
+
+// Contact returns a filter that checks if the message contains a contact.
+func Contact() RouteFilter {
+	return describe("contact", func(ctx *Context) bool {
+		m := ctx.filteredMessage()
+
+		return m != nil && m.Contact != nil
+	}).filter
+}
+
+// Location returns a filter that checks if the message contains a location.
+func Location() RouteFilter {
+	return describe("location", func(ctx *Context) bool {
+		m := ctx.filteredMessage()
+
+		return m != nil && m.Location != nil
+	}).filter
+}
+
+// Venue returns a filter that checks if the message contains a venue.
+func Venue() RouteFilter {
+	return describe("venue", func(ctx *Context) bool {
+		m := ctx.filteredMessage()
+
+		return m != nil && m.Venue != nil
+	}).filter
+}
+
+// Dice returns a filter that checks if the message contains a dice.
+func Dice() RouteFilter {
+	return describe("dice", func(ctx *Context) bool {
+		m := ctx.filteredMessage()
+
+		return m != nil && m.Dice != nil
+	}).filter
+}
+
+// WebAppData returns a filter that checks if the message contains data sent from a Web App.
+func WebAppData() RouteFilter {
+	return describe("web app data", func(ctx *Context) bool {
+		m := ctx.filteredMessage()
+
+		return m != nil && m.WebAppData != nil
+	}).filter
+}
+
+// NewChatMembers returns a filter that checks if the message is about new members joined the chat.
+func NewChatMembers() RouteFilter {
+	return describe("new chat members", func(ctx *Context) bool {
+		m := ctx.filteredMessage()
+
+		return m != nil && len(m.NewChatMembers) > 0
+	}).filter
+}
+
+// LeftChatMember returns a filter that checks if the message is about a member left the chat.
+func LeftChatMember() RouteFilter {
+	return describe("left chat member", func(ctx *Context) bool {
+		m := ctx.filteredMessage()
+
+		return m != nil && m.LeftChatMember != nil
+	}).filter
+}
+
+// filteredChat returns the chat of the message checked by message filters or the chat of the update.
+func (ctx *Context) filteredChat() *lumex.Chat {
+	if m := ctx.filteredMessage(); m != nil {
+		return &m.Chat
 	}
+
+	return ctx.Chat()
 }
@@ -13,7 +13,8 @@ func TestCommand(t *testing.T) {
 		r := New(&lumex.Bot{})
 		if !Command("test")(r.acquireContext(context.Background(), &lumex.Update{
 			Message: &lumex.Message{
-				Text: "/test",
+				Text:     "/test",
+				Entities: []lumex.MessageEntity{{Type: "bot_command", Length: 5}},
 			},
 		})) {
 			t.Error("Command failed")
@@ -24,7 +25,8 @@ func TestCommand(t *testing.T) {
 		r := New(&lumex.Bot{})
 		if Command("test")(r.acquireContext(context.Background(), &lumex.Update{
 			Message: &lumex.Message{
-				Text: "/invalid",
+				Text:     "/invalid",
+				Entities: []lumex.MessageEntity{{Type: "bot_command", Length: 8}},
 			},
 		})) {
 			t.Error("Command (invalid command) failed")
@@ -37,20 +39,91 @@ func TestCommand(t *testing.T) {
 			t.Error("Command (empty update) failed")
 		}
 	})
+
+	t.Run("matching rules", func(t *testing.T) {
+		r := New(&lumex.Bot{
+			User: lumex.User{
+				Username: "TestBot",
+			},
+		})
+		command := func(text string, length int64) *lumex.Message {
+			return &lumex.Message{
+				Text:     text,
+				Entities: []lumex.MessageEntity{{Type: "bot_command", Length: length}},
+			}
+		}
+
+		cases := []struct {
+			name    string
+			message *lumex.Message
+			want    bool
+		}{
+			{"exact", command("/start", 6), true},
+			{"with args", command("/start payload", 6), true},
+			{"case-insensitive", command("/START", 6), true},
+			{"longer command", command("/starting", 9), false},
+			{"command with suffix", command("/start_admin", 12), false},
+			{"own username", command("/start@TestBot", 14), true},
+			{"own username case-insensitive", command("/start@testbot", 14), true},
+			{"other bot username", command("/start@OtherBot", 15), false},
+			{"alias", command("/begin", 6), true},
+			{"no entity", &lumex.Message{Text: "/start"}, false},
+			{"entity is not at the beginning", &lumex.Message{
+				Text:     "hi /start",
+				Entities: []lumex.MessageEntity{{Type: "bot_command", Offset: 3, Length: 6}},
+			}, false},
+			{"caption", &lumex.Message{
+				Caption:         "/start",
+				CaptionEntities: []lumex.MessageEntity{{Type: "bot_command", Length: 6}},
+			}, true},
+		}
+
+		filter := Command("start", "begin")
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				got := filter(r.acquireContext(context.Background(), &lumex.Update{Message: tc.message}))
+				assert.Equal(t, tc.want, got, "Command(%q) = %v; want %v", tc.message.GetText(), got, tc.want)
+			})
+		}
+	})
 }
+func TestAnyCommand(t *testing.T) {
+	r := New(&lumex.Bot{})
+	cases := []struct {
+		name    string
+		message *lumex.Message
+		want    bool
+	}{
+		{"command", &lumex.Message{Text: "/test arg", Entities: []lumex.MessageEntity{{Type: "bot_command", Length: 5}}}, true},
+		{"caption command", &lumex.Message{Caption: "/test", CaptionEntities: []lumex.MessageEntity{{Type: "bot_command", Length: 5}}}, true},
+		{"command not at the beginning", &lumex.Message{Text: "hi /test", Entities: []lumex.MessageEntity{{Type: "bot_command", Offset: 3, Length: 5}}}, false},
+		{"text without entity", &lumex.Message{Text: "/test"}, false},
+		{"no message", nil, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := r.acquireContext(context.Background(), &lumex.Update{Message: tc.message})
+			assert.Equal(t, tc.want, AnyCommand()(ctx))
+		})
+	}
+}
+
 func TestCommandWithAt(t *testing.T) {
 	t.Run("router without bot", func(t *testing.T) {
 		r := New(nil)
 		if CommandWithAt("test")(r.acquireContext(context.Background(), &lumex.Update{
 			Message: &lumex.Message{
-				Text: "/test@testbot",
+				Text:     "/test@testbot",
+				Entities: []lumex.MessageEntity{{Type: "bot_command", Length: 13}},
 			},
 		})) {
 			t.Error("CommandWithAt (empty bot) failed")
 		}
 		if CommandWithAt("test")(r.acquireContext(context.Background(), &lumex.Update{
 			Message: &lumex.Message{
-				Text: "/test@invalid",
+				Text:     "/test@invalid",
+				Entities: []lumex.MessageEntity{{Type: "bot_command", Length: 13}},
 			},
 		})) {
 			t.Error("CommandWithAt (empty bot) failed")
@@ -68,21 +141,24 @@ func TestCommandWithAt(t *testing.T) {
 		})
 		if !CommandWithAt("test")(r.acquireContext(context.Background(), &lumex.Update{
 			Message: &lumex.Message{
-				Text: "/test@testbot",
+				Text:     "/test@testbot",
+				Entities: []lumex.MessageEntity{{Type: "bot_command", Length: 13}},
 			},
 		})) {
 			t.Error("CommandWithAt failed")
 		}
 		if CommandWithAt("test")(r.acquireContext(context.Background(), &lumex.Update{
 			Message: &lumex.Message{
-				Text: "/invalid@testbot",
+				Text:     "/invalid@testbot",
+				Entities: []lumex.MessageEntity{{Type: "bot_command", Length: 16}},
 			},
 		})) {
 			t.Error("CommandWithAt (invalid command) failed")
 		}
 		if CommandWithAt("test")(r.acquireContext(context.Background(), &lumex.Update{
 			Message: &lumex.Message{
-				Text: "/test@invalid",
+				Text:     "/test@invalid",
+				Entities: []lumex.MessageEntity{{Type: "bot_command", Length: 13}},
 			},
 		})) {
 			t.Error("CommandWithAt (invalid bot) failed")
@@ -509,3 +585,251 @@ func TestUsersShared(t *testing.T) {
 		t.Error("UsersShared (empty update) failed")
 	}
 }
+
+func TestCombinators(t *testing.T) {
+	r := New(&lumex.Bot{})
+	ctx := r.acquireContext(context.Background(), &lumex.Update{
+		Message: &lumex.Message{
+			Text: "hello world",
+		},
+	})
+	yes, no := TextPrefix("hello"), TextPrefix("world")
+
+	cases := []struct {
+		name   string
+		filter RouteFilter
+		want   bool
+	}{
+		{"And empty", And(), true},
+		{"And all match", And(yes, TextContains("world")), true},
+		{"And one fails", And(yes, no), false},
+		{"Or empty", Or(), false},
+		{"Or one matches", Or(no, yes), true},
+		{"Or none match", Or(no, CallbackQuery()), false},
+		{"Not", Not(no), true},
+		{"Not matched", Not(yes), false},
+		{"nested", And(Message(), Or(no, Not(CallbackQuery()))), true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, tc.filter(ctx))
+		})
+	}
+}
+
+func TestUpdateTypeFilters(t *testing.T) {
+	r := New(&lumex.Bot{})
+
+	cases := []struct {
+		name   string
+		filter RouteFilter
+		update *lumex.Update
+	}{
+		{"Message", Message(), &lumex.Update{Message: &lumex.Message{}}},
+		{"EditedMessage", EditedMessage(), &lumex.Update{EditedMessage: &lumex.Message{}}},
+		{"ChannelPost", ChannelPost(), &lumex.Update{ChannelPost: &lumex.Message{}}},
+		{"EditedChannelPost", EditedChannelPost(), &lumex.Update{EditedChannelPost: &lumex.Message{}}},
+		{"BusinessConnection", BusinessConnection(), &lumex.Update{BusinessConnection: &lumex.BusinessConnection{}}},
+		{"BusinessMessage", BusinessMessage(), &lumex.Update{BusinessMessage: &lumex.Message{}}},
+		{"EditedBusinessMessage", EditedBusinessMessage(), &lumex.Update{EditedBusinessMessage: &lumex.Message{}}},
+		{"DeletedBusinessMessages", DeletedBusinessMessages(), &lumex.Update{
+			DeletedBusinessMessages: &lumex.BusinessMessagesDeleted{},
+		}},
+		{"MessageReaction", MessageReaction(), &lumex.Update{MessageReaction: &lumex.MessageReactionUpdated{}}},
+		{"MessageReactionCount", MessageReactionCount(), &lumex.Update{
+			MessageReactionCount: &lumex.MessageReactionCountUpdated{},
+		}},
+		{"InlineQuery", InlineQuery(), &lumex.Update{InlineQuery: &lumex.InlineQuery{}}},
+		{"ChosenInlineResult", ChosenInlineResult(), &lumex.Update{ChosenInlineResult: &lumex.ChosenInlineResult{}}},
+		{"CallbackQuery", CallbackQuery(), &lumex.Update{CallbackQuery: &lumex.CallbackQuery{}}},
+		{"ShippingQuery", ShippingQuery(), &lumex.Update{ShippingQuery: &lumex.ShippingQuery{}}},
+		{"PreCheckoutQuery", PreCheckoutQuery(), &lumex.Update{PreCheckoutQuery: &lumex.PreCheckoutQuery{}}},
+		{"PurchasedPaidMedia", PurchasedPaidMedia(), &lumex.Update{PurchasedPaidMedia: &lumex.PaidMediaPurchased{}}},
+		{"Poll", Poll(), &lumex.Update{Poll: &lumex.Poll{}}},
+		{"PollAnswer", PollAnswer(), &lumex.Update{PollAnswer: &lumex.PollAnswer{}}},
+		{"MyChatMember", MyChatMember(), &lumex.Update{MyChatMember: &lumex.ChatMemberUpdated{}}},
+		{"ChatMember", ChatMember(), &lumex.Update{ChatMember: &lumex.ChatMemberUpdated{}}},
+		{"ChatJoinRequest", ChatJoinRequest(), &lumex.Update{ChatJoinRequest: &lumex.ChatJoinRequest{}}},
+		{"ChatBoost", ChatBoost(), &lumex.Update{ChatBoost: &lumex.ChatBoostUpdated{}}},
+		{"RemovedChatBoost", RemovedChatBoost(), &lumex.Update{RemovedChatBoost: &lumex.ChatBoostRemoved{}}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.True(t, tc.filter(r.acquireContext(context.Background(), tc.update)), "matching update")
+			assert.False(t, tc.filter(r.acquireContext(context.Background(), &lumex.Update{})), "empty update")
+
+			for _, other := range cases {
+				if other.name != tc.name && tc.filter(r.acquireContext(context.Background(), other.update)) {
+					t.Errorf("%s matches %s update", tc.name, other.name)
+				}
+			}
+		})
+	}
+}
+
+func TestMessageVariantFilters(t *testing.T) {
+	r := New(&lumex.Bot{})
+	message := &lumex.Message{
+		Text: "hello",
+		Chat: lumex.Chat{Id: 10, Type: lumex.ChatTypeSupergroup},
+	}
+
+	variants := []struct {
+		name   string
+		filter func(...RouteFilter) RouteFilter
+		update *lumex.Update
+	}{
+		{"Message", Message, &lumex.Update{Message: message}},
+		{"EditedMessage", EditedMessage, &lumex.Update{EditedMessage: message}},
+		{"ChannelPost", ChannelPost, &lumex.Update{ChannelPost: message}},
+		{"EditedChannelPost", EditedChannelPost, &lumex.Update{EditedChannelPost: message}},
+		{"BusinessMessage", BusinessMessage, &lumex.Update{BusinessMessage: message}},
+		{"EditedBusinessMessage", EditedBusinessMessage, &lumex.Update{EditedBusinessMessage: message}},
+	}
+
+	for _, variant := range variants {
+		t.Run(variant.name, func(t *testing.T) {
+			ctx := r.acquireContext(context.Background(), variant.update)
+
+			assert.True(t, variant.filter(TextEquals("hello"), GroupChat(), ChatID(10))(ctx))
+			assert.False(t, variant.filter(TextEquals("bye"))(ctx))
+			assert.True(t, AnyMessage(TextEquals("hello"))(ctx))
+			assert.Nil(t, ctx.filterMessage, "filtered message must be restored")
+
+			if variant.name != "Message" {
+				assert.False(t, TextEquals("hello")(ctx), "plain filters check Update.Message only")
+			}
+		})
+	}
+}
+
+func TestMessageFilters(t *testing.T) {
+	bot := &lumex.Bot{User: lumex.User{Id: 100}}
+	r := New(bot)
+
+	cases := []struct {
+		name    string
+		filter  RouteFilter
+		message *lumex.Message
+		want    bool
+	}{
+		{"PrivateChat", PrivateChat(), &lumex.Message{Chat: lumex.Chat{Type: lumex.ChatTypePrivate}}, true},
+		{"PrivateChat group", PrivateChat(), &lumex.Message{Chat: lumex.Chat{Type: lumex.ChatTypeGroup}}, false},
+		{"GroupChat", GroupChat(), &lumex.Message{Chat: lumex.Chat{Type: lumex.ChatTypeGroup}}, true},
+		{"ChatType channel", ChatType(lumex.ChatTypeChannel), &lumex.Message{Chat: lumex.Chat{Type: lumex.ChatTypeChannel}}, true},
+		{"ChatID", ChatID(1, 2), &lumex.Message{Chat: lumex.Chat{Id: 2}}, true},
+		{"ChatID other", ChatID(1, 2), &lumex.Message{Chat: lumex.Chat{Id: 3}}, false},
+		{"SenderID", SenderID(5), &lumex.Message{From: &lumex.User{Id: 5}}, true},
+		{"SenderID other", SenderID(5), &lumex.Message{From: &lumex.User{Id: 6}}, false},
+		{"SenderID no sender", SenderID(5), &lumex.Message{}, false},
+		{"ForumTopic any", ForumTopic(), &lumex.Message{IsTopicMessage: true, MessageThreadId: 3}, true},
+		{"ForumTopic id", ForumTopic(3), &lumex.Message{IsTopicMessage: true, MessageThreadId: 3}, true},
+		{"ForumTopic other id", ForumTopic(4), &lumex.Message{IsTopicMessage: true, MessageThreadId: 3}, false},
+		{"ForumTopic not topic", ForumTopic(), &lumex.Message{}, false},
+		{"Reply", Reply(), &lumex.Message{ReplyToMessage: &lumex.Message{}}, true},
+		{"Reply not reply", Reply(), &lumex.Message{}, false},
+		{"ReplyToBot", ReplyToBot(), &lumex.Message{ReplyToMessage: &lumex.Message{From: &lumex.User{Id: 100}}}, true},
+		{"ReplyToBot other", ReplyToBot(), &lumex.Message{ReplyToMessage: &lumex.Message{From: &lumex.User{Id: 1}}}, false},
+		{"Entity", Entity("url"), &lumex.Message{Entities: []lumex.MessageEntity{{Type: "bold"}, {Type: "url"}}}, true},
+		{"Entity caption", Entity("url"), &lumex.Message{CaptionEntities: []lumex.MessageEntity{{Type: "url"}}}, true},
+		{"Entity missing", Entity("url"), &lumex.Message{Entities: []lumex.MessageEntity{{Type: "bold"}}}, false},
+		{"Text", Text(), &lumex.Message{Text: "a"}, true},
+		{"Text empty", Text(), &lumex.Message{Caption: "a"}, false},
+		{"Caption", Caption(), &lumex.Message{Caption: "a"}, true},
+		{"MediaGroup", MediaGroup(), &lumex.Message{MediaGroupId: "1"}, true},
+		{"Contact", Contact(), &lumex.Message{Contact: &lumex.Contact{}}, true},
+		{"Location", Location(), &lumex.Message{Location: &lumex.Location{}}, true},
+		{"Venue", Venue(), &lumex.Message{Venue: &lumex.Venue{}}, true},
+		{"Dice", Dice(), &lumex.Message{Dice: &lumex.Dice{}}, true},
+		{"WebAppData", WebAppData(), &lumex.Message{WebAppData: &lumex.WebAppData{}}, true},
+		{"NewChatMembers", NewChatMembers(), &lumex.Message{NewChatMembers: []lumex.User{{}}}, true},
+		{"LeftChatMember", LeftChatMember(), &lumex.Message{LeftChatMember: &lumex.User{}}, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.filter(r.acquireContext(context.Background(), &lumex.Update{Message: tc.message}))
+			assert.Equal(t, tc.want, got)
+			assert.False(t, tc.filter(r.acquireContext(context.Background(), &lumex.Update{})), "empty update")
+		})
+	}
+
+	t.Run("chat and sender of non-message updates", func(t *testing.T) {
+		ctx := r.acquireContext(context.Background(), &lumex.Update{
+			ChatJoinRequest: &lumex.ChatJoinRequest{
+				Chat: lumex.Chat{Id: 1, Type: lumex.ChatTypeSupergroup},
+				From: lumex.User{Id: 2},
+			},
+		})
+		assert.True(t, And(GroupChat(), ChatID(1), SenderID(2))(ctx))
+	})
+}
+
+func TestRegexFilters(t *testing.T) {
+	r := New(nil)
+
+	t.Run("TextRegex", func(t *testing.T) {
+		filter := TextRegex(`^order #(?P<id>\d+)$`)
+
+		ctx := r.acquireContext(context.Background(), &lumex.Update{Message: &lumex.Message{Text: "order #42"}})
+		assert.True(t, filter(ctx))
+		assert.Equal(t, "42", ctx.Match("id"))
+		assert.Equal(t, []string{"order #42", "42"}, ctx.Matches())
+
+		ctx = r.acquireContext(context.Background(), &lumex.Update{Message: &lumex.Message{Text: "order #x"}})
+		assert.False(t, filter(ctx))
+		assert.Nil(t, ctx.Matches())
+		assert.False(t, filter(r.acquireContext(context.Background(), &lumex.Update{})), "empty update")
+	})
+
+	t.Run("TextRegex edited message", func(t *testing.T) {
+		ctx := r.acquireContext(context.Background(), &lumex.Update{EditedMessage: &lumex.Message{Text: "hi bob"}})
+		assert.True(t, EditedMessage(TextRegex(`hi (\w+)`))(ctx))
+		assert.Equal(t, "bob", ctx.Matches()[1])
+	})
+
+	t.Run("CallbackRegex", func(t *testing.T) {
+		filter := CallbackRegex(`^page:(?P<page>\d+)$`)
+
+		ctx := r.acquireContext(context.Background(), &lumex.Update{CallbackQuery: &lumex.CallbackQuery{Data: "page:3"}})
+		assert.True(t, filter(ctx))
+		assert.Equal(t, "3", ctx.Match("page"))
+		assert.Empty(t, ctx.Match("missing"))
+		assert.False(t, filter(r.acquireContext(context.Background(), &lumex.Update{})), "empty update")
+	})
+
+	t.Run("InlineQueryRegex", func(t *testing.T) {
+		filter := InlineQueryRegex(`^search (?P<q>.+)$`)
+
+		ctx := r.acquireContext(context.Background(), &lumex.Update{InlineQuery: &lumex.InlineQuery{Query: "search go"}})
+		assert.True(t, filter(ctx))
+		assert.Equal(t, "go", ctx.Match("q"))
+		assert.False(t, filter(r.acquireContext(context.Background(), &lumex.Update{})), "empty update")
+	})
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		assert.Panics(t, func() {
+			TextRegex(`(`)
+		})
+	})
+
+	t.Run("captures belong to the matched route", func(t *testing.T) {
+		r := New(nil)
+		r.On(And(TextRegex(`^(?P<word>\w+)`), TextEquals("never")), func(ctx *Context) error {
+			return nil
+		})
+
+		var word, second string
+		r.OnTextRegex(`^\w+ (?P<second>\w+)$`, func(ctx *Context) error {
+			word, second = ctx.Match("word"), ctx.Match("second")
+
+			return nil
+		})
+
+		assert.NoError(t, r.HandleUpdate(context.Background(), &lumex.Update{Message: &lumex.Message{Text: "hello world"}}))
+		assert.Empty(t, word)
+		assert.Equal(t, "world", second)
+	})
+}
@@ -0,0 +1,243 @@
+package router
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/kbgod/lumex"
+)
+
+// messageUpdateTypes are types of updates with a message checked by message filters, see AnyMessage.
+var messageUpdateTypes = []string{
+	lumex.UpdateTypeMessage,
+	lumex.UpdateTypeEditedMessage,
+	lumex.UpdateTypeChannelPost,
+	lumex.UpdateTypeEditedChannelPost,
+	lumex.UpdateTypeBusinessMessage,
+	lumex.UpdateTypeEditedBusinessMessage,
+}
+
+// filterSpec declares which updates the route filter can match, so the router checks the filter only for such updates.
+// Routes carry it, it is set by On* helpers and Route.UpdateTypes. Empty fields don't restrict updates. The spec may declare more updates than the filter matches, but never less.
+type filterSpec struct {
+	// updateTypes are types of updates, see lumex.UpdateType* constants.
+	updateTypes []string
+	// commands are lowercase names of commands the message must start with, see Command.
+	commands []string
+	// callbackPrefixes are prefixes the callback data must start with, see CallbackPrefix.
+	callbackPrefixes []string
+}
+
+// declare returns the filter with the spec, the description of the filter is kept.
+func declare(spec filterSpec, f describedFilter) describedFilter {
+	f.spec = spec
+
+	return f
+}
+
+// forUpdate declares that the filter matches only updates of the type.
+func forUpdate(updateType string, f describedFilter) describedFilter {
+	return declare(filterSpec{updateTypes: []string{updateType}}, f)
+}
+
+// forMessage declares that the filter of the message, like TextEquals, matches only message updates.
+// Message variants like EditedMessage don't inherit the type, because the filter checks their message inside them.
+func forMessage(f describedFilter) describedFilter {
+	return forUpdate(lumex.UpdateTypeMessage, f)
+}
+
+// indexedRoute is the route with its position in Router.routes, routes are checked in order of positions.
+type indexedRoute struct {
+	position int
+	route    *Route
+}
+
+// routeIndex groups routes by types of updates they can match, so only filters which can match the update are checked.
+// It is built on the first update after routes are added.
+type routeIndex struct {
+	// size is the number of routes the index is built from.
+	size int
+	// all are all routes, they are checked if the index is disabled by WithoutRouteIndex.
+	all   []indexedRoute
+	types map[string]*routeBucket
+	// other are routes which can match any update, they are checked for updates of types without routes.
+	other routeBucket
+}
+
+// routeBucket holds routes which can match updates of the type.
+type routeBucket struct {
+	// routes are checked for every update of the type.
+	routes []indexedRoute
+	// commands are routes of commands by the command name, they are checked only for messages with the command.
+	commands map[string][]indexedRoute
+	// callbackPrefixes are routes of callback queries by the prefix of callback data.
+	callbackPrefixes map[string][]indexedRoute
+	// prefixLengths are lengths of callbackPrefixes keys, so the data is looked up once per length.
+	prefixLengths []int
+}
+
+func newRouteIndex(routes []*Route, enabled bool) *routeIndex {
+	idx := &routeIndex{
+		size:  len(routes),
+		all:   make([]indexedRoute, len(routes)),
+		types: make(map[string]*routeBucket),
+	}
+	for position, route := range routes {
+		idx.all[position] = indexedRoute{position: position, route: route}
+	}
+
+	if !enabled {
+		return idx
+	}
+
+	for _, route := range idx.all {
+		spec := route.route.spec
+		if spec.updateTypes == nil {
+			idx.other.routes = append(idx.other.routes, route)
+			for _, bucket := range idx.types {
+				bucket.routes = append(bucket.routes, route)
+			}
+
+			continue
+		}
+
+		for _, updateType := range spec.updateTypes {
+			bucket := idx.types[updateType]
+			if bucket == nil {
+				// routes of any type registered before are checked for this type too
+				bucket = &routeBucket{routes: slices.Clone(idx.other.routes)}
+				idx.types[updateType] = bucket
+			}
+
+			bucket.add(route, spec, updateType)
+		}
+	}
+
+	return idx
+}
+
+func (b *routeBucket) add(route indexedRoute, spec filterSpec, updateType string) {
+	switch {
+	case spec.commands != nil && slices.Contains(messageUpdateTypes, updateType):
+		if b.commands == nil {
+			b.commands = make(map[string][]indexedRoute)
+		}
+
+		for _, command := range spec.commands {
+			b.commands[command] = append(b.commands[command], route)
+		}
+	case spec.callbackPrefixes != nil && updateType == lumex.UpdateTypeCallbackQuery:
+		if b.callbackPrefixes == nil {
+			b.callbackPrefixes = make(map[string][]indexedRoute)
+		}
+
+		for _, prefix := range spec.callbackPrefixes {
+			b.callbackPrefixes[prefix] = append(b.callbackPrefixes[prefix], route)
+			if !slices.Contains(b.prefixLengths, len(prefix)) {
+				b.prefixLengths = append(b.prefixLengths, len(prefix))
+			}
+		}
+	default:
+		b.routes = append(b.routes, route)
+	}
+}
+
+// candidates returns routes which can match the update in order of checking.
+// Routes found by commands and callback prefixes are merged into buf, otherwise the result is a slice of the index,
+// so it must not be modified.
+func (idx *routeIndex) candidates(update *lumex.Update, buf *[]indexedRoute) []indexedRoute {
+	updateType := update.GetType()
+	bucket, ok := idx.types[updateType]
+	if !ok {
+		bucket = &idx.other
+	}
+
+	keyed := (*buf)[:0]
+	if bucket.commands != nil {
+		if m := updateMessage(update, updateType); m != nil {
+			if cmd, ok := parseCommand(m); ok {
+				keyed = append(keyed, bucket.commands[cmd.name]...)
+			}
+		}
+	}
+	if bucket.callbackPrefixes != nil && update.CallbackQuery != nil {
+		data := update.CallbackQuery.Data
+		for _, n := range bucket.prefixLengths {
+			if n <= len(data) {
+				keyed = append(keyed, bucket.callbackPrefixes[data[:n]]...)
+			}
+		}
+	}
+
+	if len(keyed) == 0 {
+		return bucket.routes
+	}
+
+	*buf = mergeRoutes(keyed, bucket.routes)
+
+	return *buf
+}
+
+// mergeRoutes merges routes into keyed in order of positions, keyed are sorted first,
+// because routes found by different keys are not ordered and a route with several prefixes may be found more than once.
+func mergeRoutes(keyed, routes []indexedRoute) []indexedRoute {
+	slices.SortFunc(keyed, func(a, b indexedRoute) int {
+		return cmp.Compare(a.position, b.position)
+	})
+	keyed = slices.CompactFunc(keyed, func(a, b indexedRoute) bool {
+		return a.position == b.position
+	})
+
+	// keyed are moved to the end and merged from the beginning, so they are never overwritten before they are read
+	n, k := len(routes), len(keyed)
+	merged := slices.Grow(keyed, n)[:n+k]
+	copy(merged[n:], merged[:k])
+
+	i, j := 0, n
+	for w := range merged {
+		if j == n+k || (i < n && routes[i].position < merged[j].position) {
+			merged[w] = routes[i]
+			i++
+		} else {
+			merged[w] = merged[j]
+			j++
+		}
+	}
+
+	return merged
+}
+
+// updateMessage returns the message of the update of the message type.
+func updateMessage(update *lumex.Update, updateType string) *lumex.Message {
+	switch updateType {
+	case lumex.UpdateTypeMessage:
+		return update.Message
+	case lumex.UpdateTypeEditedMessage:
+		return update.EditedMessage
+	case lumex.UpdateTypeChannelPost:
+		return update.ChannelPost
+	case lumex.UpdateTypeEditedChannelPost:
+		return update.EditedChannelPost
+	case lumex.UpdateTypeBusinessMessage:
+		return update.BusinessMessage
+	case lumex.UpdateTypeEditedBusinessMessage:
+		return update.EditedBusinessMessage
+	default:
+		return nil
+	}
+}
+
+// candidates returns routes which can match the update of the context, the index is rebuilt if routes were added.
+func (r *Router) candidates(ctx *Context) []indexedRoute {
+	idx := r.index.Load()
+	if idx == nil || idx.size != len(r.routes) {
+		idx = newRouteIndex(r.routes, !r.withoutIndex)
+		r.index.Store(idx)
+	}
+
+	if r.withoutIndex {
+		return idx.all
+	}
+
+	return idx.candidates(ctx.Update, &ctx.routeBuf)
+}
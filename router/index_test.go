@@ -0,0 +1,193 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/kbgod/lumex"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoute_UpdateTypes(t *testing.T) {
+	handler := func(ctx *Context) error { return nil }
+	custom := func(ctx *Context) bool {
+		return ctx.Update.Poll != nil
+	}
+
+	r := New(nil)
+	for _, tc := range []struct {
+		name  string
+		route *Route
+		want  []string
+	}{
+		{name: "any update", route: r.OnUpdate(handler), want: nil},
+		{name: "message", route: r.OnMessage(handler), want: []string{lumex.UpdateTypeMessage}},
+		{name: "message filter", route: r.OnTextPrefix("hi", handler), want: []string{lumex.UpdateTypeMessage}},
+		{name: "command", route: r.OnCommand("start", handler), want: []string{lumex.UpdateTypeMessage}},
+		{name: "edited message", route: r.OnEditedMessage(handler), want: []string{lumex.UpdateTypeEditedMessage}},
+		{name: "callback prefix", route: r.OnCallbackPrefix("a", handler), want: []string{lumex.UpdateTypeCallbackQuery}},
+		{name: "filter of the package", route: r.On(Message(TextEquals("hi")), handler), want: nil},
+		{name: "custom", route: r.On(custom, handler), want: nil},
+		{name: "declared custom", route: r.On(custom, handler).UpdateTypes(lumex.UpdateTypePoll), want: []string{lumex.UpdateTypePoll}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, tc.route.GetUpdateTypes())
+		})
+	}
+}
+
+func TestRouter_routeIndexDoesNotCallFilters(t *testing.T) {
+	custom := func(ctx *Context) bool {
+		t.Error("custom filter must not be called while the index is built")
+
+		return false
+	}
+
+	r := New(nil)
+	r.On(custom, func(ctx *Context) error { return nil })
+	r.On(custom, func(ctx *Context) error { return nil }).UpdateTypes(lumex.UpdateTypePoll)
+	r.On(And(Message(), custom), func(ctx *Context) error { return nil }).DescribeFilter("premium user")
+
+	assert.Equal(t, []string{lumex.UpdateTypePoll}, r.routes[1].GetUpdateTypes())
+	assert.Equal(t, "premium user", r.routes[2].GetFilterDescription())
+	assert.NotEmpty(t, r.AllowedUpdates())
+	assert.NoError(t, r.Dump(io.Discard))
+}
+
+func TestRouter_routeIndex(t *testing.T) {
+	command := func(text string) *lumex.Update {
+		return &lumex.Update{Message: &lumex.Message{
+			Text:     text,
+			Entities: []lumex.MessageEntity{{Type: "bot_command", Length: int64(len(text))}},
+		}}
+	}
+	callback := func(data string) *lumex.Update {
+		return &lumex.Update{CallbackQuery: &lumex.CallbackQuery{Data: data}}
+	}
+
+	updates := []*lumex.Update{
+		command("/start"),
+		command("/help"),
+		command("/unknown"),
+		{Message: &lumex.Message{Text: "hi"}},
+		{EditedMessage: &lumex.Message{Text: "/start", Entities: command("/start").Message.Entities}},
+		callback("ab:1"),
+		callback("a:1"),
+		callback("b"),
+		callback(""),
+		{InlineQuery: &lumex.InlineQuery{Query: "q"}},
+		{Poll: &lumex.Poll{}},
+		{},
+	}
+
+	register := func(r *Router, handled *string) {
+		handler := func(name string) Handler {
+			return func(ctx *Context) error {
+				*handled = name
+
+				return nil
+			}
+		}
+
+		r.OnCommand("help", handler("help"))
+		r.OnCallbackPrefix("ab", handler("ab"))
+		r.On(Or(CallbackPrefix("a"), CallbackPrefix("ab:")), handler("a or ab:")).UpdateTypes(lumex.UpdateTypeCallbackQuery)
+		r.OnTextEquals("hi", handler("hi"))
+		// any update routes must be checked between indexed routes
+		r.On(func(ctx *Context) bool {
+			return ctx.Update.Message != nil && ctx.Update.Message.Text == "/start"
+		}, handler("custom start"))
+		r.On(Command("start", "help"), handler("start"))
+		r.On(EditedMessage(Command("start")), handler("edited start"))
+		r.OnCallbackQuery(handler("callback"))
+		r.On(func(ctx *Context) bool {
+			return ctx.Update.Poll != nil
+		}, handler("poll")).UpdateTypes(lumex.UpdateTypePoll)
+		r.Group().OnInlineQuery(handler("inline"))
+	}
+
+	var indexed, scanned string
+	r := New(nil)
+	register(r, &indexed)
+	scan := New(nil, WithoutRouteIndex())
+	register(scan, &scanned)
+
+	for _, update := range updates {
+		indexed, scanned = "", ""
+		indexErr := r.HandleUpdate(context.Background(), update)
+		scanErr := scan.HandleUpdate(context.Background(), update)
+
+		assert.Equal(t, scanErr, indexErr, "update %s", update.GetType())
+		assert.Equal(t, scanned, indexed, "update %s", update.GetType())
+	}
+
+	indexed = ""
+	assert.NoError(t, r.HandleUpdate(context.Background(), command("/start")))
+	assert.Equal(t, "custom start", indexed)
+	assert.NoError(t, r.HandleUpdate(context.Background(), callback("ab:1")))
+	assert.Equal(t, "ab", indexed)
+
+	t.Run("routes added after updates", func(t *testing.T) {
+		r.OnCommand("unknown", func(ctx *Context) error {
+			indexed = "unknown"
+
+			return nil
+		})
+
+		assert.NoError(t, r.HandleUpdate(context.Background(), command("/unknown")))
+		assert.Equal(t, "unknown", indexed)
+	})
+}
+
+func BenchmarkRouter_routeIndex(b *testing.B) {
+	newRouter := func(opts ...Option) *Router {
+		r := New(nil, opts...)
+		handler := func(ctx *Context) error {
+			return nil
+		}
+
+		// 400 routes like in a big bot: commands, menu buttons and callback buttons
+		for i := range 100 {
+			r.OnCommand(fmt.Sprintf("command%d", i), handler)
+			r.OnTextEquals(fmt.Sprintf("button %d", i), handler)
+			r.OnCallbackPrefix(fmt.Sprintf("action%d:", i), handler)
+			r.On(Message(PrivateChat(), TextPrefix(fmt.Sprintf("search %d ", i))), handler).UpdateTypes(lumex.UpdateTypeMessage)
+		}
+		r.OnMessage(handler)
+		r.OnCallbackQuery(handler)
+
+		return r
+	}
+
+	updates := map[string]*lumex.Update{
+		"command": {Message: &lumex.Message{
+			Text:     "/command99",
+			Entities: []lumex.MessageEntity{{Type: "bot_command", Length: 10}},
+		}},
+		"text":     {Message: &lumex.Message{Text: "button 99"}},
+		"callback": {CallbackQuery: &lumex.CallbackQuery{Data: "action99:1"}},
+		"fallback": {CallbackQuery: &lumex.CallbackQuery{Data: "unknown"}},
+	}
+
+	for _, mode := range []struct {
+		name string
+		opts []Option
+	}{
+		{name: "index"},
+		{name: "scan", opts: []Option{WithoutRouteIndex()}},
+	} {
+		r := newRouter(mode.opts...)
+		for _, name := range []string{"command", "text", "callback", "fallback"} {
+			update := updates[name]
+
+			b.Run(mode.name+"/"+name, func(b *testing.B) {
+				b.ReportAllocs()
+				for range b.N {
+					_ = r.HandleUpdate(context.Background(), update)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Module
+//
+// is a feature of the bot like billing or support, it registers its routes on the router given by Router.Mount.
+// A module may implement ModuleInitializer and ModuleShutdowner to manage its resources.
+type Module interface {
+	Register(r *Router)
+}
+
+// ModuleInitializer is implemented by modules which prepare resources before handling updates, see Router.InitModules.
+type ModuleInitializer interface {
+	Init(ctx context.Context) error
+}
+
+// ModuleShutdowner is implemented by modules which release resources after handling updates, see Router.ShutdownModules.
+type ModuleShutdowner interface {
+	Shutdown(ctx context.Context) error
+}
+
+// MountOpts configures the router of the mounted module.
+type MountOpts struct {
+	// Name is the name of the module used in errors of InitModules and ShutdownModules,
+	// routes named with Route.Name get the prefix "<name>.". The type of the module is used if it is empty.
+	Name string
+	// Middlewares are called before handlers of every route of the module, after middlewares of the parent router.
+	Middlewares []Handler
+	// State scopes routes of the module to states matching the pattern like UseState does,
+	// states of UseState routers of the module are relative to it.
+	State string
+	// Priority orders routes across modules: routes with higher priority are checked first,
+	// routes with equal priority are checked in order of registration.
+	// It is relative to the router the module is mounted on, routes registered directly on the root have priority 0.
+	Priority int
+}
+
+type mountedModule struct {
+	name   string
+	module Module
+}
+
+// Mount
+//
+// registers routes of the module on a sub router with its own middlewares, name prefix, state and priority.
+// Unlike Group and UseState, the order of routes across modules doesn't depend on the order of mounting
+// if priorities are set, so a module mounted later can take precedence over general routes of the root router.
+// opts may be nil. It returns the sub router of the module.
+// Example:
+// r.Mount(admin.New(db), &router.MountOpts{Name: "admin", State: "admin:*", Priority: 10})
+func (r *Router) Mount(module Module, opts *MountOpts) *Router {
+	if opts == nil {
+		opts = &MountOpts{}
+	}
+
+	name := opts.Name
+	if name == "" {
+		name = fmt.Sprintf("%T", module)
+	}
+
+	var sub *Router
+	if opts.State != "" {
+		sub = r.UseState(opts.State, opts.Middlewares...)
+	} else {
+		sub = r.Group(opts.Middlewares...)
+	}
+	if opts.Name != "" {
+		sub.namePrefix = r.namePrefix + opts.Name + "."
+	}
+	sub.priority = r.priority + opts.Priority
+
+	root := r.root()
+	root.modules = append(root.modules, mountedModule{name: name, module: module})
+
+	module.Register(sub)
+
+	return sub
+}
+
+// Include
+//
+// mounts modules without options, their routes are checked in order of registration.
+func (r *Router) Include(modules ...Module) {
+	for _, module := range modules {
+		r.Mount(module, nil)
+	}
+}
+
+// InitModules
+//
+// calls Init of mounted modules in order of mounting and stops on the first error.
+// Call it after all modules are mounted and before handling updates.
+func (r *Router) InitModules(ctx context.Context) error {
+	for _, m := range r.root().modules {
+		initializer, ok := m.module.(ModuleInitializer)
+		if !ok {
+			continue
+		}
+
+		if err := initializer.Init(ctx); err != nil {
+			return fmt.Errorf("init module %s: %w", m.name, err)
+		}
+	}
+
+	return nil
+}
+
+// ShutdownModules
+//
+// calls Shutdown of mounted modules in reverse order of mounting, so modules can depend on modules mounted before.
+// All modules are shut down even if some of them fail, errors are joined.
+func (r *Router) ShutdownModules(ctx context.Context) error {
+	var errs []error
+	for _, m := range slices.Backward(r.root().modules) {
+		shutdowner, ok := m.module.(ModuleShutdowner)
+		if !ok {
+			continue
+		}
+
+		if err := shutdowner.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("shutdown module %s: %w", m.name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
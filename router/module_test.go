@@ -0,0 +1,152 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/kbgod/lumex"
+	"github.com/stretchr/testify/assert"
+)
+
+// testModule records lifecycle calls to log.
+type testModule struct {
+	name        string
+	log         *[]string
+	initErr     error
+	shutdownErr error
+}
+
+func (m *testModule) Register(_ *Router) {}
+
+func (m *testModule) Init(_ context.Context) error {
+	*m.log = append(*m.log, "init "+m.name)
+
+	return m.initErr
+}
+
+func (m *testModule) Shutdown(_ context.Context) error {
+	*m.log = append(*m.log, "shutdown "+m.name)
+
+	return m.shutdownErr
+}
+
+// registerOnly is a module without lifecycle methods.
+type registerOnly func(r *Router)
+
+func (f registerOnly) Register(r *Router) {
+	f(r)
+}
+
+func TestRouter_Mount(t *testing.T) {
+	text := func(text string) *lumex.Update {
+		return &lumex.Update{Message: &lumex.Message{Text: text}}
+	}
+
+	t.Run("priority orders routes across modules", func(t *testing.T) {
+		var called []string
+		handler := func(name string) Handler {
+			return func(ctx *Context) error {
+				called = append(called, name)
+
+				return nil
+			}
+		}
+
+		r := New(nil)
+		r.OnMessage(handler("root"))
+		r.Mount(registerOnly(func(r *Router) {
+			r.On(Message(TextEquals("a")), handler("low"))
+		}), &MountOpts{Priority: -1})
+		r.Mount(registerOnly(func(r *Router) {
+			r.On(Message(TextEquals("a")), handler("high 1"))
+			r.Mount(registerOnly(func(r *Router) {
+				r.On(Message(TextEquals("a")), handler("nested"))
+			}), &MountOpts{Priority: 1})
+		}), &MountOpts{Priority: 10})
+		r.Mount(registerOnly(func(r *Router) {
+			r.On(Message(TextEquals("a")), handler("high 2"))
+		}), &MountOpts{Priority: 10})
+
+		routes := r.GetRoutes()
+		assert.Equal(t, []int{11, 10, 10, 0, -1}, []int{
+			routes[0].priority, routes[1].priority, routes[2].priority, routes[3].priority, routes[4].priority,
+		})
+
+		assert.NoError(t, r.HandleUpdate(context.Background(), text("a")))
+		assert.NoError(t, r.HandleUpdate(context.Background(), text("b")))
+		assert.Equal(t, []string{"nested", "root"}, called)
+	})
+
+	t.Run("middlewares, names and state", func(t *testing.T) {
+		var called []string
+		middleware := func(name string) Handler {
+			return func(ctx *Context) error {
+				called = append(called, name)
+
+				return ctx.Next()
+			}
+		}
+		handler := func(ctx *Context) error {
+			called = append(called, "handler")
+
+			return nil
+		}
+
+		r := New(nil)
+		r.Use(func(ctx *Context) error {
+			ctx.SetState("billing:pay")
+
+			return ctx.Next()
+		})
+		billing := r.Mount(registerOnly(func(r *Router) {
+			r.Use(middleware("module use"))
+			r.OnMessage(handler).Name("pay")
+		}), &MountOpts{Name: "billing", Middlewares: []Handler{middleware("module")}, State: "billing:*"})
+		r.OnCommand("other", handler).Name("other")
+
+		assert.Equal(t, "billing.pay", r.GetRoutes()[0].GetName())
+		assert.Equal(t, "other", r.GetRoutes()[1].GetName())
+		assert.Equal(t, "billing:*", r.GetRoutes()[0].GetFormattedState())
+
+		billing.Group().OnCallbackQuery(handler).Name("callback")
+		assert.Equal(t, "billing.callback", r.GetRoutes()[2].GetName())
+
+		assert.NoError(t, r.HandleUpdate(context.Background(), text("hello")))
+		assert.Equal(t, []string{"module", "module use", "handler"}, called)
+	})
+
+	t.Run("lifecycle", func(t *testing.T) {
+		var log []string
+		shutdownErr := errors.New("shutdown error")
+
+		r := New(nil)
+		r.Include(&testModule{name: "db", log: &log}, registerOnly(func(r *Router) {}))
+		r.Mount(&testModule{name: "billing", log: &log, shutdownErr: shutdownErr}, &MountOpts{Name: "billing"})
+		r.Group().Mount(&testModule{name: "support", log: &log, shutdownErr: shutdownErr}, nil)
+
+		assert.NoError(t, r.InitModules(context.Background()))
+		err := r.ShutdownModules(context.Background())
+		assert.ErrorIs(t, err, shutdownErr)
+		assert.ErrorContains(t, err, "shutdown module billing: shutdown error")
+		assert.ErrorContains(t, err, "shutdown module *router.testModule: shutdown error")
+		assert.Equal(t, []string{
+			"init db", "init billing", "init support",
+			"shutdown support", "shutdown billing", "shutdown db",
+		}, log)
+	})
+
+	t.Run("init error", func(t *testing.T) {
+		var log []string
+		initErr := errors.New("init error")
+
+		r := New(nil)
+		r.Mount(&testModule{name: "db", log: &log, initErr: initErr}, &MountOpts{Name: "db"})
+		r.Mount(&testModule{name: "billing", log: &log}, nil)
+
+		err := r.InitModules(context.Background())
+		assert.ErrorIs(t, err, initErr)
+		assert.EqualError(t, err, "init module db: init error")
+		assert.Equal(t, []string{"init db"}, log)
+	})
+}
@@ -0,0 +1,125 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// errSlotDetached is returned to handlers which take the pool slot back after HandleUpdate abandoned them.
+var errSlotDetached = errors.New("pool slot is given back")
+
+type poolContextKey struct{}
+
+// Pool
+//
+// runs update handlers with at most size handlers running at a time.
+// Handlers waiting in Context.Ask give their slot back while they wait and take it again when the reply arrives,
+// so a pool of any size can't be exhausted by waiting handlers.
+type Pool struct {
+	slots chan struct{}
+	wg    sync.WaitGroup
+}
+
+// NewPool creates a pool of size slots, size less than 1 is treated as 1.
+func NewPool(size int) *Pool {
+	return &Pool{
+		slots: make(chan struct{}, max(size, 1)),
+	}
+}
+
+// Go waits for a free slot and runs fn in a new goroutine with ctx which carries the slot.
+// It returns false without running fn if ctx is done before a slot is free.
+func (p *Pool) Go(ctx context.Context, fn func(ctx context.Context)) bool {
+	if p.acquire(ctx) != nil {
+		return false
+	}
+
+	slot := &poolSlot{pool: p, held: true}
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer slot.detach()
+
+		fn(context.WithValue(ctx, poolContextKey{}, slot))
+	}()
+
+	return true
+}
+
+// Wait blocks until all functions started by Go return.
+func (p *Pool) Wait() {
+	p.wg.Wait()
+}
+
+func (p *Pool) acquire(ctx context.Context) error {
+	select {
+	case p.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *Pool) release() {
+	<-p.slots
+}
+
+// poolSlot is the slot of the pool taken by a function started by Go, it is given back only if it is held.
+// The slot is detached when the function is finished or abandoned by HandleUpdate, it can't be taken again then.
+type poolSlot struct {
+	mu       sync.Mutex
+	pool     *Pool
+	held     bool
+	detached bool
+}
+
+func (s *poolSlot) acquire(ctx context.Context) error {
+	s.mu.Lock()
+	held, detached := s.held, s.detached
+	s.mu.Unlock()
+
+	if held {
+		return nil
+	}
+	if detached {
+		return errSlotDetached
+	}
+	if err := s.pool.acquire(ctx); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.detached {
+		s.pool.release()
+
+		return errSlotDetached
+	}
+	s.held = true
+
+	return nil
+}
+
+func (s *poolSlot) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.held {
+		s.held = false
+		s.pool.release()
+	}
+}
+
+// detach gives the slot back for good.
+func (s *poolSlot) detach() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.detached = true
+	if s.held {
+		s.held = false
+		s.pool.release()
+	}
+}
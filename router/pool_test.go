@@ -0,0 +1,32 @@
+package router
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPool(t *testing.T) {
+	pool := NewPool(0)
+	assert.Equal(t, 1, cap(pool.slots))
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	assert.True(t, pool.Go(context.Background(), func(ctx context.Context) {
+		close(started)
+		<-release
+	}))
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.False(t, pool.Go(ctx, func(ctx context.Context) {
+		t.Error("function must not run when the pool is full")
+	}))
+
+	close(release)
+	pool.Wait()
+	assert.Empty(t, pool.slots)
+}
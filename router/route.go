@@ -1,14 +1,41 @@
 package router
 
+import (
+	"slices"
+
+	"github.com/kbgod/lumex"
+)
+
 type Route struct {
 	name     string
 	filter   RouteFilter
 	state    *string
 	handlers []Handler
+	// stateMatcher matches state patterns, the state is compared exactly if it is nil.
+	stateMatcher StateMatcher
+	// middlewares is the number of group middlewares at the beginning of handlers.
+	middlewares int
+	// namePrefix is the prefix of the route name and priority is the priority of the route, see Router.Mount.
+	namePrefix string
+	priority   int
+	// router is the router the route was registered on, it is used to find the error handler.
+	router *Router
+	// spec and filterDescription are set by On* helpers, Route.UpdateTypes and Route.DescribeFilter.
+	spec              filterSpec
+	filterDescription string
+
+	// command is set by OnCommand and similar helpers, it is used to build bot commands for Router.SyncCommands.
+	command      string
+	description  string
+	descriptions map[string]string
+	scopes       []lumex.BotCommandScope
 }
 
+// Name
+//
+// sets the name of the route, routes of mounted modules get the name prefix of the module, see MountOpts.
 func (route *Route) Name(name string) *Route {
-	route.name = name
+	route.name = route.namePrefix + name
 	return route
 }
 
@@ -16,6 +43,67 @@ func (route *Route) GetName() string {
 	return route.name
 }
 
+// Use
+//
+// adds middlewares to the route, they are called after middlewares of the group and before handlers of the route.
+// Example:
+// r.OnCommand("ban", ban).Use(adminOnly)
+func (route *Route) Use(middlewares ...Handler) *Route {
+	// handlers may share the array with the slice given to On, so they are copied
+	route.handlers = slices.Concat(route.handlers[:route.middlewares], middlewares, route.handlers[route.middlewares:])
+	route.middlewares += len(middlewares)
+	return route
+}
+
+// errorHandler returns the error handler of the nearest router the route belongs to.
+func (route *Route) errorHandler() ErrorHandler {
+	for r := route.router; r != nil; r = r.parent {
+		if r.errorHandler != nil {
+			return r.errorHandler
+		}
+	}
+
+	return nil
+}
+
+// Describe
+//
+// sets the description of the command shown in the Telegram menu, see Router.SyncCommands.
+// Only routes registered with OnCommand, OnStart and OnCommandWithAt are bot commands.
+func (route *Route) Describe(description string) *Route {
+	route.description = description
+	return route
+}
+
+// DescribeIn
+//
+// sets the description of the command for users with the given language code (two-letter ISO 639-1),
+// users with other languages see the description set by Describe.
+func (route *Route) DescribeIn(languageCode, description string) *Route {
+	if route.descriptions == nil {
+		route.descriptions = make(map[string]string)
+	}
+	route.descriptions[languageCode] = description
+	return route
+}
+
+// Scope
+//
+// sets scopes of users which see the command in the Telegram menu, lumex.BotCommandScopeDefault is used if not set.
+// Scope doesn't restrict who can use the command, use filters or middlewares for it.
+func (route *Route) Scope(scopes ...lumex.BotCommandScope) *Route {
+	route.scopes = append(route.scopes, scopes...)
+	return route
+}
+
+func (route *Route) GetCommand() string {
+	return route.command
+}
+
+func (route *Route) GetDescription() string {
+	return route.description
+}
+
 func (route *Route) GetState() *string {
 	return route.state
 }
@@ -28,6 +116,52 @@ func (route *Route) GetFormattedState() string {
 	return *route.state
 }
 
+// UpdateTypes
+//
+// declares types of updates the route filter can match, see lumex.UpdateType* constants,
+// so the filter is checked only for updates of these types and AllowedUpdates includes them.
+// Routes registered with On* helpers declare their types, routes of On can match any update without it,
+// because filters passed to On are not inspected.
+// Example:
+// r.On(router.Message(router.PrivateChat()), handler).UpdateTypes(lumex.UpdateTypeMessage)
+func (route *Route) UpdateTypes(types ...string) *Route {
+	route.spec = filterSpec{updateTypes: slices.Clone(types)}
+	if route.router != nil {
+		// the index may be built already with the previous types
+		route.router.root().index.Store(nil)
+	}
+	return route
+}
+
+// GetUpdateTypes
+//
+// returns types of updates the route filter can match, nil if the route can match any update.
+func (route *Route) GetUpdateTypes() []string {
+	return slices.Clone(route.spec.updateTypes)
+}
+
+// DescribeFilter
+//
+// sets the description of the route filter shown by Router.Explain and Router.Dump.
+// Routes registered with On* helpers are described, routes of On are shown as "custom filter" without it.
+// Example:
+// r.On(isPremium, handler).DescribeFilter("premium user")
+func (route *Route) DescribeFilter(description string) *Route {
+	route.filterDescription = description
+	return route
+}
+
+// GetFilterDescription
+//
+// returns the description of the route filter, like "command /start", see DescribeFilter.
+func (route *Route) GetFilterDescription() string {
+	if route.filterDescription == "" {
+		return customFilterDescription
+	}
+
+	return route.filterDescription
+}
+
 func (route *Route) GetHandlersCount() int {
 	return len(route.handlers)
 }
@@ -1,6 +1,12 @@
 package router
 
-import "testing"
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/kbgod/lumex"
+)
 
 func TestRoute_Name(t *testing.T) {
 	route := new(Route)
@@ -92,3 +98,31 @@ func TestNewRoute(t *testing.T) {
 		t.Errorf("newRoute(nil, nil, func(ctx *Context) error { return nil }).handlers = %d; want 1", len(route.handlers))
 	}
 }
+
+func TestRoute_Use(t *testing.T) {
+	var called []string
+	handler := func(name string) Handler {
+		return func(ctx *Context) error {
+			called = append(called, name)
+
+			return ctx.Next()
+		}
+	}
+
+	r := New(nil)
+	shared := []Handler{handler("handler")}
+	r.Group(handler("group")).On(AnyUpdate(), shared...).Use(handler("route 1")).Use(handler("route 2"))
+	other := r.On(AnyUpdate(), shared...)
+
+	if err := r.HandleUpdate(context.Background(), &lumex.Update{}); err != nil {
+		t.Fatalf("router.HandleUpdate() = %v; want <nil>", err)
+	}
+
+	want := []string{"group", "route 1", "route 2", "handler"}
+	if !slices.Equal(called, want) {
+		t.Errorf("called = %v; want %v", called, want)
+	}
+	if other.GetHandlersCount() != 1 {
+		t.Errorf("other.GetHandlersCount() = %d; want 1", other.GetHandlersCount())
+	}
+}
@@ -3,8 +3,12 @@ package router
 import (
 	"context"
 	"errors"
+	"fmt"
 	"os"
+	"runtime"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/kbgod/lumex"
@@ -14,6 +18,9 @@ import (
 var (
 	ErrGroupCannotHandleUpdates = errors.New("group cannot handle updates")
 	ErrRouteNotFound            = errors.New("route not found")
+	ErrHandlerTimeout           = errors.New("handler timeout")
+	ErrHandlerPanic             = errors.New("handler panic")
+	ErrNoBot                    = errors.New("router has no bot")
 )
 
 type Router struct {
@@ -25,7 +32,21 @@ type Router struct {
 
 	contextPool sync.Pool
 
-	errorHandler ErrorHandler
+	errorHandler     ErrorHandler
+	handlerTimeout   time.Duration
+	usernameResolver UsernameResolver
+	callbackPaths    *callbackNode
+	stateMatcher     StateMatcher
+	asks             askRegistry
+	// namePrefix and priority are set by Mount and inherited by routes and sub routers.
+	namePrefix string
+	priority   int
+	modules    []mountedModule
+	// notFound are fallback routes of the root router, see NotFound.
+	notFound []*Route
+	// index is the route index of the root router, see WithoutRouteIndex.
+	index        atomic.Pointer[routeIndex]
+	withoutIndex bool
 
 	log log.Logger
 }
@@ -52,16 +73,36 @@ func New(bot *lumex.Bot, opts ...Option) *Router {
 }
 
 func (r *Router) next(ctx *Context) error {
-	for ctx.indexRoute < len(r.routes)-1 {
+	// only routes which can match the update are checked, see routeIndex
+	if ctx.indexRoute == -1 {
+		// replies to Context.Ask are not routed, they are delivered after middlewares of the router
+		if r.deliver(ctx) {
+			return nil
+		}
+		ctx.routes = r.candidates(ctx)
+	}
+
+	for ctx.indexRoute < len(ctx.routes)-1 {
 		ctx.indexRoute++
-		route := r.routes[ctx.indexRoute]
-		if route.filter(ctx) && (route.state == nil || (ctx.state != nil && *route.state == *ctx.state)) {
+		route := ctx.routes[ctx.indexRoute].route
+		// captures of regex filters belong only to the route which matched
+		ctx.match, ctx.matchNames = nil, nil
+		if route.filter(ctx) && route.matchState(ctx.state) {
 			ctx.route = route
+			ctx.setMatched(route)
 			ctx.indexHandler = -1
 			return ctx.Next()
 		}
 	}
 
+	if route := r.notFoundRoute(ctx.state); route != nil {
+		ctx.match, ctx.matchNames = nil, nil
+		ctx.route = route
+		ctx.setMatched(route)
+		ctx.indexHandler = -1
+		return ctx.Next()
+	}
+
 	return ErrRouteNotFound
 }
 
@@ -69,13 +110,33 @@ func (r *Router) Use(middlewares ...Handler) {
 	r.handlers = append(r.handlers, middlewares...)
 }
 
+// UseState creates a router which routes match only if the state of the event context matches the pattern.
+// The pattern is an exact state, a glob like "checkout:*" or alternatives like "cart|checkout:*", see MatchState.
+// The state router inherits middlewares of the router it is created on, like Group does,
+// and runs its own middlewares after them.
+//
+// Nested state routers are hierarchical: the pattern of the inner router is relative to the outer one
+// and they are joined with ":", every alternative of the outer pattern with every alternative of the inner one.
+// Example: r.UseState("checkout").UseState("address|payment") matches "checkout:address" and "checkout:payment".
+//
+// Precedence: routes are checked in order of registration whatever their patterns are,
+// so a route for "checkout:*" registered before a route for "checkout:payment" handles the payment state too.
+// Register exact states before wildcards, a warning is logged when a route of an exact state
+// is registered after a wildcard route with the same filter. Routes without state match any state.
 func (r *Router) UseState(state string, handlers ...Handler) *Router {
+	if r.state != nil {
+		state = joinStates(*r.state, state)
+	}
+
 	return &Router{
-		parent:   r,
-		state:    &state,
-		bot:      r.bot,
-		routes:   r.routes,
-		handlers: handlers,
+		parent:       r,
+		state:        &state,
+		stateMatcher: MatchState(state),
+		bot:          r.bot,
+		routes:       r.routes,
+		handlers:     slices.Concat(r.getAllSubRouterHandlers(), handlers),
+		namePrefix:   r.namePrefix,
+		priority:     r.priority,
 	}
 }
 
@@ -93,22 +154,42 @@ func (r *Router) UseState(state string, handlers ...Handler) *Router {
 // g.On(Message(), handler5)
 func (r *Router) Group(handlers ...Handler) *Router {
 	return &Router{
-		parent:   r,
-		state:    r.state,
-		bot:      r.bot,
-		routes:   nil,
-		handlers: append(r.getAllSubRouterHandlers(), handlers...),
+		parent:       r,
+		state:        r.state,
+		stateMatcher: r.stateMatcher,
+		bot:          r.bot,
+		routes:       nil,
+		handlers:     slices.Concat(r.getAllSubRouterHandlers(), handlers),
+		namePrefix:   r.namePrefix,
+		priority:     r.priority,
 	}
 }
 
+// getAllSubRouterHandlers returns middlewares which sub routers of r inherit.
+// Handlers of a sub router already include middlewares of its parents, root middlewares are called by Context.Next.
 func (r *Router) getAllSubRouterHandlers() []Handler {
 	if r.parent != nil {
-		return append(r.parent.getAllSubRouterHandlers(), r.handlers...)
+		return r.handlers
 	}
 
 	return nil
 }
 
+// root returns the router which sub routers of r add routes to.
+// GetState returns the state pattern of the router created with UseState and its groups, nil for other routers.
+// Patterns of nested state routers are joined, see UseState.
+func (r *Router) GetState() *string {
+	return r.state
+}
+
+func (r *Router) root() *Router {
+	for r.parent != nil {
+		r = r.parent
+	}
+
+	return r
+}
+
 func (r *Router) GetRoutes() []*Route {
 	return r.routes
 }
@@ -117,132 +198,277 @@ func (r *Router) addRoute(route *Route) {
 	if r.parent != nil {
 		r.parent.addRoute(route)
 	} else {
-		r.routes = append(r.routes, route)
+		r.routes = insertRoute(r.routes, route)
+		r.warnShadowed(route)
+	}
+}
+
+// insertRoute inserts the route after all routes with the same or higher priority,
+// so routes with equal priority are checked in order of registration.
+func insertRoute(routes []*Route, route *Route) []*Route {
+	i := len(routes)
+	for i > 0 && routes[i-1].priority < route.priority {
+		i--
 	}
+
+	return slices.Insert(routes, i, route)
 }
 
 // On registers a new route with the given filter and handlers.
 func (r *Router) On(filter RouteFilter, handlers ...Handler) *Route {
+	route := r.newRoute(filter, handlers)
+	r.addRoute(route)
+	return route
+}
+
+// on registers the route of the filter of the package, so the route carries the spec and the description of the filter.
+func (r *Router) on(f describedFilter, handlers []Handler) *Route {
+	route := r.newRoute(f.filter, handlers)
+	route.spec, route.filterDescription = f.spec, f.description
+	r.addRoute(route)
+	return route
+}
+
+// newRoute creates the route with middlewares and settings of the router.
+func (r *Router) newRoute(filter RouteFilter, handlers []Handler) *Route {
 	var route *Route
 	if r.parent != nil {
-		route = newRoute(filter, r.state, append(r.handlers, handlers...)...)
+		route = newRoute(filter, r.state, slices.Concat(r.handlers, handlers)...)
+		route.middlewares = len(r.handlers)
 	} else {
 		route = newRoute(filter, r.state, handlers...)
 	}
-	r.addRoute(route)
+	route.router = r
+	route.stateMatcher = r.stateMatcher
+	route.namePrefix = r.namePrefix
+	route.priority = r.priority
 	return route
 }
 
+// NotFound
+//
+// registers the fallback route called when no route matches the update instead of returning ErrRouteNotFound.
+// Fallbacks of sub routers created with UseState are called only in their states and are checked
+// before fallbacks without state, the first matching fallback is called. Middlewares of the router are called before handlers.
+// Example:
+// r.NotFound(unknownCommand)
+// r.UseState("checkout:*").NotFound(checkoutHelp)
+func (r *Router) NotFound(handlers ...Handler) *Route {
+	route := r.newRoute(AnyUpdate(), handlers)
+	root := r.root()
+	root.notFound = insertRoute(root.notFound, route)
+	return route
+}
+
+// notFoundRoute returns the fallback route for the state, nil if there is no such route.
+func (r *Router) notFoundRoute(state *string) *Route {
+	for _, scoped := range []bool{true, false} {
+		for _, route := range r.notFound {
+			if (route.state != nil) == scoped && route.matchState(state) {
+				return route
+			}
+		}
+	}
+
+	return nil
+}
+
+// OnError
+//
+// sets the error handler of routes registered on the router and its sub routers.
+// Errors of a route are handled by the error handler of the nearest router it was registered on,
+// so groups and states can handle their errors differently. OnError on the root router
+// replaces the handler set by WithErrorHandler, which also handles errors of router middlewares and timeouts.
+func (r *Router) OnError(handler ErrorHandler) {
+	r.errorHandler = handler
+}
+
 func (r *Router) OnUpdate(handlers ...Handler) *Route {
-	return r.On(AnyUpdate(), handlers...)
+	return r.on(anyUpdateFilter(), handlers)
 }
 
 func (r *Router) OnMessage(handlers ...Handler) *Route {
-	return r.On(Message(), handlers...)
+	return r.on(messageFilter(), handlers)
+}
+
+func (r *Router) OnEditedMessage(handlers ...Handler) *Route {
+	return r.on(editedMessageFilter(), handlers)
+}
+
+func (r *Router) OnChannelPost(handlers ...Handler) *Route {
+	return r.on(channelPostFilter(), handlers)
+}
+
+func (r *Router) OnEditedChannelPost(handlers ...Handler) *Route {
+	return r.on(editedChannelPostFilter(), handlers)
+}
+
+func (r *Router) OnBusinessConnection(handlers ...Handler) *Route {
+	return r.on(businessConnectionFilter(), handlers)
+}
+
+func (r *Router) OnBusinessMessage(handlers ...Handler) *Route {
+	return r.on(businessMessageFilter(), handlers)
+}
+
+func (r *Router) OnEditedBusinessMessage(handlers ...Handler) *Route {
+	return r.on(editedBusinessMessageFilter(), handlers)
+}
+
+func (r *Router) OnDeletedBusinessMessages(handlers ...Handler) *Route {
+	return r.on(deletedBusinessMessagesFilter(), handlers)
+}
+
+func (r *Router) OnMessageReaction(handlers ...Handler) *Route {
+	return r.on(messageReactionFilter(), handlers)
+}
+
+func (r *Router) OnMessageReactionCount(handlers ...Handler) *Route {
+	return r.on(messageReactionCountFilter(), handlers)
 }
 
 func (r *Router) OnCommand(command string, handlers ...Handler) *Route {
-	return r.On(Command(command), handlers...)
+	return r.on(commandFilter(command), handlers).asCommand(command)
 }
 
 func (r *Router) OnStart(handlers ...Handler) *Route {
-	return r.On(Command("start"), handlers...)
+	return r.on(commandFilter("start"), handlers).asCommand("start")
 }
 
 func (r *Router) OnTextPrefix(prefix string, handlers ...Handler) *Route {
-	return r.On(TextPrefix(prefix), handlers...)
+	return r.on(textPrefixFilter(prefix), handlers)
 }
 
 func (r *Router) OnTextEquals(text string, handlers ...Handler) *Route {
-	return r.On(TextEquals(text), handlers...)
+	return r.on(textEqualsFilter(text), handlers)
 }
 
 func (r *Router) OnTextContains(text string, handlers ...Handler) *Route {
-	return r.On(TextContains(text), handlers...)
+	return r.on(textContainsFilter(text), handlers)
 }
 
 func (r *Router) OnCommandWithAt(command string, handlers ...Handler) *Route {
-	return r.On(CommandWithAt(command), handlers...)
+	return r.on(commandWithAtFilter(command), handlers).asCommand(command)
+}
+
+func (r *Router) OnTextRegex(pattern string, handlers ...Handler) *Route {
+	return r.on(textRegexFilter(pattern), handlers)
 }
 
 func (r *Router) OnCallbackQuery(handlers ...Handler) *Route {
-	return r.On(CallbackQuery(), handlers...)
+	return r.on(callbackQueryFilter(), handlers)
 }
 
 func (r *Router) OnCallbackPrefix(prefix string, handlers ...Handler) *Route {
-	return r.On(CallbackPrefix(prefix), handlers...)
+	return r.on(callbackPrefixFilter(prefix), handlers)
+}
+
+func (r *Router) OnCallbackRegex(pattern string, handlers ...Handler) *Route {
+	return r.on(callbackRegexFilter(pattern), handlers)
 }
 
 func (r *Router) OnInlineQuery(handlers ...Handler) *Route {
-	return r.On(InlineQuery(), handlers...)
+	return r.on(inlineQueryFilter(), handlers)
+}
+
+func (r *Router) OnChosenInlineResult(handlers ...Handler) *Route {
+	return r.on(chosenInlineResultFilter(), handlers)
 }
 
 func (r *Router) OnInlinePrefix(prefix string, handlers ...Handler) *Route {
-	return r.On(InlineQueryPrefix(prefix), handlers...)
+	return r.on(inlineQueryPrefixFilter(prefix), handlers)
+}
+
+func (r *Router) OnInlineQueryRegex(pattern string, handlers ...Handler) *Route {
+	return r.on(inlineQueryRegexFilter(pattern), handlers)
 }
 
 func (r *Router) OnMyChatMember(handlers ...Handler) *Route {
-	return r.On(MyChatMember(), handlers...)
+	return r.on(myChatMemberFilter(), handlers)
 }
 
 func (r *Router) OnChatMember(handlers ...Handler) *Route {
-	return r.On(ChatMember(), handlers...)
+	return r.on(chatMemberFilter(), handlers)
+}
+
+func (r *Router) OnChatJoinRequest(handlers ...Handler) *Route {
+	return r.on(chatJoinRequestFilter(), handlers)
+}
+
+func (r *Router) OnChatBoost(handlers ...Handler) *Route {
+	return r.on(chatBoostFilter(), handlers)
+}
+
+func (r *Router) OnRemovedChatBoost(handlers ...Handler) *Route {
+	return r.on(removedChatBoostFilter(), handlers)
+}
+
+func (r *Router) OnShippingQuery(handlers ...Handler) *Route {
+	return r.on(shippingQueryFilter(), handlers)
 }
 
 func (r *Router) OnPreCheckoutQuery(handlers ...Handler) *Route {
-	return r.On(PreCheckoutQuery(), handlers...)
+	return r.on(preCheckoutQueryFilter(), handlers)
+}
+
+func (r *Router) OnPoll(handlers ...Handler) *Route {
+	return r.on(pollFilter(), handlers)
+}
+
+func (r *Router) OnPollAnswer(handlers ...Handler) *Route {
+	return r.on(pollAnswerFilter(), handlers)
 }
 
 func (r *Router) OnSuccessfulPayment(handlers ...Handler) *Route {
-	return r.On(SuccessfulPayment(), handlers...)
+	return r.on(successfulPaymentFilter(), handlers)
 }
 
 func (r *Router) OnForwardedChannelMessage(handlers ...Handler) *Route {
-	return r.On(ForwardedChannelMessage(), handlers...)
+	return r.on(forwardedChannelMessageFilter(), handlers)
 }
 
 func (r *Router) OnPhoto(handlers ...Handler) *Route {
-	return r.On(Photo(), handlers...)
+	return r.on(photoFilter(), handlers)
 }
 
 func (r *Router) OnAudio(handlers ...Handler) *Route {
-	return r.On(Audio(), handlers...)
+	return r.on(audioFilter(), handlers)
 }
 
 func (r *Router) OnDocument(handlers ...Handler) *Route {
-	return r.On(Document(), handlers...)
+	return r.on(documentFilter(), handlers)
 }
 
 func (r *Router) OnSticker(handlers ...Handler) *Route {
-	return r.On(Sticker(), handlers...)
+	return r.on(stickerFilter(), handlers)
 }
 
 func (r *Router) OnVideo(handlers ...Handler) *Route {
-	return r.On(Video(), handlers...)
+	return r.on(videoFilter(), handlers)
 }
 
 func (r *Router) OnVoice(handlers ...Handler) *Route {
-	return r.On(Voice(), handlers...)
+	return r.on(voiceFilter(), handlers)
 }
 
 func (r *Router) OnVideoNote(handlers ...Handler) *Route {
-	return r.On(VideoNote(), handlers...)
+	return r.on(videoNoteFilter(), handlers)
 }
 
 func (r *Router) OnAnimation(handlers ...Handler) *Route {
-	return r.On(Animation(), handlers...)
+	return r.on(animationFilter(), handlers)
 }
 
 func (r *Router) OnPurchasedPaidMedia(handlers ...Handler) *Route {
-	return r.On(PurchasedPaidMedia(), handlers...)
+	return r.on(purchasedPaidMediaFilter(), handlers)
 }
 
 func (r *Router) OnChatShared(handlers ...Handler) *Route {
-	return r.On(ChatShared(), handlers...)
+	return r.on(chatSharedFilter(), handlers)
 }
 
 func (r *Router) OnUsersShared(handlers ...Handler) *Route {
-	return r.On(UsersShared(), handlers...)
+	return r.on(usersSharedFilter(), handlers)
 }
 
 func (r *Router) acquireContext(ctx context.Context, update *lumex.Update) *Context {
@@ -260,31 +486,190 @@ func (r *Router) acquireContext(ctx context.Context, update *lumex.Update) *Cont
 	// clean up
 	eventCtx.state = nil
 	eventCtx.route = nil
+	if eventCtx.matched == nil {
+		eventCtx.matched = new(atomic.Pointer[Route])
+	}
+	eventCtx.matched.Store(nil)
 	eventCtx.indexRoute = -1
+	eventCtx.routes = nil
 	eventCtx.indexHandler = -1
 	eventCtx.parseMode = nil
+	eventCtx.filterMessage = nil
+	eventCtx.match = nil
+	eventCtx.matchNames = nil
+	eventCtx.callbackPath = nil
+	eventCtx.callbackMatched = false
+	eventCtx.params = eventCtx.params[:0]
+	eventCtx.filterTrace = nil
+	eventCtx.clearValues()
+	if eventCtx.typed != nil {
+		eventCtx.typed.reset()
+	}
 
 	return eventCtx
 }
 
 func (r *Router) releaseContext(ctx *Context) {
+	// values must not keep user data alive while the context waits in the pool
+	ctx.clearValues()
+	if ctx.typed != nil {
+		ctx.typed.reset()
+	}
 	r.contextPool.Put(ctx)
 }
 
 // HandleUpdate
 //
 // This method is used to handle updates. Can be used in long-polling mode or webhook mode.
+// If the handler timeout is set, the deadline is applied to the event context, so handlers and requests made
+// with it are cancelled when it is reached. Errors of handlers stopped by the deadline wrap ErrHandlerTimeout
+// and are reported to the error handler of the route with the context which is not cancelled.
+//
+// Go can't stop a goroutine, so a handler which ignores its context keeps running after the deadline.
+// If the context of HandleUpdate has a deadline, set by the handler timeout or by the caller, HandleUpdate
+// doesn't wait for such a handler: when the deadline is reached, the update is finished with an error wrapping
+// ErrHandlerTimeout and the slot of the Pool running it is given back, so workers of Listen and the dispatcher
+// move on. The handler goes on in the background without the slot until it returns. If it panics then,
+// the panic is reported to the error handler with an error wrapping ErrHandlerPanic instead of crashing the process.
 func (r *Router) HandleUpdate(ctx context.Context, update *lumex.Update) error {
 	if r.parent != nil {
 		return ErrGroupCannotHandleUpdates
 	}
+
+	if r.handlerTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.handlerTimeout)
+		defer cancel()
+	}
+
 	eventCtx := r.acquireContext(ctx, update)
+
+	if _, ok := ctx.Deadline(); !ok {
+		defer r.releaseContext(eventCtx)
+
+		return r.handled(ctx, eventCtx, eventCtx.Next())
+	}
+
+	done := make(chan handlerResult, 1)
+	go func() {
+		result := handlerResult{panicked: true}
+		defer func() {
+			if result.panicked {
+				// runtime.Goexit, like t.FailNow in a handler, doesn't panic, so nothing is recovered then
+				result.panic = recover()
+				result.goexit = result.panic == nil
+			}
+			done <- result
+		}()
+
+		result.err = eventCtx.Next()
+		result.panicked = false
+	}()
+
+	select {
+	case result := <-done:
+		return r.finished(ctx, eventCtx, result)
+	case <-ctx.Done():
+	}
+
+	select {
+	case result := <-done:
+		// the handler returned at the deadline
+		return r.finished(ctx, eventCtx, result)
+	default:
+	}
+
+	if slot, ok := ctx.Value(poolContextKey{}).(*poolSlot); ok {
+		slot.detach()
+	}
+
+	go r.abandoned(ctx, eventCtx, done)
+
+	// the abandoned handler still uses the event context, so the error is reported with a new one
+	errCtx := r.acquireContext(context.WithoutCancel(ctx), update)
+	defer r.releaseContext(errCtx)
+	errCtx.route = eventCtx.matched.Load()
+
+	err := ctx.Err()
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = fmt.Errorf("%w: %w", ErrHandlerTimeout, err)
+	}
+
+	return r.handleError(errCtx, err)
+}
+
+// handlerResult is the result of handlers run by HandleUpdate in a goroutine, a panic is passed to the caller.
+type handlerResult struct {
+	err      error
+	panicked bool
+	panic    any
+	// goexit reports that the handler goroutine was exited with runtime.Goexit.
+	goexit bool
+}
+
+// finished releases the event context of handlers which returned in time and handles their result.
+// A panic is raised again and runtime.Goexit is called again in the goroutine of HandleUpdate,
+// like if handlers were called there.
+func (r *Router) finished(ctx context.Context, eventCtx *Context, result handlerResult) error {
 	defer r.releaseContext(eventCtx)
 
-	err := eventCtx.Next()
+	switch {
+	case result.goexit:
+		runtime.Goexit()
+	case result.panicked:
+		panic(result.panic)
+	}
+
+	return r.handled(ctx, eventCtx, result.err)
+}
+
+// abandoned waits for handlers which HandleUpdate stopped waiting for at the deadline and releases their event context.
+// Nobody can recover a panic raised there, so a late panic is reported to the error handler with an error
+// wrapping ErrHandlerPanic, or logged if the error handler returns it.
+func (r *Router) abandoned(ctx context.Context, eventCtx *Context, done <-chan handlerResult) {
+	result := <-done
+	update, route := eventCtx.Update, eventCtx.matched.Load()
+	r.releaseContext(eventCtx)
 
-	if err != nil && r.errorHandler != nil {
-		r.errorHandler(eventCtx, err)
+	if !result.panicked || result.goexit {
+		return
+	}
+
+	errCtx := r.acquireContext(context.WithoutCancel(ctx), update)
+	defer r.releaseContext(errCtx)
+	errCtx.route = route
+
+	err := fmt.Errorf("%w after the deadline: %v", ErrHandlerPanic, result.panic)
+	if err = r.handleError(errCtx, err); err != nil {
+		r.log.Error(err, "handler panicked after the deadline", nil)
+	}
+}
+
+// handled reports the error of handlers, errors of handlers stopped by the deadline wrap ErrHandlerTimeout.
+func (r *Router) handled(ctx context.Context, eventCtx *Context, err error) error {
+	if err != nil && ctx.Err() != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) && !errors.Is(err, ErrHandlerTimeout) {
+			err = fmt.Errorf("%w: %w", ErrHandlerTimeout, err)
+		}
+		// the error handler may reply, so it gets the context which is not cancelled
+		eventCtx.ctx = context.WithoutCancel(ctx)
+	}
+
+	return r.handleError(eventCtx, err)
+}
+
+func (r *Router) handleError(eventCtx *Context, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	handler := r.errorHandler
+	if eventCtx.route != nil {
+		handler = eventCtx.route.errorHandler()
+	}
+
+	if handler != nil {
+		handler(eventCtx, err)
 
 		return nil
 	}
@@ -294,7 +679,11 @@ func (r *Router) HandleUpdate(ctx context.Context, update *lumex.Update) error {
 
 // Listen starts getting updates using bot.GetUpdatesChanWithContext method
 // this is preferred way to get updates in production
-// Attention: this method blocks until interrupt signal received and all workers finished or timeout reached
+// Updates are handled by a Pool of poolSize handlers, handlers waiting in Context.Ask don't occupy it.
+// Allowed updates are derived from routes if updatesOpts don't specify them, see UpdatesOpts.
+// Attention: this method blocks until interrupt signal received and all workers finished or timeout reached.
+// When the timeout is reached, handlers are cancelled and Listen returns without waiting for handlers
+// which ignore their context, see HandleUpdate.
 func (r *Router) Listen(
 	ctx context.Context,
 	interrupt chan os.Signal,
@@ -303,39 +692,29 @@ func (r *Router) Listen(
 	updatesOpts *lumex.GetUpdatesChanOpts,
 ) {
 	updatesCtx, updatesCancel := context.WithCancel(ctx)
-	updates := r.bot.GetUpdatesChanWithContext(updatesCtx, updatesOpts)
+	updates := r.bot.GetUpdatesChanWithContext(updatesCtx, r.UpdatesOpts(updatesOpts))
 
-	var wg sync.WaitGroup
+	pool := NewPool(poolSize)
 	poolCtx, poolCancel := context.WithCancel(ctx)
-	for i := 0; i < poolSize; i++ {
-		go func(id int) {
-			wg.Add(1)
-			defer wg.Done()
-			for {
-				select {
-				case update, ok := <-updates:
-					if !ok {
-						r.log.Debug("worker shutting down", map[string]any{"id": id})
-						return
-					}
-					err := func() <-chan error {
-						errChan := make(chan error)
-						go func() {
-							errChan <- r.HandleUpdate(poolCtx, &update)
-						}()
-						return errChan
-					}()
-
-					select {
-					case <-poolCtx.Done():
-						return
-					case <-err:
-						// do nothing
-					}
-				}
+	defer poolCancel()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for update := range updates {
+			if poolCtx.Err() != nil {
+				break
 			}
-		}(i)
-	}
+
+			// handlers are cancelled when the pool context is cancelled or the handler timeout is reached
+			if !pool.Go(poolCtx, func(ctx context.Context) {
+				_ = r.HandleUpdate(ctx, &update)
+			}) {
+				break
+			}
+		}
+		r.log.Debug("updates loop shutting down", nil)
+	}()
 
 	<-interrupt
 	updatesCancel()
@@ -343,10 +722,17 @@ func (r *Router) Listen(
 	r.log.Debug("updates channel closed", nil)
 	r.log.Debug("waiting for workers to finish", map[string]any{"timeout": timeout})
 
+	finished := make(chan struct{})
 	go func() {
-		<-time.After(timeout)
-		poolCancel()
+		<-done
+		pool.Wait()
+		close(finished)
 	}()
 
-	wg.Wait()
+	select {
+	case <-finished:
+	case <-time.After(timeout):
+		poolCancel()
+		r.log.Warn("workers didn't finish before the timeout, they are cancelled", map[string]any{"timeout": timeout})
+	}
 }
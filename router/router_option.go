@@ -1,6 +1,10 @@
 package router
 
-import "github.com/kbgod/lumex/log"
+import (
+	"time"
+
+	"github.com/kbgod/lumex/log"
+)
 
 type Option func(*Router)
 
@@ -23,3 +27,36 @@ func WithLogger(logger log.Logger) Option {
 		r.log = logger
 	}
 }
+
+// WithHandlerTimeout
+//
+// is an option for the router that sets the maximum duration of handling a single update.
+// The deadline is applied to the event context, so requests made with it are cancelled as well.
+// When the timeout is reached, an error wrapping ErrHandlerTimeout is reported to the error handler.
+// See HandleUpdate for handlers which ignore the context.
+func WithHandlerTimeout(timeout time.Duration) Option {
+	return func(r *Router) {
+		r.handlerTimeout = timeout
+	}
+}
+
+// WithoutRouteIndex
+//
+// is an option for the router that disables the route index, so every route filter is checked for every update.
+// By default filters are checked only for updates of types routes declare, see Route.UpdateTypes,
+// use the option if updates have several fields set, like hand-made updates in tests.
+func WithoutRouteIndex() Option {
+	return func(r *Router) {
+		r.withoutIndex = true
+	}
+}
+
+// WithUsernameResolver
+//
+// is an option for the router that sets the resolver of @username mentions in command arguments.
+// Without it, mentions bound by Usage have only the username, because Telegram doesn't provide user ids for them.
+func WithUsernameResolver(resolver UsernameResolver) Option {
+	return func(r *Router) {
+		r.usernameResolver = resolver
+	}
+}
@@ -2,11 +2,17 @@ package router
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"os"
+	"runtime"
 	"testing"
+	"time"
 
 	"github.com/kbgod/lumex"
+	"github.com/kbgod/lumex/mocks"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 func TestRouterNew(t *testing.T) {
@@ -47,7 +53,8 @@ func TestRouter_next(t *testing.T) {
 	}
 	ctx = router.acquireContext(context.Background(), &lumex.Update{
 		Message: &lumex.Message{
-			Text: "/test",
+			Text:     "/test",
+			Entities: []lumex.MessageEntity{{Type: "bot_command", Length: 5}},
 		},
 	})
 
@@ -82,6 +89,170 @@ func TestRouter_UseState(t *testing.T) {
 	if stateRouter.parent != router {
 		t.Errorf("stateRouter.parent = %v; want %v", stateRouter.parent, router)
 	}
+
+	t.Run("state patterns", func(t *testing.T) {
+		var called string
+		handler := func(name string) Handler {
+			return func(ctx *Context) error {
+				called = name
+
+				return nil
+			}
+		}
+
+		router := New(nil)
+		router.Use(func(ctx *Context) error {
+			if ctx.Update.Message.Caption != "" {
+				ctx.SetState(ctx.Update.Message.Caption)
+			}
+
+			return ctx.Next()
+		})
+		router.OnTextEquals("global", handler("global"))
+		router.UseState("checkout:confirm").OnTextEquals("cancel", handler("confirm cancel"))
+		router.UseState("checkout:*").OnTextEquals("cancel", handler("checkout cancel"))
+		router.UseState("cart|wishlist").OnTextEquals("cancel", handler("cart cancel"))
+		router.UseState("*").OnTextEquals("cancel", handler("any cancel"))
+		router.OnTextEquals("cancel", handler("no state cancel"))
+
+		cases := []struct {
+			state string
+			text  string
+			want  string
+		}{
+			{"", "cancel", "no state cancel"},
+			{"", "global", "global"},
+			{"checkout:address", "global", "global"},
+			{"checkout:address", "cancel", "checkout cancel"},
+			{"checkout:payment:card", "cancel", "checkout cancel"},
+			{"checkout:confirm", "cancel", "confirm cancel"},
+			{"checkout", "cancel", "any cancel"},
+			{"cart", "cancel", "cart cancel"},
+			{"wishlist", "cancel", "cart cancel"},
+			{"cart:items", "cancel", "any cancel"},
+		}
+
+		for _, tc := range cases {
+			t.Run(tc.state+" "+tc.text, func(t *testing.T) {
+				called = ""
+				err := router.HandleUpdate(context.Background(), &lumex.Update{
+					Message: &lumex.Message{Text: tc.text, Caption: tc.state},
+				})
+
+				assert.NoError(t, err)
+				assert.Equal(t, tc.want, called)
+			})
+		}
+	})
+
+	t.Run("first registered pattern wins", func(t *testing.T) {
+		var called string
+		router := New(nil)
+		router.Use(func(ctx *Context) error {
+			ctx.SetState("checkout:payment")
+
+			return ctx.Next()
+		})
+		router.UseState("checkout:*").OnMessage(func(ctx *Context) error {
+			called = "wildcard"
+
+			return nil
+		})
+		router.UseState("checkout:payment").OnMessage(func(ctx *Context) error {
+			called = "exact"
+
+			return nil
+		})
+
+		assert.NoError(t, router.HandleUpdate(context.Background(), &lumex.Update{Message: &lumex.Message{}}))
+		assert.Equal(t, "wildcard", called)
+	})
+
+	t.Run("nested state routers are relative", func(t *testing.T) {
+		var calls []string
+		middleware := func(name string) Handler {
+			return func(ctx *Context) error {
+				calls = append(calls, name)
+
+				return ctx.Next()
+			}
+		}
+
+		router := New(nil)
+		router.Use(func(ctx *Context) error {
+			ctx.SetState(ctx.Update.Message.Text)
+
+			return ctx.Next()
+		})
+
+		checkout := router.UseState("checkout", middleware("checkout"))
+		payment := checkout.UseState("payment|confirm", middleware("payment"))
+		assert.Equal(t, "checkout:payment|checkout:confirm", *payment.state)
+		payment.Group(middleware("group")).OnMessage(func(ctx *Context) error {
+			calls = append(calls, "handler")
+
+			return nil
+		})
+
+		for _, state := range []string{"checkout:payment", "checkout:confirm"} {
+			calls = nil
+			err := router.HandleUpdate(context.Background(), &lumex.Update{Message: &lumex.Message{Text: state}})
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"checkout", "payment", "group", "handler"}, calls, "state %s", state)
+		}
+
+		for _, state := range []string{"payment", "checkout", "cart:payment", "checkout:address"} {
+			calls = nil
+			err := router.HandleUpdate(context.Background(), &lumex.Update{Message: &lumex.Message{Text: state}})
+			assert.ErrorIs(t, err, ErrRouteNotFound, "state %s", state)
+			assert.Empty(t, calls, "state %s", state)
+		}
+	})
+
+	t.Run("state router inherits middlewares of the group", func(t *testing.T) {
+		var calls []string
+		router := New(nil)
+		router.Use(func(ctx *Context) error {
+			ctx.SetState("checkout")
+
+			return ctx.Next()
+		})
+
+		group := router.Group(func(ctx *Context) error {
+			calls = append(calls, "group")
+
+			return ctx.Next()
+		})
+		group.UseState("checkout", func(ctx *Context) error {
+			calls = append(calls, "state")
+
+			return ctx.Next()
+		}).OnMessage(func(ctx *Context) error {
+			calls = append(calls, "handler")
+
+			return nil
+		})
+
+		assert.NoError(t, router.HandleUpdate(context.Background(), &lumex.Update{Message: &lumex.Message{}}))
+		assert.Equal(t, []string{"group", "state", "handler"}, calls)
+	})
+
+	t.Run("shadowed exact state is logged", func(t *testing.T) {
+		logger := mocks.NewLogger(t)
+		logger.On("Warn", "route is shadowed by a wildcard state route registered before it", map[string]any{
+			"state":          "checkout:payment",
+			"filter":         "message",
+			"wildcard_state": "checkout:*",
+		}).Once()
+
+		router := New(nil, WithLogger(logger))
+		router.UseState("checkout:address").OnMessage(func(ctx *Context) error { return nil })
+		router.UseState("checkout:*").OnMessage(func(ctx *Context) error { return nil })
+		// other filters and states are not shadowed
+		router.UseState("checkout:payment").OnCallbackQuery(func(ctx *Context) error { return nil })
+		router.UseState("cart").OnMessage(func(ctx *Context) error { return nil })
+		router.UseState("checkout:payment").OnMessage(func(ctx *Context) error { return nil })
+	})
 }
 
 func TestRouter_Group(t *testing.T) {
@@ -152,7 +323,8 @@ func TestRouter_Group(t *testing.T) {
 
 		err := router.HandleUpdate(context.Background(), &lumex.Update{
 			Message: &lumex.Message{
-				Text: "/test",
+				Text:     "/test",
+				Entities: []lumex.MessageEntity{{Type: "bot_command", Length: 5}},
 			},
 		})
 
@@ -185,7 +357,8 @@ func TestRouter_Group(t *testing.T) {
 
 		err := router.HandleUpdate(context.Background(), &lumex.Update{
 			Message: &lumex.Message{
-				Text: "/test",
+				Text:     "/test",
+				Entities: []lumex.MessageEntity{{Type: "bot_command", Length: 5}},
 			},
 		})
 
@@ -201,7 +374,8 @@ func TestRouter_Group(t *testing.T) {
 
 		err = router.HandleUpdate(context.Background(), &lumex.Update{
 			Message: &lumex.Message{
-				Text: "/root",
+				Text:     "/root",
+				Entities: []lumex.MessageEntity{{Type: "bot_command", Length: 5}},
 			},
 		})
 
@@ -263,7 +437,8 @@ func TestRouter_On(t *testing.T) {
 
 	ctx := router.acquireContext(context.Background(), &lumex.Update{
 		Message: &lumex.Message{
-			Text: "/test",
+			Text:     "/test",
+			Entities: []lumex.MessageEntity{{Type: "bot_command", Length: 5}},
 		},
 	})
 	if err := ctx.Next(); !errors.Is(err, handlerErr) {
@@ -293,7 +468,8 @@ func TestRouter_HandleUpdate(t *testing.T) {
 
 		if err := router.HandleUpdate(context.Background(), &lumex.Update{
 			Message: &lumex.Message{
-				Text: "/test",
+				Text:     "/test",
+				Entities: []lumex.MessageEntity{{Type: "bot_command", Length: 5}},
 			},
 		}); err != nil {
 			t.Errorf(
@@ -346,6 +522,11 @@ func TestRouter_Context(t *testing.T) {
 		ctx.indexHandler = 888
 		ctx.indexRoute = 999
 		ctx.route = &Route{}
+		ctx.match = []string{"a"}
+		ctx.matchNames = []string{""}
+		ctx.callbackPath = &CallbackPath{}
+		ctx.callbackMatched = true
+		ctx.params = []string{"a"}
 
 		router.releaseContext(ctx)
 
@@ -356,6 +537,11 @@ func TestRouter_Context(t *testing.T) {
 		assert.Equal(t, -1, ctx.indexHandler, "ctx.indexHandler = %d; want -1", ctx.indexHandler)
 		assert.Equal(t, -1, ctx.indexRoute, "ctx.indexRoute = %d; want -1", ctx.indexRoute)
 		assert.Nil(t, ctx.route, "ctx.route = %v; want <nil>", ctx.route)
+		assert.Nil(t, ctx.match, "ctx.match = %v; want <nil>", ctx.match)
+		assert.Nil(t, ctx.matchNames, "ctx.matchNames = %v; want <nil>", ctx.matchNames)
+		assert.Nil(t, ctx.callbackPath, "ctx.callbackPath = %v; want <nil>", ctx.callbackPath)
+		assert.False(t, ctx.callbackMatched, "ctx.callbackMatched = true; want false")
+		assert.Empty(t, ctx.params, "ctx.params = %v; want empty", ctx.params)
 	})
 
 	t.Run("releaseContext", func(t *testing.T) {
@@ -433,7 +619,8 @@ func TestRouter_Events(t *testing.T) {
 
 		err := router.HandleUpdate(context.Background(), &lumex.Update{
 			Message: &lumex.Message{
-				Text: "/start",
+				Text:     "/start",
+				Entities: []lumex.MessageEntity{{Type: "bot_command", Length: 6}},
 			},
 		})
 
@@ -457,7 +644,8 @@ func TestRouter_Events(t *testing.T) {
 
 		err := router.HandleUpdate(context.Background(), &lumex.Update{
 			Message: &lumex.Message{
-				Text: "/test",
+				Text:     "/test",
+				Entities: []lumex.MessageEntity{{Type: "bot_command", Length: 5}},
 			},
 		})
 
@@ -557,7 +745,8 @@ func TestRouter_Events(t *testing.T) {
 
 		err := router.HandleUpdate(context.Background(), &lumex.Update{
 			Message: &lumex.Message{
-				Text: "/test@bot",
+				Text:     "/test@bot",
+				Entities: []lumex.MessageEntity{{Type: "bot_command", Length: 9}},
 			},
 		})
 
@@ -565,7 +754,8 @@ func TestRouter_Events(t *testing.T) {
 
 		err = router.HandleUpdate(context.Background(), &lumex.Update{
 			Message: &lumex.Message{
-				Text: "/test",
+				Text:     "/test",
+				Entities: []lumex.MessageEntity{{Type: "bot_command", Length: 5}},
 			},
 		})
 
@@ -589,7 +779,8 @@ func TestRouter_Events(t *testing.T) {
 
 		err := router.HandleUpdate(context.Background(), &lumex.Update{
 			Message: &lumex.Message{
-				Text: "/test@bot",
+				Text:     "/test@bot",
+				Entities: []lumex.MessageEntity{{Type: "bot_command", Length: 9}},
 			},
 		})
 
@@ -1088,3 +1279,342 @@ func TestRouter_ErrorHandler(t *testing.T) {
 		assert.Equal(t, ErrRouteNotFound, err, "router.HandleUpdate() = %v; want ErrRouteNotFound")
 	})
 }
+
+func TestRouter_HandlerTimeout(t *testing.T) {
+	t.Run("timeout is reported to error handler", func(t *testing.T) {
+		var handlerErr error
+		router := New(nil, WithHandlerTimeout(10*time.Millisecond), WithErrorHandler(func(ctx *Context, err error) {
+			handlerErr = err
+
+			assert.NoError(t, ctx.Context().Err(), "error handler context must not be cancelled")
+		}))
+		router.OnUpdate(func(ctx *Context) error {
+			<-ctx.Context().Done()
+
+			return ctx.Context().Err()
+		})
+
+		err := router.HandleUpdate(context.Background(), &lumex.Update{})
+		assert.Nil(t, err, "router.HandleUpdate() = %v; want <nil>", err)
+		assert.ErrorIs(t, handlerErr, ErrHandlerTimeout)
+		assert.ErrorIs(t, handlerErr, context.DeadlineExceeded)
+	})
+
+	t.Run("timeout is reported to error handler of the group", func(t *testing.T) {
+		var groupErr error
+		router := New(nil, WithHandlerTimeout(10*time.Millisecond), WithErrorHandler(func(ctx *Context, err error) {
+			t.Error("router error handler must not be called")
+		}))
+		group := router.Group()
+		group.OnError(func(ctx *Context, err error) {
+			groupErr = err
+		})
+		group.OnUpdate(func(ctx *Context) error {
+			<-ctx.Context().Done()
+
+			return ctx.Context().Err()
+		})
+
+		err := router.HandleUpdate(context.Background(), &lumex.Update{})
+		assert.Nil(t, err, "router.HandleUpdate() = %v; want <nil>", err)
+		assert.ErrorIs(t, groupErr, ErrHandlerTimeout)
+	})
+
+	t.Run("handler panic reaches the caller", func(t *testing.T) {
+		router := New(nil, WithHandlerTimeout(time.Second))
+		router.OnUpdate(func(ctx *Context) error {
+			panic("handler panic")
+		})
+
+		assert.PanicsWithValue(t, "handler panic", func() {
+			_ = router.HandleUpdate(context.Background(), &lumex.Update{})
+		})
+	})
+
+	t.Run("timeout error returned without error handler", func(t *testing.T) {
+		router := New(nil, WithHandlerTimeout(10*time.Millisecond))
+		router.OnUpdate(func(ctx *Context) error {
+			<-ctx.Context().Done()
+
+			return ctx.Context().Err()
+		})
+
+		err := router.HandleUpdate(context.Background(), &lumex.Update{})
+		assert.ErrorIs(t, err, ErrHandlerTimeout)
+	})
+
+	t.Run("handler finished in time", func(t *testing.T) {
+		router := New(nil, WithHandlerTimeout(time.Second))
+		router.OnUpdate(func(ctx *Context) error {
+			_, ok := ctx.Context().Deadline()
+			assert.True(t, ok, "handler context has no deadline")
+
+			return nil
+		})
+
+		err := router.HandleUpdate(context.Background(), &lumex.Update{})
+		assert.Nil(t, err, "router.HandleUpdate() = %v; want <nil>", err)
+	})
+
+	t.Run("handler ignoring its context is abandoned", func(t *testing.T) {
+		release := make(chan struct{})
+		defer close(release)
+
+		var groupErr error
+		router := New(nil, WithHandlerTimeout(10*time.Millisecond))
+		group := router.Group()
+		group.OnError(func(ctx *Context, err error) {
+			groupErr = err
+
+			assert.NoError(t, ctx.Context().Err(), "error handler context must not be cancelled")
+		})
+		group.OnUpdate(func(ctx *Context) error {
+			<-release
+
+			return nil
+		})
+
+		err := router.HandleUpdate(context.Background(), &lumex.Update{})
+		assert.Nil(t, err, "router.HandleUpdate() = %v; want <nil>", err)
+		assert.ErrorIs(t, groupErr, ErrHandlerTimeout)
+	})
+
+	t.Run("panic of abandoned handler is reported", func(t *testing.T) {
+		errs := make(chan error, 2)
+		router := New(nil, WithHandlerTimeout(10*time.Millisecond), WithErrorHandler(func(ctx *Context, err error) {
+			assert.NoError(t, ctx.Context().Err(), "error handler context must not be cancelled")
+			errs <- err
+		}))
+		router.OnUpdate(func(ctx *Context) error {
+			time.Sleep(30 * time.Millisecond)
+
+			panic("late")
+		})
+
+		assert.NoError(t, router.HandleUpdate(context.Background(), &lumex.Update{}))
+		assert.ErrorIs(t, <-errs, ErrHandlerTimeout)
+
+		err := <-errs
+		assert.ErrorIs(t, err, ErrHandlerPanic)
+		assert.ErrorContains(t, err, "late")
+	})
+
+	t.Run("goexit of handler in time", func(t *testing.T) {
+		router := New(nil, WithHandlerTimeout(time.Second))
+		router.OnUpdate(func(ctx *Context) error {
+			runtime.Goexit()
+
+			return nil
+		})
+
+		returned := make(chan bool)
+		go func() {
+			defer close(returned)
+			_ = router.HandleUpdate(context.Background(), &lumex.Update{})
+			returned <- true
+		}()
+
+		assert.False(t, <-returned, "HandleUpdate must exit the goroutine like the handler did")
+	})
+
+	t.Run("abandoned handler gives the pool slot back", func(t *testing.T) {
+		release := make(chan struct{})
+		defer close(release)
+
+		router := New(nil, WithHandlerTimeout(10*time.Millisecond))
+		router.OnTextEquals("stuck", func(ctx *Context) error {
+			<-release
+
+			return nil
+		})
+		router.OnTextEquals("ok", func(ctx *Context) error {
+			return nil
+		})
+
+		pool := NewPool(1)
+		errs := make(chan error, 2)
+		for _, text := range []string{"stuck", "ok"} {
+			assert.True(t, pool.Go(context.Background(), func(ctx context.Context) {
+				errs <- router.HandleUpdate(ctx, &lumex.Update{Message: &lumex.Message{Text: text}})
+			}))
+		}
+
+		assert.ErrorIs(t, <-errs, ErrHandlerTimeout)
+		assert.NoError(t, <-errs)
+		pool.Wait()
+	})
+
+	t.Run("cancelled parent context", func(t *testing.T) {
+		router := New(nil)
+		router.OnUpdate(func(ctx *Context) error {
+			<-ctx.Context().Done()
+
+			return ctx.Context().Err()
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(10*time.Millisecond, cancel)
+
+		err := router.HandleUpdate(ctx, &lumex.Update{})
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.NotErrorIs(t, err, ErrHandlerTimeout)
+	})
+}
+
+func TestRouter_Listen_stuckHandler(t *testing.T) {
+	cl := mocks.NewBotClient(t)
+	getUpdates := func() *mock.Call {
+		return cl.On("RequestWithContext", mock.Anything, mock.Anything, "getUpdates", mock.Anything, mock.Anything)
+	}
+	getUpdates().Return(json.RawMessage(`[{"update_id":1,"message":{"text":"hi"}}]`), nil).Once()
+	getUpdates().Return(func(
+		ctx context.Context, _ string, _ string, _ map[string]any, _ *lumex.RequestOpts,
+	) (json.RawMessage, error) {
+		<-ctx.Done()
+
+		return nil, ctx.Err()
+	}, nil).Maybe()
+
+	bot, err := lumex.NewBot("123:test", &lumex.BotOpts{BotClient: cl, DisableTokenCheck: true})
+	assert.NoError(t, err)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+
+	r := New(bot)
+	r.OnMessage(func(ctx *Context) error {
+		close(started)
+		// the handler ignores its context
+		<-release
+
+		return nil
+	})
+
+	interrupt := make(chan os.Signal, 1)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		r.Listen(context.Background(), interrupt, 10*time.Millisecond, 1, &lumex.GetUpdatesChanOpts{ErrorHandler: func(error) {}})
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("update is not handled")
+	}
+	interrupt <- os.Interrupt
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Listen waits for the stuck handler after the timeout")
+	}
+}
+
+func TestRouter_OnError(t *testing.T) {
+	routeErr := errors.New("route error")
+	failing := func(ctx *Context) error { return routeErr }
+
+	var handled []string
+	errorHandler := func(name string) ErrorHandler {
+		return func(ctx *Context, err error) {
+			assert.ErrorIs(t, err, routeErr)
+			handled = append(handled, name)
+		}
+	}
+
+	r := New(nil, WithErrorHandler(errorHandler("root")))
+	r.On(TextEquals("root"), failing)
+
+	admin := r.Group()
+	admin.On(TextEquals("admin"), failing)
+	// the handler is used by routes registered before OnError too
+	admin.OnError(errorHandler("admin"))
+	admin.UseState("ban").On(TextEquals("ban"), failing)
+	admin.Group().On(TextEquals("nested"), failing)
+
+	r.Use(func(ctx *Context) error {
+		ctx.SetState("ban")
+		if ctx.Update.Message.Text == "middleware" {
+			return routeErr
+		}
+
+		return ctx.Next()
+	})
+
+	for _, text := range []string{"root", "admin", "ban", "nested", "middleware"} {
+		err := r.HandleUpdate(context.Background(), &lumex.Update{Message: &lumex.Message{Text: text}})
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, []string{"root", "admin", "admin", "admin", "root"}, handled)
+
+	t.Run("without root handler", func(t *testing.T) {
+		r := New(nil)
+		r.On(TextEquals("root"), failing)
+		r.Group().OnError(func(ctx *Context, err error) {
+			t.Error("error handler of the group must not be called")
+		})
+
+		err := r.HandleUpdate(context.Background(), &lumex.Update{Message: &lumex.Message{Text: "root"}})
+		assert.ErrorIs(t, err, routeErr)
+	})
+}
+
+func TestRouter_NotFound(t *testing.T) {
+	var called []string
+	handler := func(name string) Handler {
+		return func(ctx *Context) error {
+			called = append(called, name)
+
+			return ctx.Next()
+		}
+	}
+	setState := func(state string) Handler {
+		return func(ctx *Context) error {
+			if state != "" {
+				ctx.SetState(state)
+			}
+
+			return ctx.Next()
+		}
+	}
+
+	t.Run("fallbacks by state", func(t *testing.T) {
+		r := New(nil)
+		r.OnCommand("start", handler("start"))
+		r.NotFound(handler("default"))
+		r.UseState("checkout:*", handler("checkout middleware")).NotFound(handler("checkout"))
+		r.UseState("menu").NotFound(handler("menu")).Name("menu fallback")
+
+		for _, tc := range []struct {
+			state string
+			want  []string
+		}{
+			{state: "", want: []string{"default"}},
+			{state: "checkout:pay", want: []string{"checkout middleware", "checkout"}},
+			{state: "menu", want: []string{"menu"}},
+			{state: "other", want: []string{"default"}},
+		} {
+			called = nil
+			r.handlers = []Handler{setState(tc.state)}
+
+			err := r.HandleUpdate(context.Background(), &lumex.Update{Message: &lumex.Message{Text: "hi"}})
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, called, "state %q", tc.state)
+
+			e := r.ExplainState(&lumex.Update{Message: &lumex.Message{Text: "hi"}}, tc.state)
+			assert.True(t, e.NotFound)
+			assert.NotNil(t, e.Handled)
+		}
+	})
+
+	t.Run("no fallback for the state", func(t *testing.T) {
+		r := New(nil)
+		r.UseState("menu").NotFound(handler("menu"))
+
+		err := r.HandleUpdate(context.Background(), &lumex.Update{})
+		assert.ErrorIs(t, err, ErrRouteNotFound)
+		assert.Contains(t, r.Explain(&lumex.Update{}).String(), ErrRouteNotFound.Error())
+	})
+}
@@ -0,0 +1,124 @@
+package router
+
+import "strings"
+
+// StateMatcher reports whether the state of the event context matches the state pattern of a route.
+type StateMatcher func(state string) bool
+
+// MatchState
+//
+// compiles the state pattern used by Router.UseState:
+// "checkout:address" matches the state exactly,
+// "*" matches any sequence of characters, so "checkout:*" matches "checkout:address" and "checkout:payment:card",
+// "|" separates alternatives, so "checkout:address|checkout:payment" matches any of the two states.
+func MatchState(pattern string) StateMatcher {
+	alternatives := strings.Split(pattern, "|")
+	if len(alternatives) == 1 && !strings.Contains(pattern, "*") {
+		return func(state string) bool {
+			return state == pattern
+		}
+	}
+
+	return func(state string) bool {
+		for _, alternative := range alternatives {
+			if matchGlob(alternative, state) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// joinStates joins the pattern of a nested state router to the pattern of the outer one, see Router.UseState.
+func joinStates(outer, inner string) string {
+	var joined []string
+	for _, o := range strings.Split(outer, "|") {
+		for _, i := range strings.Split(inner, "|") {
+			joined = append(joined, o+":"+i)
+		}
+	}
+
+	return strings.Join(joined, "|")
+}
+
+// isExactState reports whether the pattern matches a single state.
+func isExactState(pattern string) bool {
+	return !strings.ContainsAny(pattern, "*|")
+}
+
+// warnShadowed logs a warning if the route of an exact state can't be reached,
+// because a wildcard route checked before it matches the state with the same filter.
+// Filters are compared by descriptions of On* helpers, routes of On are never compared.
+func (r *Router) warnShadowed(route *Route) {
+	if r.log == nil || route.state == nil || !isExactState(*route.state) || route.filterDescription == "" {
+		return
+	}
+
+	filter := route.filterDescription
+	for _, earlier := range r.routes {
+		if earlier == route {
+			return
+		}
+
+		if earlier.state == nil || isExactState(*earlier.state) || !earlier.matchState(route.state) {
+			continue
+		}
+
+		if earlierFilter := earlier.filterDescription; earlierFilter == filter || earlierFilter == "any update" {
+			r.log.Warn("route is shadowed by a wildcard state route registered before it", map[string]any{
+				"state":          *route.state,
+				"filter":         filter,
+				"wildcard_state": *earlier.state,
+			})
+
+			return
+		}
+	}
+}
+
+// matchGlob matches s against the pattern where "*" matches any sequence of characters.
+func matchGlob(pattern, s string) bool {
+	// star and next remember the last "*" and the position in s it is matched up to, to backtrack on mismatch
+	star, next := -1, 0
+	p, i := 0, 0
+
+	for i < len(s) {
+		switch {
+		case p < len(pattern) && pattern[p] == '*':
+			star, next = p, i
+			p++
+		case p < len(pattern) && pattern[p] == s[i]:
+			p++
+			i++
+		case star >= 0:
+			next++
+			p, i = star+1, next
+		default:
+			return false
+		}
+	}
+
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+
+	return p == len(pattern)
+}
+
+// matchState reports whether the route can handle the event context in the state.
+func (route *Route) matchState(state *string) bool {
+	if route.state == nil {
+		return true
+	}
+
+	if state == nil {
+		return false
+	}
+
+	if route.stateMatcher != nil {
+		return route.stateMatcher(*state)
+	}
+
+	return *route.state == *state
+}
@@ -0,0 +1,41 @@
+package router
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchState(t *testing.T) {
+	cases := []struct {
+		pattern string
+		state   string
+		want    bool
+	}{
+		{"checkout", "checkout", true},
+		{"checkout", "checkout:address", false},
+		{"checkout:*", "checkout:address", true},
+		{"checkout:*", "checkout:", true},
+		{"checkout:*", "checkout", false},
+		{"checkout:*", "cart:address", false},
+		{"*:payment", "checkout:payment", true},
+		{"*:payment", "checkout:payment:card", false},
+		{"checkout:*:card", "checkout:payment:card", true},
+		{"checkout:*:card", "checkout:a:b:card", true},
+		{"*", "", true},
+		{"*", "anything", true},
+		{"**", "a", true},
+		{"a*b*c", "abxbc", true},
+		{"a*b*c", "acb", false},
+		{"cart|checkout:*", "cart", true},
+		{"cart|checkout:*", "checkout:address", true},
+		{"cart|checkout:*", "wishlist", false},
+		{"", "", true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.pattern+" "+tc.state, func(t *testing.T) {
+			assert.Equal(t, tc.want, MatchState(tc.pattern)(tc.state))
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package router
+
+import (
+	"context"
+
+	"github.com/kbgod/lumex"
+)
+
+// TypedContext
+//
+// is the event context with the application state App of the type T, see NewTyped.
+// It embeds Context, so helpers like Reply and Next are called on it directly.
+// The Context method of the embedded event context is hidden by the field, use Std to get the context.Context.
+type TypedContext[T any] struct {
+	*Context
+	// App is created by the initializer of the typed router once per update.
+	App T
+
+	initialized bool
+}
+
+// Std returns the context.Context of the update, the same as ctx.Context.Context().
+func (ctx *TypedContext[T]) Std() context.Context {
+	return ctx.Context.Context()
+}
+
+// reset drops the application state, so it isn't kept alive while the event context waits in the pool.
+func (ctx *TypedContext[T]) reset() {
+	var zero T
+	ctx.Context = nil
+	ctx.App = zero
+	ctx.initialized = false
+}
+
+// TypedHandler is the handler of a typed router, see NewTyped.
+type TypedHandler[T any] func(*TypedContext[T]) error
+
+// TypedInitializer creates the application state of the update, see NewTyped.
+type TypedInitializer[T any] func(ctx *Context) (T, error)
+
+// TypedRouter
+//
+// is the router which handlers receive TypedContext, see NewTyped.
+// It embeds Router, so methods which are not typed like HandleUpdate, Listen and OnError are called on it directly,
+// and r.Router.Use and r.Router.On register middlewares and routes with plain handlers.
+// Common On* helpers take typed handlers, other helpers of the embedded router take handlers converted with Handler.
+// Like Router.On, On doesn't know update types of a custom filter, so the route is checked for every update
+// and isn't taken into account by AllowedUpdates unless they are declared with Route.UpdateTypes.
+type TypedRouter[T any] struct {
+	*Router
+
+	init TypedInitializer[T]
+}
+
+// NewTyped
+//
+// creates the router which handlers receive TypedContext with the application state created by init,
+// so handlers don't need to get the user, transaction or flags from the context with type assertions.
+// The state is created lazily by the first typed handler of the update which is called,
+// so plain middlewares registered before typed handlers can prepare values for init with Context.Set.
+// An error of init is returned by the handler like its own error. Typed contexts are reused
+// with pooled event contexts. init may be nil, then App is the zero value.
+// Example:
+//
+//	r := router.NewTyped(bot, func(ctx *router.Context) (AppCtx, error) {
+//		user, err := users.Get(ctx.Context(), ctx.Sender().Id)
+//		return AppCtx{User: user}, err
+//	})
+//	r.On(router.Command("me"), func(ctx *router.TypedContext[AppCtx]) error {
+//		return ctx.ReplyVoid(ctx.App.User.Name)
+//	})
+func NewTyped[T any](bot *lumex.Bot, init TypedInitializer[T], opts ...Option) *TypedRouter[T] {
+	return &TypedRouter[T]{Router: New(bot, opts...), init: init}
+}
+
+// typed returns the typed router of the sub router of r.
+func (r *TypedRouter[T]) typed(router *Router) *TypedRouter[T] {
+	return &TypedRouter[T]{Router: router, init: r.init}
+}
+
+// Context
+//
+// returns the typed context of the event context, the application state is created if it isn't yet.
+// It is used by plain handlers which need the application state.
+func (r *TypedRouter[T]) Context(ctx *Context) (*TypedContext[T], error) {
+	typed, ok := ctx.typed.(*TypedContext[T])
+	if !ok {
+		typed = &TypedContext[T]{}
+		ctx.typed = typed
+	}
+
+	if !typed.initialized {
+		typed.Context = ctx
+		if r.init != nil {
+			app, err := r.init(ctx)
+			if err != nil {
+				return nil, err
+			}
+			typed.App = app
+		}
+		typed.initialized = true
+	}
+
+	return typed, nil
+}
+
+// Handler
+//
+// converts the typed handler to the plain one, so it can be used with methods which are not typed,
+// like OnPhoto, Mount and NotFound of the embedded router.
+// Example: r.OnPhoto(r.Handler(photo))
+func (r *TypedRouter[T]) Handler(handler TypedHandler[T]) Handler {
+	return func(ctx *Context) error {
+		typed, err := r.Context(ctx)
+		if err != nil {
+			return err
+		}
+
+		return handler(typed)
+	}
+}
+
+// handlers converts typed handlers to plain ones.
+func (r *TypedRouter[T]) handlers(handlers []TypedHandler[T]) []Handler {
+	converted := make([]Handler, len(handlers))
+	for i, handler := range handlers {
+		converted[i] = r.Handler(handler)
+	}
+
+	return converted
+}
+
+// Use
+//
+// registers typed middlewares, plain middlewares are registered with r.Router.Use
+func (r *TypedRouter[T]) Use(middlewares ...TypedHandler[T]) {
+	r.Router.Use(r.handlers(middlewares)...)
+}
+
+// On registers a new route with the given filter and typed handlers.
+func (r *TypedRouter[T]) On(filter RouteFilter, handlers ...TypedHandler[T]) *Route {
+	return r.Router.On(filter, r.handlers(handlers)...)
+}
+
+func (r *TypedRouter[T]) OnUpdate(handlers ...TypedHandler[T]) *Route {
+	return r.Router.OnUpdate(r.handlers(handlers)...)
+}
+
+func (r *TypedRouter[T]) OnMessage(handlers ...TypedHandler[T]) *Route {
+	return r.Router.OnMessage(r.handlers(handlers)...)
+}
+
+func (r *TypedRouter[T]) OnCommand(command string, handlers ...TypedHandler[T]) *Route {
+	return r.Router.OnCommand(command, r.handlers(handlers)...)
+}
+
+func (r *TypedRouter[T]) OnStart(handlers ...TypedHandler[T]) *Route {
+	return r.Router.OnStart(r.handlers(handlers)...)
+}
+
+func (r *TypedRouter[T]) OnTextPrefix(prefix string, handlers ...TypedHandler[T]) *Route {
+	return r.Router.OnTextPrefix(prefix, r.handlers(handlers)...)
+}
+
+func (r *TypedRouter[T]) OnTextEquals(text string, handlers ...TypedHandler[T]) *Route {
+	return r.Router.OnTextEquals(text, r.handlers(handlers)...)
+}
+
+func (r *TypedRouter[T]) OnCallbackQuery(handlers ...TypedHandler[T]) *Route {
+	return r.Router.OnCallbackQuery(r.handlers(handlers)...)
+}
+
+func (r *TypedRouter[T]) OnCallbackPrefix(prefix string, handlers ...TypedHandler[T]) *Route {
+	return r.Router.OnCallbackPrefix(prefix, r.handlers(handlers)...)
+}
+
+func (r *TypedRouter[T]) OnCallbackPath(pattern string, handlers ...TypedHandler[T]) *Route {
+	return r.Router.OnCallbackPath(pattern, r.handlers(handlers)...)
+}
+
+func (r *TypedRouter[T]) OnInlineQuery(handlers ...TypedHandler[T]) *Route {
+	return r.Router.OnInlineQuery(r.handlers(handlers)...)
+}
+
+// Group
+//
+// creates a new typed router group with the given typed middlewares, see Router.Group
+func (r *TypedRouter[T]) Group(handlers ...TypedHandler[T]) *TypedRouter[T] {
+	return r.typed(r.Router.Group(r.handlers(handlers)...))
+}
+
+// UseState
+//
+// creates a typed router which routes match only if the state of the event context matches the pattern,
+// see Router.UseState
+func (r *TypedRouter[T]) UseState(state string, handlers ...TypedHandler[T]) *TypedRouter[T] {
+	return r.typed(r.Router.UseState(state, r.handlers(handlers)...))
+}
@@ -0,0 +1,135 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/kbgod/lumex"
+	"github.com/stretchr/testify/assert"
+)
+
+type testApp struct {
+	user  string
+	flags []string
+}
+
+func TestTypedRouter(t *testing.T) {
+	text := func(text string) *lumex.Update {
+		return &lumex.Update{Message: &lumex.Message{Text: text}}
+	}
+
+	t.Run("app is created once per update", func(t *testing.T) {
+		inits := 0
+		r := NewTyped(nil, func(ctx *Context) (testApp, error) {
+			inits++
+			user, _ := Value[string](ctx, "user")
+
+			return testApp{user: user}, nil
+		})
+
+		// plain middlewares run before the app is created
+		r.Router.Use(func(ctx *Context) error {
+			ctx.Set("user", ctx.Update.Message.Text)
+
+			return ctx.Next()
+		})
+		r.Use(func(ctx *TypedContext[testApp]) error {
+			ctx.App.flags = append(ctx.App.flags, "middleware")
+
+			return ctx.Next()
+		})
+
+		var handled []testApp
+		g := r.Group(func(ctx *TypedContext[testApp]) error {
+			ctx.App.flags = append(ctx.App.flags, "group")
+
+			return ctx.Next()
+		})
+		g.On(Message(), func(ctx *TypedContext[testApp]) error {
+			handled = append(handled, ctx.App)
+
+			return nil
+		})
+
+		assert.NoError(t, r.HandleUpdate(context.Background(), text("alice")))
+		assert.NoError(t, r.HandleUpdate(context.Background(), text("bob")))
+
+		assert.Equal(t, 2, inits)
+		assert.Equal(t, []testApp{
+			{user: "alice", flags: []string{"middleware", "group"}},
+			{user: "bob", flags: []string{"middleware", "group"}},
+		}, handled)
+	})
+
+	t.Run("init error", func(t *testing.T) {
+		errInit := errors.New("init")
+		r := NewTyped(nil, func(ctx *Context) (testApp, error) {
+			return testApp{}, errInit
+		})
+		called := false
+		r.On(AnyUpdate(), func(ctx *TypedContext[testApp]) error {
+			called = true
+
+			return nil
+		})
+
+		assert.ErrorIs(t, r.HandleUpdate(context.Background(), text("hi")), errInit)
+		assert.False(t, called)
+	})
+
+	t.Run("plain routes and state", func(t *testing.T) {
+		r := NewTyped[testApp](nil, nil)
+		var handled string
+		r.Router.OnStart(r.Handler(func(ctx *TypedContext[testApp]) error {
+			handled = "start " + ctx.App.user
+
+			return nil
+		}))
+		r.UseState("checkout").On(Message(), func(ctx *TypedContext[testApp]) error {
+			handled = "checkout"
+
+			return nil
+		})
+		r.Router.Use(func(ctx *Context) error {
+			if ctx.Update.Message.Text == "buy" {
+				ctx.SetState("checkout")
+			}
+
+			return ctx.Next()
+		})
+
+		assert.NoError(t, r.HandleUpdate(context.Background(), &lumex.Update{Message: &lumex.Message{
+			Text:     "/start",
+			Entities: []lumex.MessageEntity{{Type: "bot_command", Length: 6}},
+		}}))
+		assert.Equal(t, "start ", handled)
+		assert.NoError(t, r.HandleUpdate(context.Background(), text("buy")))
+		assert.Equal(t, "checkout", handled)
+	})
+	t.Run("typed helpers keep filter specs", func(t *testing.T) {
+		r := NewTyped[testApp](nil, nil)
+		var handled []string
+		start := r.OnStart(func(ctx *TypedContext[testApp]) error {
+			assert.NotNil(t, ctx.Std())
+			handled = append(handled, "start")
+
+			return nil
+		})
+		r.OnCallbackPrefix("buy:", func(ctx *TypedContext[testApp]) error {
+			handled = append(handled, "buy")
+
+			return nil
+		})
+
+		assert.Equal(t, []string{lumex.UpdateTypeMessage}, start.GetUpdateTypes())
+		assert.Equal(t, []string{lumex.UpdateTypeMessage, lumex.UpdateTypeCallbackQuery}, r.AllowedUpdates())
+
+		assert.NoError(t, r.HandleUpdate(context.Background(), &lumex.Update{Message: &lumex.Message{
+			Text:     "/start",
+			Entities: []lumex.MessageEntity{{Type: "bot_command", Length: 6}},
+		}}))
+		assert.NoError(t, r.HandleUpdate(context.Background(), &lumex.Update{CallbackQuery: &lumex.CallbackQuery{Data: "buy:1"}}))
+		assert.Equal(t, []string{"start", "buy"}, handled)
+	})
+}
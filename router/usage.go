@@ -0,0 +1,466 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kbgod/lumex"
+)
+
+// ArgKind is a kind of command argument value declared in the usage.
+type ArgKind string
+
+const (
+	ArgString   ArgKind = "string"
+	ArgInt      ArgKind = "int"
+	ArgFloat    ArgKind = "float"
+	ArgBool     ArgKind = "bool"
+	ArgDuration ArgKind = "duration"
+	// ArgMention is a @username mention or a text mention of a user without username.
+	ArgMention ArgKind = "mention"
+	// ArgID is a numeric user or chat identifier.
+	ArgID ArgKind = "id"
+)
+
+var usageParamRegexp = regexp.MustCompile(`^([<\[])(\w+)(?::(\w+(?:\|\w+)*))?(\.\.\.)?([>\]])$`)
+
+// UsernameResolver resolves @username mentions to user identifiers, e.g. using a database of known users.
+type UsernameResolver func(ctx *Context, username string) (int64, error)
+
+// Mention is a user referenced in command arguments.
+type Mention struct {
+	// UserID is the user identifier. It is zero for @username mentions, unless UsernameResolver is set.
+	UserID int64
+	// Username is the username of @username mentions without "@".
+	Username string
+	// User is the mentioned user of text mentions.
+	User *lumex.User
+}
+
+var (
+	mentionType  = reflect.TypeOf(Mention{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+type usageParam struct {
+	name     string
+	kinds    []ArgKind
+	optional bool
+	variadic bool
+}
+
+// Usage
+//
+// describes expected command arguments, like "/ban <user:mention|id> [duration:duration] [reason...]".
+// <name> is a required argument, [name] is an optional one, name... takes the rest of arguments.
+// The kinds of value are listed after colon and tried in order, the default kind is string.
+type Usage struct {
+	spec   string
+	params []usageParam
+}
+
+// ParseUsage
+//
+// parses usage specification. See Usage for the syntax.
+func ParseUsage(spec string) (*Usage, error) {
+	usage := &Usage{spec: strings.TrimSpace(spec)}
+
+	// the command itself is a part of the usage line only for the user
+	fields := strings.Fields(usage.spec)
+	if len(fields) > 0 && strings.HasPrefix(fields[0], "/") {
+		fields = fields[1:]
+	}
+
+	seen := make(map[string]struct{}, len(fields))
+	for _, field := range fields {
+		m := usageParamRegexp.FindStringSubmatch(field)
+		if m == nil || (m[1] == "<") != (m[5] == ">") {
+			return nil, fmt.Errorf("invalid usage parameter %q", field)
+		}
+
+		param := usageParam{
+			name:     m[2],
+			optional: m[1] == "[",
+			variadic: m[4] != "",
+			kinds:    []ArgKind{ArgString},
+		}
+		if m[3] != "" {
+			param.kinds = param.kinds[:0]
+			for _, kind := range strings.Split(m[3], "|") {
+				switch k := ArgKind(kind); k {
+				case ArgString, ArgInt, ArgFloat, ArgBool, ArgDuration, ArgMention, ArgID:
+					param.kinds = append(param.kinds, k)
+				default:
+					return nil, fmt.Errorf("unknown kind %q of usage parameter %q", kind, param.name)
+				}
+			}
+		}
+
+		if _, ok := seen[param.name]; ok {
+			return nil, fmt.Errorf("duplicated usage parameter %q", param.name)
+		}
+		seen[param.name] = struct{}{}
+
+		if n := len(usage.params); n > 0 {
+			if usage.params[n-1].variadic {
+				return nil, fmt.Errorf("usage parameter %q follows variadic parameter", param.name)
+			}
+			if usage.params[n-1].optional && !param.optional {
+				return nil, fmt.Errorf("required usage parameter %q follows optional parameter", param.name)
+			}
+		}
+
+		usage.params = append(usage.params, param)
+	}
+
+	return usage, nil
+}
+
+// MustParseUsage
+//
+// is like ParseUsage but panics if the specification is invalid.
+func MustParseUsage(spec string) *Usage {
+	usage, err := ParseUsage(spec)
+	if err != nil {
+		panic(err)
+	}
+
+	return usage
+}
+
+// String returns the usage specification.
+func (u *Usage) String() string {
+	return u.spec
+}
+
+// Bind
+//
+// parses arguments of the command in the update and stores them in the struct pointed to by dst.
+// Fields are matched with arguments by the `arg` tag or by the lowercase field name.
+// Supported field types are string, integers, floats, bool, time.Duration, Mention
+// and slices of them for variadic arguments. A string field of a variadic argument gets
+// the rest of the message text as is, even with unterminated quotes.
+// An optional argument is left zero if the value doesn't fit it and there are arguments after it,
+// so the value is tried with the next argument.
+// Argument errors are returned as *UsageError.
+func (u *Usage) Bind(ctx *Context, dst any) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("bind destination must be a pointer to struct, got %T", dst)
+	}
+
+	fields, err := u.fields(v.Elem().Type())
+	if err != nil {
+		return err
+	}
+
+	return u.bind(ctx, v.Elem(), fields)
+}
+
+// fields returns indexes of struct fields for every usage parameter.
+func (u *Usage) fields(t reflect.Type) ([]int, error) {
+	byName := make(map[string]int, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := field.Tag.Get("arg")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		byName[name] = i
+	}
+
+	fields := make([]int, len(u.params))
+	for i, param := range u.params {
+		index, ok := byName[param.name]
+		if !ok {
+			return nil, fmt.Errorf("no field for argument %q in %s", param.name, t)
+		}
+
+		fieldType := t.Field(index).Type
+		if param.variadic && fieldType.Kind() == reflect.Slice {
+			fieldType = fieldType.Elem()
+		} else if param.variadic && fieldType.Kind() != reflect.String {
+			return nil, fmt.Errorf("field %s of variadic argument %q must be a slice or string", t.Field(index).Name, param.name)
+		}
+
+		for _, kind := range param.kinds {
+			if !assignable(kind, fieldType) {
+				return nil, fmt.Errorf("field %s of type %s can't hold %s argument %q", t.Field(index).Name, fieldType, kind, param.name)
+			}
+		}
+
+		fields[i] = index
+	}
+
+	return fields, nil
+}
+
+func (u *Usage) bind(ctx *Context, dst reflect.Value, fields []int) error {
+	m := ctx.commandMessage()
+	if m == nil {
+		return &UsageError{Usage: u, Err: ErrNotCommand}
+	}
+
+	tokens, text, err := commandArgTokens(m)
+	// the unterminated quote is an error only if the argument with it is not in the rest of the text taken as is
+	unterminated := errors.Is(err, ErrUnterminatedQuote)
+	if err != nil && !unterminated {
+		return &UsageError{Usage: u, Err: err}
+	}
+
+	for i, param := range u.params {
+		field := dst.Field(fields[i])
+
+		if len(tokens) == 0 {
+			if !param.optional {
+				return &UsageError{Usage: u, Arg: param.name, Err: ErrMissingArgument}
+			}
+
+			continue
+		}
+
+		if param.variadic && field.Kind() == reflect.String {
+			field.SetString(strings.TrimSpace(text[tokens[0].start:]))
+			tokens = nil
+
+			continue
+		}
+
+		if !param.variadic {
+			err := error(&UsageError{Usage: u, Err: ErrUnterminatedQuote})
+			if !unterminated || len(tokens) > 1 {
+				err = u.set(ctx, param, field, tokens[0])
+			}
+
+			// the optional argument is omitted if the value doesn't fit it, so it's tried with the next one,
+			// like the reason in "/ban <user> [duration:duration] [reason...]"
+			if err != nil && param.optional && i < len(u.params)-1 &&
+				(errors.Is(err, ErrInvalidArgument) || errors.Is(err, ErrUnterminatedQuote)) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			tokens = tokens[1:]
+
+			continue
+		}
+
+		if unterminated {
+			return &UsageError{Usage: u, Err: ErrUnterminatedQuote}
+		}
+
+		field.Set(reflect.MakeSlice(field.Type(), len(tokens), len(tokens)))
+		for j, token := range tokens {
+			if err := u.set(ctx, param, field.Index(j), token); err != nil {
+				return err
+			}
+		}
+		tokens = nil
+	}
+
+	if len(tokens) > 0 {
+		return &UsageError{Usage: u, Err: ErrTooManyArguments}
+	}
+
+	return nil
+}
+
+// set parses the token with the first matching kind of the parameter and stores the value in the field.
+func (u *Usage) set(ctx *Context, param usageParam, field reflect.Value, token argToken) error {
+	for _, kind := range param.kinds {
+		value, ok, err := parseArg(ctx, kind, token)
+		if err != nil {
+			return &UsageError{Usage: u, Arg: param.name, Err: err}
+		}
+		if !ok {
+			continue
+		}
+
+		if err := setArg(field, value); err != nil {
+			return &UsageError{Usage: u, Arg: param.name, Err: err}
+		}
+
+		return nil
+	}
+
+	kinds := make([]string, 0, len(param.kinds))
+	for _, kind := range param.kinds {
+		kinds = append(kinds, string(kind))
+	}
+
+	return &UsageError{
+		Usage: u,
+		Arg:   param.name,
+		Err:   fmt.Errorf("%w: expected %s, got %q", ErrInvalidArgument, strings.Join(kinds, " or "), token.value),
+	}
+}
+
+// parseArg parses the token as the given kind. It reports false if the token is not of that kind.
+func parseArg(ctx *Context, kind ArgKind, token argToken) (any, bool, error) {
+	switch kind {
+	case ArgString:
+		return token.value, true, nil
+	case ArgInt:
+		v, err := strconv.ParseInt(token.value, 10, 64)
+		return v, err == nil, nil
+	case ArgFloat:
+		v, err := strconv.ParseFloat(token.value, 64)
+		return v, err == nil, nil
+	case ArgBool:
+		v, err := strconv.ParseBool(token.value)
+		return v, err == nil, nil
+	case ArgDuration:
+		v, err := time.ParseDuration(token.value)
+		return v, err == nil, nil
+	case ArgID:
+		v, err := strconv.ParseInt(token.value, 10, 64)
+		if err != nil || v == 0 {
+			return nil, false, nil
+		}
+		return Mention{UserID: v}, true, nil
+	case ArgMention:
+		if token.entity == nil {
+			return nil, false, nil
+		}
+
+		switch token.entity.Type {
+		case "text_mention":
+			if token.entity.User == nil {
+				return nil, false, nil
+			}
+			return Mention{UserID: token.entity.User.Id, User: token.entity.User}, true, nil
+		case "mention":
+			mention := Mention{Username: strings.TrimPrefix(token.entity.Text, "@")}
+			if ctx.router != nil && ctx.router.usernameResolver != nil {
+				id, err := ctx.router.usernameResolver(ctx, mention.Username)
+				if err != nil {
+					return nil, false, fmt.Errorf("failed to resolve @%s: %w", mention.Username, err)
+				}
+				mention.UserID = id
+			}
+			return mention, true, nil
+		}
+	}
+
+	return nil, false, nil
+}
+
+func assignable(kind ArgKind, t reflect.Type) bool {
+	switch kind {
+	case ArgString:
+		return t.Kind() == reflect.String
+	case ArgInt:
+		return (isInt(t) && t != durationType) || isFloat(t)
+	case ArgFloat:
+		return isFloat(t)
+	case ArgBool:
+		return t.Kind() == reflect.Bool
+	case ArgDuration:
+		return t == durationType
+	case ArgMention, ArgID:
+		return t == mentionType || (isInt(t) && t != durationType)
+	}
+
+	return false
+}
+
+func setArg(field reflect.Value, value any) error {
+	switch v := value.(type) {
+	case string:
+		field.SetString(v)
+	case int64:
+		if isFloat(field.Type()) {
+			field.SetFloat(float64(v))
+		} else if field.OverflowInt(v) {
+			return fmt.Errorf("%w: %d is out of range", ErrInvalidArgument, v)
+		} else {
+			field.SetInt(v)
+		}
+	case float64:
+		field.SetFloat(v)
+	case bool:
+		field.SetBool(v)
+	case time.Duration:
+		field.SetInt(int64(v))
+	case Mention:
+		if field.Type() == mentionType {
+			field.Set(reflect.ValueOf(v))
+		} else if v.UserID == 0 {
+			return fmt.Errorf("%w: can't resolve @%s to user id", ErrInvalidArgument, v.Username)
+		} else {
+			field.SetInt(v.UserID)
+		}
+	default:
+		return errors.New("unsupported argument value")
+	}
+
+	return nil
+}
+
+func isInt(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+
+	return false
+}
+
+func isFloat(t reflect.Type) bool {
+	return t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64
+}
+
+// BindArgs
+//
+// returns a handler which binds command arguments described by usage into T and calls handler with them.
+// The usage and T are validated at registration, so the function panics if they don't match.
+// If arguments are invalid, the handler is not called and *UsageError is returned.
+//
+// Example:
+//
+//	type BanArgs struct {
+//		User     router.Mention `arg:"user"`
+//		Duration time.Duration  `arg:"duration"`
+//		Reason   string         `arg:"reason"`
+//	}
+//
+//	r.OnCommand("ban", router.BindArgs("/ban <user:mention|id> [duration:duration] [reason...]",
+//		func(ctx *router.Context, args *BanArgs) error {
+//			return ctx.ReplyVoid("banned " + strconv.FormatInt(args.User.UserID, 10))
+//		},
+//	))
+func BindArgs[T any](usage string, handler func(ctx *Context, args *T) error) Handler {
+	u := MustParseUsage(usage)
+
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("BindArgs: %s is not a struct", t))
+	}
+
+	fields, err := u.fields(t)
+	if err != nil {
+		panic("BindArgs: " + err.Error())
+	}
+
+	return func(ctx *Context) error {
+		args := new(T)
+		if err := u.bind(ctx, reflect.ValueOf(args).Elem(), fields); err != nil {
+			return err
+		}
+
+		return handler(ctx, args)
+	}
+}
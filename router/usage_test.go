@@ -0,0 +1,206 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kbgod/lumex"
+	"github.com/stretchr/testify/assert"
+)
+
+type banArgs struct {
+	User     Mention       `arg:"user"`
+	Duration time.Duration `arg:"duration"`
+	Reason   string        `arg:"reason"`
+}
+
+func commandUpdate(text string, entities ...lumex.MessageEntity) *lumex.Update {
+	command := text
+	for i, c := range text {
+		if c == ' ' {
+			command = text[:i]
+			break
+		}
+	}
+
+	return &lumex.Update{
+		Message: &lumex.Message{
+			Text: text,
+			Entities: append(
+				[]lumex.MessageEntity{{Type: "bot_command", Length: int64(len(command))}},
+				entities...,
+			),
+		},
+	}
+}
+
+func TestParseUsage(t *testing.T) {
+	valid := []string{
+		"/ban <user:mention|id> [duration:duration] [reason...]",
+		"<a> <b:int> [c:float|string]",
+		"[rest...]",
+		"",
+	}
+	for _, spec := range valid {
+		_, err := ParseUsage(spec)
+		assert.NoError(t, err, "ParseUsage(%q)", spec)
+	}
+
+	invalid := []string{
+		"<a]",
+		"<a:unknown>",
+		"[a] <b>",
+		"<a...> <b>",
+		"<a> <a>",
+		"a",
+	}
+	for _, spec := range invalid {
+		_, err := ParseUsage(spec)
+		assert.Error(t, err, "ParseUsage(%q)", spec)
+	}
+
+	assert.Panics(t, func() {
+		MustParseUsage("<a]")
+	})
+}
+
+func TestBindArgs(t *testing.T) {
+	const usage = "/ban <user:mention|id> [duration:duration] [reason...]"
+
+	t.Run("registration validates struct", func(t *testing.T) {
+		assert.Panics(t, func() {
+			BindArgs(usage, func(ctx *Context, args *struct{ User Mention }) error { return nil })
+		}, "missing fields")
+		assert.Panics(t, func() {
+			BindArgs("<user:mention>", func(ctx *Context, args *struct{ User string }) error { return nil })
+		}, "incompatible field type")
+		assert.Panics(t, func() {
+			BindArgs("<n:int>", func(ctx *Context, args *struct{ N time.Duration }) error { return nil })
+		}, "int into duration")
+	})
+
+	bind := func(r *Router, update *lumex.Update) (*banArgs, error) {
+		var got *banArgs
+		handler := BindArgs(usage, func(ctx *Context, args *banArgs) error {
+			got = args
+			return nil
+		})
+
+		err := handler(r.acquireContext(context.Background(), update))
+
+		return got, err
+	}
+
+	t.Run("id with rest of text", func(t *testing.T) {
+		args, err := bind(New(nil), commandUpdate("/ban 123 1h30m  spam\nand flood"))
+		assert.NoError(t, err)
+		assert.Equal(t, &banArgs{
+			User:     Mention{UserID: 123},
+			Duration: 90 * time.Minute,
+			Reason:   "spam\nand flood",
+		}, args)
+	})
+
+	t.Run("text mention with spaces", func(t *testing.T) {
+		user := &lumex.User{Id: 42, FirstName: "Іван Петренко"}
+		args, err := bind(New(nil), commandUpdate(
+			"/ban Іван Петренко",
+			lumex.MessageEntity{Type: "text_mention", Offset: 5, Length: 13, User: user},
+		))
+		assert.NoError(t, err)
+		assert.Equal(t, &banArgs{User: Mention{UserID: 42, User: user}}, args)
+	})
+
+	t.Run("username mention", func(t *testing.T) {
+		update := commandUpdate("/ban @someone", lumex.MessageEntity{Type: "mention", Offset: 5, Length: 8})
+
+		args, err := bind(New(nil), update)
+		assert.NoError(t, err)
+		assert.Equal(t, Mention{Username: "someone"}, args.User)
+
+		r := New(nil, WithUsernameResolver(func(ctx *Context, username string) (int64, error) {
+			if username == "someone" {
+				return 7, nil
+			}
+			return 0, errors.New("unknown user")
+		}))
+		args, err = bind(r, update)
+		assert.NoError(t, err)
+		assert.Equal(t, Mention{UserID: 7, Username: "someone"}, args.User)
+
+		_, err = bind(r, commandUpdate("/ban @other", lumex.MessageEntity{Type: "mention", Offset: 5, Length: 6}))
+		assert.Error(t, err)
+	})
+
+	t.Run("omitted optional argument", func(t *testing.T) {
+		args, err := bind(New(nil), commandUpdate("/ban 123 spam"))
+		assert.NoError(t, err)
+		assert.Equal(t, &banArgs{User: Mention{UserID: 123}, Reason: "spam"}, args)
+
+		var got banArgs
+		u := MustParseUsage("<user:mention|id> [duration:duration]")
+		err = u.Bind(New(nil).acquireContext(context.Background(), commandUpdate("/ban 1 forever")), &got)
+		assert.ErrorIs(t, err, ErrInvalidArgument, "the last optional argument is not omitted")
+	})
+
+	t.Run("unterminated quote in rest of text", func(t *testing.T) {
+		args, err := bind(New(nil), commandUpdate("/ban 123 don't do that"))
+		assert.NoError(t, err)
+		assert.Equal(t, &banArgs{User: Mention{UserID: 123}, Reason: "don't do that"}, args)
+
+		args, err = bind(New(nil), commandUpdate(`/ban 1 1h "spam`))
+		assert.NoError(t, err)
+		assert.Equal(t, &banArgs{User: Mention{UserID: 1}, Duration: time.Hour, Reason: `"spam`}, args)
+	})
+
+	t.Run("usage errors", func(t *testing.T) {
+		cases := []struct {
+			name   string
+			update *lumex.Update
+			arg    string
+			err    error
+		}{
+			{"missing required", commandUpdate("/ban"), "user", ErrMissingArgument},
+			{"invalid user", commandUpdate("/ban someone"), "user", ErrInvalidArgument},
+			{"unterminated quote", commandUpdate(`/ban "someone`), "", ErrUnterminatedQuote},
+			{"not a command", &lumex.Update{Message: &lumex.Message{Text: "ban 1"}}, "", ErrNotCommand},
+		}
+
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				args, err := bind(New(nil), tc.update)
+				assert.Nil(t, args, "handler must not be called")
+
+				var usageErr *UsageError
+				if assert.ErrorAs(t, err, &usageErr) {
+					assert.Equal(t, tc.arg, usageErr.Arg)
+					assert.ErrorIs(t, err, tc.err)
+					assert.Contains(t, err.Error(), "usage: "+usage)
+				}
+			})
+		}
+	})
+
+	t.Run("too many arguments and slices", func(t *testing.T) {
+		type sumArgs struct {
+			Numbers []int    `arg:"numbers"`
+			Scale   float64  `arg:"scale"`
+			Labels  []string `arg:"-"`
+			Verbose bool
+		}
+
+		var got sumArgs
+		u := MustParseUsage("<scale:float> <verbose:bool> [numbers:int...]")
+		err := u.Bind(New(nil).acquireContext(context.Background(), commandUpdate("/sum 1.5 true 1 2 3")), &got)
+		assert.NoError(t, err)
+		assert.Equal(t, sumArgs{Numbers: []int{1, 2, 3}, Scale: 1.5, Verbose: true}, got)
+
+		u = MustParseUsage("<scale:float>")
+		err = u.Bind(New(nil).acquireContext(context.Background(), commandUpdate("/sum 1 2")), &got)
+		assert.ErrorIs(t, err, ErrTooManyArguments)
+
+		assert.Error(t, u.Bind(nil, got), "non-pointer destination")
+	})
+}
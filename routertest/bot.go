@@ -0,0 +1,367 @@
+package routertest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode"
+
+	"github.com/kbgod/lumex"
+	"github.com/kbgod/lumex/router"
+)
+
+// Call
+//
+// is a request of the bot to the Bot API recorded as typed values: common parameters are fields,
+// optional parameters are read as options of the method with Opts and other parameters with Param.
+type Call struct {
+	Method string
+	// ChatID is the chat_id parameter, it is zero if the method doesn't have it or the chat is a @username.
+	ChatID int64
+	// Text is the text of the message or the caption of the media, or the text of the callback query answer.
+	Text        string
+	ParseMode   string
+	MessageID   int64
+	ReplyMarkup lumex.ReplyMarkup
+
+	// params are parameters of the request as they are passed to lumex.BotClient.
+	params  map[string]any
+	checked bool
+	// sentID is the identifier of the message sent or edited by the call.
+	sentID int64
+}
+
+// newCall returns the call with common parameters taken from params.
+func newCall(method string, params map[string]any) *Call {
+	call := &Call{Method: method, params: params}
+	call.ChatID, _ = params["chat_id"].(int64)
+	call.MessageID, _ = params["message_id"].(int64)
+	call.ParseMode, _ = params["parse_mode"].(string)
+	call.ReplyMarkup, _ = params["reply_markup"].(lumex.ReplyMarkup)
+	for _, key := range []string{"text", "caption"} {
+		if text, ok := params[key].(string); ok {
+			call.Text = text
+
+			break
+		}
+	}
+
+	return call
+}
+
+// Param
+//
+// returns the parameter of the call with the key as T, like the results of answerInlineQuery
+// or the photo of sendPhoto. It reports false if the call doesn't have the parameter of that type.
+// Example: results, ok := routertest.Param[[]lumex.InlineQueryResult](call, "results")
+func Param[T any](call *Call, key string) (T, bool) {
+	value, ok := call.params[key].(T)
+
+	return value, ok
+}
+
+// Opts
+//
+// returns optional parameters of the call as options T of the method, like lumex.SendMessageOpts for sendMessage.
+// Fields are filled from parameters with the same names, like ReplyParameters from reply_parameters.
+// Example: routertest.Opts[lumex.AnswerCallbackQueryOpts](bot.ExpectAnswer().Call()).ShowAlert
+func Opts[T any](call *Call) *T {
+	opts := new(T)
+	v := reflect.ValueOf(opts).Elem()
+	if call == nil || v.Kind() != reflect.Struct {
+		return opts
+	}
+
+	for i := 0; i < v.NumField(); i++ {
+		value, ok := call.params[paramName(v.Type().Field(i).Name)]
+		if !ok || value == nil {
+			continue
+		}
+
+		if param := reflect.ValueOf(value); param.Type().AssignableTo(v.Field(i).Type()) {
+			v.Field(i).Set(param)
+		}
+	}
+
+	return opts
+}
+
+// paramName returns the name of the parameter of the options field, like "message_thread_id" for MessageThreadId.
+func paramName(field string) string {
+	var name strings.Builder
+	for i, r := range field {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				name.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		name.WriteRune(r)
+	}
+
+	return name.String()
+}
+
+// IsSend reports whether the call sends a message, like sendMessage, sendPhoto or copyMessage.
+func (c *Call) IsSend() bool {
+	return strings.HasPrefix(c.Method, "send") || c.Method == "copyMessage" || c.Method == "forwardMessage"
+}
+
+// IsEdit reports whether the call edits a message, like editMessageText or editMessageReplyMarkup.
+func (c *Call) IsEdit() bool {
+	return strings.HasPrefix(c.Method, "editMessage")
+}
+
+// InlineKeyboard returns rows of the inline keyboard of the message, nil if it doesn't have it.
+func (c *Call) InlineKeyboard() [][]lumex.InlineKeyboardButton {
+	switch markup := c.ReplyMarkup.(type) {
+	case lumex.InlineKeyboardMarkup:
+		return markup.InlineKeyboard
+	case *lumex.InlineKeyboardMarkup:
+		return markup.InlineKeyboard
+	}
+
+	return nil
+}
+
+// Keyboard returns rows of the reply keyboard of the message, nil if it doesn't have it.
+func (c *Call) Keyboard() [][]lumex.KeyboardButton {
+	switch markup := c.ReplyMarkup.(type) {
+	case lumex.ReplyKeyboardMarkup:
+		return markup.Keyboard
+	case *lumex.ReplyKeyboardMarkup:
+		return markup.Keyboard
+	}
+
+	return nil
+}
+
+// inlineButton returns the inline button of the message with the text.
+func (c *Call) inlineButton(text string) (lumex.InlineKeyboardButton, bool) {
+	for _, row := range c.InlineKeyboard() {
+		for _, button := range row {
+			if button.Text == text {
+				return button, true
+			}
+		}
+	}
+
+	return lumex.InlineKeyboardButton{}, false
+}
+
+// button returns the reply keyboard button of the message with the text.
+func (c *Call) button(text string) (lumex.KeyboardButton, bool) {
+	for _, row := range c.Keyboard() {
+		for _, button := range row {
+			if button.Text == text {
+				return button, true
+			}
+		}
+	}
+
+	return lumex.KeyboardButton{}, false
+}
+
+// String returns the method and the text of the call for failure messages.
+func (c *Call) String() string {
+	if c.Text == "" {
+		return fmt.Sprintf("%s(chat %d)", c.Method, c.ChatID)
+	}
+
+	return fmt.Sprintf("%s(chat %d, %q)", c.Method, c.ChatID, c.Text)
+}
+
+// Responder returns the result of the call or an error, the result is encoded to JSON.
+type Responder func(call *Call) (any, error)
+
+// Bot
+//
+// is the bot which doesn't send requests to the Bot API, it records them as calls and responds like Telegram
+// with messages for send and edit methods, the bot user for getMe and true for other methods.
+// Responses of methods are replaced with Respond. It is safe for concurrent use.
+type Bot struct {
+	*lumex.Bot
+
+	t          testing.TB
+	mu         sync.Mutex
+	calls      []*Call
+	responders map[string]Responder
+	messageID  int64
+}
+
+// NewBot returns the fake bot with the username "test_bot" which fails t on unexpected errors.
+func NewBot(t testing.TB) *Bot {
+	fake := &Bot{t: t, responders: make(map[string]Responder)}
+
+	bot, err := lumex.NewBot("123456:test", &lumex.BotOpts{
+		BotClient:         &client{bot: fake},
+		DisableTokenCheck: true,
+	})
+	if err != nil {
+		t.Fatalf("routertest: failed to create bot: %v", err)
+	}
+	bot.User = lumex.User{Id: 123456, IsBot: true, FirstName: "Test", Username: "test_bot"}
+	fake.Bot = bot
+
+	return fake
+}
+
+// Respond
+//
+// replaces the response of the method, so tests can check how handlers process results and errors of the Bot API.
+// Example: bot.Respond("sendMessage", func(*routertest.Call) (any, error) { return nil, &lumex.TelegramError{...} })
+func (b *Bot) Respond(method string, responder Responder) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.responders[method] = responder
+}
+
+// Calls returns all calls of the bot in order.
+func (b *Bot) Calls() []*Call {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]*Call(nil), b.calls...)
+}
+
+// Reset forgets recorded calls.
+func (b *Bot) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.calls = nil
+}
+
+// HandleUpdate
+//
+// handles the update with the router as if it was sent to the bot, so routers created without a bot can be tested.
+func (b *Bot) HandleUpdate(r *router.Router, update *lumex.Update) error {
+	ctx := context.WithValue(context.Background(), router.BotContextKey{}, b.Bot)
+
+	return r.HandleUpdate(ctx, update)
+}
+
+// request records the call and returns its response.
+func (b *Bot) request(method string, params map[string]any) (json.RawMessage, error) {
+	call := newCall(method, params)
+
+	b.mu.Lock()
+	b.calls = append(b.calls, call)
+	responder := b.responders[method]
+	b.mu.Unlock()
+
+	if responder == nil {
+		responder = b.respond
+	}
+
+	result, err := responder(call)
+	if err != nil {
+		return nil, err
+	}
+
+	// custom responders return sent messages too, so buttons under them can be pressed
+	if m := sentMessage(result); m != nil {
+		b.mu.Lock()
+		call.sentID = m.MessageId
+		b.mu.Unlock()
+	}
+
+	return json.Marshal(result)
+}
+
+// sentMessage returns the message in the result of the call, nil if there is no message.
+func sentMessage(result any) *lumex.Message {
+	switch m := result.(type) {
+	case *lumex.Message:
+		return m
+	case lumex.Message:
+		return &m
+	case []*lumex.Message:
+		if len(m) > 0 {
+			return m[0]
+		}
+	case []lumex.Message:
+		if len(m) > 0 {
+			return &m[0]
+		}
+	}
+
+	return nil
+}
+
+// respond returns the default response of the call.
+func (b *Bot) respond(call *Call) (any, error) {
+	switch {
+	case call.Method == "getMe":
+		return b.User, nil
+	case call.Method == "sendMediaGroup":
+		return []*lumex.Message{b.message(call)}, nil
+	case call.Method == "copyMessage":
+		return lumex.MessageId{MessageId: b.message(call).MessageId}, nil
+	case call.IsSend():
+		return b.message(call), nil
+	case call.IsEdit() && call.ChatID != 0:
+		return b.message(call), nil
+	}
+
+	return true, nil
+}
+
+// message returns the message sent or edited by the call.
+func (b *Bot) message(call *Call) *lumex.Message {
+	b.mu.Lock()
+	id := call.MessageID
+	if id == 0 {
+		b.messageID++
+		id = b.messageID
+	}
+	call.sentID = id
+	b.mu.Unlock()
+
+	return &lumex.Message{
+		MessageId:   id,
+		From:        &b.User,
+		Chat:        lumex.Chat{Id: call.ChatID},
+		Date:        time.Now().Unix(),
+		Text:        call.Text,
+		ReplyMarkup: inlineMarkup(call),
+	}
+}
+
+// inlineMarkup returns the inline keyboard of the message sent by the call.
+func inlineMarkup(call *Call) *lumex.InlineKeyboardMarkup {
+	if keyboard := call.InlineKeyboard(); keyboard != nil {
+		return &lumex.InlineKeyboardMarkup{InlineKeyboard: keyboard}
+	}
+
+	return nil
+}
+
+// client is the lumex.BotClient of the fake bot.
+type client struct {
+	bot *Bot
+}
+
+func (c *client) RequestWithContext(
+	ctx context.Context, _ string, method string, params map[string]any, _ *lumex.RequestOpts,
+) (json.RawMessage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return c.bot.request(method, params)
+}
+
+func (c *client) GetAPIURL(_ *lumex.RequestOpts) string {
+	return lumex.DefaultAPIURL
+}
+
+func (c *client) FileURL(token string, filePath string, _ *lumex.RequestOpts) string {
+	return lumex.DefaultAPIURL + "/file/bot" + token + "/" + filePath
+}
@@ -0,0 +1,121 @@
+package routertest
+
+import (
+	"time"
+
+	"github.com/kbgod/lumex"
+	"github.com/kbgod/lumex/router"
+)
+
+// Conversation
+//
+// sends updates of the user in the chat to the router one by one like Telegram does,
+// so flows of several steps like FSM forms are tested end to end.
+// Errors of handlers fail the test.
+// Example:
+//
+//	c := bot.Conversation(r, user, routertest.PrivateChat(user))
+//	c.Send("/start").ExpectReply().TextContains("What is your name?")
+//	c.Send("Alice").ExpectReply().TextContains("Hi, Alice").WithInlineButton("Confirm")
+//	c.Press("Confirm").ExpectAnswer()
+type Conversation struct {
+	bot    *Bot
+	router *router.Router
+	user   *lumex.User
+	chat   lumex.Chat
+}
+
+// Conversation starts the conversation of the user with the bot in the chat.
+func (b *Bot) Conversation(r *router.Router, user *lumex.User, chat lumex.Chat) *Conversation {
+	return &Conversation{bot: b, router: r, user: user, chat: chat}
+}
+
+// Send sends the text message of the user, commands get the bot_command entity.
+func (c *Conversation) Send(text string) *Conversation {
+	c.bot.t.Helper()
+
+	return c.Handle(TextMessage(c.user, c.chat, text))
+}
+
+// Press
+//
+// presses the button with the text under the latest message of the bot in the chat which has it:
+// the callback query is sent for inline buttons and the text message for reply keyboard buttons.
+// The test fails if no message of the bot has the button or the inline button has no callback data,
+// like URL and web app buttons, because Telegram doesn't send callback queries for them.
+func (c *Conversation) Press(text string) *Conversation {
+	c.bot.t.Helper()
+
+	calls := c.bot.Calls()
+	for i := len(calls) - 1; i >= 0; i-- {
+		call := calls[i]
+		if call.ChatID != c.chat.Id || !call.IsSend() && !call.IsEdit() {
+			continue
+		}
+
+		if button, ok := call.inlineButton(text); ok {
+			if button.CallbackData == "" {
+				c.bot.t.Errorf("routertest: button %q in chat %d has no callback data", text, c.chat.Id)
+
+				return c
+			}
+
+			return c.Handle(callback(c.user, c.message(call), button.CallbackData))
+		}
+		if _, ok := call.button(text); ok {
+			return c.Send(text)
+		}
+	}
+
+	c.bot.t.Errorf("routertest: no button %q in chat %d", text, c.chat.Id)
+
+	return c
+}
+
+// Handle sends the update to the router.
+func (c *Conversation) Handle(update *lumex.Update) *Conversation {
+	c.bot.t.Helper()
+
+	if err := c.bot.HandleUpdate(c.router, update); err != nil {
+		c.bot.t.Errorf("routertest: failed to handle %s update: %v", update.GetType(), err)
+	}
+
+	return c
+}
+
+// ExpectReply checks the next message of the bot in the chat, see Bot.ExpectReply.
+func (c *Conversation) ExpectReply() *Expectation {
+	c.bot.t.Helper()
+
+	return c.bot.ExpectReply(c.chat.Id)
+}
+
+// ExpectEdit checks the next edit of a message in the chat, see Bot.ExpectEdit.
+func (c *Conversation) ExpectEdit() *Expectation {
+	c.bot.t.Helper()
+
+	return c.bot.ExpectEdit(c.chat.Id)
+}
+
+// ExpectAnswer checks the next answer to a callback query, see Bot.ExpectAnswer.
+func (c *Conversation) ExpectAnswer() *Expectation {
+	c.bot.t.Helper()
+
+	return c.bot.ExpectAnswer()
+}
+
+// message returns the message of the bot in the chat sent or edited by the call.
+func (c *Conversation) message(call *Call) lumex.Message {
+	c.bot.mu.Lock()
+	id := call.sentID
+	c.bot.mu.Unlock()
+
+	return lumex.Message{
+		MessageId:   id,
+		From:        &c.bot.User,
+		Chat:        c.chat,
+		Date:        time.Now().Unix(),
+		Text:        call.Text,
+		ReplyMarkup: inlineMarkup(call),
+	}
+}
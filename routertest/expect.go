@@ -0,0 +1,169 @@
+package routertest
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Expectation
+//
+// checks the call found by Bot.ExpectReply and similar methods, failed checks fail the test without stopping it.
+// Checks of the missing call are skipped, the missing call itself is already reported.
+type Expectation struct {
+	bot  *Bot
+	call *Call
+}
+
+// Call returns the checked call, nil if it wasn't found.
+func (e *Expectation) Call() *Call {
+	return e.call
+}
+
+// ExpectReply
+//
+// finds the first message sent to the chat which isn't checked yet and marks it as checked,
+// so consecutive ExpectReply calls check consecutive messages.
+// Example: bot.ExpectReply(chatID).TextContains("hello").WithInlineButton("Next")
+func (b *Bot) ExpectReply(chatID int64) *Expectation {
+	b.t.Helper()
+
+	return b.expect("message to chat "+formatID(chatID), func(call *Call) bool {
+		return call.IsSend() && call.ChatID == chatID
+	})
+}
+
+// ExpectEdit finds the first edit of a message in the chat which isn't checked yet and marks it as checked.
+func (b *Bot) ExpectEdit(chatID int64) *Expectation {
+	b.t.Helper()
+
+	return b.expect("edit in chat "+formatID(chatID), func(call *Call) bool {
+		return call.IsEdit() && call.ChatID == chatID
+	})
+}
+
+// ExpectAnswer finds the first answer to a callback query which isn't checked yet and marks it as checked.
+func (b *Bot) ExpectAnswer() *Expectation {
+	b.t.Helper()
+
+	return b.ExpectCall("answerCallbackQuery")
+}
+
+// ExpectCall finds the first call of the method which isn't checked yet and marks it as checked.
+func (b *Bot) ExpectCall(method string) *Expectation {
+	b.t.Helper()
+
+	return b.expect(method, func(call *Call) bool {
+		return call.Method == method
+	})
+}
+
+// ExpectNoCalls fails the test if there are calls which aren't checked yet.
+func (b *Bot) ExpectNoCalls() {
+	b.t.Helper()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, call := range b.calls {
+		if !call.checked {
+			b.t.Errorf("routertest: unexpected call %s", call)
+		}
+	}
+}
+
+func (b *Bot) expect(name string, match func(call *Call) bool) *Expectation {
+	b.t.Helper()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, call := range b.calls {
+		if !call.checked && match(call) {
+			call.checked = true
+
+			return &Expectation{bot: b, call: call}
+		}
+	}
+
+	b.t.Errorf("routertest: expected %s, got calls %s", name, b.unchecked())
+
+	return &Expectation{bot: b}
+}
+
+// unchecked returns calls which aren't checked yet for failure messages.
+func (b *Bot) unchecked() string {
+	var calls []string
+	for _, call := range b.calls {
+		if !call.checked {
+			calls = append(calls, call.String())
+		}
+	}
+
+	return "[" + strings.Join(calls, ", ") + "]"
+}
+
+// TextEquals checks that the text of the call is equal to text.
+func (e *Expectation) TextEquals(text string) *Expectation {
+	e.bot.t.Helper()
+
+	if e.call != nil && e.call.Text != text {
+		e.bot.t.Errorf("routertest: %s: text %q, want %q", e.call.Method, e.call.Text, text)
+	}
+
+	return e
+}
+
+// TextContains checks that the text of the call contains substr.
+func (e *Expectation) TextContains(substr string) *Expectation {
+	e.bot.t.Helper()
+
+	if e.call != nil && !strings.Contains(e.call.Text, substr) {
+		e.bot.t.Errorf("routertest: %s: text %q doesn't contain %q", e.call.Method, e.call.Text, substr)
+	}
+
+	return e
+}
+
+// WithParseMode checks the parse mode of the call.
+func (e *Expectation) WithParseMode(parseMode string) *Expectation {
+	e.bot.t.Helper()
+
+	if e.call != nil && e.call.ParseMode != parseMode {
+		e.bot.t.Errorf("routertest: %s: parse mode %q, want %q", e.call.Method, e.call.ParseMode, parseMode)
+	}
+
+	return e
+}
+
+// WithInlineButton checks that the inline keyboard of the message has the button with the text.
+func (e *Expectation) WithInlineButton(text string) *Expectation {
+	e.bot.t.Helper()
+
+	if e.call == nil {
+		return e
+	}
+	if _, ok := e.call.inlineButton(text); !ok {
+		e.bot.t.Errorf("routertest: %s: no inline button %q", e.call, text)
+	}
+
+	return e
+}
+
+// WithButton checks that the reply keyboard of the message has the button with the text.
+func (e *Expectation) WithButton(text string) *Expectation {
+	e.bot.t.Helper()
+
+	if e.call == nil {
+		return e
+	}
+	if _, ok := e.call.button(text); !ok {
+		e.bot.t.Errorf("routertest: %s: no button %q", e.call, text)
+	}
+
+	return e
+}
+
+// formatID formats the chat identifier for failure messages.
+func formatID(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
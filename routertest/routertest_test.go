@@ -0,0 +1,219 @@
+package routertest_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/kbgod/lumex"
+	"github.com/kbgod/lumex/fsm"
+	"github.com/kbgod/lumex/router"
+	"github.com/kbgod/lumex/routertest"
+	"github.com/stretchr/testify/assert"
+)
+
+// newSignupRouter returns the router of the signup form: /start asks the name, the name is confirmed with inline buttons.
+func newSignupRouter() *router.Router {
+	r := router.New(nil)
+	r.Use(fsm.Middleware(fsm.NewMemory()))
+
+	r.OnStart(func(ctx *router.Context) error {
+		ctx.SetState("signup:name")
+
+		return ctx.ReplyVoid("What is your name?")
+	})
+
+	name := r.UseState("signup:name")
+	name.OnMessage(func(ctx *router.Context) error {
+		if err := fsm.FromContext(ctx).Set("name", ctx.Message().Text); err != nil {
+			return err
+		}
+		ctx.SetState("signup:confirm")
+
+		menu := lumex.NewInlineMenu()
+		menu.Row().CallbackBtn("Confirm", "confirm").CallbackBtn("Cancel", "cancel")
+
+		return ctx.ReplyWithMenuVoid("Hi, "+ctx.Message().Text+"! Is it right?", menu)
+	})
+
+	confirm := r.UseState("signup:confirm")
+	confirm.OnCallbackPrefix("confirm", func(ctx *router.Context) error {
+		var name string
+		if _, err := fsm.FromContext(ctx).Get("name", &name); err != nil {
+			return err
+		}
+		ctx.ClearState()
+
+		if err := ctx.AnswerVoid("Saved"); err != nil {
+			return err
+		}
+
+		return ctx.EditMessageTextVoid("Welcome, " + name)
+	})
+	confirm.OnCallbackPrefix("cancel", func(ctx *router.Context) error {
+		ctx.ClearState()
+
+		return ctx.AnswerAlertVoid("Cancelled")
+	})
+
+	return r
+}
+
+func TestConversation(t *testing.T) {
+	bot := routertest.NewBot(t)
+	user := routertest.User(42, "Alice")
+	chat := routertest.PrivateChat(user)
+
+	r := newSignupRouter()
+	c := bot.Conversation(r, user, chat)
+	c.Send("/start").ExpectReply().TextEquals("What is your name?")
+	c.Send("Alice").ExpectReply().TextContains("Hi, Alice").WithInlineButton("Confirm").WithInlineButton("Cancel")
+	c.Press("Confirm")
+	c.ExpectAnswer().TextEquals("Saved")
+	c.ExpectEdit().TextEquals("Welcome, Alice")
+	bot.ExpectNoCalls()
+
+	// the state is cleared, so the name isn't expected anymore
+	assert.ErrorIs(t, bot.HandleUpdate(r, routertest.TextMessage(user, chat, "Bob")), router.ErrRouteNotFound)
+	bot.ExpectNoCalls()
+}
+
+func TestBot(t *testing.T) {
+	bot := routertest.NewBot(t)
+	user := routertest.User(1, "Bob")
+	group := routertest.GroupChat(-100, "Group")
+
+	r := router.New(bot.Bot)
+	r.OnCommand("help", func(ctx *router.Context) error {
+		ctx.SetParseMode(lumex.ParseModeHTML)
+
+		return ctx.ReplyWithMenuVoid("<b>Help</b>", lumex.NewMenu().TextBtn("Menu"))
+	})
+	r.OnChatMember(func(ctx *router.Context) error {
+		return ctx.ReplyVoid("Welcome, " + ctx.Update.ChatMember.NewChatMember.GetUser().FirstName)
+	})
+	r.OnInlineQuery(func(ctx *router.Context) error {
+		return ctx.AnswerQueryVoid(nil)
+	})
+
+	assert.NoError(t, bot.HandleUpdate(r, routertest.TextMessage(user, group, "/help")))
+	assert.NoError(t, bot.HandleUpdate(r, routertest.Joined(group, user)))
+	assert.NoError(t, bot.HandleUpdate(r, routertest.InlineQuery(user, "query")))
+
+	bot.ExpectReply(group.Id).TextEquals("<b>Help</b>").WithParseMode(lumex.ParseModeHTML).WithButton("Menu")
+	bot.ExpectReply(group.Id).TextEquals("Welcome, Bob")
+	bot.ExpectCall("answerInlineQuery")
+	bot.ExpectNoCalls()
+	assert.Len(t, bot.Calls(), 3)
+
+	t.Run("typed params", func(t *testing.T) {
+		r := router.New(bot.Bot)
+		r.OnCallbackPrefix("cancel", func(ctx *router.Context) error {
+			return ctx.AnswerAlertVoid("Cancelled")
+		})
+		r.OnInlineQuery(func(ctx *router.Context) error {
+			return ctx.AnswerQueryVoid([]lumex.InlineQueryResult{lumex.InlineQueryResultArticle{Id: "1", Title: "Article"}})
+		})
+
+		assert.NoError(t, bot.HandleUpdate(r, routertest.Callback(user, group, "cancel")))
+		assert.NoError(t, bot.HandleUpdate(r, routertest.InlineQuery(user, "query")))
+
+		answer := bot.ExpectAnswer().TextEquals("Cancelled").Call()
+		assert.True(t, routertest.Opts[lumex.AnswerCallbackQueryOpts](answer).ShowAlert)
+		assert.Nil(t, routertest.Opts[lumex.AnswerCallbackQueryOpts](answer).RequestOpts)
+
+		results, ok := routertest.Param[[]lumex.InlineQueryResult](bot.ExpectCall("answerInlineQuery").Call(), "results")
+		assert.True(t, ok)
+		assert.Equal(t, []lumex.InlineQueryResult{lumex.InlineQueryResultArticle{Id: "1", Title: "Article"}}, results)
+		bot.ExpectNoCalls()
+	})
+
+	t.Run("respond", func(t *testing.T) {
+		errBlocked := errors.New("bot was blocked by the user")
+		bot.Respond("sendMessage", func(call *routertest.Call) (any, error) {
+			return nil, errBlocked
+		})
+
+		err := bot.HandleUpdate(r, routertest.TextMessage(user, routertest.PrivateChat(user), "/help"))
+		assert.ErrorIs(t, err, errBlocked)
+	})
+}
+
+func TestBot_Respond(t *testing.T) {
+	bot := routertest.NewBot(t)
+	user := routertest.User(42, "Alice")
+	chat := routertest.PrivateChat(user)
+
+	// the message returned by the responder is the one buttons are pressed under
+	bot.Respond("sendMessage", func(call *routertest.Call) (any, error) {
+		return &lumex.Message{MessageId: 100, Chat: chat, Text: call.Text}, nil
+	})
+
+	var pressed int64
+	r := router.New(nil)
+	r.OnStart(func(ctx *router.Context) error {
+		return ctx.ReplyWithMenuVoid("Menu", lumex.NewInlineMenu().CallbackBtn("Next", "next"))
+	})
+	r.OnCallbackPrefix("next", func(ctx *router.Context) error {
+		pressed = ctx.Update.CallbackQuery.Message.GetMessageId()
+
+		return ctx.AnswerVoid("")
+	})
+
+	c := bot.Conversation(r, user, chat)
+	c.Send("/start").ExpectReply().TextEquals("Menu")
+	c.Press("Next").ExpectAnswer()
+	assert.Equal(t, int64(100), pressed)
+}
+
+// recorder records failures of expectations instead of failing the test.
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestExpectation_failures(t *testing.T) {
+	rec := &recorder{TB: t}
+	bot := routertest.NewBot(rec)
+	_, err := bot.SendMessage(1, "hello", nil)
+	assert.NoError(t, err)
+
+	bot.ExpectReply(1).TextContains("bye").WithInlineButton("Next")
+	bot.ExpectReply(1).TextEquals("hello")
+	bot.ExpectNoCalls()
+
+	assert.Equal(t, []string{
+		`routertest: sendMessage: text "hello" doesn't contain "bye"`,
+		`routertest: sendMessage(chat 1, "hello"): no inline button "Next"`,
+		`routertest: expected message to chat 1, got calls []`,
+	}, rec.errors)
+}
+
+func TestConversation_Press_urlButton(t *testing.T) {
+	rec := &recorder{TB: t}
+	bot := routertest.NewBot(rec)
+	user := routertest.User(42, "Alice")
+	chat := routertest.PrivateChat(user)
+
+	r := router.New(nil)
+	r.OnStart(func(ctx *router.Context) error {
+		return ctx.ReplyWithMenuVoid("Menu", lumex.NewInlineMenu().URLBtn("Site", "https://example.com"))
+	})
+
+	bot.Conversation(r, user, chat).Send("/start").Press("Site")
+
+	assert.Equal(t, []string{`routertest: button "Site" in chat 42 has no callback data`}, rec.errors)
+}
+
+func TestTextMessage_commandEntity(t *testing.T) {
+	user := routertest.User(42, "Alice")
+	update := routertest.TextMessage(user, routertest.PrivateChat(user), "/café now")
+
+	assert.Equal(t, []lumex.MessageEntity{{Type: "bot_command", Length: 5}}, update.Message.Entities)
+}
@@ -0,0 +1,139 @@
+package routertest
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/kbgod/lumex"
+	"github.com/kbgod/lumex/telegramtest"
+)
+
+// counters make identifiers of built updates unique like identifiers given by Telegram.
+var (
+	updateID  atomic.Int64
+	messageID atomic.Int64
+	queryID   atomic.Int64
+)
+
+// User returns a user with the identifier and the first name.
+func User(id int64, firstName string) *lumex.User {
+	return &lumex.User{Id: id, FirstName: firstName}
+}
+
+// PrivateChat returns the private chat with the user.
+func PrivateChat(user *lumex.User) lumex.Chat {
+	return lumex.Chat{
+		Id:        user.Id,
+		Type:      lumex.ChatTypePrivate,
+		FirstName: user.FirstName,
+		Username:  user.Username,
+	}
+}
+
+// GroupChat returns a supergroup with the identifier and the title.
+func GroupChat(id int64, title string) lumex.Chat {
+	return lumex.Chat{Id: id, Type: lumex.ChatTypeSupergroup, Title: title}
+}
+
+// newUpdate returns an update with a new identifier.
+func newUpdate() *lumex.Update {
+	return &lumex.Update{UpdateId: updateID.Add(1)}
+}
+
+// newMessage returns a message with a new identifier sent now.
+func newMessage(from *lumex.User, chat lumex.Chat, text string) *lumex.Message {
+	return &lumex.Message{
+		MessageId: messageID.Add(1),
+		From:      from,
+		Chat:      chat,
+		Date:      time.Now().Unix(),
+		Text:      text,
+		Entities:  telegramtest.CommandEntities(text),
+	}
+}
+
+// TextMessage
+//
+// returns the update with the text message of the user in the chat.
+// Commands at the start of the text get the bot_command entity like Telegram sets it.
+// Example: routertest.TextMessage(user, routertest.PrivateChat(user), "/start")
+func TextMessage(from *lumex.User, chat lumex.Chat, text string) *lumex.Update {
+	update := newUpdate()
+	update.Message = newMessage(from, chat, text)
+
+	return update
+}
+
+// Callback
+//
+// returns the update with the callback query of the user who pressed the inline button with the data
+// under the message of the bot in the chat.
+func Callback(from *lumex.User, chat lumex.Chat, data string) *lumex.Update {
+	return callback(from, lumex.Message{MessageId: messageID.Add(1), Chat: chat, Date: time.Now().Unix()}, data)
+}
+
+// callback returns the update with the callback query of the button under the message.
+func callback(from *lumex.User, message lumex.Message, data string) *lumex.Update {
+	update := newUpdate()
+	update.CallbackQuery = &lumex.CallbackQuery{
+		Id:           strconv.FormatInt(queryID.Add(1), 10),
+		From:         *from,
+		Message:      message,
+		ChatInstance: strconv.FormatInt(message.Chat.Id, 10),
+		Data:         data,
+	}
+
+	return update
+}
+
+// InlineQuery returns the update with the inline query of the user.
+func InlineQuery(from *lumex.User, query string) *lumex.Update {
+	update := newUpdate()
+	update.InlineQuery = &lumex.InlineQuery{
+		Id:    strconv.FormatInt(queryID.Add(1), 10),
+		From:  *from,
+		Query: query,
+	}
+
+	return update
+}
+
+// ChatMember
+//
+// returns the chat_member update of the chat where the member changed from oldMember to newMember by the user from,
+// e.g. routertest.ChatMember(chat, user, lumex.ChatMemberLeft{User: *user}, lumex.ChatMemberMember{User: *user})
+func ChatMember(chat lumex.Chat, from *lumex.User, oldMember, newMember lumex.ChatMember) *lumex.Update {
+	update := newUpdate()
+	update.ChatMember = chatMemberUpdated(chat, from, oldMember, newMember)
+
+	return update
+}
+
+// MyChatMember returns the my_chat_member update of the chat where the bot member changed from oldMember to newMember.
+func MyChatMember(chat lumex.Chat, from *lumex.User, oldMember, newMember lumex.ChatMember) *lumex.Update {
+	update := newUpdate()
+	update.MyChatMember = chatMemberUpdated(chat, from, oldMember, newMember)
+
+	return update
+}
+
+// Joined returns the chat_member update of the user who joined the chat.
+func Joined(chat lumex.Chat, user *lumex.User) *lumex.Update {
+	return ChatMember(chat, user, lumex.ChatMemberLeft{User: *user}, lumex.ChatMemberMember{User: *user})
+}
+
+// Left returns the chat_member update of the user who left the chat.
+func Left(chat lumex.Chat, user *lumex.User) *lumex.Update {
+	return ChatMember(chat, user, lumex.ChatMemberMember{User: *user}, lumex.ChatMemberLeft{User: *user})
+}
+
+func chatMemberUpdated(chat lumex.Chat, from *lumex.User, oldMember, newMember lumex.ChatMember) *lumex.ChatMemberUpdated {
+	return &lumex.ChatMemberUpdated{
+		Chat:          chat,
+		From:          *from,
+		Date:          time.Now().Unix(),
+		OldChatMember: oldMember,
+		NewChatMember: newMember,
+	}
+}
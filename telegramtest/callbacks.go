@@ -0,0 +1,123 @@
+package telegramtest
+
+import (
+	"strconv"
+
+	"github.com/kbgod/lumex"
+)
+
+// callbackQuery is the callback query sent to the bot and its answer.
+type callbackQuery struct {
+	answered  bool
+	text      string
+	showAlert bool
+}
+
+// CallbackAnswer is the answer of the bot to the callback query.
+type CallbackAnswer struct {
+	Text      string
+	ShowAlert bool
+}
+
+// addCallbackQuery queues the callback query of the button under the message and returns its identifier.
+// It must be called with s.mu locked.
+func (s *Server) addCallbackQuery(from lumex.User, message *lumex.Message, data string) string {
+	s.queryID++
+	// identifiers of callback queries are big numbers like in Telegram
+	id := strconv.FormatInt(4_000_000_000_000_000_000+s.queryID, 10)
+	s.queries[id] = &callbackQuery{}
+
+	s.addUpdate(lumex.Update{CallbackQuery: &lumex.CallbackQuery{
+		Id:           id,
+		From:         from,
+		Message:      *cloneMessage(message),
+		ChatInstance: strconv.FormatInt(message.Chat.Id*31, 10),
+		Data:         data,
+	}})
+
+	return id
+}
+
+// CallbackAnswer returns the answer of the bot to the callback query and reports whether it was answered.
+func (s *Server) CallbackAnswer(queryID string) (CallbackAnswer, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	query, ok := s.queries[queryID]
+	if !ok || !query.answered {
+		return CallbackAnswer{}, false
+	}
+
+	return CallbackAnswer{Text: query.text, ShowAlert: query.showAlert}, true
+}
+
+func (s *Server) answerCallbackQuery(req *request) (any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// a callback query can be answered once
+	query, ok := s.queries[req.param("callback_query_id")]
+	if !ok || query.answered {
+		return nil, errQueryInvalid
+	}
+
+	query.answered = true
+	query.text = req.param("text")
+	query.showAlert = req.boolParam("show_alert")
+	s.notify()
+
+	return true, nil
+}
+
+func (s *Server) answerInlineQuery(req *request) (any, error) {
+	if req.param("inline_query_id") == "" {
+		return nil, errQueryInvalid
+	}
+
+	return true, nil
+}
+
+// commandsKey returns the key of commands of the scope and language parameters.
+func commandsKey(req *request) string {
+	scope := req.param("scope")
+	if scope == "" {
+		scope = `{"type":"default"}`
+	}
+
+	return scope + "|" + req.param("language_code")
+}
+
+func (s *Server) setMyCommands(req *request) (any, error) {
+	var commands []lumex.BotCommand
+	if _, err := req.jsonParam("commands", &commands); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.commands[commandsKey(req)] = commands
+
+	return true, nil
+}
+
+func (s *Server) getMyCommands(req *request) (any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	commands := s.commands[commandsKey(req)]
+	if commands == nil {
+		commands = []lumex.BotCommand{}
+	}
+
+	return commands, nil
+}
+
+func (s *Server) deleteMyCommands(req *request) (any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.commands, commandsKey(req))
+
+	return true, nil
+}
@@ -0,0 +1,237 @@
+package telegramtest
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/kbgod/lumex"
+)
+
+// file is the file uploaded by the bot or sent by a user.
+type file struct {
+	id       string
+	uniqueID string
+	name     string
+	path     string
+	data     []byte
+}
+
+// addFile stores the file with new identifiers in the directory. It must be called with s.mu locked.
+func (s *Server) addFile(dir, name string, data []byte) *file {
+	s.fileID++
+	f := &file{
+		// identifiers are opaque strings of different lengths like in Telegram
+		id:       "BQACAgIAAxkBAA" + base64.RawURLEncoding.EncodeToString(fmt.Appendf(nil, "file:%d:%s", s.fileID, dir)),
+		uniqueID: "AgAD" + base64.RawURLEncoding.EncodeToString(fmt.Appendf(nil, "%d", s.fileID)),
+		name:     path.Base(name),
+		path:     fmt.Sprintf("%s/file_%d%s", dir, s.fileID, path.Ext(name)),
+		data:     data,
+	}
+	s.files[f.id] = f
+
+	return f
+}
+
+// inputFile returns the file of the parameter: the uploaded file, the file identifier or the URL of the file.
+func (s *Server) inputFile(req *request, key, dir string) (*file, error) {
+	value := req.param(key)
+	if value == "" {
+		if _, ok := req.files[key]; ok {
+			value = "attach://" + key
+		}
+	}
+
+	return s.fileOf(req, value, dir)
+}
+
+// fileOf returns the file of the value like "media" of InputMedia: "attach://<name>" of the uploaded file,
+// the file identifier or the URL of the file.
+func (s *Server) fileOf(req *request, value, dir string) (*file, error) {
+	if name, ok := strings.CutPrefix(value, "attach://"); ok {
+		header, data, err := req.file(name)
+		if err != nil {
+			return nil, err
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		return s.addFile(dir, header.Filename, data), nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if f, ok := s.files[value]; ok {
+		return f, nil
+	}
+	if strings.HasPrefix(value, "http://") || strings.HasPrefix(value, "https://") {
+		// files by URL are not downloaded, they are empty
+		return s.addFile(dir, value, nil), nil
+	}
+
+	return nil, errFileID
+}
+
+// mediaMessage returns the message with the file of the media kind, like Photo for "photo".
+func mediaMessage(kind string, f *file, caption string) lumex.Message {
+	size := int64(len(f.data))
+	message := lumex.Message{Caption: caption}
+	switch kind {
+	case "photo":
+		message.Photo = []lumex.PhotoSize{{FileId: f.id, FileUniqueId: f.uniqueID, Width: 800, Height: 600, FileSize: size}}
+	case "document":
+		message.Document = &lumex.Document{FileId: f.id, FileUniqueId: f.uniqueID, FileName: f.name, FileSize: size}
+	case "video":
+		message.Video = &lumex.Video{FileId: f.id, FileUniqueId: f.uniqueID, Width: 1280, Height: 720, FileSize: size}
+	case "audio":
+		message.Audio = &lumex.Audio{FileId: f.id, FileUniqueId: f.uniqueID, FileSize: size}
+	case "voice":
+		message.Voice = &lumex.Voice{FileId: f.id, FileUniqueId: f.uniqueID, FileSize: size}
+	case "animation":
+		message.Animation = &lumex.Animation{FileId: f.id, FileUniqueId: f.uniqueID, Width: 320, Height: 240, FileSize: size}
+	case "sticker":
+		message.Sticker = &lumex.Sticker{FileId: f.id, FileUniqueId: f.uniqueID, Type: "regular", Width: 512, Height: 512, FileSize: size}
+	case "video_note":
+		message.VideoNote = &lumex.VideoNote{FileId: f.id, FileUniqueId: f.uniqueID, Length: 240, FileSize: size}
+	}
+
+	return message
+}
+
+// sendMedia returns the send method of the media kind, like sendPhoto for "photo".
+func (s *Server) sendMedia(kind string) method {
+	return func(req *request) (any, error) {
+		f, err := s.inputFile(req, kind, kind+"s")
+		if err != nil {
+			return nil, err
+		}
+
+		return s.botMessage(req, mediaMessage(kind, f, req.param("caption")))
+	}
+}
+
+// inputMedia is the InputMedia of sendMediaGroup and editMessageMedia.
+type inputMedia struct {
+	Type    string `json:"type"`
+	Media   string `json:"media"`
+	Caption string `json:"caption"`
+}
+
+// media returns the message with the file of the input media.
+func (s *Server) media(req *request, item inputMedia) (lumex.Message, error) {
+	switch item.Type {
+	case "photo", "video", "document", "audio", "animation":
+	default:
+		return lumex.Message{}, badRequest("can't parse InputMedia: unsupported media type")
+	}
+
+	f, err := s.fileOf(req, item.Media, item.Type+"s")
+	if err != nil {
+		return lumex.Message{}, err
+	}
+
+	return mediaMessage(item.Type, f, item.Caption), nil
+}
+
+func (s *Server) sendMediaGroup(req *request) (any, error) {
+	var items []inputMedia
+	if _, err := req.jsonParam("media", &items); err != nil {
+		return nil, err
+	}
+	if len(items) < 2 || len(items) > 10 {
+		return nil, badRequest("wrong number of messages in the media group: must include 2-10 items")
+	}
+
+	// all files are resolved before the first message is sent, so invalid media don't leave a part of the group
+	messages := make([]lumex.Message, 0, len(items))
+	for _, item := range items {
+		message, err := s.media(req, item)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+
+	s.mu.Lock()
+	s.mediaGroupID++
+	groupID := strconv.FormatInt(s.mediaGroupID, 10)
+	s.mu.Unlock()
+
+	sent := make([]*lumex.Message, 0, len(messages))
+	for _, message := range messages {
+		message.MediaGroupId = groupID
+		m, err := s.botMessage(req, message)
+		if err != nil {
+			return nil, err
+		}
+		sent = append(sent, m)
+	}
+
+	return sent, nil
+}
+
+func (s *Server) editMessageMedia(req *request) (any, error) {
+	var item inputMedia
+	if ok, err := req.jsonParam("media", &item); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, badRequest("media must be non-empty")
+	}
+
+	media, err := s.media(req, item)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.edit(req, func(m *lumex.Message) error {
+		if m.Text != "" {
+			return badRequest("there is no media in the message to edit")
+		}
+		media.MessageId, media.Date, media.Chat = m.MessageId, m.Date, m.Chat
+		media.From, media.ReplyToMessage, media.MediaGroupId = m.From, m.ReplyToMessage, m.MediaGroupId
+		*m = media
+
+		return nil
+	})
+}
+
+func (s *Server) getFile(req *request) (any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, ok := s.files[req.param("file_id")]
+	if !ok {
+		return nil, errInvalidFileID
+	}
+
+	return lumex.File{FileId: f.id, FileUniqueId: f.uniqueID, FileSize: int64(len(f.data)), FilePath: f.path}, nil
+}
+
+// serveFile serves the file downloaded by the path returned by getFile.
+func (s *Server) serveFile(w http.ResponseWriter, filePath string) {
+	s.mu.Lock()
+	var data []byte
+	found := false
+	for _, f := range s.files {
+		if f.path == filePath {
+			data, found = f.data, true
+
+			break
+		}
+	}
+	s.mu.Unlock()
+
+	if !found {
+		writeResponse(w, nil, errNotFound)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	_, _ = w.Write(data)
+}
@@ -0,0 +1,616 @@
+package telegramtest
+
+import (
+	"context"
+	"math/rand/v2"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/kbgod/lumex"
+)
+
+// chatState keeps messages of the chat, message identifiers grow in every chat separately like in private chats.
+type chatState struct {
+	chat      lumex.Chat
+	messageID int64
+	messages  []*lumex.Message
+	// sent are times of messages sent by the bot to the chat, see Server.checkFloodLimits.
+	sent []time.Time
+}
+
+// add adds the message to the chat with a new identifier.
+func (c *chatState) add(message lumex.Message) *lumex.Message {
+	c.messageID++
+	message.MessageId = c.messageID
+	message.Chat = c.chat
+	message.Date = time.Now().Unix()
+
+	m := &message
+	c.messages = append(c.messages, m)
+
+	return m
+}
+
+// message returns the message of the chat by the identifier.
+func (c *chatState) message(id int64) (*lumex.Message, bool) {
+	for _, m := range c.messages {
+		if m.MessageId == id {
+			return m, true
+		}
+	}
+
+	return nil, false
+}
+
+// cloneMessage returns a copy of the message, so stored messages aren't changed by their readers.
+func cloneMessage(m *lumex.Message) *lumex.Message {
+	message := *m
+
+	return &message
+}
+
+// CommandEntities
+//
+// returns the bot_command entity of the text which starts with a command like Telegram sets it,
+// the length is counted in UTF-16 code units. It returns nil if the text doesn't start with a command.
+// Example: telegramtest.CommandEntities("/start hello")
+func CommandEntities(text string) []lumex.MessageEntity {
+	if len(text) < 2 || text[0] != '/' {
+		return nil
+	}
+
+	end := strings.IndexAny(text, " \n")
+	if end == -1 {
+		end = len(text)
+	}
+
+	length := len(utf16.Encode([]rune(text[:end])))
+
+	return []lumex.MessageEntity{{Type: "bot_command", Offset: 0, Length: int64(length)}}
+}
+
+// AddChat adds the chat, so the bot can send messages to it before users write there.
+func (s *Server) AddChat(chat lumex.Chat) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.addChat(chat)
+}
+
+// addChat returns the chat, it is created if it doesn't exist. It must be called with s.mu locked.
+func (s *Server) addChat(chat lumex.Chat) *chatState {
+	c, ok := s.chats[chat.Id]
+	if !ok {
+		if chat.Type == "" {
+			chat.Type = lumex.ChatTypePrivate
+		}
+		c = &chatState{chat: chat}
+		s.chats[chat.Id] = c
+	}
+
+	return c
+}
+
+// Messages returns messages of the chat in order, including messages of users.
+func (s *Server) Messages(chatID int64) []lumex.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.chats[chatID]
+	if !ok {
+		return nil
+	}
+
+	messages := make([]lumex.Message, len(c.messages))
+	for i, m := range c.messages {
+		messages[i] = *m
+	}
+
+	return messages
+}
+
+// WaitMessage
+//
+// waits until the bot sends a message to the chat with the identifier greater than afterID and returns it.
+// Pass the identifier of the message of the user to get the reply to it.
+// Example:
+//
+//	m := s.SendMessage(user, chat, "/start")
+//	reply, err := s.WaitMessage(ctx, chat.Id, m.MessageId)
+func (s *Server) WaitMessage(ctx context.Context, chatID, afterID int64) (lumex.Message, error) {
+	for {
+		s.mu.Lock()
+		if c, ok := s.chats[chatID]; ok {
+			for _, m := range c.messages {
+				if m.MessageId > afterID && m.From != nil && m.From.Id == s.user.Id {
+					s.mu.Unlock()
+
+					return *m, nil
+				}
+			}
+		}
+		changed := s.changed
+		s.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return lumex.Message{}, ctx.Err()
+		}
+	}
+}
+
+// targetChat returns the chat of the chat_id parameter which the bot can send messages to.
+// It must be called with s.mu locked.
+func (s *Server) targetChat(req *request, key string) (*chatState, error) {
+	value := req.param(key)
+	if value == "" {
+		return nil, badRequest("chat_id is empty")
+	}
+
+	if strings.HasPrefix(value, "@") {
+		for _, c := range s.chats {
+			if strings.EqualFold("@"+c.chat.Username, value) {
+				return c, nil
+			}
+		}
+
+		return nil, errChatNotFound
+	}
+
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return nil, errChatNotFound
+	}
+	c, ok := s.chats[id]
+	if !ok {
+		return nil, errChatNotFound
+	}
+	if c.chat.Type == lumex.ChatTypePrivate && s.blocked[id] {
+		return nil, errBlocked
+	}
+
+	return c, nil
+}
+
+// checkFloodLimits fails if the bot sent too many messages in all chats or in the group,
+// otherwise it counts the new message. It must be called with s.mu locked.
+func (s *Server) checkFloodLimits(c *chatState) error {
+	now := time.Now()
+	group := c.chat.Type != lumex.ChatTypePrivate
+
+	if group {
+		if err := checkLimit(s.groupLimit, c.sent, now); err != nil {
+			return err
+		}
+	}
+	if err := checkLimit(s.globalLimit, s.sent, now); err != nil {
+		return err
+	}
+
+	s.sent = countMessage(s.globalLimit, s.sent, now)
+	if group {
+		c.sent = countMessage(s.groupLimit, c.sent, now)
+	}
+
+	return nil
+}
+
+// checkLimit fails with the flood limit error if the limit of messages sent at times sent is reached.
+func checkLimit(limit Limit, sent []time.Time, now time.Time) error {
+	if limit.Messages <= 0 {
+		return nil
+	}
+
+	var recent []time.Time
+	for _, t := range sent {
+		if now.Sub(t) < limit.Interval {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) < limit.Messages {
+		return nil
+	}
+
+	return tooManyRequests(recent[len(recent)-limit.Messages].Add(limit.Interval).Sub(now))
+}
+
+// countMessage adds the time of the message to sent and forgets times which don't matter for the limit anymore.
+func countMessage(limit Limit, sent []time.Time, now time.Time) []time.Time {
+	if limit.Messages <= 0 {
+		return sent
+	}
+
+	sent = slices.DeleteFunc(sent, func(t time.Time) bool {
+		return now.Sub(t) >= limit.Interval
+	})
+
+	return append(sent, now)
+}
+
+// botMessage adds the message of the bot to the chat of the chat_id parameter
+// with the reply markup and the replied message taken from parameters.
+func (s *Server) botMessage(req *request, message lumex.Message) (*lumex.Message, error) {
+	markup, err := inlineMarkup(req)
+	if err != nil {
+		return nil, err
+	}
+	var reply lumex.ReplyParameters
+	if _, err := req.jsonParam("reply_parameters", &reply); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, err := s.targetChat(req, "chat_id")
+	if err != nil {
+		return nil, err
+	}
+	if reply.MessageId != 0 {
+		replied, ok := c.message(reply.MessageId)
+		if !ok && !reply.AllowSendingWithoutReply {
+			return nil, badRequest("message to be replied not found")
+		}
+		if ok {
+			message.ReplyToMessage = cloneMessage(replied)
+		}
+	}
+	if err := s.checkFloodLimits(c); err != nil {
+		return nil, err
+	}
+
+	message.From = &s.user
+	message.ReplyMarkup = markup
+	m := c.add(message)
+	s.notify()
+
+	return cloneMessage(m), nil
+}
+
+func (s *Server) sendLocation(req *request) (any, error) {
+	latitude, err := req.floatParam("latitude")
+	if err != nil {
+		return nil, err
+	}
+	longitude, err := req.floatParam("longitude")
+	if err != nil {
+		return nil, err
+	}
+
+	return s.botMessage(req, lumex.Message{Location: &lumex.Location{Latitude: latitude, Longitude: longitude}})
+}
+
+func (s *Server) sendContact(req *request) (any, error) {
+	contact := &lumex.Contact{
+		PhoneNumber: req.param("phone_number"),
+		FirstName:   req.param("first_name"),
+		LastName:    req.param("last_name"),
+	}
+	if contact.PhoneNumber == "" || contact.FirstName == "" {
+		return nil, badRequest("phone number and first name must be non-empty")
+	}
+
+	return s.botMessage(req, lumex.Message{Contact: contact})
+}
+
+func (s *Server) sendPoll(req *request) (any, error) {
+	question := req.param("question")
+	if strings.TrimSpace(question) == "" {
+		return nil, badRequest("poll question must be non-empty")
+	}
+	var options []lumex.InputPollOption
+	if _, err := req.jsonParam("options", &options); err != nil {
+		return nil, err
+	}
+	if len(options) < 2 || len(options) > 10 {
+		return nil, badRequest("poll must have 2-10 options")
+	}
+
+	poll := &lumex.Poll{
+		Question:              question,
+		IsAnonymous:           true,
+		Type:                  "regular",
+		AllowsMultipleAnswers: req.boolParam("allows_multiple_answers"),
+	}
+	if value, ok := req.params["is_anonymous"]; ok {
+		poll.IsAnonymous, _ = strconv.ParseBool(value)
+	}
+	if pollType := req.param("type"); pollType != "" {
+		poll.Type = pollType
+	}
+	for _, option := range options {
+		poll.Options = append(poll.Options, lumex.PollOption{Text: option.Text})
+	}
+
+	s.mu.Lock()
+	s.pollID++
+	poll.Id = strconv.FormatInt(s.pollID, 10)
+	s.mu.Unlock()
+
+	return s.botMessage(req, lumex.Message{Poll: poll})
+}
+
+// diceValues are the maximum values of dice emoji, the value of the sent dice is random from 1 to it.
+var diceValues = map[string]int64{"🎲": 6, "🎯": 6, "🎳": 6, "🏀": 5, "⚽": 5, "🎰": 64}
+
+func (s *Server) sendDice(req *request) (any, error) {
+	emoji := req.param("emoji")
+	if emoji == "" {
+		emoji = "🎲"
+	}
+	maxValue, ok := diceValues[emoji]
+	if !ok {
+		return nil, badRequest("invalid dice emoji specified")
+	}
+
+	return s.botMessage(req, lumex.Message{Dice: &lumex.Dice{Emoji: emoji, Value: rand.Int64N(maxValue) + 1}})
+}
+
+// inlineMarkup returns the inline keyboard of the reply_markup parameter, other keyboards aren't kept in messages.
+func inlineMarkup(req *request) (*lumex.InlineKeyboardMarkup, error) {
+	var markup lumex.InlineKeyboardMarkup
+	if _, err := req.jsonParam("reply_markup", &markup); err != nil {
+		return nil, err
+	}
+	if len(markup.InlineKeyboard) == 0 {
+		return nil, nil
+	}
+
+	return &markup, nil
+}
+
+func (s *Server) sendMessage(req *request) (any, error) {
+	text := req.param("text")
+	if strings.TrimSpace(text) == "" {
+		return nil, errEmptyText
+	}
+
+	return s.botMessage(req, lumex.Message{Text: text})
+}
+
+func (s *Server) sendChatAction(req *request) (any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.targetChat(req, "chat_id"); err != nil {
+		return nil, err
+	}
+
+	return true, nil
+}
+
+// sourceMessage returns a copy of the message of the from_chat_id and message_id parameters.
+func (s *Server) sourceMessage(req *request) (*lumex.Message, error) {
+	messageID, err := req.intParam("message_id")
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	from, err := s.targetChat(req, "from_chat_id")
+	if err != nil {
+		return nil, err
+	}
+	m, ok := from.message(messageID)
+	if !ok {
+		return nil, badRequest("message to copy not found")
+	}
+
+	return cloneMessage(m), nil
+}
+
+func (s *Server) copyMessage(req *request) (any, error) {
+	source, err := s.sourceMessage(req)
+	if err != nil {
+		return nil, err
+	}
+
+	message := lumex.Message{
+		Text:      source.Text,
+		Entities:  source.Entities,
+		Caption:   source.Caption,
+		Photo:     source.Photo,
+		Document:  source.Document,
+		Video:     source.Video,
+		Audio:     source.Audio,
+		Voice:     source.Voice,
+		Animation: source.Animation,
+		Sticker:   source.Sticker,
+		VideoNote: source.VideoNote,
+	}
+	if caption, ok := req.params["caption"]; ok {
+		message.Caption = caption
+	}
+
+	m, err := s.botMessage(req, message)
+	if err != nil {
+		return nil, err
+	}
+
+	return lumex.MessageId{MessageId: m.MessageId}, nil
+}
+
+func (s *Server) forwardMessage(req *request) (any, error) {
+	source, err := s.sourceMessage(req)
+	if err != nil {
+		return nil, err
+	}
+	source.ReplyMarkup = nil
+	source.ReplyToMessage = nil
+
+	return s.botMessage(req, *source)
+}
+
+// editedMessage returns the message of the bot of the chat_id and message_id parameters to edit.
+// It must be called with s.mu locked.
+func (s *Server) editedMessage(req *request) (*lumex.Message, error) {
+	if req.param("inline_message_id") != "" {
+		return nil, errEditNotFound
+	}
+
+	messageID, err := req.intParam("message_id")
+	if err != nil {
+		return nil, err
+	}
+	c, err := s.targetChat(req, "chat_id")
+	if err != nil {
+		return nil, err
+	}
+	m, ok := c.message(messageID)
+	if !ok {
+		return nil, errEditNotFound
+	}
+	if m.From == nil || m.From.Id != s.user.Id {
+		return nil, errCantEdit
+	}
+
+	return m, nil
+}
+
+// edit changes the message of the bot with the edit function and fails if nothing is changed.
+func (s *Server) edit(req *request, edit func(m *lumex.Message) error) (any, error) {
+	markup, err := inlineMarkup(req)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, err := s.editedMessage(req)
+	if err != nil {
+		return nil, err
+	}
+
+	edited := cloneMessage(m)
+	if err := edit(edited); err != nil {
+		return nil, err
+	}
+	edited.ReplyMarkup = markup
+	edited.EditDate = 0
+	if reflect.DeepEqual(*edited, withoutEditDate(m)) {
+		return nil, errNotModified
+	}
+
+	edited.EditDate = time.Now().Unix()
+	*m = *edited
+	s.notify()
+
+	return cloneMessage(m), nil
+}
+
+// withoutEditDate returns a copy of the message without the date of the last edit.
+func withoutEditDate(m *lumex.Message) lumex.Message {
+	message := *m
+	message.EditDate = 0
+
+	return message
+}
+
+func (s *Server) editMessageText(req *request) (any, error) {
+	text := req.param("text")
+	if strings.TrimSpace(text) == "" {
+		return nil, errEmptyText
+	}
+
+	return s.edit(req, func(m *lumex.Message) error {
+		if m.Text == "" {
+			return badRequest("there is no text in the message to edit")
+		}
+		m.Text = text
+		m.Entities = nil
+
+		return nil
+	})
+}
+
+func (s *Server) editMessageCaption(req *request) (any, error) {
+	caption := req.param("caption")
+
+	return s.edit(req, func(m *lumex.Message) error {
+		if m.Text != "" {
+			return badRequest("there is no caption in the message to edit")
+		}
+		m.Caption = caption
+		m.CaptionEntities = nil
+
+		return nil
+	})
+}
+
+func (s *Server) editMessageReplyMarkup(req *request) (any, error) {
+	return s.edit(req, func(*lumex.Message) error {
+		return nil
+	})
+}
+
+func (s *Server) deleteMessage(req *request) (any, error) {
+	messageID, err := req.intParam("message_id")
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, err := s.targetChat(req, "chat_id")
+	if err != nil {
+		return nil, err
+	}
+	i := slices.IndexFunc(c.messages, func(m *lumex.Message) bool {
+		return m.MessageId == messageID
+	})
+	if i == -1 {
+		return nil, errDeleteNotFound
+	}
+	c.messages = slices.Delete(c.messages, i, i+1)
+	s.notify()
+
+	return true, nil
+}
+
+func (s *Server) setMessageReaction(req *request) (any, error) {
+	messageID, err := req.intParam("message_id")
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, err := s.targetChat(req, "chat_id")
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := c.message(messageID); !ok {
+		return nil, errMessageInvalid
+	}
+
+	return true, nil
+}
+
+func (s *Server) getChat(req *request) (any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, err := s.targetChat(req, "chat_id")
+	if err != nil {
+		return nil, err
+	}
+
+	return lumex.ChatFullInfo{
+		Id:        c.chat.Id,
+		Type:      c.chat.Type,
+		Title:     c.chat.Title,
+		Username:  c.chat.Username,
+		FirstName: c.chat.FirstName,
+		LastName:  c.chat.LastName,
+	}, nil
+}
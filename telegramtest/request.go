@@ -0,0 +1,137 @@
+package telegramtest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+)
+
+// request holds parameters of the Bot API request sent as multipart form, url-encoded form or JSON.
+type request struct {
+	ctx    context.Context
+	params map[string]string
+	files  map[string]*multipart.FileHeader
+}
+
+func newRequest(r *http.Request) (*request, error) {
+	req := &request{ctx: r.Context(), params: make(map[string]string)}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json":
+		var body map[string]json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("can't parse JSON encoded request parameters")
+		}
+
+		for key, value := range body {
+			var s string
+			if json.Unmarshal(value, &s) == nil {
+				req.params[key] = s
+			} else {
+				req.params[key] = string(value)
+			}
+		}
+	case "multipart/form-data":
+		if err := r.ParseMultipartForm(maxMemory); err != nil {
+			return nil, fmt.Errorf("can't parse multipart request parameters")
+		}
+
+		for key, values := range r.MultipartForm.Value {
+			req.params[key] = values[0]
+		}
+		req.files = make(map[string]*multipart.FileHeader)
+		for key, files := range r.MultipartForm.File {
+			req.files[key] = files[0]
+		}
+	default:
+		if err := r.ParseForm(); err != nil {
+			return nil, fmt.Errorf("can't parse request parameters")
+		}
+
+		for key := range r.Form {
+			req.params[key] = r.Form.Get(key)
+		}
+	}
+
+	return req, nil
+}
+
+// param returns the parameter, empty if it is missing.
+func (r *request) param(key string) string {
+	return r.params[key]
+}
+
+// intParam returns the integer parameter, zero if it is missing.
+func (r *request) intParam(key string) (int64, error) {
+	value, ok := r.params[key]
+	if !ok || value == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, badRequest(fmt.Sprintf("invalid %s specified", key))
+	}
+
+	return n, nil
+}
+
+// floatParam returns the required float parameter.
+func (r *request) floatParam(key string) (float64, error) {
+	value, ok := r.params[key]
+	if !ok || value == "" {
+		return 0, badRequest(key + " must be non-empty")
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, badRequest(fmt.Sprintf("invalid %s specified", key))
+	}
+
+	return f, nil
+}
+
+// boolParam returns the boolean parameter, false if it is missing.
+func (r *request) boolParam(key string) bool {
+	value, _ := strconv.ParseBool(r.params[key])
+
+	return value
+}
+
+// jsonParam decodes the JSON-serialized parameter to dst and reports whether it is present.
+func (r *request) jsonParam(key string, dst any) (bool, error) {
+	value, ok := r.params[key]
+	if !ok || value == "" {
+		return false, nil
+	}
+
+	if err := json.Unmarshal([]byte(value), dst); err != nil {
+		return false, badRequest(fmt.Sprintf("can't parse %s JSON object", key))
+	}
+
+	return true, nil
+}
+
+// file returns contents of the uploaded file attached as "attach://<name>".
+func (r *request) file(name string) (*multipart.FileHeader, []byte, error) {
+	header, ok := r.files[name]
+	if !ok {
+		return nil, nil, badRequest("file must be non-empty")
+	}
+
+	f, err := header.Open()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+
+	return header, data, err
+}
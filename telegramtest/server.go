@@ -0,0 +1,348 @@
+package telegramtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kbgod/lumex"
+)
+
+const (
+	// DefaultToken is the token of the bot served by the server unless WithToken is used.
+	DefaultToken = "123456789:AAHdqTcvCH1vGWJxfSeofSAs0K5PALDsaw"
+
+	// maxMemory is the size of request bodies kept in memory while multipart forms are parsed.
+	maxMemory = 32 << 20
+)
+
+// Limit is the number of messages which can be sent in the interval, zero Messages disables the limit.
+type Limit struct {
+	Messages int
+	Interval time.Duration
+}
+
+var (
+	// DefaultGlobalLimit is the limit of messages of the bot in all chats, like the limit of broadcasts in Telegram.
+	DefaultGlobalLimit = Limit{Messages: 30, Interval: time.Second}
+	// DefaultGroupLimit is the limit of messages of the bot in a group, supergroup or channel.
+	DefaultGroupLimit = Limit{Messages: 20, Interval: time.Minute}
+)
+
+type Option func(*Server)
+
+// WithToken sets the token of the served bot, requests with another token fail with 401 Unauthorized.
+func WithToken(token string) Option {
+	return func(s *Server) {
+		s.token = token
+	}
+}
+
+// WithBotUser sets the user of the served bot returned by getMe.
+func WithBotUser(user lumex.User) Option {
+	return func(s *Server) {
+		s.user = user
+	}
+}
+
+// WithFloodLimits sets limits of messages sent by the bot in all chats and in a group,
+// requests over them fail with 429 Too Many Requests and retry_after like in Telegram.
+func WithFloodLimits(global, group Limit) Option {
+	return func(s *Server) {
+		s.globalLimit = global
+		s.groupLimit = group
+	}
+}
+
+// Server
+//
+// is the in-memory stand-in of the Bot API for integration tests: the bot works with it over HTTP
+// like with api.telegram.org, so polling, webhooks setup, sending and editing messages, callbacks and files
+// are tested end to end. Chats and messages are kept in memory, tests inject messages and button presses of users
+// with SendMessage and PressButton and wait for replies of the bot with WaitMessage.
+// Methods of the Bot API which are not implemented fail with 501 Not Implemented, so tests don't mistake them
+// for errors returned by Telegram, unknown methods fail with 404 Not Found like in Telegram.
+type Server struct {
+	// URL is the API URL of the server, it is set as lumex.RequestOpts APIURL of the bot client.
+	URL string
+
+	server      *httptest.Server
+	token       string
+	user        lumex.User
+	globalLimit Limit
+	groupLimit  Limit
+	methods     map[string]method
+
+	mu sync.Mutex
+	// changed is closed and replaced when updates or messages change, so waiting requests and tests wake up.
+	changed chan struct{}
+	updates
+	chats    map[int64]*chatState
+	blocked  map[int64]bool
+	sent     []time.Time
+	files    map[string]*file
+	fileID   int64
+	queries  map[string]*callbackQuery
+	queryID  int64
+	commands map[string][]lumex.BotCommand
+	// mediaGroupID and pollID are identifiers of the last sent media group and poll.
+	mediaGroupID int64
+	pollID       int64
+}
+
+// method handles the request of the Bot API method and returns its result.
+type method func(req *request) (any, error)
+
+// NewServer starts the server, it must be closed with Close.
+func NewServer(opts ...Option) *Server {
+	s := &Server{
+		token:       DefaultToken,
+		globalLimit: DefaultGlobalLimit,
+		groupLimit:  DefaultGroupLimit,
+		changed:     make(chan struct{}),
+		chats:       make(map[int64]*chatState),
+		blocked:     make(map[int64]bool),
+		files:       make(map[string]*file),
+		queries:     make(map[string]*callbackQuery),
+		commands:    make(map[string][]lumex.BotCommand),
+	}
+	s.updates.updateID = 100000000
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.user.Id == 0 {
+		id, _, _ := strings.Cut(s.token, ":")
+		s.user.Id, _ = strconv.ParseInt(id, 10, 64)
+		s.user.IsBot = true
+		s.user.FirstName = "Test Bot"
+		s.user.Username = "test_bot"
+	}
+
+	s.methods = map[string]method{
+		"getme":                  s.getMe,
+		"getupdates":             s.getUpdates,
+		"setwebhook":             s.setWebhook,
+		"deletewebhook":          s.deleteWebhook,
+		"getwebhookinfo":         s.getWebhookInfo,
+		"sendmessage":            s.sendMessage,
+		"sendphoto":              s.sendMedia("photo"),
+		"senddocument":           s.sendMedia("document"),
+		"sendvideo":              s.sendMedia("video"),
+		"sendaudio":              s.sendMedia("audio"),
+		"sendvoice":              s.sendMedia("voice"),
+		"sendanimation":          s.sendMedia("animation"),
+		"sendsticker":            s.sendMedia("sticker"),
+		"sendvideonote":          s.sendMedia("video_note"),
+		"sendmediagroup":         s.sendMediaGroup,
+		"sendlocation":           s.sendLocation,
+		"sendcontact":            s.sendContact,
+		"sendpoll":               s.sendPoll,
+		"senddice":               s.sendDice,
+		"sendchataction":         s.sendChatAction,
+		"copymessage":            s.copyMessage,
+		"forwardmessage":         s.forwardMessage,
+		"deletemessage":          s.deleteMessage,
+		"editmessagetext":        s.editMessageText,
+		"editmessagecaption":     s.editMessageCaption,
+		"editmessagemedia":       s.editMessageMedia,
+		"editmessagereplymarkup": s.editMessageReplyMarkup,
+		"setmessagereaction":     s.setMessageReaction,
+		"answercallbackquery":    s.answerCallbackQuery,
+		"answerinlinequery":      s.answerInlineQuery,
+		"getchat":                s.getChat,
+		"getfile":                s.getFile,
+		"setmycommands":          s.setMyCommands,
+		"getmycommands":          s.getMyCommands,
+		"deletemycommands":       s.deleteMyCommands,
+	}
+
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.server.URL
+
+	return s
+}
+
+// Close stops the server, waiting requests like long polling fail.
+func (s *Server) Close() {
+	s.server.CloseClientConnections()
+	s.server.Close()
+}
+
+// Token returns the token of the served bot.
+func (s *Server) Token() string {
+	return s.token
+}
+
+// User returns the user of the served bot.
+func (s *Server) User() lumex.User {
+	return s.user
+}
+
+// Client returns the bot client which sends requests to the server.
+func (s *Server) Client() *lumex.BaseBotClient {
+	return &lumex.BaseBotClient{
+		Client:             http.Client{},
+		DefaultRequestOpts: &lumex.RequestOpts{APIURL: s.URL, Timeout: 10 * time.Second},
+	}
+}
+
+// NewBot returns the bot which works with the server, the token is checked with getMe like with Telegram.
+func (s *Server) NewBot() (*lumex.Bot, error) {
+	return lumex.NewBot(s.token, &lumex.BotOpts{BotClient: s.Client()})
+}
+
+// notify wakes up requests and tests waiting for changes. It must be called with s.mu locked.
+func (s *Server) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// Error is the error response of the Bot API.
+type Error struct {
+	Code        int
+	Description string
+	Parameters  *lumex.ResponseParameters
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s", e.Code, e.Description)
+}
+
+// errors returned like Telegram returns them.
+var (
+	errUnauthorized   = &Error{Code: http.StatusUnauthorized, Description: "Unauthorized"}
+	errNotFound       = &Error{Code: http.StatusNotFound, Description: "Not Found"}
+	errChatNotFound   = badRequest("chat not found")
+	errBlocked        = &Error{Code: http.StatusForbidden, Description: "Forbidden: bot was blocked by the user"}
+	errEmptyText      = badRequest("message text is empty")
+	errNotModified    = badRequest("message is not modified: specified new message content and reply markup are exactly the same as a current content and reply markup of the message")
+	errEditNotFound   = badRequest("message to edit not found")
+	errCantEdit       = badRequest("message can't be edited")
+	errDeleteNotFound = badRequest("message to delete not found")
+	errMessageInvalid = badRequest("MESSAGE_ID_INVALID")
+	errQueryInvalid   = badRequest("query is too old and response timeout expired or query ID is invalid")
+	errFileID         = badRequest("wrong file identifier/HTTP URL specified")
+	errInvalidFileID  = badRequest("invalid file_id")
+	errWebhookActive  = &Error{
+		Code:        http.StatusConflict,
+		Description: "Conflict: can't use getUpdates method while webhook is active; use deleteWebhook to delete the webhook first",
+	}
+	errPollingConflict = &Error{
+		Code:        http.StatusConflict,
+		Description: "Conflict: terminated by other getUpdates request; make sure that only one bot instance is running",
+	}
+)
+
+func badRequest(description string) *Error {
+	return &Error{Code: http.StatusBadRequest, Description: "Bad Request: " + description}
+}
+
+// notImplemented returns the error of the Bot API method which the server doesn't implement.
+func notImplemented(name string) *Error {
+	return &Error{Code: http.StatusNotImplemented, Description: "Not Implemented: telegramtest doesn't implement " + name}
+}
+
+// botMethods are lower case names of Bot API methods called by lumex.Bot, like "sendpoll" for SendPollWithContext.
+var botMethods = func() map[string]bool {
+	methods := make(map[string]bool)
+	t := reflect.TypeOf(&lumex.Bot{})
+	for i := range t.NumMethod() {
+		if name, ok := strings.CutSuffix(t.Method(i).Name, "WithContext"); ok {
+			methods[strings.ToLower(name)] = true
+		}
+	}
+
+	return methods
+}()
+
+// tooManyRequests returns the flood limit error with the number of seconds to wait.
+func tooManyRequests(retryAfter time.Duration) *Error {
+	seconds := int64((retryAfter + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	return &Error{
+		Code:        http.StatusTooManyRequests,
+		Description: fmt.Sprintf("Too Many Requests: retry after %d", seconds),
+		Parameters:  &lumex.ResponseParameters{RetryAfter: seconds},
+	}
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	if filePath, ok := strings.CutPrefix(path, "file/bot"+s.token+"/"); ok {
+		s.serveFile(w, filePath)
+
+		return
+	}
+
+	token, name, ok := strings.Cut(strings.TrimPrefix(path, "bot"), "/")
+	if !ok || !strings.HasPrefix(path, "bot") {
+		writeResponse(w, nil, errNotFound)
+
+		return
+	}
+	if token != s.token {
+		writeResponse(w, nil, errUnauthorized)
+
+		return
+	}
+
+	handle, ok := s.methods[strings.ToLower(name)]
+	if !ok && botMethods[strings.ToLower(name)] {
+		writeResponse(w, nil, notImplemented(name))
+
+		return
+	}
+	if !ok {
+		writeResponse(w, nil, errNotFound)
+
+		return
+	}
+
+	req, err := newRequest(r)
+	if err != nil {
+		writeResponse(w, nil, badRequest(err.Error()))
+
+		return
+	}
+
+	result, err := handle(req)
+	writeResponse(w, result, err)
+}
+
+// writeResponse writes the result or the error in the format of the Bot API.
+func writeResponse(w http.ResponseWriter, result any, err error) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if err != nil {
+		apiErr, ok := err.(*Error)
+		if !ok {
+			apiErr = &Error{Code: http.StatusInternalServerError, Description: "Internal Server Error: " + err.Error()}
+		}
+
+		w.WriteHeader(apiErr.Code)
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"ok":          false,
+			"error_code":  apiErr.Code,
+			"description": apiErr.Description,
+			"parameters":  apiErr.Parameters,
+		})
+
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(map[string]any{"ok": true, "result": result})
+}
+
+func (s *Server) getMe(_ *request) (any, error) {
+	return s.user, nil
+}
@@ -0,0 +1,421 @@
+package telegramtest_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kbgod/lumex"
+	"github.com/kbgod/lumex/dispatcher"
+	"github.com/kbgod/lumex/router"
+	"github.com/kbgod/lumex/routertest"
+	"github.com/kbgod/lumex/telegramtest"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	user    = lumex.User{Id: 1001, FirstName: "Alice"}
+	private = lumex.Chat{Id: 1001, Type: lumex.ChatTypePrivate}
+	group   = lumex.Chat{Id: -100200, Type: lumex.ChatTypeSupergroup, Title: "Group"}
+)
+
+// newMenuRouter returns the router which replies to /start with the inline menu and edits the menu when it's pressed.
+func newMenuRouter(bot *lumex.Bot) *router.Router {
+	r := router.New(bot)
+
+	r.OnStart(func(ctx *router.Context) error {
+		return ctx.ReplyWithMenuVoid("Menu", lumex.NewInlineMenu().CallbackBtn("Settings", "settings"))
+	})
+	r.OnCallbackPrefix("settings", func(ctx *router.Context) error {
+		if err := ctx.EditMessageTextVoid("Settings"); err != nil {
+			return err
+		}
+
+		return ctx.AnswerVoid("opened")
+	})
+	r.OnChatMember(func(ctx *router.Context) error {
+		return nil
+	})
+
+	return r
+}
+
+func waitMessage(t *testing.T, s *telegramtest.Server, chatID, afterID int64) lumex.Message {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	m, err := s.WaitMessage(ctx, chatID, afterID)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	return m
+}
+
+func telegramError(t *testing.T, err error) *lumex.TelegramError {
+	t.Helper()
+
+	var tgErr *lumex.TelegramError
+	if !assert.ErrorAs(t, err, &tgErr) {
+		t.FailNow()
+	}
+
+	return tgErr
+}
+
+func TestServer_polling(t *testing.T) {
+	s := telegramtest.NewServer()
+	defer s.Close()
+
+	bot, err := s.NewBot()
+	assert.NoError(t, err)
+	assert.Equal(t, "test_bot", bot.User.Username)
+
+	d := dispatcher.New(bot, newMenuRouter(bot))
+	assert.NoError(t, d.StartPolling(1, &lumex.GetUpdatesChanOpts{
+		GetUpdatesOpts: &lumex.GetUpdatesOpts{Timeout: 1, RequestOpts: &lumex.RequestOpts{Timeout: 5 * time.Second}},
+	}))
+	defer func() {
+		assert.NoError(t, d.Stop(context.Background()))
+	}()
+
+	start := s.SendMessage(user, private, "/start")
+	menu := waitMessage(t, s, private.Id, start.MessageId)
+	assert.Equal(t, "Menu", menu.Text)
+	assert.Equal(t, s.User().Id, menu.From.Id)
+
+	// allowed updates are derived from routes of the router
+	info, err := bot.GetWebhookInfo(nil)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		lumex.UpdateTypeMessage, lumex.UpdateTypeCallbackQuery, lumex.UpdateTypeChatMember,
+	}, info.AllowedUpdates)
+
+	queryID, err := s.PressButton(user, private.Id, menu.MessageId, "Settings")
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		_, answered := s.CallbackAnswer(queryID)
+
+		return answered
+	}, 5*time.Second, 10*time.Millisecond)
+
+	answer, _ := s.CallbackAnswer(queryID)
+	assert.Equal(t, telegramtest.CallbackAnswer{Text: "opened"}, answer)
+
+	messages := s.Messages(private.Id)
+	assert.Len(t, messages, 2)
+	assert.Equal(t, "Settings", messages[1].Text)
+	assert.NotZero(t, messages[1].EditDate)
+
+	_, err = s.PressButton(user, private.Id, menu.MessageId, "Missing")
+	assert.Error(t, err)
+}
+
+func TestServer_getUpdates(t *testing.T) {
+	t.Run("allowed updates", func(t *testing.T) {
+		s := telegramtest.NewServer()
+		defer s.Close()
+
+		bot, err := s.NewBot()
+		assert.NoError(t, err)
+
+		s.SendUpdate(*routertest.Joined(group, &user))
+		message := s.SendMessage(user, private, "hello")
+
+		updates, err := bot.GetUpdates(nil)
+		assert.NoError(t, err)
+		if assert.Len(t, updates, 1) {
+			assert.Equal(t, message.MessageId, updates[0].Message.MessageId)
+		}
+
+		s.SendUpdate(*routertest.Joined(group, &user))
+		updates, err = bot.GetUpdates(&lumex.GetUpdatesOpts{
+			Offset:         updates[0].UpdateId + 1,
+			AllowedUpdates: []string{lumex.UpdateTypeChatMember},
+		})
+		assert.NoError(t, err)
+		assert.Len(t, updates, 1)
+		assert.Len(t, s.PendingUpdates(), 1)
+	})
+
+	t.Run("webhook is active", func(t *testing.T) {
+		s := telegramtest.NewServer()
+		defer s.Close()
+
+		bot, err := s.NewBot()
+		assert.NoError(t, err)
+
+		_, err = bot.SetWebhook("https://example.com/bot", nil)
+		assert.NoError(t, err)
+
+		_, err = bot.GetUpdates(nil)
+		assert.Equal(t, http.StatusConflict, telegramError(t, err).Code)
+
+		_, err = bot.DeleteWebhook(nil)
+		assert.NoError(t, err)
+
+		_, err = bot.GetUpdates(nil)
+		assert.NoError(t, err)
+	})
+
+	t.Run("terminated by other request", func(t *testing.T) {
+		s := telegramtest.NewServer()
+		defer s.Close()
+
+		bot, err := s.NewBot()
+		assert.NoError(t, err)
+
+		errs := make(chan error, 1)
+		go func() {
+			_, err := bot.GetUpdates(&lumex.GetUpdatesOpts{Timeout: 5, RequestOpts: &lumex.RequestOpts{Timeout: 10 * time.Second}})
+			errs <- err
+		}()
+
+		// the second request terminates the first one, which may not have started yet
+		var first error
+		assert.Eventually(t, func() bool {
+			_, err := bot.GetUpdates(nil)
+			assert.NoError(t, err)
+
+			select {
+			case first = <-errs:
+				return true
+			default:
+				return false
+			}
+		}, 5*time.Second, 10*time.Millisecond)
+		assert.Equal(t, http.StatusConflict, telegramError(t, first).Code)
+	})
+}
+
+func TestServer_errors(t *testing.T) {
+	s := telegramtest.NewServer()
+	defer s.Close()
+
+	bot, err := s.NewBot()
+	assert.NoError(t, err)
+
+	t.Run("unauthorized", func(t *testing.T) {
+		_, err := lumex.NewBot("1:wrong", &lumex.BotOpts{BotClient: s.Client()})
+		assert.Equal(t, http.StatusUnauthorized, telegramError(t, err).Code)
+	})
+
+	t.Run("unknown method", func(t *testing.T) {
+		_, err := bot.Request("sendTelepathy", nil, nil)
+		assert.Equal(t, http.StatusNotFound, telegramError(t, err).Code)
+	})
+
+	t.Run("not implemented method", func(t *testing.T) {
+		_, err := bot.SendVenue(private.Id, 1, 2, "Venue", "Address", nil)
+		tgErr := telegramError(t, err)
+		assert.Equal(t, http.StatusNotImplemented, tgErr.Code)
+		assert.Contains(t, tgErr.Description, "sendVenue")
+	})
+
+	t.Run("chat not found", func(t *testing.T) {
+		_, err := bot.SendMessage(404, "hello", nil)
+		tgErr := telegramError(t, err)
+		assert.Equal(t, http.StatusBadRequest, tgErr.Code)
+		assert.Equal(t, "Bad Request: chat not found", tgErr.Description)
+	})
+
+	t.Run("empty text", func(t *testing.T) {
+		s.AddChat(private)
+
+		_, err := bot.SendMessage(private.Id, "", nil)
+		assert.Equal(t, "Bad Request: message text is empty", telegramError(t, err).Description)
+	})
+
+	t.Run("blocked", func(t *testing.T) {
+		s.AddChat(private)
+		s.BlockBot(user.Id)
+
+		_, err := bot.SendMessage(private.Id, "hello", nil)
+		assert.Equal(t, http.StatusForbidden, telegramError(t, err).Code)
+
+		s.SendMessage(user, private, "I'm back")
+		_, err = bot.SendMessage(private.Id, "hello", nil)
+		assert.NoError(t, err)
+	})
+
+	t.Run("message is not modified", func(t *testing.T) {
+		m, err := bot.SendMessage(private.Id, "text", nil)
+		assert.NoError(t, err)
+
+		_, _, err = bot.EditMessageText("text", &lumex.EditMessageTextOpts{ChatId: private.Id, MessageId: m.MessageId})
+		assert.True(t, strings.HasPrefix(telegramError(t, err).Description, "Bad Request: message is not modified"))
+
+		_, _, err = bot.EditMessageText("new", &lumex.EditMessageTextOpts{ChatId: private.Id, MessageId: m.MessageId + 100})
+		assert.Equal(t, "Bad Request: message to edit not found", telegramError(t, err).Description)
+	})
+}
+
+func TestServer_floodLimits(t *testing.T) {
+	s := telegramtest.NewServer(telegramtest.WithFloodLimits(
+		telegramtest.Limit{Messages: 3, Interval: time.Minute},
+		telegramtest.Limit{Messages: 2, Interval: time.Minute},
+	))
+	defer s.Close()
+	s.AddChat(private)
+	s.AddChat(group)
+
+	bot, err := s.NewBot()
+	assert.NoError(t, err)
+
+	for range 2 {
+		_, err := bot.SendMessage(group.Id, "hello", nil)
+		assert.NoError(t, err)
+	}
+
+	_, err = bot.SendMessage(group.Id, "hello", nil)
+	tgErr := telegramError(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, tgErr.Code)
+	if assert.NotNil(t, tgErr.ResponseParams) {
+		assert.Positive(t, tgErr.ResponseParams.RetryAfter)
+	}
+
+	_, err = bot.SendMessage(private.Id, "hello", nil)
+	assert.NoError(t, err)
+
+	_, err = bot.SendMessage(private.Id, "hello", nil)
+	assert.Equal(t, http.StatusTooManyRequests, telegramError(t, err).Code)
+}
+
+func TestServer_files(t *testing.T) {
+	s := telegramtest.NewServer()
+	defer s.Close()
+
+	bot, err := s.NewBot()
+	assert.NoError(t, err)
+
+	download := func(fileID string) string {
+		f, err := bot.GetFile(fileID, nil)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+
+		resp, err := http.Get(s.Client().FileURL(s.Token(), f.FilePath, nil))
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		defer resp.Body.Close()
+
+		data, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+
+		return string(data)
+	}
+
+	received := s.SendDocument(user, private, "report.txt", []byte("report"))
+	assert.Equal(t, "report", download(received.Document.FileId))
+
+	sent, err := bot.SendDocument(private.Id, lumex.InputFileByReader("notes.txt", strings.NewReader("notes")), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "notes.txt", sent.Document.FileName)
+	assert.Equal(t, "notes", download(sent.Document.FileId))
+
+	// files are resent by identifiers
+	resent, err := bot.SendDocument(private.Id, lumex.InputFileByID(sent.Document.FileId), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, sent.Document.FileId, resent.Document.FileId)
+
+	_, err = bot.GetFile("unknown", nil)
+	assert.Equal(t, http.StatusBadRequest, telegramError(t, err).Code)
+
+	_, err = bot.SendDocument(private.Id, lumex.InputFileByID("unknown"), nil)
+	assert.True(t, errors.As(err, new(*lumex.TelegramError)))
+}
+
+func TestServer_sendMethods(t *testing.T) {
+	s := telegramtest.NewServer()
+	defer s.Close()
+	s.AddChat(private)
+
+	bot, err := s.NewBot()
+	assert.NoError(t, err)
+
+	t.Run("media group", func(t *testing.T) {
+		album, err := bot.SendMediaGroup(private.Id, []lumex.InputMedia{
+			lumex.InputMediaPhoto{Media: lumex.InputFileByReader("first.jpg", strings.NewReader("first")), Caption: "album"},
+			lumex.InputMediaDocument{Media: lumex.InputFileByURL("https://example.com/second.pdf")},
+		}, nil)
+		assert.NoError(t, err)
+		if assert.Len(t, album, 2) {
+			assert.Equal(t, "album", album[0].Caption)
+			assert.Len(t, album[0].Photo, 1)
+			assert.NotNil(t, album[1].Document)
+			assert.NotEmpty(t, album[0].MediaGroupId)
+			assert.Equal(t, album[0].MediaGroupId, album[1].MediaGroupId)
+		}
+
+		_, err = bot.SendMediaGroup(private.Id, []lumex.InputMedia{
+			lumex.InputMediaPhoto{Media: lumex.InputFileByID("unknown")},
+			lumex.InputMediaPhoto{Media: lumex.InputFileByID("unknown")},
+		}, nil)
+		assert.Equal(t, http.StatusBadRequest, telegramError(t, err).Code)
+	})
+
+	t.Run("location, contact and dice", func(t *testing.T) {
+		location, err := bot.SendLocation(private.Id, 50.45, 30.52, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, &lumex.Location{Latitude: 50.45, Longitude: 30.52}, location.Location)
+
+		contact, err := bot.SendContact(private.Id, "+380000000000", "Bob", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, &lumex.Contact{PhoneNumber: "+380000000000", FirstName: "Bob"}, contact.Contact)
+
+		dice, err := bot.SendDice(private.Id, &lumex.SendDiceOpts{Emoji: "🏀"})
+		assert.NoError(t, err)
+		assert.Equal(t, "🏀", dice.Dice.Emoji)
+		assert.True(t, dice.Dice.Value >= 1 && dice.Dice.Value <= 5)
+	})
+
+	t.Run("poll", func(t *testing.T) {
+		poll, err := bot.SendPoll(private.Id, "Tea or coffee?", []lumex.InputPollOption{{Text: "Tea"}, {Text: "Coffee"}}, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "Tea or coffee?", poll.Poll.Question)
+		assert.Equal(t, []lumex.PollOption{{Text: "Tea"}, {Text: "Coffee"}}, poll.Poll.Options)
+		assert.True(t, poll.Poll.IsAnonymous)
+		assert.Equal(t, "regular", poll.Poll.Type)
+
+		_, err = bot.SendPoll(private.Id, "Tea?", []lumex.InputPollOption{{Text: "Tea"}}, nil)
+		assert.Equal(t, http.StatusBadRequest, telegramError(t, err).Code)
+	})
+
+	t.Run("edit media", func(t *testing.T) {
+		photo, err := bot.SendPhoto(private.Id, lumex.InputFileByReader("photo.jpg", strings.NewReader("photo")), nil)
+		assert.NoError(t, err)
+
+		edited, _, err := bot.EditMessageMedia(lumex.InputMediaVideo{
+			Media:   lumex.InputFileByReader("video.mp4", strings.NewReader("video")),
+			Caption: "video",
+		}, &lumex.EditMessageMediaOpts{ChatId: private.Id, MessageId: photo.MessageId})
+		assert.NoError(t, err)
+		assert.Equal(t, photo.MessageId, edited.MessageId)
+		assert.Empty(t, edited.Photo)
+		assert.NotNil(t, edited.Video)
+		assert.Equal(t, "video", edited.Caption)
+		assert.NotZero(t, edited.EditDate)
+
+		text, err := bot.SendMessage(private.Id, "text", nil)
+		assert.NoError(t, err)
+
+		_, _, err = bot.EditMessageMedia(lumex.InputMediaPhoto{Media: lumex.InputFileByID(photo.Photo[0].FileId)},
+			&lumex.EditMessageMediaOpts{ChatId: private.Id, MessageId: text.MessageId})
+		assert.Equal(t, "Bad Request: there is no media in the message to edit", telegramError(t, err).Description)
+	})
+}
+
+func TestCommandEntities(t *testing.T) {
+	assert.Nil(t, telegramtest.CommandEntities("hello"))
+	assert.Nil(t, telegramtest.CommandEntities("/"))
+	assert.Equal(t, []lumex.MessageEntity{{Type: "bot_command", Length: 6}}, telegramtest.CommandEntities("/start"))
+	// the length is counted in UTF-16 code units like Telegram counts it
+	assert.Equal(t, []lumex.MessageEntity{{Type: "bot_command", Length: 7}}, telegramtest.CommandEntities("/😀café\nhi"))
+}
@@ -0,0 +1,263 @@
+package telegramtest
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/kbgod/lumex"
+)
+
+// notDefaultUpdateTypes are types of updates Telegram doesn't send unless they are allowed explicitly.
+var notDefaultUpdateTypes = []string{
+	lumex.UpdateTypeChatMember,
+	lumex.UpdateTypeMessageReaction,
+	lumex.UpdateTypeMessageReactionCount,
+}
+
+// updates is the queue of updates of the bot.
+type updates struct {
+	updateID int64
+	pending  []lumex.Update
+	// allowedUpdates are set by getUpdates and setWebhook, nil and empty mean the default types.
+	allowedUpdates []string
+	webhookURL     string
+	// poll is the number of the last getUpdates request, earlier requests which still wait are terminated.
+	poll int64
+}
+
+// allowed reports whether updates of the type are sent to the bot.
+func (u *updates) allowed(updateType string) bool {
+	if len(u.allowedUpdates) == 0 {
+		return !slices.Contains(notDefaultUpdateTypes, updateType)
+	}
+
+	return slices.Contains(u.allowedUpdates, updateType)
+}
+
+// addUpdate queues the update with a new identifier. It must be called with s.mu locked.
+func (s *Server) addUpdate(update lumex.Update) int64 {
+	s.updateID++
+	update.UpdateId = s.updateID
+	s.pending = append(s.pending, update)
+	s.notify()
+
+	return update.UpdateId
+}
+
+// SendUpdate
+//
+// queues the update for the bot and returns its identifier, update_id of the update is replaced.
+// Updates of types which are not allowed by the bot are dropped when the bot gets updates.
+func (s *Server) SendUpdate(update lumex.Update) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addUpdate(update)
+}
+
+// SendMessage
+//
+// sends the text message of the user to the chat, so the bot gets it with the next update.
+// Commands at the start of the text get the bot_command entity. The chat is created if it doesn't exist,
+// a user who blocked the bot unblocks it by sending a message to the private chat.
+func (s *Server) SendMessage(from lumex.User, chat lumex.Chat, text string) lumex.Message {
+	return s.send(from, chat, lumex.Message{Text: text, Entities: CommandEntities(text)})
+}
+
+// SendDocument sends the file of the user to the chat, the bot can download it with getFile.
+func (s *Server) SendDocument(from lumex.User, chat lumex.Chat, name string, data []byte) lumex.Message {
+	s.mu.Lock()
+	f := s.addFile("documents", name, data)
+	s.mu.Unlock()
+
+	return s.send(from, chat, lumex.Message{Document: &lumex.Document{
+		FileId:       f.id,
+		FileUniqueId: f.uniqueID,
+		FileName:     name,
+		FileSize:     int64(len(data)),
+	}})
+}
+
+// send adds the message of the user to the chat and queues the update with it.
+func (s *Server) send(from lumex.User, chat lumex.Chat, message lumex.Message) lumex.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.addChat(chat)
+	if c.chat.Type == lumex.ChatTypePrivate {
+		delete(s.blocked, from.Id)
+	}
+
+	message.From = &from
+	m := c.add(message)
+	s.addUpdate(lumex.Update{Message: cloneMessage(m)})
+
+	return *cloneMessage(m)
+}
+
+// PressButton
+//
+// presses the inline button with the text under the message of the bot, so the bot gets the callback query.
+// It returns the identifier of the callback query to check the answer with CallbackAnswer.
+func (s *Server) PressButton(from lumex.User, chatID, messageID int64, text string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.chats[chatID]
+	if !ok {
+		return "", fmt.Errorf("telegramtest: chat %d not found", chatID)
+	}
+	m, ok := c.message(messageID)
+	if !ok {
+		return "", fmt.Errorf("telegramtest: message %d not found in chat %d", messageID, chatID)
+	}
+
+	if m.ReplyMarkup != nil {
+		for _, row := range m.ReplyMarkup.InlineKeyboard {
+			for _, button := range row {
+				if button.Text == text && button.CallbackData != "" {
+					return s.addCallbackQuery(from, m, button.CallbackData), nil
+				}
+			}
+		}
+	}
+
+	return "", fmt.Errorf("telegramtest: message %d in chat %d has no callback button %q", messageID, chatID, text)
+}
+
+// BlockBot blocks the bot by the user, so messages to the private chat with the user fail with 403 Forbidden.
+func (s *Server) BlockBot(userID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.blocked[userID] = true
+}
+
+// PendingUpdates returns updates which the bot didn't get yet.
+func (s *Server) PendingUpdates() []lumex.Update {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.pending)
+}
+
+// takeUpdates drops updates confirmed by the offset and updates which are not allowed,
+// and returns up to limit updates. It must be called with s.mu locked.
+func (s *Server) takeUpdates(offset, limit int64) []lumex.Update {
+	s.pending = slices.DeleteFunc(s.pending, func(update lumex.Update) bool {
+		return update.UpdateId < offset || !s.updates.allowed(update.GetType())
+	})
+
+	return slices.Clone(s.pending[:min(int64(len(s.pending)), limit)])
+}
+
+func (s *Server) getUpdates(req *request) (any, error) {
+	offset, err := req.intParam("offset")
+	if err != nil {
+		return nil, err
+	}
+	limit, err := req.intParam("limit")
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > 100 {
+		limit = 100
+	}
+	timeout, err := req.intParam("timeout")
+	if err != nil {
+		return nil, err
+	}
+	var allowed []string
+	setAllowed, err := req.jsonParam("allowed_updates", &allowed)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	if s.webhookURL != "" {
+		s.mu.Unlock()
+
+		return nil, errWebhookActive
+	}
+	if setAllowed {
+		s.allowedUpdates = allowed
+	}
+	s.updates.poll++
+	poll := s.updates.poll
+	s.notify()
+	s.mu.Unlock()
+
+	wait := time.NewTimer(time.Duration(timeout) * time.Second)
+	defer wait.Stop()
+
+	for {
+		s.mu.Lock()
+		if s.updates.poll != poll {
+			s.mu.Unlock()
+
+			return nil, errPollingConflict
+		}
+		result := s.takeUpdates(offset, limit)
+		changed := s.changed
+		s.mu.Unlock()
+
+		if len(result) > 0 || timeout <= 0 {
+			return result, nil
+		}
+
+		select {
+		case <-changed:
+		case <-wait.C:
+			return result, nil
+		case <-req.ctx.Done():
+			return nil, context.Cause(req.ctx)
+		}
+	}
+}
+
+func (s *Server) setWebhook(req *request) (any, error) {
+	var allowed []string
+	setAllowed, err := req.jsonParam("allowed_updates", &allowed)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.webhookURL = req.param("url")
+	if setAllowed {
+		s.allowedUpdates = allowed
+	}
+	if req.boolParam("drop_pending_updates") {
+		s.pending = nil
+	}
+	s.notify()
+
+	return true, nil
+}
+
+func (s *Server) deleteWebhook(req *request) (any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.webhookURL = ""
+	if req.boolParam("drop_pending_updates") {
+		s.pending = nil
+	}
+
+	return true, nil
+}
+
+func (s *Server) getWebhookInfo(_ *request) (any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return lumex.WebhookInfo{
+		Url:                s.webhookURL,
+		PendingUpdateCount: int64(len(s.pending)),
+		AllowedUpdates:     s.allowedUpdates,
+	}, nil
+}